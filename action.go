@@ -8,11 +8,14 @@ package task
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 )
 
 // Action is a unit of work that gets run.
@@ -32,7 +35,7 @@ func (f ActionFunc) Run(ctx context.Context, st *State, sc Script) error {
 type Script interface {
 	Add(a ...Action)                                          // Add normal actions to the script.
 	Rollback(a ...Action)                                     // Add actions to only  be run on rollback.
-	Defer(a ...Action)                                        // Add actions to be run at the end, both on error and on normal run.
+	Defer(a ...Action)                                        // Add actions to be run once at the end, both on error and on normal run.
 	RunAction(ctx context.Context, st *State, a Action) error // Run a single action on the script.
 	Run(ctx context.Context, st *State, parent Script) error  // Run current script under givent state.
 }
@@ -41,14 +44,41 @@ type Script interface {
 // for ScriptAdd and Run.
 func Run(ctx context.Context, st *State, a Action) error {
 	sc := NewScript(a)
-	return sc.Run(ctx, st, nil)
+	return st.redactError(sc.Run(ctx, st, nil))
 }
 
+// script is the list of actions of a Script. Running it runs a copy, so
+// the cursor and any actions added during the run belong to that run, and
+// the same Script may be run repeatedly and concurrently.
 type script struct {
 	at   int
 	list []Action
 
-	rollback *script
+	rollback   *script
+	deferred   []Action
+	savepoints map[string]int
+	checkpoint string // File to save progress to, see ResumeScript.
+	middleware []func(Action) Action
+}
+
+// newRun returns a copy of the script to run, starting at the first action.
+func (sc *script) newRun() *script {
+	r := &script{
+		list:       append([]Action(nil), sc.list...),
+		deferred:   append([]Action(nil), sc.deferred...),
+		checkpoint: sc.checkpoint,
+		middleware: append([]func(Action) Action(nil), sc.middleware...),
+	}
+	if sc.rollback != nil {
+		r.rollback = &script{list: append([]Action(nil), sc.rollback.list...)}
+	}
+	for name, n := range sc.savepoints {
+		if r.savepoints == nil {
+			r.savepoints = make(map[string]int, len(sc.savepoints))
+		}
+		r.savepoints[name] = n
+	}
+	return r
 }
 
 // NewScript creates a script and appends the given actions to it.
@@ -71,14 +101,78 @@ func (sc *script) Rollback(a ...Action) {
 	sc.rollback.Add(a...)
 }
 
-// Defer executes the given actions both in the event of a rollback or
-// for normal execution.
+// Defer adds actions to run once when the script ends, whether it
+// succeeds or fails, after any rollback actions. Deferred actions run in
+// the reverse order they are added, like a Go defer.
 func (sc *script) Defer(a ...Action) {
-	if sc.rollback == nil {
-		sc.rollback = &script{}
+	sc.deferred = append(sc.deferred, a...)
+}
+
+// Use adds middleware to the current script that wraps each action the
+// script runs after Use, including rollback and deferred actions, for
+// concerns such as timing, logging, or retries. The first middleware added
+// is the outermost. Actions of a nested Script are run by that script, so
+// only the nested Script as a whole is wrapped.
+func Use(mw ...func(Action) Action) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		s, ok := sc.(*script)
+		if !ok {
+			return fmt.Errorf("use: unsupported script type %T", sc)
+		}
+		s.middleware = append(s.middleware, mw...)
+		return nil
+	})
+}
+
+// savepoint records the rollback actions added so far under name. After
+// RollbackTo(name) runs, a failure only runs the rollback actions added
+// after the savepoint. Setting a savepoint again moves it.
+func (sc *script) savepoint(name string) {
+	if sc.savepoints == nil {
+		sc.savepoints = make(map[string]int)
 	}
-	sc.rollback.Add(a...)
-	sc.Add(a...)
+	n := 0
+	if sc.rollback != nil {
+		n = len(sc.rollback.list)
+	}
+	sc.savepoints[name] = n
+}
+
+// Savepoint marks the rollback actions added so far to the current script
+// under name. Setting a savepoint again moves it. See RollbackTo.
+func Savepoint(name string) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		s, ok := sc.(*script)
+		if !ok {
+			return fmt.Errorf("savepoint %q: unsupported script type %T", name, sc)
+		}
+		s.savepoint(name)
+		return nil
+	})
+}
+
+// RollbackTo limits the rollback of the current script to the savepoint
+// name: if a later action fails, only the rollback actions added after the
+// savepoint are run, and the ones added before it are kept. The savepoint
+// must be set in the same script.
+func RollbackTo(name string) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		s, ok := sc.(*script)
+		if !ok {
+			return fmt.Errorf("rollback to %q: unsupported script type %T", name, sc)
+		}
+		n, ok := s.savepoints[name]
+		if !ok {
+			return fmt.Errorf("rollback to %q: unknown savepoint", name)
+		}
+		if s.rollback == nil {
+			s.rollback = &script{}
+		}
+		if s.rollback.at < n {
+			s.rollback.at = n
+		}
+		return nil
+	})
 }
 
 // Rollback adds actions to the current rollback script.
@@ -89,7 +183,9 @@ func Rollback(a ...Action) Action {
 	})
 }
 
-// Defer actions to the current end of the script. Always execute on error or success.
+// Defer actions to run once when the current script ends, on error or
+// success, after any rollback actions. Deferred actions run in the reverse
+// order they are added.
 func Defer(a ...Action) Action {
 	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
 		sc.Defer(a...)
@@ -121,12 +217,19 @@ type Policy byte
 // any error will be logged to the ErrorLogger. If SkipRollback is selected
 // then a failure will not trigger the rollback actions. If both Continue
 // and SkipRollbackk are selected, execution will continue and SkipRollback
-// will be ignored.
+// will be ignored. If SkipRollbackOnCancel is selected then a failure
+// caused by canceling the context, such as on an interrupt, will not
+// trigger the rollback actions, other failures still will. If
+// PropagateRollback is selected then the rollback actions of a nested
+// script that succeeds are added to the rollback actions of its parent
+// script, so they run if the parent fails later.
 const (
 	PolicyFail     Policy = 0
 	PolicyContinue Policy = 1 << iota
 	PolicyLog
 	PolicySkipRollback
+	PolicySkipRollbackOnCancel
+	PolicyPropagateRollback
 
 	// Fail
 	// Fail + Log
@@ -146,11 +249,42 @@ type State struct {
 	Stderr io.Writer
 	Branch Branch
 	Policy Policy
+	Level  Level // Minimum level of messages to log, defaults to LevelInfo.
+	Color  bool  // Output may be colored, see ColorEnabled and Colorize.
 
 	ErrorLogger func(err error)  // Logger to use when Error is called.
 	MsgLogger   func(msg string) // Logger to use when Log or Logf is called.
 
+	ProgressRenderer ProgressRenderer // Displays progress from StartProgress, none if nil.
+	FS               FS               // File system of the file actions, the OS if nil.
+	Clock            Clock            // Clock of the run, the system clock if nil.
+	Events           Events           // Receives the events of the run, if set.
+
+	// RollbackTimeout limits the time rollback actions may run, if not zero.
+	// Rollback actions are not canceled with the context of the run, so
+	// they may run after an interrupt. RollbackActionTimeout limits the
+	// time of each rollback action. If RollbackContext is set, rollback
+	// actions run with it instead, so a caller may cancel them, such as on
+	// a second interrupt.
+	RollbackTimeout       time.Duration
+	RollbackActionTimeout time.Duration
+	RollbackContext       context.Context
+
 	bucket map[string]interface{}
+
+	names      []string // Names of the running Named actions.
+	failErr    error
+	failAction string
+	secrets    *secrets
+	results    *results
+	eventFuncs []func(e Event)
+	eventErr   error // Last error emitted.
+	audit      *audit
+	rand       *runRand
+	changes    *changes
+	resources  []func() error // Released when the script that tracked them ends.
+	elevated   bool           // Exec runs commands elevated.
+	continued  Errors         // Errors ignored under PolicyContinue.
 }
 
 // Values of the state.
@@ -175,9 +309,11 @@ func Environ() map[string]string {
 // DefaultState creates a new states with the current OS env.
 func DefaultState() *State {
 	wd, _ := os.Getwd()
+	env := Environ()
 	return &State{
-		Env:    Environ(),
+		Env:    env,
 		Dir:    wd,
+		Color:  ColorEnabled(os.Stdout, env),
 		Stdout: os.Stdout,
 		Stderr: os.Stderr,
 		ErrorLogger: func(err error) {
@@ -189,12 +325,9 @@ func DefaultState() *State {
 	}
 }
 
-// Log a message to the MsgLogger if present.
+// Log a message to the MsgLogger if present, at LevelInfo.
 func (st *State) Log(msg string) {
-	if st.MsgLogger == nil {
-		return
-	}
-	st.MsgLogger(msg)
+	st.LogLevel(LevelInfo, msg)
 }
 
 // Logf logs a formatted message to the MsgLogger if present.
@@ -207,7 +340,14 @@ func (st *State) Error(err error) {
 	if st.ErrorLogger == nil {
 		return
 	}
-	st.ErrorLogger(err)
+	st.ErrorLogger(st.redactError(err))
+}
+
+// Failure returns the name of the innermost Named action running when the
+// run failed and the first error that failed it. Actions run by Defer or
+// as rollback actions may use it to report the outcome.
+func (st *State) Failure() (action string, err error) {
+	return st.failAction, st.failErr
 }
 
 // Filepath returns filename if absolute, or State.Dir + filename if not.
@@ -224,12 +364,81 @@ func (st *State) init() {
 	}
 }
 
+// copy returns a State with its own Env, bucket, and tracked resources, so
+// it may be used concurrently with st. Values in the bucket are not copied.
+func (st *State) copy() *State {
+	c := *st
+	c.resources = nil
+	// Clone the slices, so appends by concurrent copies do not share a
+	// backing array.
+	c.names = append([]string(nil), st.names...)
+	c.continued = append(Errors(nil), st.continued...)
+	if st.Env != nil {
+		c.Env = make(map[string]string, len(st.Env))
+		for k, v := range st.Env {
+			c.Env[k] = v
+		}
+	}
+	if st.bucket != nil {
+		c.bucket = make(map[string]interface{}, len(st.bucket))
+		for k, v := range st.bucket {
+			c.bucket[k] = v
+		}
+	}
+	return &c
+}
+
+type stateKey struct{}
+
+// WithState returns a context carrying st, so functions that are not
+// actions, such as callbacks, may reach the State with FromContext.
+func WithState(ctx context.Context, st *State) context.Context {
+	return context.WithValue(ctx, stateKey{}, st)
+}
+
+// FromContext returns the State stored in ctx by WithState, or nil.
+func FromContext(ctx context.Context) *State {
+	st, _ := ctx.Value(stateKey{}).(*State)
+	return st
+}
+
 // Get the variable called name from the state bucket.
 func (st *State) Get(name string) interface{} {
 	st.init()
 	return st.bucket[name]
 }
 
+// VarError is returned when a required State variable is not set.
+type VarError struct {
+	Name  string
+	Known []string // Names of the variables that are set, sorted.
+}
+
+func (err *VarError) Error() string {
+	if len(err.Known) == 0 {
+		return fmt.Sprintf("variable %q not set; no variables are set", err.Name)
+	}
+	return fmt.Sprintf("variable %q not set; known variables: %s", err.Name, strings.Join(err.Known, ", "))
+}
+
+// MustGet gets the variable called name from the state bucket. If it is
+// not set, or is nil, a *VarError listing the known variables is returned.
+func (st *State) MustGet(name string) (any, error) {
+	st.init()
+	if v := st.bucket[name]; v != nil {
+		return v, nil
+	}
+	known := make([]string, 0, len(st.bucket))
+	for k, v := range st.bucket {
+		// Skip internal variables.
+		if v != nil && !strings.HasPrefix(k, "__") {
+			known = append(known, k)
+		}
+	}
+	sort.Strings(known)
+	return nil, &VarError{Name: name, Known: known}
+}
+
 // Default gets the variable called name from the state bucket. If
 // no value is present, return v.
 func (st *State) Default(name string, v interface{}) interface{} {
@@ -243,12 +452,20 @@ func (st *State) Default(name string, v interface{}) interface{} {
 // Set the variable v to the name.
 func (st *State) Set(name string, v interface{}) {
 	st.init()
+	if st.changes != nil {
+		old, had := st.bucket[name]
+		st.track(ChangeSet, name, old, had, v)
+	}
 	st.bucket[name] = v
 }
 
 // Delete the variable called name.
 func (st *State) Delete(name string) {
 	st.init()
+	if st.changes != nil {
+		old, had := st.bucket[name]
+		st.track(ChangeDelete, name, old, had, nil)
+	}
 	delete(st.bucket, name)
 }
 
@@ -262,7 +479,41 @@ func (sc *script) RunAction(ctx context.Context, st *State, a Action) error {
 	case <-ctx.Done():
 		return ctx.Err()
 	}
-	err := a.Run(ctx, st, sc)
+	na, named := a.(*namedAction)
+	var start time.Time
+	if named {
+		st.names = append(st.names, na.name)
+		start = st.Now()
+		st.emit(Event{Type: EventStart})
+	}
+	run := a
+	for i := len(sc.middleware) - 1; i >= 0; i-- {
+		run = sc.middleware[i](run)
+	}
+	err := run.Run(ctx, st, sc)
+	if err != nil && st.emitting() && !errors.Is(err, st.eventErr) {
+		// Report an error once, not again as it is returned by each
+		// enclosing action.
+		st.eventErr = err
+		st.emit(Event{Type: EventError, Err: err.Error()})
+	}
+	if named {
+		d := st.Since(start)
+		if st.results != nil {
+			path := append([]string(nil), st.names...)
+			st.results.add(result{Path: path, Start: start, Duration: d, Err: err})
+		}
+		if st.emitting() {
+			e := Event{Type: EventFinish, Duration: d}
+			if err != nil {
+				e.Err = err.Error()
+			}
+			st.emit(e)
+		}
+		defer func() {
+			st.names = st.names[:len(st.names)-1]
+		}()
+	}
 	if err == nil {
 		return nil
 	}
@@ -270,19 +521,170 @@ func (sc *script) RunAction(ctx context.Context, st *State, a Action) error {
 		st.Error(err)
 	}
 	if st.Policy&PolicyContinue != 0 {
+		st.continued = append(st.continued, sc.wrapError(st, err))
 		err = nil
 	}
-	if st.Policy&PolicySkipRollback != 0 {
-		return err
+	if err != nil && st.failErr == nil {
+		st.failErr = err
+		if len(st.names) > 0 {
+			st.failAction = st.names[len(st.names)-1]
+		}
 	}
 	if err == nil {
-		return err
+		return nil
 	}
-	rberr := sc.rollback.Run(context.Background(), st, sc)
-	if rberr == nil {
-		return err
+	terr := sc.wrapError(st, err)
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+		terr.Canceled = true
+	}
+	if st.Policy&PolicySkipRollback != 0 {
+		return terr
+	}
+	if terr.Canceled && st.Policy&PolicySkipRollbackOnCancel != 0 {
+		return terr
+	}
+	if sc.rollback != nil && sc.rollback.at < len(sc.rollback.list) {
+		terr.RolledBack = true
+		rctx := context.WithoutCancel(ctx)
+		if st.RollbackContext != nil {
+			rctx = st.RollbackContext
+		}
+		if st.RollbackTimeout > 0 {
+			var cancel context.CancelFunc
+			rctx, cancel = context.WithTimeout(rctx, st.RollbackTimeout)
+			defer cancel()
+		}
+		sc.rollback.middleware = sc.middleware
+		start := st.Now()
+		st.emit(Event{Type: EventRollbackStart})
+		report, rberr := sc.rollback.runRollback(rctx, st)
+		terr.Rollback = append(terr.Rollback, report...)
+		if rberr != nil {
+			terr.RollbackErr = errors.Join(terr.RollbackErr, rberr)
+		}
+		if st.emitting() {
+			e := Event{Type: EventRollback, Duration: st.Since(start)}
+			if rberr != nil {
+				e.Err = rberr.Error()
+			}
+			st.emit(e)
+		}
+	}
+	return terr
+}
+
+// wrapError returns err as an *Error of the running action.
+func (sc *script) wrapError(st *State, err error) *Error {
+	if terr, ok := err.(*Error); ok {
+		return terr
+	}
+	return &Error{
+		Path: append([]string(nil), st.names...),
+		Step: sc.at - 1,
+		Err:  err,
+	}
+}
+
+// Error is returned when an action run by a Script fails. Its message is
+// that of Err, followed by the rollback error if the rollback failed.
+type Error struct {
+	Path []string // Names of the Named actions running when it failed.
+	Step int      // Index of the failed action in its Script, -1 if not run as a step.
+	Err  error    // Error of the failed action.
+
+	Canceled    bool             // The failure was caused by canceling the context.
+	RolledBack  bool             // Rollback actions were run.
+	RollbackErr error            // Error of the rollback actions, nil if they succeeded.
+	Rollback    []RollbackAction // Rollback actions of each script rolled back, innermost first.
+
+	// Trail is the step run in each Script, from the outermost Script to
+	// the one that ran the failed action.
+	Trail []Frame
+}
+
+// Errors is a list of errors, such as the errors ignored under
+// PolicyContinue returned by State.Errors.
+type Errors []error
+
+func (errs Errors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
 	}
-	return fmt.Errorf("%v, rollback failed: %v", err, rberr)
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the errors.
+func (errs Errors) Unwrap() []error {
+	return errs
+}
+
+// Errors returns the errors of the actions that failed while PolicyContinue
+// was set, in the order they failed, or nil if none failed.
+func (st *State) Errors() Errors {
+	if len(st.continued) == 0 {
+		return nil
+	}
+	return append(Errors(nil), st.continued...)
+}
+
+// Frame is a step of a Script in the Trail of an Error.
+type Frame struct {
+	Step int    // Index of the action in its Script.
+	Name string // Name of the action if it is Named.
+}
+
+func (f Frame) String() string {
+	return fmt.Sprintf("%s[%d]", f.Name, f.Step)
+}
+
+// Breadcrumb returns the Trail of the error, such as
+// "[0] > deploy[2] > push[1]", with the name, if Named, and the index of
+// the step run in each Script.
+func (err *Error) Breadcrumb() string {
+	parts := make([]string, len(err.Trail))
+	for i, f := range err.Trail {
+		parts[i] = f.String()
+	}
+	return strings.Join(parts, " > ")
+}
+
+// Format formats the error like Error. The %+v verb prefixes the message
+// with the Breadcrumb.
+func (err *Error) Format(f fmt.State, verb rune) {
+	switch {
+	case verb == 'v' && f.Flag('+') && len(err.Trail) > 0:
+		fmt.Fprintf(f, "%s: %s", err.Breadcrumb(), err.Error())
+	case verb == 'q':
+		fmt.Fprintf(f, "%q", err.Error())
+	default:
+		io.WriteString(f, err.Error())
+	}
+}
+
+// RollbackAction reports a rollback action run after a failure. Actions
+// after a failed rollback action are not run.
+type RollbackAction struct {
+	Name     string // Name of a Named action, empty otherwise.
+	Step     int    // Index of the action in the rollback script.
+	Ran      bool
+	Err      error
+	Duration time.Duration
+}
+
+func (err *Error) Error() string {
+	if err.RollbackErr == nil {
+		return err.Err.Error()
+	}
+	return fmt.Sprintf("%v, rollback failed: %v", err.Err, err.RollbackErr)
+}
+
+// Unwrap returns Err and RollbackErr.
+func (err *Error) Unwrap() []error {
+	if err.RollbackErr == nil {
+		return []error{err.Err}
+	}
+	return []error{err.Err, err.RollbackErr}
 }
 
 func (sc *script) runNext(ctx context.Context, st *State) error {
@@ -294,18 +696,107 @@ func (sc *script) runNext(ctx context.Context, st *State) error {
 	return sc.RunAction(ctx, st, a)
 }
 
-// Run the items in the method script. The parent script is ignored.
+// runRollback runs the remaining rollback actions, each limited by
+// State.RollbackActionTimeout, and reports each action.
+func (sc *script) runRollback(ctx context.Context, st *State) ([]RollbackAction, error) {
+	var report []RollbackAction
+	var err error
+	// Rollback actions may add more rollback actions.
+	for sc.at < len(sc.list) {
+		a := sc.list[sc.at]
+		sc.at++
+		ra := RollbackAction{Step: sc.at - 1}
+		if na, ok := a.(*namedAction); ok {
+			ra.Name = na.name
+		}
+		if err == nil {
+			ra.Ran = true
+			actx, cancel := ctx, context.CancelFunc(func() {})
+			if st.RollbackActionTimeout > 0 {
+				actx, cancel = context.WithTimeout(ctx, st.RollbackActionTimeout)
+			}
+			start := st.Now()
+			err = sc.RunAction(actx, st, a)
+			ra.Duration = st.Since(start)
+			ra.Err = err
+			cancel()
+		}
+		report = append(report, ra)
+	}
+	return report, err
+}
+
+// Run the items in the method script. The script itself is not modified,
+// actions added while running are added to the current run only. Under
+// PolicyPropagateRollback the rollback actions that did not run are added
+// to the parent script, if any, when the script succeeds.
 func (sc *script) Run(ctx context.Context, st *State, parent Script) error {
 	if sc == nil {
 		return nil
 	}
+	n := len(st.resources)
+	r := sc.newRun()
+	if err := r.loadCheckpoint(st); err != nil {
+		return err
+	}
+	err := r.run(ctx, st)
+	if err == nil {
+		err = r.removeCheckpoint(st)
+	}
+	if err == nil && parent != nil && st.Policy&PolicyPropagateRollback != 0 {
+		if rb := r.rollback; rb != nil && rb.at < len(rb.list) {
+			parent.Rollback(rb.list[rb.at:]...)
+		}
+	}
+	if derr := r.runDeferred(ctx, st); derr != nil {
+		err = errors.Join(err, derr)
+	}
+	if rerr := st.release(n); rerr != nil {
+		err = errors.Join(err, rerr)
+	}
+	return err
+}
+
+// runDeferred runs each deferred action, last added first, even if the
+// context is canceled or an action fails. A deferred action that fails
+// does not run the rollback actions.
+func (sc *script) runDeferred(ctx context.Context, st *State) error {
+	ctx = context.WithoutCancel(ctx)
+	orig := st.Policy
+	st.Policy |= PolicySkipRollback
+	defer func() { st.Policy = orig }()
+	var errs []error
+	// Deferred actions may defer more actions.
+	for len(sc.deferred) > 0 {
+		last := len(sc.deferred) - 1
+		a := sc.deferred[last]
+		sc.deferred = sc.deferred[:last]
+		if err := sc.RunAction(ctx, st, a); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// run the remaining items of the script.
+func (sc *script) run(ctx context.Context, st *State) error {
 	var err error
 	for {
 		err = sc.runNext(ctx, st)
 		if err == io.EOF {
 			return nil
 		}
+		if err == nil {
+			err = sc.saveCheckpoint(st)
+		}
 		if err != nil {
+			if terr, ok := err.(*Error); ok {
+				f := Frame{Step: sc.at - 1}
+				if na, ok := sc.list[sc.at-1].(*namedAction); ok {
+					f.Name = na.name
+				}
+				terr.Trail = append([]Frame{f}, terr.Trail...)
+			}
 			return err
 		}
 	}
@@ -320,6 +811,27 @@ func AddRollback(a ...Action) Action {
 	})
 }
 
+type namedAction struct {
+	name string
+	a    Action
+}
+
+// Run the action. The error policy is applied when the Script runs the
+// namedAction, so it is reported with the name.
+func (na *namedAction) Run(ctx context.Context, st *State, sc Script) error {
+	return na.a.Run(ctx, st, sc)
+}
+
+func (na *namedAction) String() string {
+	return na.name
+}
+
+// Named gives the action a name, reported by State.Failure when the
+// action fails and by JUnitReport.
+func Named(name string, a Action) Action {
+	return &namedAction{name: name, a: a}
+}
+
 // Switch will run the f action, read the state branch value, and then
 // execute the given action in sw.
 func Switch(f Action, sw map[Branch]Action) Action {
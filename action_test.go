@@ -0,0 +1,498 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestError(t *testing.T) {
+	fail := errors.New("fail")
+	rbFail := errors.New("rollback fail")
+	ok := ActionFunc(func(ctx context.Context, st *State, sc Script) error { return nil })
+
+	err := Run(context.Background(), &State{}, NewScript(
+		ok,
+		Rollback(ActionFunc(func(ctx context.Context, st *State, sc Script) error { return rbFail })),
+		Named("deploy", NewScript(
+			ok,
+			Named("push", ActionFunc(func(ctx context.Context, st *State, sc Script) error { return fail })),
+		)),
+	))
+	var terr *Error
+	if !errors.As(err, &terr) {
+		t.Fatalf("expected *Error, got %T %v", err, err)
+	}
+	if g, w := terr.Path, []string{"deploy", "push"}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("got path %q, want %q", g, w)
+	}
+	if terr.Step != 1 {
+		t.Fatalf("got step %d, want 1", terr.Step)
+	}
+	if !terr.RolledBack || !errors.Is(err, rbFail) || !errors.Is(err, fail) {
+		t.Fatalf("expected failed rollback, got %+v", terr)
+	}
+	if g, w := err.Error(), "fail, rollback failed: rollback fail"; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+
+	err = Run(context.Background(), &State{}, NewScript(ok, ok, ActionFunc(func(ctx context.Context, st *State, sc Script) error { return fail })))
+	if !errors.As(err, &terr) || terr.Step != 2 || terr.RolledBack || len(terr.Path) != 0 || err.Error() != "fail" {
+		t.Fatalf("got %+v", terr)
+	}
+}
+
+func TestMustGet(t *testing.T) {
+	st := &State{}
+	_, err := st.MustGet("version")
+	if g, w := fmt.Sprint(err), `variable "version" not set; no variables are set`; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+	st.Set("tag", "v1")
+	st.Set("arch", "arm64")
+	st.Set("unset", nil)
+	_, err = st.MustGet("version")
+	var verr *VarError
+	if !errors.As(err, &verr) || verr.Name != "version" {
+		t.Fatalf("got %#v, want *VarError", err)
+	}
+	if g, w := err.Error(), `variable "version" not set; known variables: arch, tag`; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+	if v, err := st.MustGet("tag"); err != nil || v != "v1" {
+		t.Fatalf("got %v, %v", v, err)
+	}
+}
+
+func TestScriptReuse(t *testing.T) {
+	var mu sync.Mutex
+	count := 0
+	step := ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		mu.Lock()
+		count++
+		mu.Unlock()
+		return nil
+	})
+	// The action added while running must only be run by that run.
+	sc := NewScript(step, ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		sc.Add(step)
+		return nil
+	}))
+
+	for i := 0; i < 2; i++ {
+		if err := Run(context.Background(), &State{}, sc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if count != 4 {
+		t.Fatalf("got %d steps after two runs, want 4", count)
+	}
+
+	count = 0
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := sc.Run(context.Background(), &State{}, nil); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if count != 16 {
+		t.Fatalf("got %d steps after concurrent runs, want 16", count)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	ctx := context.Background()
+	if st := FromContext(ctx); st != nil {
+		t.Fatalf("got %v from an empty context, want nil", st)
+	}
+	st := &State{}
+	st.Set("v", 1)
+	helper := func(ctx context.Context) any {
+		return FromContext(ctx).Get("v")
+	}
+	err := Run(ctx, st, ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		if got := helper(WithState(ctx, st)); got != 1 {
+			return fmt.Errorf("got %v, want 1", got)
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRollbackCancel(t *testing.T) {
+	interrupt := func(cancel context.CancelFunc) Action {
+		return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			cancel()
+			return ctx.Err()
+		})
+	}
+	fail := ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		return errors.New("fail")
+	})
+	var rolledBack bool
+	rollback := ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		rolledBack = ctx.Err() == nil
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := Run(ctx, &State{}, NewScript(Rollback(rollback), interrupt(cancel)))
+	var terr *Error
+	if !errors.As(err, &terr) || !terr.Canceled || !terr.RolledBack || !rolledBack {
+		t.Fatalf("expected rollback after cancel, got %+v, rolled back %t", terr, rolledBack)
+	}
+
+	rolledBack = false
+	ctx, cancel = context.WithCancel(context.Background())
+	st := &State{Policy: PolicySkipRollbackOnCancel}
+	err = Run(ctx, st, NewScript(Rollback(rollback), interrupt(cancel)))
+	if !errors.As(err, &terr) || !terr.Canceled || terr.RolledBack || rolledBack {
+		t.Fatalf("expected no rollback after cancel, got %+v", terr)
+	}
+	err = Run(context.Background(), st, NewScript(Rollback(rollback), fail))
+	if !errors.As(err, &terr) || terr.Canceled || !terr.RolledBack || !rolledBack {
+		t.Fatalf("expected rollback after failure, got %+v", terr)
+	}
+
+	st = &State{RollbackTimeout: time.Millisecond}
+	err = Run(context.Background(), st, NewScript(
+		Rollback(ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})),
+		fail,
+	))
+	if !errors.As(err, &terr) || !errors.Is(terr.RollbackErr, context.DeadlineExceeded) {
+		t.Fatalf("expected rollback timeout, got %+v", terr)
+	}
+
+	rctx, rcancel := context.WithCancel(context.Background())
+	st = &State{RollbackContext: rctx}
+	err = Run(context.Background(), st, NewScript(
+		Rollback(ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			rcancel()
+			<-ctx.Done()
+			return ctx.Err()
+		})),
+		fail,
+	))
+	if !errors.As(err, &terr) || !errors.Is(terr.RollbackErr, context.Canceled) {
+		t.Fatalf("expected rollback canceled, got %+v", terr)
+	}
+}
+
+func TestRollbackReport(t *testing.T) {
+	hang := ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	ok := ActionFunc(func(ctx context.Context, st *State, sc Script) error { return nil })
+	fail := ActionFunc(func(ctx context.Context, st *State, sc Script) error { return errors.New("fail") })
+
+	st := &State{RollbackActionTimeout: time.Millisecond}
+	err := Run(context.Background(), st, NewScript(
+		Rollback(Named("unlock", ok)),
+		Named("outer", NewScript(
+			Rollback(Named("drop", hang), Named("delete", ok)),
+			fail,
+		)),
+	))
+	var terr *Error
+	if !errors.As(err, &terr) {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+	var got []string
+	for _, ra := range terr.Rollback {
+		got = append(got, fmt.Sprintf("%d %s ran=%t err=%v", ra.Step, ra.Name, ra.Ran, ra.Err))
+	}
+	want := []string{
+		"0 drop ran=true err=context deadline exceeded",
+		"1 delete ran=false err=<nil>",
+		"0 unlock ran=true err=<nil>",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got report\n%q\nwant\n%q", got, want)
+	}
+	if !errors.Is(terr.RollbackErr, context.DeadlineExceeded) {
+		t.Fatalf("got rollback error %v", terr.RollbackErr)
+	}
+}
+
+func TestErrorTrail(t *testing.T) {
+	ok := ActionFunc(func(ctx context.Context, st *State, sc Script) error { return nil })
+	fail := ActionFunc(func(ctx context.Context, st *State, sc Script) error { return errors.New("exit status 1") })
+	err := Run(context.Background(), &State{}, NewScript(
+		ok,
+		ok,
+		Named("deploy", NewScript(
+			ok,
+			WithPolicy(PolicyFail, NewScript(Named("push", fail))),
+		)),
+	))
+	var terr *Error
+	if !errors.As(err, &terr) {
+		t.Fatalf("expected *Error, got %T", err)
+	}
+	want := []Frame{{Step: 0}, {Step: 2, Name: "deploy"}, {Step: 1}, {Step: 0, Name: "push"}}
+	if !reflect.DeepEqual(terr.Trail, want) {
+		t.Fatalf("got trail %v, want %v", terr.Trail, want)
+	}
+	if g, w := fmt.Sprintf("%+v", err), "[0] > deploy[2] > [1] > push[0]: exit status 1"; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+	if g, w := fmt.Sprintf("%v %q", err, err), `exit status 1 "exit status 1"`; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	target := func(name string, fail bool) Action {
+		return Named(name, ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			if fail {
+				return fmt.Errorf("%s failed", name)
+			}
+			return nil
+		}))
+	}
+	var logged []error
+	st := &State{ErrorLogger: func(err error) { logged = append(logged, err) }}
+	err := Run(context.Background(), st, WithPolicy(PolicyContinue|PolicyLog, NewScript(
+		target("linux", false),
+		target("darwin", true),
+		target("windows", true),
+	)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := st.Errors()
+	if g, w := errs.Error(), "darwin failed\nwindows failed"; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+	var terr *Error
+	if !errors.As(errs, &terr) || terr.Path[0] != "darwin" || len(logged) != 2 {
+		t.Fatalf("got %+v, logged %d", terr, len(logged))
+	}
+	if errs := (&State{}).Errors(); errs != nil {
+		t.Fatalf("got %v, want nil", errs)
+	}
+}
+
+func TestDefer(t *testing.T) {
+	var log []string
+	step := func(name string, err error) Action {
+		return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			log = append(log, name)
+			return err
+		})
+	}
+	fail := errors.New("fail")
+
+	err := Run(context.Background(), &State{}, NewScript(
+		Defer(step("close a", nil)),
+		step("work", nil),
+		Defer(step("close b", nil)),
+		step("more", nil),
+	))
+	if g, w := strings.Join(log, ","), "work,more,close b,close a"; err != nil || g != w {
+		t.Fatalf("success: got %q, %v; want %q", g, err, w)
+	}
+
+	log = nil
+	err = Run(context.Background(), &State{}, NewScript(
+		Defer(step("close", nil)),
+		Rollback(step("undo", nil)),
+		step("work", fail),
+	))
+	if g, w := strings.Join(log, ","), "work,undo,close"; !errors.Is(err, fail) || g != w {
+		t.Fatalf("failure: got %q, %v; want %q", g, err, w)
+	}
+
+	// A failed deferred action is reported without running the rollback,
+	// and does not stop the other deferred actions.
+	log = nil
+	closeErr := errors.New("close failed")
+	err = Run(context.Background(), &State{}, NewScript(
+		Rollback(step("undo", nil)),
+		Defer(step("close a", nil)),
+		Defer(step("close b", closeErr)),
+		step("work", nil),
+	))
+	if g, w := strings.Join(log, ","), "work,close b,close a"; !errors.Is(err, closeErr) || g != w {
+		t.Fatalf("deferred failure: got %q, %v; want %q", g, err, w)
+	}
+
+	// Deferred actions run when the context is canceled.
+	log = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	err = Run(ctx, &State{}, NewScript(
+		Defer(step("close", nil)),
+		ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			cancel()
+			return ctx.Err()
+		}),
+	))
+	if g := strings.Join(log, ","); !errors.Is(err, context.Canceled) || g != "close" {
+		t.Fatalf("canceled: got %q, %v", g, err)
+	}
+}
+
+func TestSavepoint(t *testing.T) {
+	var log []string
+	step := func(name string, err error) Action {
+		return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			log = append(log, name)
+			return err
+		})
+	}
+	fail := errors.New("fail")
+	release := func(upload error) Script {
+		return NewScript(
+			step("build", nil),
+			Rollback(step("remove artifacts", nil)),
+			Savepoint("built"),
+			RollbackTo("built"),
+			step("upload", nil),
+			Rollback(step("delete upload", nil)),
+			step("publish", upload),
+		)
+	}
+
+	err := Run(context.Background(), &State{}, release(fail))
+	if g, w := strings.Join(log, ","), "build,upload,publish,delete upload"; !errors.Is(err, fail) || g != w {
+		t.Fatalf("got %q, %v; want %q", g, err, w)
+	}
+
+	// Without RollbackTo the savepoint does not limit the rollback.
+	log = nil
+	err = Run(context.Background(), &State{}, NewScript(
+		step("build", nil),
+		Rollback(step("remove artifacts", nil)),
+		Savepoint("built"),
+		step("upload", fail),
+	))
+	if g, w := strings.Join(log, ","), "build,upload,remove artifacts"; !errors.Is(err, fail) || g != w {
+		t.Fatalf("without RollbackTo: got %q, %v; want %q", g, err, w)
+	}
+
+	// Savepoints belong to the script that sets them.
+	err = Run(context.Background(), &State{}, NewScript(Savepoint("a"), NewScript(RollbackTo("a"))))
+	var terr *Error
+	if !errors.As(err, &terr) || terr.Err.Error() != `rollback to "a": unknown savepoint` {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestPropagateRollback(t *testing.T) {
+	var log []string
+	step := func(name string, err error) Action {
+		return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			log = append(log, name)
+			return err
+		})
+	}
+	fail := errors.New("fail")
+	deploy := NewScript(
+		NewScript(step("create db", nil), Rollback(step("drop db", nil))),
+		step("migrate", fail),
+	)
+
+	err := Run(context.Background(), &State{}, deploy)
+	if g, w := strings.Join(log, ","), "create db,migrate"; !errors.Is(err, fail) || g != w {
+		t.Fatalf("got %q, %v; want %q", g, err, w)
+	}
+
+	log = nil
+	err = Run(context.Background(), &State{Policy: PolicyPropagateRollback}, deploy)
+	if g, w := strings.Join(log, ","), "create db,migrate,drop db"; !errors.Is(err, fail) || g != w {
+		t.Fatalf("propagate: got %q, %v; want %q", g, err, w)
+	}
+
+	// A nested script that fails runs its own rollback only once.
+	log = nil
+	err = Run(context.Background(), &State{Policy: PolicyPropagateRollback}, NewScript(
+		Rollback(step("unlock", nil)),
+		NewScript(Rollback(step("drop db", nil)), step("create db", fail)),
+	))
+	if g, w := strings.Join(log, ","), "create db,drop db,unlock"; !errors.Is(err, fail) || g != w {
+		t.Fatalf("nested failure: got %q, %v; want %q", g, err, w)
+	}
+}
+
+func TestUse(t *testing.T) {
+	var log []string
+	step := func(name string, err error) Action {
+		return Named(name, ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			log = append(log, name)
+			return err
+		}))
+	}
+	trace := func(prefix string) func(Action) Action {
+		return func(a Action) Action {
+			return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+				name := "?"
+				if na, ok := a.(*namedAction); ok {
+					name = na.name
+				}
+				log = append(log, prefix+" "+name)
+				return a.Run(ctx, st, sc)
+			})
+		}
+	}
+	fail := errors.New("fail")
+
+	err := Run(context.Background(), &State{}, NewScript(
+		step("before", nil),
+		Use(trace("outer"), trace("inner")),
+		Defer(step("cleanup", nil)),
+		Rollback(step("undo", nil)),
+		NewScript(step("nested", nil)),
+		step("deploy", fail),
+	))
+	want := []string{
+		"before",
+		"outer ?", "inner ?", // Defer
+		"outer ?", "inner ?", // Rollback
+		"outer ?", "inner ?", "nested",
+		// The outer middleware is passed the action wrapped by the inner.
+		"outer ?", "inner deploy", "deploy",
+		"outer ?", "inner undo", "undo",
+		"outer ?", "inner cleanup", "cleanup",
+	}
+	if !errors.Is(err, fail) || !reflect.DeepEqual(log, want) {
+		t.Fatalf("got %q, %v\nwant %q", log, err, want)
+	}
+
+	// Retry each action once.
+	retry := func(a Action) Action {
+		return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			if err := a.Run(ctx, st, sc); err == nil {
+				return nil
+			}
+			return a.Run(ctx, st, sc)
+		})
+	}
+	tries := 0
+	flaky := ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		tries++
+		if tries == 1 {
+			return fail
+		}
+		return nil
+	})
+	sc := NewScript(Use(retry), flaky)
+	if err := Run(context.Background(), &State{}, sc); err != nil || tries != 2 {
+		t.Fatalf("got %v after %d tries", err, tries)
+	}
+}
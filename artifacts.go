@@ -0,0 +1,128 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ArtifactsVar is the State variable that, when set to a directory, runs
+// Registry tasks with ActionOutput into the directory. Commands from a
+// Registry set it with the "-artifacts" flag.
+const ArtifactsVar = "artifacts"
+
+// actionFiles holds the open output files of each action.
+type actionFiles struct {
+	mu    sync.Mutex
+	dir   string
+	files map[string]*os.File
+	err   error
+}
+
+func (af *actionFiles) write(name string, p []byte) {
+	af.mu.Lock()
+	defer af.mu.Unlock()
+	f, ok := af.files[name]
+	if !ok {
+		fn := filepath.Join(af.dir, filepath.FromSlash(name))
+		err := ensureDir(fn)
+		if err == nil {
+			f, err = os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		}
+		if err != nil {
+			af.err = errors.Join(af.err, err)
+		}
+		af.files[name] = f
+	}
+	if f == nil {
+		return
+	}
+	if _, err := f.Write(p); err != nil && af.err == nil {
+		af.err = err
+	}
+}
+
+func (af *actionFiles) close() error {
+	af.mu.Lock()
+	defer af.mu.Unlock()
+	err := af.err
+	for _, f := range af.files {
+		if f != nil {
+			err = errors.Join(err, f.Close())
+		}
+	}
+	return err
+}
+
+// actionFileWriter writes to w and to the file of the running action.
+type actionFileWriter struct {
+	af     *actionFiles
+	st     *State
+	stream string
+	w      io.Writer
+}
+
+func (aw *actionFileWriter) Write(p []byte) (int, error) {
+	name := "run"
+	if len(aw.st.names) > 0 {
+		parts := make([]string, len(aw.st.names))
+		for i, n := range aw.st.names {
+			parts[i] = artifactName(n)
+		}
+		name = strings.Join(parts, "/")
+	}
+	aw.af.write(name+"."+aw.stream+".log", []byte(aw.st.Redact(string(p))))
+	if aw.w == nil {
+		return len(p), nil
+	}
+	return aw.w.Write(p)
+}
+
+// artifactName returns the action name safe to use as a file name.
+func artifactName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, name)
+	if strings.Trim(name, ".") == "" {
+		return "_" + name
+	}
+	return name
+}
+
+// ActionOutput runs the action a and also writes the stdout and stderr of
+// each Named action to files in dir, relative to State.Dir, such as an
+// artifacts directory uploaded by CI. Files are named by the action path,
+// such as "deploy/push.stdout.log" for the "push" action run within
+// "deploy". Output outside of Named actions is written to "run.stdout.log"
+// and "run.stderr.log". Output of actions run concurrently on a copy of
+// the State is written to the file of the action that started them.
+func ActionOutput(dir any, a Action) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		d, err := ExpandEnvErr(dir, st)
+		if err != nil {
+			return err
+		}
+		af := &actionFiles{dir: st.Filepath(d), files: make(map[string]*os.File)}
+		if dryRun(st, "artifacts: %s", af.dir) {
+			return sc.RunAction(ctx, st, a)
+		}
+		oldStdout, oldStderr := st.Stdout, st.Stderr
+		st.Stdout = &actionFileWriter{af: af, st: st, stream: "stdout", w: oldStdout}
+		st.Stderr = &actionFileWriter{af: af, st: st, stream: "stderr", w: oldStderr}
+		err = sc.RunAction(ctx, st, a)
+		st.Stdout, st.Stderr = oldStdout, oldStderr
+		return errors.Join(err, af.close())
+	})
+}
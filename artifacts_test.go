@@ -0,0 +1,43 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestActionOutput(t *testing.T) {
+	dir := t.TempDir()
+	out := &strings.Builder{}
+	st := &State{Dir: dir, Stdout: out, Stderr: out}
+	a := ActionOutput("artifacts", Named("deploy", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		fmt.Fprintln(st.Stdout, "deploying")
+		return sc.RunAction(ctx, st, Named("push image", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			fmt.Fprintln(st.Stdout, "pushed")
+			fmt.Fprintln(st.Stderr, "warning")
+			return nil
+		})))
+	})))
+	if err := Run(context.Background(), st, a); err != nil {
+		t.Fatal(err)
+	}
+	if g, w := out.String(), "deploying\npushed\nwarning\n"; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+	for fn, want := range map[string]string{
+		"deploy.stdout.log":            "deploying\n",
+		"deploy/push_image.stdout.log": "pushed\n",
+		"deploy/push_image.stderr.log": "warning\n",
+	} {
+		b, err := os.ReadFile(filepath.Join(dir, "artifacts", filepath.FromSlash(fn)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("%s: got %q, want %q", fn, b, want)
+		}
+	}
+}
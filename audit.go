@@ -0,0 +1,148 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ExecRecord is the audit record of an executed command. Secrets are
+// redacted.
+type ExecRecord struct {
+	Start    time.Time     `json:"start"`
+	Args     []string      `json:"args"`
+	Dir      string        `json:"dir"`
+	Env      []string      `json:"env,omitempty"`   // "KEY=value" set or changed from the process env.
+	Unset    []string      `json:"unset,omitempty"` // Keys of the process env not passed to the command.
+	ExitCode int           `json:"exit_code"`       // -1 if the command did not start or was killed.
+	Duration time.Duration `json:"duration"`        // Nanoseconds the command ran.
+	Err      string        `json:"error,omitempty"`
+}
+
+// audit holds the exec records of a run, shared by copies of the State.
+type audit struct {
+	mu      sync.Mutex
+	records []ExecRecord
+	file    *os.File
+	enc     *json.Encoder
+}
+
+// AuditExec records each command run with Exec, or by an action that calls
+// State.AuditCmd, for the rest of the run. The records are returned by
+// State.ExecAudit. If filename is not empty, each record is also appended
+// to the file, relative to State.Dir, as a line of JSON. The file is closed
+// when the script ends.
+func AuditExec(filename any) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		a := &audit{}
+		if filename != nil {
+			fn, err := ExpandEnvErr(filename, st)
+			if err != nil {
+				return err
+			}
+			if len(fn) > 0 {
+				f, err := os.OpenFile(st.Filepath(fn), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+				if err != nil {
+					return err
+				}
+				a.file, a.enc = f, json.NewEncoder(f)
+				sc.Defer(ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+					a.mu.Lock()
+					defer a.mu.Unlock()
+					if a.file == nil {
+						return nil
+					}
+					err := a.file.Close()
+					a.file, a.enc = nil, nil
+					return err
+				}))
+			}
+		}
+		st.audit = a
+		return nil
+	})
+}
+
+// ExecAudit returns the commands recorded since AuditExec.
+func (st *State) ExecAudit() []ExecRecord {
+	if st.audit == nil {
+		return nil
+	}
+	st.audit.mu.Lock()
+	defer st.audit.mu.Unlock()
+	return append([]ExecRecord(nil), st.audit.records...)
+}
+
+// AuditCmd records the command, which started at start, from State.Now,
+// and ended with err, if AuditExec is in effect. Actions that run commands with os/exec rather
+// then Exec should call it after the command ends.
+func (st *State) AuditCmd(cmd *exec.Cmd, start time.Time, err error) {
+	a := st.audit
+	if a == nil {
+		return
+	}
+	rec := ExecRecord{
+		Start:    start,
+		Args:     make([]string, len(cmd.Args)),
+		Dir:      st.Redact(cmd.Dir),
+		ExitCode: -1,
+		Duration: st.Since(start),
+	}
+	for i, arg := range cmd.Args {
+		rec.Args[i] = st.Redact(arg)
+	}
+	if cmd.ProcessState != nil {
+		rec.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		rec.ExitCode = ee.ExitCode()
+	}
+	if err != nil {
+		rec.Err = st.Redact(err.Error())
+	}
+	if cmd.Env != nil {
+		rec.Env, rec.Unset = envDiff(Environ(), cmd.Env)
+		for i, kv := range rec.Env {
+			rec.Env[i] = st.Redact(kv)
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.records = append(a.records, rec)
+	if a.enc != nil {
+		a.enc.Encode(rec)
+	}
+}
+
+// envDiff returns the "KEY=value" pairs of list that are not in base and
+// the keys of base not in list, sorted.
+func envDiff(base map[string]string, list []string) (set, unset []string) {
+	seen := make(map[string]bool, len(list))
+	for _, kv := range list {
+		k, v, _ := strings.Cut(kv, "=")
+		seen[k] = true
+		if bv, ok := base[k]; !ok || bv != v {
+			set = append(set, kv)
+		}
+	}
+	for k := range base {
+		if !seen[k] {
+			unset = append(unset, k)
+		}
+	}
+	sort.Strings(set)
+	sort.Strings(unset)
+	return set, unset
+}
@@ -0,0 +1,90 @@
+package task
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAuditExec(t *testing.T) {
+	dir := t.TempDir()
+	env := Environ()
+	env["AUDIT_TOKEN"] = "s3cret"
+	st := &State{Dir: dir, Env: env, Policy: PolicyContinue}
+	st.MarkSecret("s3cret")
+	err := Run(context.Background(), st, NewScript(
+		AuditExec("audit.jsonl"),
+		Exec("go", "env", "GOOS"),
+		Exec("go", "bogus-command", "s3cret"),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs := st.ExecAudit()
+	if len(recs) != 2 {
+		t.Fatalf("got %d records, want 2", len(recs))
+	}
+	if g, w := recs[0].Args, []string{"go", "env", "GOOS"}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("got args %q, want %q", g, w)
+	}
+	if recs[0].ExitCode != 0 || recs[0].Dir != dir || recs[0].Duration <= 0 {
+		t.Fatalf("bad record %+v", recs[0])
+	}
+	if g, w := recs[0].Env, []string{"AUDIT_TOKEN=****"}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("got env %q, want %q", g, w)
+	}
+	if g, w := recs[1].Args, []string{"go", "bogus-command", "****"}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("got args %q, want %q", g, w)
+	}
+	if recs[1].ExitCode == 0 || len(recs[1].Err) == 0 {
+		t.Fatalf("expected failure, got %+v", recs[1])
+	}
+
+	f, err := os.Open(filepath.Join(dir, "audit.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines []ExecRecord
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec ExecRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, rec)
+	}
+	if len(lines) != 2 || lines[1].ExitCode != recs[1].ExitCode {
+		t.Fatalf("got file records %+v", lines)
+	}
+
+	// The start and duration are from the State clock.
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	st = &State{Dir: dir, Env: Environ(), Clock: stoppedClock(now)}
+	err = Run(context.Background(), st, NewScript(
+		AuditExec(""),
+		Exec("go", "env", "GOOS"),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs = st.ExecAudit()
+	if len(recs) != 1 || !recs[0].Start.Equal(now) || recs[0].Duration != 0 {
+		t.Fatalf("got records %+v, want start %v", recs, now)
+	}
+}
+
+func TestEnvDiff(t *testing.T) {
+	set, unset := envDiff(map[string]string{"A": "1", "B": "2", "C": "3"}, []string{"A=1", "B=x", "D=4"})
+	if g, w := set, []string{"B=x", "D=4"}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("got set %q, want %q", g, w)
+	}
+	if g, w := unset, []string{"C"}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("got unset %q, want %q", g, w)
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrCacheMiss is returned by a CacheBackend when the key is not stored.
+var ErrCacheMiss = errors.New("cache miss")
+
+// CacheBackend stores task output artifacts by content-addressed key,
+// so they may be shared between machines. It must be safe for
+// concurrent use.
+type CacheBackend interface {
+	// Get returns the data stored under key, or ErrCacheMiss.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Put stores the data under key.
+	Put(ctx context.Context, key string, data []byte) error
+}
+
+// DirCache is a CacheBackend that stores artifacts in a local directory.
+type DirCache string
+
+func (dc DirCache) path(key string) string {
+	sub := key
+	if len(sub) > 2 {
+		sub = sub[:2]
+	}
+	return filepath.Join(string(dc), sub, key)
+}
+
+// Get implements CacheBackend.
+func (dc DirCache) Get(ctx context.Context, key string) ([]byte, error) {
+	b, err := os.ReadFile(dc.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrCacheMiss
+	}
+	return b, err
+}
+
+// Put implements CacheBackend.
+func (dc DirCache) Put(ctx context.Context, key string, data []byte) error {
+	fn := dc.path(key)
+	if err := os.MkdirAll(filepath.Dir(fn), 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(fn), key)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), fn)
+}
+
+// HTTPCache is a CacheBackend that uses GET and PUT requests to URL/key,
+// as served by common build cache servers. A 404 response is a miss.
+type HTTPCache struct {
+	URL    string
+	Header http.Header // Added to each request, such as for authorization.
+	Client *http.Client
+}
+
+func (hc *HTTPCache) do(ctx context.Context, method, key string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(hc.URL, "/")+"/"+key, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range hc.Header {
+		req.Header[k] = v
+	}
+	client := hc.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// Get implements CacheBackend.
+func (hc *HTTPCache) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := hc.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(resp.Body)
+	case http.StatusNotFound:
+		return nil, ErrCacheMiss
+	}
+	return nil, fmt.Errorf("cache get %s: %s", key, resp.Status)
+}
+
+// Put implements CacheBackend.
+func (hc *HTTPCache) Put(ctx context.Context, key string, data []byte) error {
+	resp, err := hc.do(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("cache put %s: %s", key, resp.Status)
+	}
+	return nil
+}
+
+// TieredCache returns a CacheBackend that gets from each backend in order,
+// such as a local DirCache then a remote cache. A hit is copied to the
+// backends before it. Errors from a backend, such as an unreachable
+// server, are skipped over if a later backend has the key. Put stores
+// to every backend.
+func TieredCache(backends ...CacheBackend) CacheBackend {
+	return tiered(backends)
+}
+
+type tiered []CacheBackend
+
+func (tc tiered) Get(ctx context.Context, key string) ([]byte, error) {
+	var errs []error
+	for i, b := range tc {
+		data, err := b.Get(ctx, key)
+		if err == nil {
+			for _, prev := range tc[:i] {
+				prev.Put(ctx, key, data)
+			}
+			return data, nil
+		}
+		if !errors.Is(err, ErrCacheMiss) {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return nil, ErrCacheMiss
+}
+
+func (tc tiered) Put(ctx context.Context, key string, data []byte) error {
+	var errs []error
+	for _, b := range tc {
+		if err := b.Put(ctx, key, data); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// cacheKey returns the content-addressed key of the task outputs for the
+// fingerprint of its sources.
+func cacheKey(t *Task, sum string) string {
+	h := sha256.New()
+	writeField(h, t.Name)
+	writeField(h, sum)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// restoreOutputs extracts the cached outputs of the task, reporting false
+// on a cache miss.
+func (r *Registry) restoreOutputs(ctx context.Context, st *State, t *Task, sum string) (bool, error) {
+	data, err := r.Cache.Get(ctx, cacheKey(t, sum))
+	if errors.Is(err, ErrCacheMiss) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := untarFiles(data, st.Filepath(t.Dir)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// storeOutputs archives the task outputs to the cache.
+func (r *Registry) storeOutputs(ctx context.Context, st *State, t *Task, sum string) error {
+	dir := st.Filepath(t.Dir)
+	var files []string
+	for _, pattern := range t.Outputs {
+		list, err := Glob(dir, pattern)
+		if err != nil {
+			return err
+		}
+		files = append(files, list...)
+	}
+	data, err := tarFiles(dir, files)
+	if err != nil {
+		return err
+	}
+	return r.Cache.Put(ctx, cacheKey(t, sum), data)
+}
+
+// tarFiles returns a tar.gz archive of the files, relative to dir.
+func tarFiles(dir string, files []string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for _, fn := range files {
+		b, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(fn)))
+		if err != nil {
+			return nil, err
+		}
+		fi, err := os.Stat(filepath.Join(dir, filepath.FromSlash(fn)))
+		if err != nil {
+			return nil, err
+		}
+		err = tw.WriteHeader(&tar.Header{Name: fn, Mode: int64(fi.Mode().Perm()), Size: int64(len(b)), Typeflag: tar.TypeReg})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(b); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// untarFiles extracts the files of a tarFiles archive into dir.
+func untarFiles(data []byte, dir string) error {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.Clean(filepath.FromSlash(h.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("invalid cached file %q", h.Name)
+		}
+		fn := filepath.Join(dir, name)
+		if err := ensureDir(fn); err != nil {
+			return err
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(fn, b, fs.FileMode(h.Mode).Perm()); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCacheBackends(t *testing.T) {
+	ctx := context.Background()
+	var (
+		mu      sync.Mutex
+		objects = map[string][]byte{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, "/cache/")
+		switch r.Method {
+		case http.MethodGet:
+			b, ok := objects[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(b)
+		case http.MethodPut:
+			objects[key], _ = io.ReadAll(r.Body)
+		}
+	}))
+	defer srv.Close()
+
+	remote := &HTTPCache{URL: srv.URL + "/cache/", Header: http.Header{"Authorization": {"Bearer tok"}}}
+	local := DirCache(t.TempDir())
+	if _, err := remote.Get(ctx, "abc"); !errors.Is(err, ErrCacheMiss) {
+		t.Fatalf("expected remote miss, got %v", err)
+	}
+	if _, err := local.Get(ctx, "abc"); !errors.Is(err, ErrCacheMiss) {
+		t.Fatalf("expected local miss, got %v", err)
+	}
+	if err := remote.Put(ctx, "abc", []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A remote hit is copied to the local cache.
+	tc := TieredCache(local, remote)
+	b, err := tc.Get(ctx, "abc")
+	if err != nil || string(b) != "data" {
+		t.Fatalf("got %q, %v", b, err)
+	}
+	if b, err := local.Get(ctx, "abc"); err != nil || string(b) != "data" {
+		t.Fatalf("expected local backfill, got %q, %v", b, err)
+	}
+
+	// The local cache is used when the remote is unavailable.
+	srv.Close()
+	if b, err := tc.Get(ctx, "abc"); err != nil || string(b) != "data" {
+		t.Fatalf("expected local fallback, got %q, %v", b, err)
+	}
+	if _, err := tc.Get(ctx, "def"); err == nil || errors.Is(err, ErrCacheMiss) {
+		t.Fatalf("expected remote error, got %v", err)
+	}
+}
+
+func TestRegistryCache(t *testing.T) {
+	cache := DirCache(t.TempDir())
+	runs := 0
+	build := func(dir string) {
+		fps, err := OpenFingerprintStore(filepath.Join(dir, ".task", "fp.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &Registry{Fingerprints: fps, Cache: cache}
+		bt := r.Register("build", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			runs++
+			if err := os.MkdirAll(st.Filepath("bin"), 0700); err != nil {
+				return err
+			}
+			return os.WriteFile(st.Filepath("bin/out"), []byte("built"), 0600)
+		}))
+		bt.Sources = []string{"src/*.go"}
+		bt.Outputs = []string{"bin/*"}
+		err = Run(context.Background(), &State{Dir: dir}, r.Action("build"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	newDir := func(src string) string {
+		dir := t.TempDir()
+		os.MkdirAll(filepath.Join(dir, "src"), 0700)
+		os.WriteFile(filepath.Join(dir, "src", "a.go"), []byte(src), 0600)
+		return dir
+	}
+
+	build(newDir("package a"))
+	if runs != 1 {
+		t.Fatalf("expected one run, got %d", runs)
+	}
+
+	// Another checkout of the same sources restores the outputs.
+	dir := newDir("package a")
+	build(dir)
+	if runs != 1 {
+		t.Fatalf("expected outputs restored from cache, got %d runs", runs)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "bin", "out"))
+	if err != nil || string(b) != "built" {
+		t.Fatalf("got restored output %q, %v", b, err)
+	}
+	build(dir)
+	if runs != 1 {
+		t.Fatalf("expected restored task to be up to date, got %d runs", runs)
+	}
+
+	build(newDir("package b"))
+	if runs != 2 {
+		t.Fatalf("expected changed sources to run, got %d runs", runs)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChangeKind is the kind of a State change.
+type ChangeKind string
+
+// Kinds of changes recorded by TrackChanges.
+const (
+	ChangeSet      ChangeKind = "set"      // State.Set
+	ChangeDelete   ChangeKind = "delete"   // State.Delete
+	ChangeSetenv   ChangeKind = "setenv"   // State.Setenv
+	ChangeUnsetenv ChangeKind = "unsetenv" // State.Unsetenv
+)
+
+// Change is a recorded change of a State variable or environment
+// variable. Values are formatted with fmt.Sprint and secrets are redacted.
+type Change struct {
+	Time   time.Time
+	Action string // Path of the Named action that made the change, joined by "/".
+	Kind   ChangeKind
+	Name   string
+	Old    string
+	HadOld bool // The variable was set before the change.
+	New    string
+}
+
+func (c Change) String() string {
+	action := c.Action
+	if len(action) == 0 {
+		action = "-"
+	}
+	old := "(unset)"
+	if c.HadOld {
+		old = fmt.Sprintf("%q", c.Old)
+	}
+	switch c.Kind {
+	case ChangeDelete, ChangeUnsetenv:
+		return fmt.Sprintf("%s: %s %s (was %s)", action, c.Kind, c.Name, old)
+	}
+	return fmt.Sprintf("%s: %s %s=%q (was %s)", action, c.Kind, c.Name, c.New, old)
+}
+
+// changes holds the changes of a run, shared by copies of the State.
+type changes struct {
+	mu   sync.Mutex
+	list []Change
+}
+
+// TrackChanges records each change made with State.Set, Delete, Setenv,
+// and Unsetenv for the rest of the run, with the action that made it. The
+// changes are returned by State.Changes. Changes made to State.Env
+// directly are not recorded.
+func TrackChanges() Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		if st.changes == nil {
+			st.changes = &changes{}
+		}
+		return nil
+	})
+}
+
+// Changes returns the changes recorded since TrackChanges. If name is not
+// empty only the changes of that variable are returned.
+func (st *State) Changes(name string) []Change {
+	if st.changes == nil {
+		return nil
+	}
+	st.changes.mu.Lock()
+	defer st.changes.mu.Unlock()
+	var list []Change
+	for _, c := range st.changes.list {
+		if len(name) == 0 || c.Name == name {
+			list = append(list, c)
+		}
+	}
+	return list
+}
+
+// track records a change if TrackChanges is in effect.
+func (st *State) track(kind ChangeKind, name string, old any, hadOld bool, v any) {
+	c := st.changes
+	if c == nil {
+		return
+	}
+	ch := Change{
+		Time:   st.Now(),
+		Action: strings.Join(st.names, "/"),
+		Kind:   kind,
+		Name:   name,
+		HadOld: hadOld,
+	}
+	if hadOld {
+		ch.Old = st.Redact(fmt.Sprint(old))
+	}
+	switch kind {
+	case ChangeSet, ChangeSetenv:
+		ch.New = st.Redact(fmt.Sprint(v))
+	}
+	c.mu.Lock()
+	c.list = append(c.list, ch)
+	c.mu.Unlock()
+}
@@ -0,0 +1,51 @@
+package task
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestTrackChanges(t *testing.T) {
+	st := &State{Env: map[string]string{"OUT": "/tmp"}}
+	st.Set("untracked", 1)
+	st.MarkSecret("hunter2")
+	err := Run(context.Background(), st, NewScript(
+		TrackChanges(),
+		Named("build", NewScript(
+			Named("configure", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+				st.Set("stdout", "a.txt")
+				st.Setenv("OUT", "/build")
+				st.Set("token", "hunter2")
+				return nil
+			})),
+			ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+				st.Set("stdout", 42)
+				st.Delete("untracked")
+				st.Unsetenv("OUT")
+				return nil
+			}),
+		)),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range st.Changes("") {
+		got = append(got, c.String())
+	}
+	want := []string{
+		`build/configure: set stdout="a.txt" (was (unset))`,
+		`build/configure: setenv OUT="/build" (was "/tmp")`,
+		`build/configure: set token="****" (was (unset))`,
+		`build: set stdout="42" (was "a.txt")`,
+		`build: delete untracked (was "1")`,
+		`build: unsetenv OUT (was "/build")`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got\n%q\nwant\n%q", got, want)
+	}
+	if g := st.Changes("stdout"); len(g) != 2 || g[1].New != "42" || g[1].Action != "build" {
+		t.Fatalf("got stdout changes %+v", g)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// ResumeScript creates a script of the actions that saves its progress to
+// the file filename, relative to State.Dir, after each action succeeds.
+// The Env and the State variables that can be encoded as JSON are saved
+// with it, except values that contain a secret. When the script runs and
+// the file exists, the saved Env and variables are restored and the
+// actions that completed are skipped, so a run stopped by a failure or an
+// interrupt continues where it stopped. Restored variables have the types
+// decoded by encoding/json, so a []string is restored as a []any. The file
+// is removed when the script succeeds. No progress is saved in dry-run mode.
+//
+// Rollback and deferred actions added by skipped actions are not restored.
+// If rollback actions undo the work of completed actions, run the script
+// with PolicySkipRollback or PolicySkipRollbackOnCancel.
+func ResumeScript(filename string, a ...Action) Script {
+	sc := &script{checkpoint: filename}
+	sc.list = append(sc.list, a...)
+	return sc
+}
+
+// checkpointFile is the progress of a ResumeScript saved to a file.
+type checkpointFile struct {
+	Step int                        `json:"step"`
+	Env  map[string]string          `json:"env,omitempty"`
+	Vars map[string]json.RawMessage `json:"vars,omitempty"`
+}
+
+// loadCheckpoint restores the progress saved to the checkpoint file, if any.
+func (sc *script) loadCheckpoint(st *State) error {
+	if len(sc.checkpoint) == 0 || DryRun(st) {
+		return nil
+	}
+	fn := st.Filepath(sc.checkpoint)
+	b, err := readFileFS(st.FileSystem(), fn)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	var cp checkpointFile
+	err = json.Unmarshal(b, &cp)
+	if err != nil {
+		return fmt.Errorf("checkpoint %s: %w", fn, err)
+	}
+	if cp.Step < 0 || cp.Step > len(sc.list) {
+		return fmt.Errorf("checkpoint %s: step %d out of range, script has %d actions", fn, cp.Step, len(sc.list))
+	}
+	if len(cp.Env) > 0 && st.Env == nil {
+		st.Env = make(map[string]string, len(cp.Env))
+	}
+	for k, v := range cp.Env {
+		st.Env[k] = v
+	}
+	for k, raw := range cp.Vars {
+		var v any
+		err = json.Unmarshal(raw, &v)
+		if err != nil {
+			return fmt.Errorf("checkpoint %s: variable %q: %w", fn, k, err)
+		}
+		st.Set(k, v)
+	}
+	sc.at = cp.Step
+	st.Logf("resuming from %s at step %d", fn, cp.Step)
+	return nil
+}
+
+// saveCheckpoint saves the progress of the script to the checkpoint file.
+func (sc *script) saveCheckpoint(st *State) error {
+	if len(sc.checkpoint) == 0 || DryRun(st) {
+		return nil
+	}
+	cp := checkpointFile{
+		Step: sc.at,
+		Env:  make(map[string]string, len(st.Env)),
+		Vars: make(map[string]json.RawMessage, len(st.bucket)),
+	}
+	for k, v := range st.Env {
+		if st.Redact(v) != v {
+			continue
+		}
+		cp.Env[k] = v
+	}
+	for k, v := range st.bucket {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			continue
+		}
+		if st.Redact(string(raw)) != string(raw) {
+			continue
+		}
+		cp.Vars[k] = raw
+	}
+	b, err := json.MarshalIndent(cp, "", "\t")
+	if err != nil {
+		return err
+	}
+	fsys := st.FileSystem()
+	fn := st.Filepath(sc.checkpoint)
+	err = ensureDirFS(fsys, fn)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so a crash doesn't corrupt the checkpoint.
+	tmp := fn + ".tmp"
+	err = writeFileFS(fsys, tmp, bytes.NewReader(b), 0600)
+	if err != nil {
+		return err
+	}
+	return fsys.Rename(tmp, fn)
+}
+
+// removeCheckpoint removes the checkpoint file after the script succeeds.
+func (sc *script) removeCheckpoint(st *State) error {
+	if len(sc.checkpoint) == 0 || DryRun(st) {
+		return nil
+	}
+	return st.FileSystem().RemoveAll(st.Filepath(sc.checkpoint))
+}
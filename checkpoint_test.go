@@ -0,0 +1,71 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResumeScript(t *testing.T) {
+	dir := t.TempDir()
+	var log []string
+	fail := true
+	deploy := ResumeScript(".task/deploy.json",
+		ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			log = append(log, "build")
+			st.Set("version", "v1.2.0")
+			st.Set("token", "hunter2")
+			st.MarkSecret("hunter2")
+			st.Setenv("TARGET", "prod")
+			return nil
+		}),
+		ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			log = append(log, "push "+ExpandEnv("${version} $TARGET", st))
+			if fail {
+				return errors.New("network down")
+			}
+			return nil
+		}),
+	)
+	fn := filepath.Join(dir, ".task", "deploy.json")
+
+	err := Run(context.Background(), &State{Dir: dir}, deploy)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "hunter2") {
+		t.Fatalf("checkpoint contains a secret:\n%s", b)
+	}
+
+	fail = false
+	log = nil
+	st := &State{Dir: dir}
+	if err := Run(context.Background(), st, deploy); err != nil {
+		t.Fatal(err)
+	}
+	if g, w := strings.Join(log, ","), "push v1.2.0 prod"; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+	if st.Get("token") != nil {
+		t.Fatalf("secret variable restored: %v", st.Get("token"))
+	}
+	if _, err := os.Stat(fn); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("checkpoint not removed: %v", err)
+	}
+
+	// With no checkpoint the script runs from the start.
+	log = nil
+	if err := Run(context.Background(), &State{Dir: dir}, deploy); err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 2 {
+		t.Fatalf("got %q, want both actions", log)
+	}
+}
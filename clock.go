@@ -0,0 +1,88 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Clock tells the time and waits for durations. Set State.Clock to a fake
+// clock in tests so time-dependent actions, such as watch polling, may be
+// advanced instantly. If State.Clock is nil the system clock is used.
+type Clock interface {
+	Now() time.Time
+	// After returns a channel that receives the time once d has elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func (st *State) clock() Clock {
+	if st.Clock == nil {
+		return systemClock{}
+	}
+	return st.Clock
+}
+
+// Now returns the current time of the State.Clock.
+func (st *State) Now() time.Time {
+	return st.clock().Now()
+}
+
+// Since returns the time elapsed since t on the State.Clock.
+func (st *State) Since(t time.Time) time.Duration {
+	return st.clock().Now().Sub(t)
+}
+
+// Sleep waits for d on the State.Clock. It returns the context error if
+// ctx is done first.
+func (st *State) Sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-st.clock().After(d):
+		return nil
+	}
+}
+
+// Sleep waits for d on the State.Clock, or until the context is canceled.
+// In dry-run mode it does not wait.
+func Sleep(d time.Duration) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		if dryRun(st, "sleep: %v", d) {
+			return nil
+		}
+		return st.Sleep(ctx, d)
+	})
+}
+
+// SleepVar is like Sleep for the duration in the State variable name, a
+// time.Duration or a string such as "1m30s".
+func SleepVar(name VAR) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		v, err := st.MustGet(string(name))
+		if err != nil {
+			return err
+		}
+		var d time.Duration
+		switch v := v.(type) {
+		default:
+			return fmt.Errorf("sleep %q: knows time.Duration and string, unsupported type %T", name, v)
+		case time.Duration:
+			d = v
+		case string:
+			d, err = time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("sleep %q: %w", name, err)
+			}
+		}
+		return Sleep(d).Run(ctx, st, sc)
+	})
+}
@@ -0,0 +1,91 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stoppedClock is a Clock where time does not pass.
+type stoppedClock time.Time
+
+func (c stoppedClock) Now() time.Time { return time.Time(c) }
+
+func (c stoppedClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- time.Time(c)
+	}
+	return ch
+}
+
+func TestClock(t *testing.T) {
+	now := time.Date(2018, 1, 2, 15, 4, 5, 0, time.UTC)
+	var events []Event
+	st := &State{Clock: stoppedClock(now), eventFuncs: []func(e Event){func(e Event) { events = append(events, e) }}}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := Run(ctx, st, Named("wait", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		if err := st.Sleep(ctx, 0); err != nil {
+			return err
+		}
+		return st.Sleep(ctx, time.Second)
+	})))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want deadline exceeded", err)
+	}
+	for _, e := range events {
+		if !e.Time.Equal(now) || e.Duration != 0 {
+			t.Fatalf("got event %+v, want time from clock", e)
+		}
+	}
+}
+
+// recordClock is a Clock that records the waits and returns at once.
+type recordClock struct {
+	waits []time.Duration
+}
+
+func (c *recordClock) Now() time.Time { return time.Time{} }
+
+func (c *recordClock) After(d time.Duration) <-chan time.Time {
+	c.waits = append(c.waits, d)
+	ch := make(chan time.Time, 1)
+	ch <- time.Time{}
+	return ch
+}
+
+func TestSleep(t *testing.T) {
+	c := &recordClock{}
+	st := &State{Clock: c}
+	st.Set("pause", "1m30s")
+	st.Set("short", 2*time.Second)
+	err := Run(context.Background(), st, NewScript(Sleep(time.Second), SleepVar("pause"), SleepVar("short")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := fmt.Sprint(c.waits), "[1s 1m30s 2s]"; g != w {
+		t.Fatalf("got waits %s, want %s", g, w)
+	}
+
+	st.Set("pause", "soon")
+	if err := Run(context.Background(), st, SleepVar("pause")); err == nil || !strings.Contains(err.Error(), `sleep "pause": time: invalid duration`) {
+		t.Fatalf("got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Run(ctx, &State{Clock: stoppedClock{}}, NewScript(Sleep(time.Hour))); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want canceled", err)
+	}
+
+	out := &strings.Builder{}
+	st = &State{Clock: stoppedClock{}, Stdout: out}
+	st.Set(DryRunVar, true)
+	if err := Run(context.Background(), st, Sleep(time.Hour)); err != nil || out.String() != "sleep: 1h0m0s\n" {
+		t.Fatalf("got %q, %v", out, err)
+	}
+}
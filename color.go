@@ -0,0 +1,87 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"fmt"
+	"os"
+)
+
+// Color is an ANSI foreground color.
+type Color int
+
+// Colors used for status lines and prefixes.
+const (
+	Red     Color = 31
+	Green   Color = 32
+	Yellow  Color = 33
+	Blue    Color = 34
+	Magenta Color = 35
+	Cyan    Color = 36
+)
+
+// isTerminal reports if f is a terminal.
+func isTerminal(f *os.File) bool {
+	if f == nil {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// ColorEnabled reports if output to f should be colored: f is a terminal,
+// NO_COLOR is not set, and TERM is not "dumb" in env.
+func ColorEnabled(f *os.File, env map[string]string) bool {
+	if len(env["NO_COLOR"]) > 0 || env["TERM"] == "dumb" {
+		return false
+	}
+	return isTerminal(f)
+}
+
+// Colorize returns text in color c if State.Color is set, or text as is.
+func (st *State) Colorize(c Color, text string) string {
+	if !st.Color {
+		return text
+	}
+	return fmt.Sprintf("\x1b[%dm%s\x1b[0m", int(c), text)
+}
+
+// Status of an operation reported with LogStatus.
+type Status int
+
+// Status values.
+const (
+	StatusOK Status = iota
+	StatusFail
+	StatusSkip
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusOK:
+		return "ok"
+	case StatusFail:
+		return "fail"
+	case StatusSkip:
+		return "skip"
+	}
+	return fmt.Sprintf("status(%d)", int(s))
+}
+
+func (s Status) color() Color {
+	switch s {
+	case StatusOK:
+		return Green
+	case StatusFail:
+		return Red
+	}
+	return Yellow
+}
+
+// LogStatus logs the message starting with the status, such as
+// "ok   build", colored by status if State.Color is set.
+func (st *State) LogStatus(s Status, msg string) {
+	st.Log(st.Colorize(s.color(), fmt.Sprintf("%-4s", s)) + " " + msg)
+}
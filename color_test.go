@@ -0,0 +1,43 @@
+package task
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestColorEnabled(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if ColorEnabled(f, nil) {
+		t.Fatal("expected no color for a file")
+	}
+	if ColorEnabled(nil, nil) {
+		t.Fatal("expected no color for nil")
+	}
+	if ColorEnabled(os.Stdout, map[string]string{"NO_COLOR": "1"}) {
+		t.Fatal("expected NO_COLOR to disable color")
+	}
+}
+
+func TestLogStatus(t *testing.T) {
+	var msgs []string
+	st := &State{MsgLogger: func(msg string) { msgs = append(msgs, msg) }}
+	st.LogStatus(StatusOK, "build")
+	st.Color = true
+	st.LogStatus(StatusFail, "test")
+	st.LogStatus(StatusSkip, "lint")
+	want := []string{
+		"ok   build",
+		"\x1b[31mfail\x1b[0m test",
+		"\x1b[33mskip\x1b[0m lint",
+	}
+	for i, w := range want {
+		if i >= len(msgs) || msgs[i] != w {
+			t.Fatalf("got %q, want %q", msgs, want)
+		}
+	}
+}
@@ -7,6 +7,7 @@ package task
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"strconv"
 	"strings"
@@ -36,7 +37,7 @@ type Flag struct {
 	ENV      string // Optional env var to read from if flag not present.
 	Usage    string
 	Required bool // Required flag, will error if not set.
-	Value    any
+	Value    any  // Pointer to the value to set, or a flag.Value.
 	Default  any
 	Type     FlagType
 	Validate func(v any) error
@@ -46,7 +47,8 @@ type Flag struct {
 type FlagType byte
 
 // FlagType options. If a default is present the flag type may be left as
-// Auto to choose the parse type based on the default type.
+// Auto to choose the parse type based on the default type. FlagValue is
+// chosen if the Value is a flag.Value, which parses the value itself.
 const (
 	FlagAuto FlagType = iota
 	FlagString
@@ -54,17 +56,27 @@ const (
 	FlagInt64
 	FlagFloat64
 	FlagDuration
+	FlagValue
 )
 
-func (ft FlagType) spaceValue() bool {
-	switch ft {
+func (fs *flagStatus) spaceValue() bool {
+	switch fs.flag.Type {
 	default:
 		return true
 	case FlagBool:
 		return false
+	case FlagValue:
+		return !isBoolFlag(fs.flag.Value)
 	}
 }
 
+// isBoolFlag reports if v is a flag.Value of a flag that takes no value,
+// such as "-v".
+func isBoolFlag(v any) bool {
+	b, ok := v.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
 type flagStatus struct {
 	flag *Flag
 	used bool
@@ -75,6 +87,8 @@ func flagType(v any) FlagType {
 	switch v.(type) {
 	default:
 		return FlagAuto
+	case flag.Value:
+		return FlagValue
 	case string, *string:
 		return FlagString
 	case bool, *bool:
@@ -103,6 +117,13 @@ func (fs *flagStatus) init() error {
 	if fl.Type == FlagAuto && fl.Default != nil {
 		fl.Type = flagType(fl.Default)
 	}
+	if fl.Type == FlagValue {
+		if _, ok := fl.Value.(flag.Value); !ok {
+			return fmt.Errorf("invalid flag value %[1]v (%[1]T) for -%[2]s, want a flag.Value", fl.Value, fl.Name)
+		}
+		// The default may be of any type.
+		return nil
+	}
 	if fl.Default != nil {
 		var ok bool
 		switch fl.Type {
@@ -164,7 +185,7 @@ func (fs *flagStatus) init() error {
 				ok = true
 			}
 		case FlagDuration:
-			_, ok = fl.Default.(*time.Duration)
+			_, ok = fl.Value.(*time.Duration)
 		}
 		if !ok {
 			return fmt.Errorf("invalid default flag value %[1]v (%[1]T) for -%[2]s", fl.Default, fl.Name)
@@ -248,6 +269,18 @@ func (fs *flagStatus) set(st *State, vs string, fromENV bool) error {
 			*x = v
 		}
 		setv = v
+	case FlagValue:
+		v := fl.Value.(flag.Value)
+		if vs == "" && isBoolFlag(v) {
+			vs = "true"
+		}
+		if err := v.Set(vs); err != nil {
+			return fmt.Errorf("invalid value %q for -%s: %w", vs, fl.Name, err)
+		}
+		setv = vs
+		if g, ok := v.(flag.Getter); ok {
+			setv = g.Get()
+		}
 	}
 	st.Set(fl.Name, setv)
 	if fl.Validate != nil {
@@ -284,7 +317,7 @@ func (c *Command) Exec(args []string) Action {
 				return err
 			}
 			if len(fs.flag.ENV) > 0 {
-				if v, ok := st.Env[fs.flag.ENV]; ok && len(v) > 0 {
+				if v, ok := st.LookupEnv(fs.flag.ENV); ok && len(v) > 0 {
 					if err := fs.set(st, v, true); err != nil {
 						return err
 					}
@@ -346,7 +379,7 @@ func (c *Command) Exec(args []string) Action {
 			}
 			val := ""
 			if len(nameValue) == 1 {
-				if fl.flag.Type.spaceValue() {
+				if fl.spaceValue() {
 					nextFlag = fl
 					continue
 				}
@@ -6,6 +6,7 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestCommand(t *testing.T) {
@@ -115,6 +116,20 @@ cmder - Example Commander
 	-*f1 - set the current f1 (ghi)
 	-f2 - set the current f2 (nmo)
 	-*f3 [CMDER_F3] - set the current f3 (fhg)
+`,
+		},
+		{
+			Name: "duration-value",
+			Command: &Command{
+				Name: "cmder",
+				Flags: []*Flag{
+					{Name: "timeout", Value: new(time.Duration), Default: time.Second},
+				},
+				Action: showVar,
+			},
+			Args: "-timeout 2s",
+			Output: `
+var timeout = 2s (time.Duration)
 `,
 		},
 	}
@@ -0,0 +1,187 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Sequence runs the actions in order in the current script, stopping at the
+// first error. Unlike a nested Script, rollback and deferred actions added
+// by the actions are added to the current script.
+func Sequence(a ...Action) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		for _, action := range a {
+			if err := sc.RunAction(ctx, st, action); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// try runs a in its own script so its failure does not roll back the
+// current script or set the failure of the state.
+func try(ctx context.Context, st *State, sc Script, a Action) error {
+	failErr, failAction := st.failErr, st.failAction
+	err := NewScript(a).Run(ctx, st, sc)
+	st.failErr, st.failAction = failErr, failAction
+	return err
+}
+
+// Optional runs a and ignores its error, which is logged at LevelDebug.
+// Rollback actions added by a run if it fails. Canceling the context is
+// still reported.
+func Optional(a Action) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		err := try(ctx, st, sc, a)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		st.Debugf("optional: %v", err)
+		return nil
+	})
+}
+
+// Not runs a and inverts the state branch it sets, so BranchTrue becomes
+// BranchFalse and BranchFalse becomes BranchTrue. Other branches are kept.
+func Not(a Action) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		err := sc.RunAction(ctx, st, a)
+		if err != nil {
+			return err
+		}
+		switch st.Branch {
+		case BranchTrue:
+			st.Branch = BranchFalse
+		case BranchFalse:
+			st.Branch = BranchTrue
+		}
+		return nil
+	})
+}
+
+// First runs the actions in order until one succeeds. If all fail the
+// errors are joined and returned.
+func First(a ...Action) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		var errs []error
+		for _, a := range a {
+			err := try(ctx, st, sc, a)
+			if err == nil {
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			errs = append(errs, err)
+		}
+		return errors.Join(errs...)
+	})
+}
+
+// If runs then if cond returns true, otherwise it runs otherwise, which
+// may be nil. It is a simpler Switch for a condition computed in Go.
+func If(cond func(ctx context.Context, st *State) (bool, error), then, otherwise Action) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		ok, err := cond(ctx, st)
+		if err != nil {
+			return err
+		}
+		next := otherwise
+		if ok {
+			next = then
+		}
+		if next == nil {
+			return nil
+		}
+		return sc.RunAction(ctx, st, next)
+	})
+}
+
+// IterationVar is the State variable set by While and ForEach to the
+// number of the current iteration, starting at 0. Its previous value is
+// restored when the loop returns, so loops may be nested.
+const IterationVar = "iteration"
+
+// restoreVar returns a func that sets the State variable name back to its
+// current value, or deletes it if it is not set.
+func restoreVar(st *State, name string) func() {
+	old := st.Get(name)
+	return func() {
+		if old == nil {
+			st.Delete(name)
+			return
+		}
+		st.Set(name, old)
+	}
+}
+
+// While runs cond and, while it sets the state branch to BranchTrue, runs
+// body and then cond again. The branch is reset after cond runs. The loop
+// stops with the context error if the context is canceled.
+func While(cond, body Action) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		defer restoreVar(st, IterationVar)()
+		for i := 0; ; i++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			st.Set(IterationVar, i)
+			if err := sc.RunAction(ctx, st, cond); err != nil {
+				return err
+			}
+			br := st.Branch
+			st.Branch = BranchUnset
+			if br != BranchTrue {
+				return nil
+			}
+			if err := sc.RunAction(ctx, st, body); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// ForEach runs body for each item of the []string or []any stored in the
+// State variable list, setting itemVar to the item and IterationVar to its
+// index before each run.
+func ForEach(list VAR, itemVar string, body Action) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		v, err := st.MustGet(string(list))
+		if err != nil {
+			return err
+		}
+		var items []any
+		switch v := v.(type) {
+		default:
+			return fmt.Errorf("for each %q: knows []string and []any, unsupported type %T", list, v)
+		case []any:
+			items = v
+		case []string:
+			items = make([]any, len(v))
+			for i, s := range v {
+				items[i] = s
+			}
+		}
+		defer restoreVar(st, IterationVar)()
+		for i, item := range items {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			st.Set(IterationVar, i)
+			st.Set(itemVar, item)
+			if err := sc.RunAction(ctx, st, body); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
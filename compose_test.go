@@ -0,0 +1,191 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCompose(t *testing.T) {
+	var log []string
+	step := func(name string, err error) Action {
+		return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			log = append(log, name)
+			return err
+		})
+	}
+	fail := errors.New("fail")
+	run := func(a Action) (*State, error) {
+		log = nil
+		st := &State{}
+		return st, Run(context.Background(), st, a)
+	}
+
+	// Rollback added in a Sequence belongs to the enclosing script.
+	_, err := run(NewScript(
+		Sequence(step("a", nil), Rollback(step("undo a", nil))),
+		step("b", fail),
+	))
+	if !errors.Is(err, fail) || strings.Join(log, ",") != "a,b,undo a" {
+		t.Fatalf("sequence: got %v, log %q", err, log)
+	}
+
+	st, err := run(NewScript(
+		Optional(NewScript(Rollback(step("undo x", nil)), step("x", fail))),
+		step("y", nil),
+	))
+	if err != nil || strings.Join(log, ",") != "x,undo x,y" {
+		t.Fatalf("optional: got %v, log %q", err, log)
+	}
+	if _, ferr := st.Failure(); ferr != nil {
+		t.Fatalf("optional: got failure %v", ferr)
+	}
+
+	_, err = run(First(step("x", fail), step("y", nil), step("z", nil)))
+	if err != nil || strings.Join(log, ",") != "x,y" {
+		t.Fatalf("first: got %v, log %q", err, log)
+	}
+	_, err = run(First(step("x", fail), step("y", errors.New("other"))))
+	if g, w := err.Error(), "fail\nother"; !errors.Is(err, fail) || g != w {
+		t.Fatalf("first: got %q, want %q", g, w)
+	}
+
+	for _, tc := range []struct{ in, want Branch }{
+		{BranchTrue, BranchFalse},
+		{BranchFalse, BranchTrue},
+		{BranchCommit, BranchCommit},
+	} {
+		st, err := run(Not(ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			st.Branch = tc.in
+			return nil
+		})))
+		if err != nil || st.Branch != tc.want {
+			t.Fatalf("not %v: got %v, %v", tc.in, st.Branch, err)
+		}
+	}
+}
+
+func TestIf(t *testing.T) {
+	var got string
+	set := func(s string) Action {
+		return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			got = s
+			return nil
+		})
+	}
+	isProd := func(ctx context.Context, st *State) (bool, error) {
+		env, ok := st.Get("env").(string)
+		if !ok {
+			return false, errors.New("env not set")
+		}
+		return env == "prod", nil
+	}
+	for _, tc := range []struct {
+		env       any
+		otherwise Action
+		want      string
+	}{
+		{"prod", set("else"), "then"},
+		{"dev", set("else"), "else"},
+		{"dev", nil, ""},
+	} {
+		got = ""
+		st := &State{}
+		st.Set("env", tc.env)
+		if err := Run(context.Background(), st, If(isProd, set("then"), tc.otherwise)); err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Fatalf("env %v: got %q, want %q", tc.env, got, tc.want)
+		}
+	}
+	err := Run(context.Background(), &State{}, If(isProd, set("then"), nil))
+	if err == nil || err.Error() != "env not set" {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestWhile(t *testing.T) {
+	lessThan := func(n int) Action {
+		return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			if st.Get(IterationVar).(int) < n {
+				st.Branch = BranchTrue
+			}
+			return nil
+		})
+	}
+	var seen []int
+	body := ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		seen = append(seen, st.Get(IterationVar).(int))
+		return nil
+	})
+	st := &State{}
+	if err := Run(context.Background(), st, While(lessThan(3), body)); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 3 || seen[2] != 2 || st.Branch != BranchUnset {
+		t.Fatalf("got iterations %v, branch %v", seen, st.Branch)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := Run(ctx, &State{}, While(lessThan(1000), ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		if st.Get(IterationVar).(int) == 5 {
+			cancel()
+		}
+		return nil
+	})))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want canceled", err)
+	}
+}
+
+func TestForEach(t *testing.T) {
+	var got []string
+	build := ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		got = append(got, fmt.Sprintf("%d:%s", st.Get(IterationVar), ExpandEnv("${goos}", st)))
+		return nil
+	})
+	st := &State{}
+	st.Set("platforms", []string{"linux", "darwin", "windows"})
+	if err := Run(context.Background(), st, ForEach("platforms", "goos", build)); err != nil {
+		t.Fatal(err)
+	}
+	if g, w := strings.Join(got, ","), "0:linux,1:darwin,2:windows"; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+
+	got = nil
+	st.Set("platforms", []any{"plan9"})
+	if err := Run(context.Background(), st, ForEach("platforms", "goos", build)); err != nil || len(got) != 1 {
+		t.Fatalf("got %q, %v", got, err)
+	}
+
+	st.Set("platforms", "linux")
+	err := Run(context.Background(), st, ForEach("platforms", "goos", build))
+	if g, w := fmt.Sprint(err), `for each "platforms": knows []string and []any, unsupported type string`; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+	var verr *VarError
+	if err := Run(context.Background(), &State{}, ForEach("platforms", "goos", build)); !errors.As(err, &verr) {
+		t.Fatalf("got %v, want *VarError", err)
+	}
+
+	// A nested loop restores the iteration of the outer loop.
+	got = nil
+	st = &State{}
+	st.Set("platforms", []string{"linux", "darwin"})
+	st.Set("arches", []string{"amd64", "arm64"})
+	inner := ForEach("arches", "goarch", Sequence())
+	outer := ForEach("platforms", "goos", Sequence(inner, build))
+	if err := Run(context.Background(), st, outer); err != nil {
+		t.Fatal(err)
+	}
+	if g, w := strings.Join(got, ","), "0:linux,1:darwin"; g != w {
+		t.Fatalf("nested: got %q, want %q", g, w)
+	}
+	if v := st.Get(IterationVar); v != nil {
+		t.Fatalf("got iteration %v after the loop, want unset", v)
+	}
+}
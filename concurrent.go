@@ -0,0 +1,119 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// goCopy returns a copy of st to run an action concurrently with others,
+// with writes to stdout and stderr serialized by mu.
+func goCopy(st *State, mu *sync.Mutex) *State {
+	cst := st.copy()
+	cst.Stdout = &teeWriter{mu: mu, w: st.Stdout}
+	cst.Stderr = &teeWriter{mu: mu, w: st.Stderr}
+	return cst
+}
+
+// Race runs the actions concurrently, each on a copy of the State, and
+// returns when the first succeeds, canceling the others. The Env and
+// variables of the action that succeeded are kept. If all fail the errors
+// are joined and returned.
+func Race(a ...Action) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		type result struct {
+			i   int
+			st  *State
+			err error
+		}
+		results := make(chan result, len(a))
+		mu := &sync.Mutex{}
+		for i, a := range a {
+			cst := goCopy(st, mu)
+			go func(i int, a Action) {
+				results <- result{i: i, st: cst, err: Run(ctx, cst, a)}
+			}(i, a)
+		}
+		var winner *State
+		errs := make([]error, len(a))
+		for range a {
+			r := <-results
+			switch {
+			case r.err != nil:
+				errs[r.i] = r.err
+			case winner == nil:
+				winner = r.st
+				cancel()
+			}
+		}
+		if winner == nil {
+			return errors.Join(errs...)
+		}
+		st.Env, st.bucket = winner.Env, winner.bucket
+		return nil
+	})
+}
+
+// Limit runs the actions concurrently, each on a copy of the State, with
+// at most n running at once. If n is less than one all run at once. The
+// first failure cancels the actions still running or waiting to run, and
+// the errors of the failed actions are joined and returned. If ctx is
+// canceled first, its error is returned. Changes to the variables and Env
+// of the copies are not kept.
+func Limit(n int, a ...Action) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		limit := n
+		if limit < 1 {
+			limit = len(a)
+		}
+		parent := ctx
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		sem := make(chan struct{}, limit)
+		mu := &sync.Mutex{}
+		errs := make([]error, len(a))
+		wg := &sync.WaitGroup{}
+		for i, a := range a {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			cst := goCopy(st, mu)
+			wg.Add(1)
+			go func(i int, a Action) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				if err := Run(ctx, cst, a); err != nil {
+					errs[i] = err
+					cancel()
+				}
+			}(i, a)
+		}
+		wg.Wait()
+		// Leave out the errors of actions canceled by the first failure.
+		var failed []error
+		for _, err := range errs {
+			if err != nil && !errors.Is(err, context.Canceled) {
+				failed = append(failed, err)
+			}
+		}
+		if len(failed) > 0 {
+			return errors.Join(failed...)
+		}
+		if err := parent.Err(); err != nil {
+			return err
+		}
+		return errors.Join(errs...)
+	})
+}
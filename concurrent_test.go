@@ -0,0 +1,141 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRace(t *testing.T) {
+	mirror := func(name string, err error, block bool) Action {
+		return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			fmt.Fprintf(st.Stdout, "try %s\n", name)
+			if block {
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			if err != nil {
+				return err
+			}
+			st.Set("mirror", name)
+			return nil
+		})
+	}
+	out := &strings.Builder{}
+	st := &State{Stdout: out}
+	err := Run(context.Background(), st, Race(
+		mirror("slow", nil, true),
+		mirror("down", errors.New("down"), false),
+		mirror("fast", nil, false),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := st.Get("mirror"); g != "fast" {
+		t.Fatalf("got mirror %v, want fast", g)
+	}
+	// Actions may be canceled before they start.
+	if !strings.Contains(out.String(), "try fast\n") {
+		t.Fatalf("got output %q", out)
+	}
+
+	err = Run(context.Background(), &State{}, Race(
+		mirror("a", errors.New("a failed"), false),
+		mirror("b", errors.New("b failed"), false),
+	))
+	if g, w := fmt.Sprint(err), "a failed\nb failed"; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	var mu sync.Mutex
+	running, peak, done := 0, 0, 0
+	work := ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		running--
+		done++
+		mu.Unlock()
+		return nil
+	})
+	list := make([]Action, 10)
+	for i := range list {
+		list[i] = work
+	}
+	if err := Run(context.Background(), &State{}, Limit(3, list...)); err != nil {
+		t.Fatal(err)
+	}
+	if peak > 3 || done != 10 {
+		t.Fatalf("got peak %d, done %d", peak, done)
+	}
+
+	fail := errors.New("fail")
+	block := ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	failing := ActionFunc(func(ctx context.Context, st *State, sc Script) error { return fail })
+	err := Run(context.Background(), &State{}, Limit(2, block, failing, block, block))
+	if g := fmt.Sprint(err); !errors.Is(err, fail) || g != "fail" {
+		t.Fatalf("got %q, want fail", g)
+	}
+
+	// Canceling ctx before the rest start returns the ctx error.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		cancel()
+		return nil
+	})
+	err = Run(ctx, &State{}, Limit(1, stop, work, work))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context canceled", err)
+	}
+}
+
+// growNames runs nested Named actions, leaving spare capacity in the
+// running names of st, so concurrent copies of st that run Named actions
+// race under -race if they share it.
+func growNames(t *testing.T, st *State) {
+	t.Helper()
+	noop := ActionFunc(func(ctx context.Context, st *State, sc Script) error { return nil })
+	if err := Run(context.Background(), st, Named("a", NewScript(Named("b", NewScript(Named("c", noop)))))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLimitNamed(t *testing.T) {
+	noop := ActionFunc(func(ctx context.Context, st *State, sc Script) error { return nil })
+	st := &State{}
+	growNames(t, st)
+	err := Run(context.Background(), st, Named("all", Limit(0,
+		Named("x", noop), Named("y", noop), Named("z", noop),
+	)))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRaceNamed(t *testing.T) {
+	wait := ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	st := &State{}
+	growNames(t, st)
+	err := Run(context.Background(), st, Named("all", Race(
+		Named("x", wait), Named("y", wait), Named("z", wait),
+	)))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DiagramFormat is the output format of WriteDiagram.
+type DiagramFormat int
+
+// Diagram formats.
+const (
+	DOT     DiagramFormat = iota // Graphviz DOT.
+	Mermaid                      // Mermaid flowchart.
+)
+
+// diagram is a graph of nodes, which may be groups of nodes, and edges.
+type diagram struct {
+	n     int
+	nodes []*diagramNode
+	edges [][2]string
+}
+
+type diagramNode struct {
+	id    string
+	label string
+	group []*diagramNode // Set for a group.
+}
+
+func (d *diagram) node(parent *[]*diagramNode, label string) *diagramNode {
+	d.n++
+	n := &diagramNode{id: "n" + strconv.Itoa(d.n), label: label}
+	*parent = append(*parent, n)
+	return n
+}
+
+// action adds the nodes of a, run in order, to parent and returns the ids
+// of the first and last nodes run, or empty strings if there are none.
+// Steps of a Script are joined in order. A Named Script is a group.
+func (d *diagram) action(parent *[]*diagramNode, a Action) (first, last string) {
+	switch v := a.(type) {
+	case *script:
+		for _, step := range v.list {
+			f, l := d.action(parent, step)
+			if len(f) == 0 {
+				continue
+			}
+			if len(last) > 0 {
+				d.edges = append(d.edges, [2]string{last, f})
+			}
+			if len(first) == 0 {
+				first = f
+			}
+			last = l
+		}
+		return first, last
+	case *namedAction:
+		if sc, ok := v.a.(*script); ok {
+			g := d.node(parent, v.name)
+			g.group = []*diagramNode{}
+			first, last = d.action(&g.group, sc)
+			if len(first) == 0 {
+				g.group = nil
+				return g.id, g.id
+			}
+			return first, last
+		}
+		n := d.node(parent, v.name)
+		return n.id, n.id
+	case nil:
+		return "", ""
+	}
+	n := d.node(parent, "action")
+	return n.id, n.id
+}
+
+// WriteDiagram writes the structure of v to w without running it, in
+// the format f. The value v may be:
+//   - an Action, whose Script steps are drawn in order, with Named actions
+//     labeled by name and Named Scripts drawn as groups. Other actions are
+//     labeled "action" as their steps are not known until run.
+//   - a *Registry, with an edge from each dependency to the task.
+//   - a *Command, with an edge from each command to its sub-commands. Each
+//     command is labeled with its name, usage, and flags, one per line.
+func WriteDiagram(w io.Writer, f DiagramFormat, v any) error {
+	d := &diagram{}
+	switch v := v.(type) {
+	default:
+		return fmt.Errorf("diagram: unsupported type %T", v)
+	case *Registry:
+		ids := map[string]string{}
+		tasks := v.Tasks()
+		for _, t := range tasks {
+			ids[t.Name] = d.node(&d.nodes, t.Name).id
+		}
+		for _, t := range tasks {
+			for _, dep := range t.Deps {
+				id, ok := ids[dep]
+				if !ok {
+					id = d.node(&d.nodes, dep+" (missing)").id
+					ids[dep] = id
+				}
+				d.edges = append(d.edges, [2]string{id, ids[t.Name]})
+			}
+		}
+	case *Command:
+		var add func(c *Command) string
+		add = func(c *Command) string {
+			id := d.node(&d.nodes, commandLabel(c)).id
+			for _, sub := range c.Commands {
+				d.edges = append(d.edges, [2]string{id, add(sub)})
+			}
+			return id
+		}
+		add(v)
+	case Action:
+		d.action(&d.nodes, v)
+	}
+	buf := &strings.Builder{}
+	switch f {
+	default:
+		return fmt.Errorf("diagram: unknown format %d", f)
+	case DOT:
+		buf.WriteString("digraph {\n")
+		writeDOT(buf, d.nodes, "\t")
+		for _, e := range d.edges {
+			fmt.Fprintf(buf, "\t%s -> %s;\n", e[0], e[1])
+		}
+		buf.WriteString("}\n")
+	case Mermaid:
+		buf.WriteString("flowchart TD\n")
+		writeMermaid(buf, d.nodes, "\t")
+		for _, e := range d.edges {
+			fmt.Fprintf(buf, "\t%s --> %s\n", e[0], e[1])
+		}
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+// commandLabel returns the name of c followed by its usage and flags, if any,
+// on separate lines.
+func commandLabel(c *Command) string {
+	lines := []string{c.Name}
+	if len(c.Usage) > 0 {
+		lines = append(lines, c.Usage)
+	}
+	if len(c.Flags) > 0 {
+		names := make([]string, len(c.Flags))
+		for i, fl := range c.Flags {
+			names[i] = "-" + fl.Name
+		}
+		lines = append(lines, strings.Join(names, " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func writeDOT(buf *strings.Builder, nodes []*diagramNode, indent string) {
+	for _, n := range nodes {
+		if n.group == nil {
+			fmt.Fprintf(buf, "%s%s [label=%s];\n", indent, n.id, strconv.Quote(n.label))
+			continue
+		}
+		fmt.Fprintf(buf, "%ssubgraph cluster_%s {\n%s\tlabel=%s;\n", indent, n.id, indent, strconv.Quote(n.label))
+		writeDOT(buf, n.group, indent+"\t")
+		fmt.Fprintf(buf, "%s}\n", indent)
+	}
+}
+
+func writeMermaid(buf *strings.Builder, nodes []*diagramNode, indent string) {
+	for _, n := range nodes {
+		label := strings.ReplaceAll(n.label, `"`, "#quot;")
+		label = `"` + strings.ReplaceAll(label, "\n", "<br>") + `"`
+		if n.group == nil {
+			fmt.Fprintf(buf, "%s%s[%s]\n", indent, n.id, label)
+			continue
+		}
+		fmt.Fprintf(buf, "%ssubgraph %s [%s]\n", indent, n.id, label)
+		writeMermaid(buf, n.group, indent+"\t")
+		fmt.Fprintf(buf, "%send\n", indent)
+	}
+}
@@ -0,0 +1,94 @@
+package task
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestWriteDiagram(t *testing.T) {
+	step := ActionFunc(func(ctx context.Context, st *State, sc Script) error { return nil })
+	sc := NewScript(
+		Named("build", step),
+		Named("deploy", NewScript(
+			Named("push", step),
+			step,
+		)),
+		Named("notify", step),
+	)
+	buf := &strings.Builder{}
+	if err := WriteDiagram(buf, DOT, sc); err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph {
+	n1 [label="build"];
+	subgraph cluster_n2 {
+		label="deploy";
+		n3 [label="push"];
+		n4 [label="action"];
+	}
+	n5 [label="notify"];
+	n3 -> n4;
+	n1 -> n3;
+	n4 -> n5;
+}
+`
+	if g := buf.String(); g != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", g, want)
+	}
+
+	buf.Reset()
+	if err := WriteDiagram(buf, Mermaid, sc); err != nil {
+		t.Fatal(err)
+	}
+	want = `flowchart TD
+	n1["build"]
+	subgraph n2 ["deploy"]
+		n3["push"]
+		n4["action"]
+	end
+	n5["notify"]
+	n3 --> n4
+	n1 --> n3
+	n4 --> n5
+`
+	if g := buf.String(); g != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", g, want)
+	}
+
+	r := &Registry{}
+	r.Register("build", step)
+	r.Register("test", step).Deps = []string{"build"}
+	buf.Reset()
+	if err := WriteDiagram(buf, Mermaid, r); err != nil {
+		t.Fatal(err)
+	}
+	want = "flowchart TD\n\tn1[\"build\"]\n\tn2[\"test\"]\n\tn1 --> n2\n"
+	if g := buf.String(); g != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", g, want)
+	}
+
+	buf.Reset()
+	cmd := &Command{Name: "root", Commands: []*Command{{Name: "a"}, {Name: "b"}}}
+	if err := WriteDiagram(buf, DOT, cmd); err != nil {
+		t.Fatal(err)
+	}
+	if g := buf.String(); !strings.Contains(g, "n1 -> n2;\n\tn1 -> n3;\n") {
+		t.Fatalf("got:\n%s", g)
+	}
+
+	cmd.Commands[0].Usage = "Build the binaries."
+	cmd.Commands[0].Flags = []*Flag{{Name: "os"}, {Name: "arch"}}
+	for f, want := range map[DiagramFormat]string{
+		DOT:     `n2 [label="a\nBuild the binaries.\n-os -arch"];`,
+		Mermaid: `n2["a<br>Build the binaries.<br>-os -arch"]`,
+	} {
+		buf.Reset()
+		if err := WriteDiagram(buf, f, cmd); err != nil {
+			t.Fatal(err)
+		}
+		if g := buf.String(); !strings.Contains(g, want) {
+			t.Fatalf("got:\n%s\nwant line %s", g, want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// diffContext is the number of unchanged lines shown around changes.
+const diffContext = 3
+
+// maxDiffCells limits the size of the line comparison table. Larger files
+// are shown as replaced in full.
+const maxDiffCells = 4 << 20
+
+// UnifiedDiff returns the unified diff of the lines of a and b, labeled
+// with the names, or an empty string if they are equal.
+func UnifiedDiff(aName, bName string, a, b []byte) string {
+	if bytes.Equal(a, b) {
+		return ""
+	}
+	al, bl := splitLines(a), splitLines(b)
+	ops := diffLines(al, bl)
+
+	buf := &strings.Builder{}
+	fmt.Fprintf(buf, "--- %s\n+++ %s\n", aName, bName)
+	// Each op is an equal (' '), removed ('-'), or added ('+') line.
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		// Find the end of the hunk: the changes until diffContext*2
+		// equal lines in a row.
+		start := max(i-diffContext, 0)
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+				continue
+			}
+			if j-end >= diffContext*2 {
+				break
+			}
+		}
+		end = min(end+diffContext, len(ops))
+
+		aStart, bStart := ops[start].a, ops[start].b
+		var aCount, bCount int
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+		for _, op := range ops[start:end] {
+			buf.WriteByte(op.kind)
+			buf.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+	return buf.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprint(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func splitLines(b []byte) []string {
+	lines := strings.SplitAfter(string(b), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+type diffOp struct {
+	kind byte
+	line string
+	a, b int // Line index in a and b before the op.
+}
+
+// diffLines returns the edit script from a to b using the longest common
+// subsequence of lines.
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	var lcs [][]int32
+	if n*m <= maxDiffCells {
+		lcs = make([][]int32, n+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, m+1)
+		}
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+	}
+	var ops []diffOp
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case lcs != nil && i < n && j < m && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i], i, j})
+			i++
+			j++
+		case i < n && (j == m || lcs == nil || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', a[i], i, j})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j], i, j})
+			j++
+		}
+	}
+	return ops
+}
+
+// dryRunWrite writes the plan line and, if the state is in dry-run mode,
+// the diff of the current content of the file fn to the new content.
+// It returns true if the state is in dry-run mode.
+func dryRunWrite(st *State, fn string, perm os.FileMode, content []byte) bool {
+	if !dryRun(st, "write: %s (%v)", fn, perm) || st.Stdout == nil {
+		return DryRun(st)
+	}
+	old, err := readFileFS(st.FileSystem(), fn)
+	aName := fn
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		aName = "/dev/null"
+	case err != nil:
+		fmt.Fprintf(st.Stdout, "\t(%v)\n", err)
+		return true
+	}
+	var msg string
+	switch {
+	case bytes.Equal(old, content):
+		msg = "\t(unchanged)\n"
+	case isBinary(old) || isBinary(content):
+		msg = "\t(binary content differs)\n"
+	default:
+		msg = UnifiedDiff(aName, fn, old, content)
+	}
+	fmt.Fprint(st.Stdout, st.Redact(msg))
+	return true
+}
+
+func isBinary(b []byte) bool {
+	return bytes.IndexByte(b, 0) >= 0 || !utf8.Valid(b)
+}
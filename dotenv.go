@@ -0,0 +1,116 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ReadDotenv reads the KEY=VALUE lines of a dotenv file. Blank lines and
+// lines starting with "#" are ignored, and a leading "export " is allowed.
+// Double quoted values are unquoted like Go strings, single quoted values
+// are used as is.
+func ReadDotenv(filename string) (map[string]string, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDotenv(b)
+}
+
+// ParseDotenv parses the content of a dotenv file. See ReadDotenv.
+func ParseDotenv(b []byte) (map[string]string, error) {
+	env := make(map[string]string)
+	s := bufio.NewScanner(bytes.NewReader(b))
+	n := 0
+	for s.Scan() {
+		n++
+		line := strings.TrimSpace(s.Text())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		k, v, ok := strings.Cut(line, "=")
+		k = strings.TrimSpace(k)
+		if !ok || len(k) == 0 {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", n)
+		}
+		v = strings.TrimSpace(v)
+		var rest string
+		switch {
+		case strings.HasPrefix(v, `"`):
+			q, err := strconv.QuotedPrefix(v)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			rest = v[len(q):]
+			v, _ = strconv.Unquote(q)
+		case strings.HasPrefix(v, "'"):
+			i := strings.IndexByte(v[1:], '\'')
+			if i < 0 {
+				return nil, fmt.Errorf("line %d: unterminated quote", n)
+			}
+			rest = v[i+2:]
+			v = v[1 : i+1]
+		default:
+			// Allow a trailing comment on unquoted values.
+			if i := strings.Index(v, " #"); i >= 0 {
+				v = strings.TrimSpace(v[:i])
+			}
+		}
+		if rest = strings.TrimSpace(rest); len(rest) > 0 && rest[0] != '#' {
+			return nil, fmt.Errorf("line %d: unexpected %q after value", n, rest)
+		}
+		env[k] = v
+	}
+	return env, s.Err()
+}
+
+// taskEnv returns the env to run t with. The dotenv files are read in order,
+// then the task Env is applied, each overriding the values before it.
+// Missing dotenv files are ignored. Task Env values are expanded with
+// ExpandEnv in key order against the env built so far.
+func taskEnv(st *State, t *Task) (map[string]string, error) {
+	env := make(map[string]string, len(st.Env)+len(t.Env))
+	for k, v := range st.Env {
+		env[k] = v
+	}
+	// Set values with Setenv, so names differing only in case replace
+	// each other on Windows.
+	expand := &State{Env: env, bucket: st.bucket}
+	for _, fn := range t.Dotenv {
+		m, err := ReadDotenv(st.Filepath(fn))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("dotenv %s: %w", fn, err)
+		}
+		for k, v := range m {
+			expand.Setenv(k, v)
+		}
+	}
+	keys := make([]string, 0, len(t.Env))
+	for k := range t.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v, err := ExpandEnvErr(t.Env[k], expand)
+		if err != nil {
+			return nil, err
+		}
+		expand.Setenv(k, v)
+	}
+	return env, nil
+}
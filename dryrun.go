@@ -0,0 +1,62 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DryRunVar is the State variable that, when set to true, makes Exec and
+// the file actions write what they would do to State.Stdout rather then
+// doing it. Arguments are shown fully expanded, so the output may be
+// reviewed as a plan. Commands from a Registry set it with the "-dry-run" flag.
+const DryRunVar = "dry-run"
+
+// DryRun reports if the state is in dry-run mode.
+func DryRun(st *State) bool {
+	dry, _ := st.Get(DryRunVar).(bool)
+	return dry
+}
+
+// dryRun writes the formatted plan line to stdout and returns true if the
+// state is in dry-run mode. The line, formatted as "op: detail", is also
+// emitted as an EventOp.
+func dryRun(st *State, f string, v ...any) bool {
+	if st.emitting() {
+		op, detail, _ := strings.Cut(fmt.Sprintf(f, v...), ": ")
+		st.emit(Event{Type: EventOp, Op: op, Detail: detail})
+	}
+	if !DryRun(st) {
+		return false
+	}
+	if st.Stdout != nil {
+		io.WriteString(st.Stdout, st.Redact(fmt.Sprintf(f+"\n", v...)))
+	}
+	return true
+}
+
+// DryRunf is the dry-run check of the file actions, for actions of other
+// packages. If the state is in dry-run mode, it writes the formatted plan
+// line, such as "upload: a.txt -> s3://bucket/a.txt", to State.Stdout and
+// returns true. The line is also emitted as an EventOp.
+func DryRunf(st *State, f string, v ...any) bool {
+	return dryRun(st, f, v...)
+}
+
+// quoteArgs joins the arguments with spaces, quoting any argument that
+// is empty or contains white space or quotes.
+func quoteArgs(args []string) string {
+	list := make([]string, len(args))
+	for i, a := range args {
+		if len(a) == 0 || strings.ContainsAny(a, " \t\r\n\"'\\") {
+			a = strconv.Quote(a)
+		}
+		list[i] = a
+	}
+	return strings.Join(list, " ")
+}
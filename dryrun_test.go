@@ -0,0 +1,93 @@
+package task
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	dir := t.TempDir()
+	r := &Registry{}
+	r.Register("release", NewScript(
+		Env("OUT=bin/app"),
+		Exec("go", "build", "-o", "${OUT}", "-ldflags", "-X main.v=1"),
+		WriteFile("${OUT}.txt", 0600, "built"),
+		Move("${OUT}", "dist/app"),
+		Delete("bin"),
+	))
+	stdout := &strings.Builder{}
+	st := &State{Dir: dir, Stdout: stdout}
+	err := Run(context.Background(), st, r.Command("r", "").Exec([]string{"-dry-run", "release"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "" +
+		"exec: go build -o bin/app -ldflags \"-X main.v=1\" (in " + dir + ")\n" +
+		"write: " + filepath.Join(dir, "bin/app.txt") + " (-rw-------)\n" +
+		"--- /dev/null\n" +
+		"+++ " + filepath.Join(dir, "bin/app.txt") + "\n" +
+		"@@ -0,0 +1 @@\n" +
+		"+built\n" +
+		"\\ No newline at end of file\n" +
+		"move: " + filepath.Join(dir, "bin/app") + " -> " + filepath.Join(dir, "dist/app") + "\n" +
+		"delete: " + filepath.Join(dir, "bin") + "\n"
+	if g := stdout.String(); g != want {
+		t.Fatalf("got %q, want %q", g, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bin")); !os.IsNotExist(err) {
+		t.Fatalf("dry run created files: %v", err)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	b := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n"
+	want := `--- a
++++ b
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -10,3 +10,4 @@
+ 10
+ 11
+ 12
++13
+`
+	if g := UnifiedDiff("a", "b", []byte(a), []byte(b)); g != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", g, want)
+	}
+	if g := UnifiedDiff("a", "b", []byte(a), []byte(a)); g != "" {
+		t.Fatalf("expected no diff, got %q", g)
+	}
+}
+
+func TestDryRunWriteDiff(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "app.conf")
+	os.WriteFile(fn, []byte("port=80\nhost=a\n"), 0600)
+	stdout := &strings.Builder{}
+	st := &State{Dir: dir, Stdout: stdout}
+	st.Set(DryRunVar, true)
+	st.Set("conf", "port=8080\nhost=a\n")
+	err := Run(context.Background(), st, NewScript(
+		WriteFile("app.conf", 0600, VAR("conf")),
+		WriteFile("app.conf", 0600, []byte("port=80\nhost=a\n")),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "write: " + fn + " (-rw-------)\n" +
+		"--- " + fn + "\n+++ " + fn + "\n@@ -1,2 +1,2 @@\n-port=80\n+port=8080\n host=a\n" +
+		"write: " + fn + " (-rw-------)\n\t(unchanged)\n"
+	if g := stdout.String(); g != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", g, want)
+	}
+}
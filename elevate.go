@@ -0,0 +1,34 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrElevation is returned by Exec in an Elevated action when the command
+// cannot be run with elevated privileges.
+var ErrElevation = errors.New("elevation unavailable")
+
+// Elevated runs a with the commands run by Exec elevated to root or
+// Administrator, if the process is not already.
+//
+// On Unix commands are run with sudo. If there is no terminal to ask for a
+// password, as in CI, sudo is run with -n, and an error wrapping
+// ErrElevation is returned if it needs a password. Sudo may reset the
+// environment of the command, depending on its configuration.
+//
+// On Windows commands are started with a UAC prompt. The output of an
+// elevated command is not captured, as it runs in its own window.
+func Elevated(a Action) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		orig := st.elevated
+		st.elevated = true
+		err := sc.RunAction(ctx, st, a)
+		st.elevated = orig
+		return err
+	})
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"runtime"
+	"strings"
+)
+
+// envFold is set if environment variable names are case-insensitive.
+var envFold = runtime.GOOS == "windows"
+
+// LookupEnv returns the value of the variable key in State.Env and if it
+// is present. On Windows, where variable names are case-insensitive, a
+// variable is found if its name differs only in case, such as "Path" for
+// "PATH".
+func (st *State) LookupEnv(key string) (string, bool) {
+	return envValue(st.Env, key, envFold)
+}
+
+// Getenv returns the value of the variable key in State.Env like
+// LookupEnv, or an empty string if it is not present.
+func (st *State) Getenv(key string) string {
+	v, _ := st.LookupEnv(key)
+	return v
+}
+
+// Setenv sets the variable key in State.Env. On Windows a variable whose
+// name differs only in case is replaced, keeping the name it had, so it is
+// passed to child processes once.
+func (st *State) Setenv(key, value string) {
+	if st.Env == nil {
+		st.Env = make(map[string]string)
+	}
+	if envFold {
+		if _, ok := st.Env[key]; !ok {
+			for k := range st.Env {
+				if strings.EqualFold(k, key) {
+					key = k
+					break
+				}
+			}
+		}
+	}
+	if st.changes != nil {
+		old, had := st.Env[key]
+		st.track(ChangeSetenv, key, old, had, value)
+	}
+	st.Env[key] = value
+}
+
+// Unsetenv removes the variable key from State.Env. On Windows variables
+// whose name differs only in case are removed too.
+func (st *State) Unsetenv(key string) {
+	if st.changes != nil {
+		old, had := st.LookupEnv(key)
+		st.track(ChangeUnsetenv, key, old, had, nil)
+	}
+	delete(st.Env, key)
+	if !envFold {
+		return
+	}
+	for k := range st.Env {
+		if strings.EqualFold(k, key) {
+			delete(st.Env, k)
+		}
+	}
+}
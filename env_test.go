@@ -0,0 +1,31 @@
+package task
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEnvFold(t *testing.T) {
+	defer func(fold bool) { envFold = fold }(envFold)
+	for _, fold := range []bool{false, true} {
+		envFold = fold
+		st := &State{Env: map[string]string{"Path": "/bin"}}
+		err := Run(context.Background(), st, Env("PATH=${PATH}:/usr/bin", "home=/root"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fold {
+			if len(st.Env) != 2 || st.Env["Path"] != "/bin:/usr/bin" || st.Getenv("HOME") != "/root" {
+				t.Fatalf("fold: got %v", st.Env)
+			}
+			st.Unsetenv("path")
+			if _, ok := st.LookupEnv("PATH"); ok {
+				t.Fatalf("fold: got %v after unset", st.Env)
+			}
+			continue
+		}
+		if len(st.Env) != 3 || st.Env["Path"] != "/bin" || st.Env["PATH"] != ":/usr/bin" || st.Getenv("HOME") != "" {
+			t.Fatalf("got %v", st.Env)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventType is the kind of a run Event.
+type EventType string
+
+// Event types.
+const (
+	EventStart  EventType = "start"  // A Named action started.
+	EventFinish EventType = "finish" // A Named action finished, Err is set if it failed.
+	EventOp     EventType = "op"     // An exec or file operation, as shown in dry-run mode.
+	EventError  EventType = "error"  // An action returned an error.
+
+	EventSkip          EventType = "skip"           // A Registry task was skipped, Detail is the reason.
+	EventWarn          EventType = "warn"           // A warning was logged, Detail is the message.
+	EventRollbackStart EventType = "rollback-start" // Rollback actions are about to run.
+	EventRollback      EventType = "rollback"       // Rollback actions were run, Err is set if they failed.
+)
+
+// Event is a lifecycle event of a run. Secrets are redacted.
+type Event struct {
+	Time     time.Time     `json:"time"`
+	Type     EventType     `json:"type"`
+	Action   string        `json:"action,omitempty"`   // Path of the running Named actions, joined with "/".
+	Op       string        `json:"op,omitempty"`       // Operation, such as "exec" or "write".
+	Detail   string        `json:"detail,omitempty"`   // Operation detail, such as the command line.
+	Duration time.Duration `json:"duration,omitempty"` // Nanoseconds the action ran, for EventFinish and EventRollback.
+	Err      string        `json:"error,omitempty"`
+}
+
+// Events receives the events of a run set in State.Events, for custom
+// progress displays and CI annotations. The methods may be called
+// concurrently by actions that run concurrently, such as with Limit.
+type Events interface {
+	OnActionStart(e Event)   // A Named action started, EventStart.
+	OnActionEnd(e Event)     // A Named action finished, EventFinish.
+	OnRollbackStart(e Event) // Rollback actions are about to run, EventRollbackStart.
+	OnRollbackEnd(e Event)   // Rollback actions were run, EventRollback.
+	OnEvent(e Event)         // Any other event, such as EventOp or EventError.
+}
+
+// EventHooks is an Events that calls the function set for each kind of
+// event. Functions that are nil are not called.
+type EventHooks struct {
+	ActionStart   func(e Event)
+	ActionEnd     func(e Event)
+	RollbackStart func(e Event)
+	RollbackEnd   func(e Event)
+	Event         func(e Event)
+}
+
+func (h EventHooks) call(f func(e Event), e Event) {
+	if f != nil {
+		f(e)
+	}
+}
+
+func (h EventHooks) OnActionStart(e Event)   { h.call(h.ActionStart, e) }
+func (h EventHooks) OnActionEnd(e Event)     { h.call(h.ActionEnd, e) }
+func (h EventHooks) OnRollbackStart(e Event) { h.call(h.RollbackStart, e) }
+func (h EventHooks) OnRollbackEnd(e Event)   { h.call(h.RollbackEnd, e) }
+func (h EventHooks) OnEvent(e Event)         { h.call(h.Event, e) }
+
+// sendEvent calls the method of ev for the type of e.
+func sendEvent(ev Events, e Event) {
+	switch e.Type {
+	default:
+		ev.OnEvent(e)
+	case EventStart:
+		ev.OnActionStart(e)
+	case EventFinish:
+		ev.OnActionEnd(e)
+	case EventRollbackStart:
+		ev.OnRollbackStart(e)
+	case EventRollback:
+		ev.OnRollbackEnd(e)
+	}
+}
+
+// emit the event to the event handlers of the run.
+func (st *State) emit(e Event) {
+	if !st.emitting() {
+		return
+	}
+	e.Time = st.Now()
+	e.Action = strings.Join(st.names, "/")
+	e.Detail = st.Redact(e.Detail)
+	e.Err = st.Redact(e.Err)
+	for _, f := range st.eventFuncs {
+		f(e)
+	}
+	if st.Events != nil {
+		sendEvent(st.Events, e)
+	}
+}
+
+func (st *State) emitting() bool {
+	return len(st.eventFuncs) > 0 || st.Events != nil
+}
+
+// JSONEvents runs the action a and writes each Event of the run to w as a
+// line of JSON, for CI annotators and log pipelines. Writes to w are
+// serialized.
+func JSONEvents(w io.Writer, a Action) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		var mu sync.Mutex
+		enc := json.NewEncoder(w)
+		orig := st.eventFuncs
+		st.eventFuncs = append(orig[:len(orig):len(orig)], func(e Event) {
+			mu.Lock()
+			enc.Encode(e)
+			mu.Unlock()
+		})
+		err := sc.RunAction(ctx, st, a)
+		st.eventFuncs = orig
+		return err
+	})
+}
@@ -0,0 +1,94 @@
+package task
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONEvents(t *testing.T) {
+	dir := t.TempDir()
+	out := &strings.Builder{}
+	st := &State{Dir: dir}
+	err := Run(context.Background(), st, JSONEvents(out, NewScript(
+		Named("write", WriteFile("a.txt", 0600, []byte("a"))),
+		Named("fail", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			return sc.RunAction(ctx, st, ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+				return errors.New("bad")
+			}))
+		})),
+	)))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	var got []string
+	sc := bufio.NewScanner(strings.NewReader(out.String()))
+	for sc.Scan() {
+		var e Event
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Time.IsZero() {
+			t.Fatalf("missing time in %s", sc.Text())
+		}
+		got = append(got, fmt.Sprintf("%s %s %s %s", e.Type, e.Action, e.Op, e.Err))
+	}
+	want := []string{
+		"start write  ",
+		"op write write ",
+		"finish write  ",
+		"start fail  ",
+		"error fail  bad",
+		"finish fail  bad",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestEvents(t *testing.T) {
+	var got []string
+	hook := func(name string) func(e Event) {
+		return func(e Event) {
+			s := name + " " + e.Action
+			if len(e.Err) > 0 {
+				s += ": " + e.Err
+			}
+			got = append(got, s)
+		}
+	}
+	st := &State{Events: EventHooks{
+		ActionStart:   hook("start"),
+		ActionEnd:     hook("end"),
+		RollbackStart: hook("rollback start"),
+		RollbackEnd:   hook("rollback end"),
+	}}
+	ok := ActionFunc(func(ctx context.Context, st *State, sc Script) error { return nil })
+	err := Run(context.Background(), st, NewScript(
+		Rollback(Named("undo", ok)),
+		Named("deploy", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			return errors.New("fail")
+		})),
+	))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	// Rollback runs under the path of the action that failed.
+	want := []string{
+		"start deploy",
+		"end deploy: fail",
+		"rollback start deploy",
+		"start deploy/undo",
+		"end deploy/undo",
+		"rollback end deploy",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// resolveExec returns the name, which exec.Command finds in the PATH.
+func resolveExec(st *State, name string) (string, error) {
+	return name, nil
+}
+
+func prepareCmd(st *State, cmd *exec.Cmd) error {
+	return nil
+}
+
+var geteuid = os.Geteuid
+
+// elevateCmd runs the command with sudo, unless the process runs as root.
+// Without a terminal sudo may not ask for a password, so it is checked
+// first that sudo does not need one.
+func elevateCmd(ctx context.Context, st *State, cmd *exec.Cmd) error {
+	if geteuid() == 0 {
+		return nil
+	}
+	sudo, err := lookPath("sudo", st.Dir, st.Env, false, isRegularFile)
+	if err != nil {
+		return fmt.Errorf("%w: sudo not found: %v", ErrElevation, err)
+	}
+	args := []string{sudo}
+	if !hasTerminal() {
+		check := exec.CommandContext(ctx, sudo, "-n", "true")
+		check.Env, check.Dir = cmd.Env, cmd.Dir
+		if err := check.Run(); err != nil {
+			return fmt.Errorf("%w: sudo requires a password and there is no terminal to ask for it", ErrElevation)
+		}
+		args = append(args, "-n")
+	}
+	cmd.Args = append(append(args, "--", cmd.Path), cmd.Args[1:]...)
+	cmd.Path = sudo
+	return nil
+}
+
+// hasTerminal reports if the process has a controlling terminal, which
+// sudo asks for the password on.
+var hasTerminal = func() bool {
+	f, err := os.Open("/dev/tty")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
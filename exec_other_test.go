@@ -0,0 +1,54 @@
+//go:build !windows
+
+package task
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestElevated(t *testing.T) {
+	origEUID, origTerminal := geteuid, hasTerminal
+	geteuid = func() int { return 1000 }
+	hasTerminal = func() bool { return false }
+	defer func() { geteuid, hasTerminal = origEUID, origTerminal }()
+
+	bin := t.TempDir()
+	sudo := `#!/bin/sh
+if [ "$1" = "-n" ] && [ "$2" = "true" ]; then
+	exit $NEED_PASSWORD
+fi
+echo sudo "$@"
+`
+	if err := os.WriteFile(filepath.Join(bin, "sudo"), []byte(sudo), 0755); err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{"PATH": bin + string(filepath.ListSeparator) + os.Getenv("PATH"), "NEED_PASSWORD": "0"}
+
+	var out string
+	st := &State{Env: env}
+	err := Run(context.Background(), st, Elevated(WithStd(&out, nil, Exec("true", "a b"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out, "sudo -n -- /") || !strings.HasSuffix(out, "/true a b\n") {
+		t.Fatalf("got %q", out)
+	}
+
+	env["NEED_PASSWORD"] = "1"
+	err = Run(context.Background(), st, Elevated(Exec("true")))
+	if !errors.Is(err, ErrElevation) || !strings.Contains(err.Error(), "requires a password") {
+		t.Fatalf("got %v, want ErrElevation", err)
+	}
+
+	// Commands outside of Elevated are run as is.
+	out = ""
+	err = Run(context.Background(), st, WithStd(&out, nil, Exec("echo", "plain")))
+	if err != nil || out != "plain\n" {
+		t.Fatalf("got %q, %v", out, err)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// resolveExec finds the executable in the State PATH, trying the
+// extensions of PATHEXT, such as ".exe" and ".cmd".
+func resolveExec(st *State, name string) (string, error) {
+	return lookPath(name, st.Dir, st.Env, true, isRegularFile)
+}
+
+// prepareCmd runs .bat and .cmd scripts with cmd.exe, quoting the
+// arguments for it rather than with the rules of CommandLineToArgvW.
+func prepareCmd(st *State, cmd *exec.Cmd) error {
+	if !isCmdScript(cmd.Path) {
+		return nil
+	}
+	line, err := QuoteCmd(append([]string{cmd.Path}, cmd.Args[1:]...))
+	if err != nil {
+		return err
+	}
+	comspec, _ := envValue(st.Env, "COMSPEC", true)
+	if len(comspec) == 0 {
+		comspec = os.Getenv("COMSPEC")
+	}
+	if len(comspec) == 0 {
+		comspec = `C:\Windows\System32\cmd.exe`
+	}
+	cmd.Path = comspec
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CmdLine = quoteWindowsArg(comspec) + ` /d /e:ON /v:OFF /s /c "` + line + `"`
+	return nil
+}
+
+// elevateCmd starts the command with a UAC prompt using the PowerShell
+// Start-Process cmdlet, unless the process is already elevated. The exit
+// code of the command is the exit code of PowerShell.
+func elevateCmd(ctx context.Context, st *State, cmd *exec.Cmd) error {
+	if isElevated() {
+		return nil
+	}
+	powershell, err := lookPath("powershell", st.Dir, st.Env, true, isRegularFile)
+	if err != nil {
+		return fmt.Errorf("%w: powershell not found: %v", ErrElevation, err)
+	}
+	quote := func(s string) string {
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	}
+	script := "$p = Start-Process -Verb RunAs -Wait -PassThru -FilePath " + quote(cmd.Path)
+	if cmd.SysProcAttr != nil && len(cmd.SysProcAttr.CmdLine) > 0 {
+		// The command line set by prepareCmd, without the program.
+		args := strings.TrimPrefix(cmd.SysProcAttr.CmdLine, quoteWindowsArg(cmd.Path)+" ")
+		script += " -ArgumentList " + quote(args)
+		cmd.SysProcAttr.CmdLine = ""
+	} else if len(cmd.Args) > 1 {
+		script += " -ArgumentList " + quote(QuoteWindows(cmd.Args[1:]))
+	}
+	if len(cmd.Dir) > 0 {
+		script += " -WorkingDirectory " + quote(cmd.Dir)
+	}
+	script += "; exit $p.ExitCode"
+	cmd.Path = powershell
+	cmd.Args = []string{powershell, "-NoProfile", "-NonInteractive", "-Command", script}
+	return nil
+}
+
+// isElevated reports if the process token is elevated.
+func isElevated() bool {
+	token, err := syscall.OpenCurrentProcessToken()
+	if err != nil {
+		return false
+	}
+	defer token.Close()
+	const tokenElevation = 20
+	var elevated uint32
+	var n uint32
+	err = syscall.GetTokenInformation(token, tokenElevation, (*byte)(unsafe.Pointer(&elevated)), uint32(unsafe.Sizeof(elevated)), &n)
+	return err == nil && elevated != 0
+}
@@ -0,0 +1,490 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is a parsed condition expression, such as:
+//
+//	os == "linux" && env.CI == "true"
+//	!exists("bin/server") || force
+//
+// Names resolve to runtime facts, the State env, or State variables:
+//
+//	os, arch     runtime.GOOS and runtime.GOARCH
+//	env.NAME     the State env variable NAME, or "" if unset
+//	var.NAME     the State variable NAME
+//	NAME         the State variable NAME
+//
+// Values are strings, numbers, booleans, or nil for a missing variable.
+// The operators are ||, &&, !, ==, !=, <, <=, >, >= and parentheses.
+// Values compare as numbers if both are numbers or one is a number and the
+// other a numeric string, otherwise as strings. The function exists(path)
+// reports if a file exists, relative to State.Dir. In a boolean context
+// false, nil, "", "false", "0", and 0 are false; other values are true.
+type Expr struct {
+	src  string
+	eval exprFunc
+}
+
+type exprFunc func(st *State) (any, error)
+
+// ParseExpr parses the condition expression.
+func ParseExpr(s string) (*Expr, error) {
+	p := &exprParser{src: s}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %q", p.tok.text)
+	}
+	return &Expr{src: s, eval: f}, nil
+}
+
+// MustParseExpr is like ParseExpr but panics if the expression is invalid.
+func MustParseExpr(s string) *Expr {
+	e, err := ParseExpr(s)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// String returns the source of the expression.
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval evaluates the expression against the state.
+func (e *Expr) Eval(st *State) (any, error) {
+	v, err := e.eval(st)
+	if err != nil {
+		return nil, fmt.Errorf("expr %q: %w", e.src, err)
+	}
+	return v, nil
+}
+
+// Bool evaluates the expression against the state and reports if it is true.
+func (e *Expr) Bool(st *State) (bool, error) {
+	v, err := e.Eval(st)
+	if err != nil {
+		return false, err
+	}
+	return truth(v), nil
+}
+
+// When runs the action only if the condition expression is true.
+// When panics if the expression is invalid.
+func When(expr string, a Action) Action {
+	e := MustParseExpr(expr)
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		ok, err := e.Bool(st)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		return sc.RunAction(ctx, st, a)
+	})
+}
+
+func truth(v any) bool {
+	switch x := v.(type) {
+	default:
+		return true
+	case nil:
+		return false
+	case bool:
+		return x
+	case float64:
+		return x != 0
+	case string:
+		return len(x) > 0 && x != "false" && x != "0"
+	}
+}
+
+// exprValue converts a state value to a string, float64, bool, or nil.
+func exprValue(v any) any {
+	switch x := v.(type) {
+	default:
+		return fmt.Sprint(x)
+	case nil, string, bool, float64:
+		return x
+	case *string:
+		return *x
+	case []byte:
+		return string(x)
+	case int:
+		return float64(x)
+	case int32:
+		return float64(x)
+	case int64:
+		return float64(x)
+	case float32:
+		return float64(x)
+	}
+}
+
+func exprNumber(v any) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func exprString(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// compare returns -1, 0, or 1.
+func compare(a, b any) int {
+	_, aNum := a.(float64)
+	_, bNum := b.(float64)
+	if aNum || bNum {
+		af, aok := exprNumber(a)
+		bf, bok := exprNumber(b)
+		if aok && bok {
+			switch {
+			case af < bf:
+				return -1
+			case af > bf:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(exprString(a), exprString(b))
+}
+
+type tokKind byte
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+type exprParser struct {
+	src string
+	pos int
+	tok token
+}
+
+func (p *exprParser) errorf(f string, v ...any) error {
+	return fmt.Errorf("expr %q at %d: %s", p.src, p.tok.pos, fmt.Sprintf(f, v...))
+}
+
+// next reads the next token into p.tok.
+func (p *exprParser) next() error {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	p.tok = token{pos: start}
+	if p.pos >= len(p.src) {
+		p.tok.kind = tokEOF
+		return nil
+	}
+	c := p.src[p.pos]
+	switch {
+	case c == '"':
+		q, err := strconv.QuotedPrefix(p.src[p.pos:])
+		if err != nil {
+			return p.errorf("invalid string")
+		}
+		s, _ := strconv.Unquote(q)
+		p.pos += len(q)
+		p.tok.kind, p.tok.text = tokString, s
+	case c >= '0' && c <= '9':
+		for p.pos < len(p.src) && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		p.tok.kind, p.tok.text = tokNumber, p.src[start:p.pos]
+	case c == '_' || unicode.IsLetter(rune(c)):
+		for p.pos < len(p.src) {
+			c := rune(p.src[p.pos])
+			if c != '_' && c != '.' && !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+				break
+			}
+			p.pos++
+		}
+		p.tok.kind, p.tok.text = tokIdent, p.src[start:p.pos]
+	default:
+		for _, op := range []string{"||", "&&", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", ","} {
+			if strings.HasPrefix(p.src[p.pos:], op) {
+				p.pos += len(op)
+				p.tok.kind, p.tok.text = tokOp, op
+				return nil
+			}
+		}
+		return p.errorf("unexpected %q", c)
+	}
+	return nil
+}
+
+func (p *exprParser) isOp(op string) bool {
+	return p.tok.kind == tokOp && p.tok.text == op
+}
+
+func (p *exprParser) parseOr() (exprFunc, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(st *State) (any, error) {
+			v, err := l(st)
+			if err != nil || truth(v) {
+				return truth(v), err
+			}
+			v, err = right(st)
+			return truth(v), err
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprFunc, error) {
+	left, err := p.parseCompare()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseCompare()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(st *State) (any, error) {
+			v, err := l(st)
+			if err != nil || !truth(v) {
+				return truth(v), err
+			}
+			v, err = right(st)
+			return truth(v), err
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseCompare() (exprFunc, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokOp {
+		return left, nil
+	}
+	var test func(c int) bool
+	switch p.tok.text {
+	default:
+		return left, nil
+	case "==":
+		test = func(c int) bool { return c == 0 }
+	case "!=":
+		test = func(c int) bool { return c != 0 }
+	case "<":
+		test = func(c int) bool { return c < 0 }
+	case "<=":
+		test = func(c int) bool { return c <= 0 }
+	case ">":
+		test = func(c int) bool { return c > 0 }
+	case ">=":
+		test = func(c int) bool { return c >= 0 }
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	right, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return func(st *State) (any, error) {
+		a, err := left(st)
+		if err != nil {
+			return nil, err
+		}
+		b, err := right(st)
+		if err != nil {
+			return nil, err
+		}
+		if ab, ok := a.(bool); ok {
+			if bb, ok := b.(bool); ok {
+				c := 1
+				if ab == bb {
+					c = 0
+				}
+				return test(c), nil
+			}
+		}
+		return test(compare(a, b)), nil
+	}, nil
+}
+
+func (p *exprParser) parseUnary() (exprFunc, error) {
+	if p.isOp("!") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		f, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(st *State) (any, error) {
+			v, err := f(st)
+			return !truth(v), err
+		}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprFunc, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokEOF:
+		return nil, p.errorf("unexpected end")
+	case tokString:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		return func(st *State) (any, error) { return tok.text, nil }, nil
+	case tokNumber:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", tok.text)
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		return func(st *State) (any, error) { return f, nil }, nil
+	case tokOp:
+		if !p.isOp("(") {
+			return nil, p.errorf("unexpected %q", tok.text)
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isOp(")") {
+			return nil, p.errorf("missing )")
+		}
+		return f, p.next()
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.isOp("(") {
+		return p.parseCall(tok.text)
+	}
+	return exprIdent(tok.text), nil
+}
+
+func (p *exprParser) parseCall(name string) (exprFunc, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	var args []exprFunc
+	for !p.isOp(")") {
+		if len(args) > 0 {
+			if !p.isOp(",") {
+				return nil, p.errorf("expected , or )")
+			}
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		}
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, f)
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	switch name {
+	default:
+		return nil, p.errorf("unknown function %q", name)
+	case "exists":
+		if len(args) != 1 {
+			return nil, p.errorf("exists takes one argument")
+		}
+		return func(st *State) (any, error) {
+			v, err := args[0](st)
+			if err != nil {
+				return nil, err
+			}
+			_, err = os.Stat(st.Filepath(exprString(v)))
+			return err == nil, nil
+		}, nil
+	}
+}
+
+func exprIdent(name string) exprFunc {
+	switch name {
+	case "true":
+		return func(st *State) (any, error) { return true, nil }
+	case "false":
+		return func(st *State) (any, error) { return false, nil }
+	case "nil":
+		return func(st *State) (any, error) { return nil, nil }
+	case "os":
+		return func(st *State) (any, error) { return runtime.GOOS, nil }
+	case "arch":
+		return func(st *State) (any, error) { return runtime.GOARCH, nil }
+	}
+	if key, ok := strings.CutPrefix(name, "env."); ok {
+		return func(st *State) (any, error) { return st.Getenv(key), nil }
+	}
+	key := strings.TrimPrefix(name, "var.")
+	return func(st *State) (any, error) { return exprValue(st.Get(key)), nil }
+}
@@ -0,0 +1,84 @@
+package task
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestExpr(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	st := &State{
+		Dir: dir,
+		Env: map[string]string{"CI": "true", "N": "10"},
+	}
+	st.Set("force", true)
+	st.Set("count", int64(3))
+	st.Set("name", "web")
+
+	list := []struct {
+		Expr  string
+		Value bool
+		Error bool
+	}{
+		{Expr: `os == "` + runtime.GOOS + `" && env.CI == "true"`, Value: true},
+		{Expr: `arch != "` + runtime.GOARCH + `"`, Value: false},
+		{Expr: `env.MISSING == ""`, Value: true},
+		{Expr: `env.N > 9`, Value: true},
+		{Expr: `env.N > "9"`, Value: false}, // String comparison.
+		{Expr: `count >= 3 && var.count < 4`, Value: true},
+		{Expr: `!force || name == "api"`, Value: false},
+		{Expr: `(false || name) && !missing`, Value: true},
+		{Expr: `exists("a.txt") && !exists("b.txt")`, Value: true},
+		{Expr: `force == true`, Value: true},
+		{Expr: `os ==`, Error: true},
+		{Expr: `(os`, Error: true},
+		{Expr: `nope(1)`, Error: true},
+		{Expr: `"abc`, Error: true},
+	}
+	for _, item := range list {
+		e, err := ParseExpr(item.Expr)
+		if item.Error {
+			if err == nil {
+				t.Errorf("%s: expected error", item.Expr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", item.Expr, err)
+			continue
+		}
+		got, err := e.Bool(st)
+		if err != nil {
+			t.Errorf("%s: %v", item.Expr, err)
+			continue
+		}
+		if got != item.Value {
+			t.Errorf("%s: got %t, want %t", item.Expr, got, item.Value)
+		}
+	}
+}
+
+func TestWhen(t *testing.T) {
+	ran := 0
+	a := ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		ran++
+		return nil
+	})
+	st := &State{Env: map[string]string{"CI": "true"}}
+	err := Run(context.Background(), st, NewScript(
+		When(`env.CI == "true"`, a),
+		When(`env.CI != "true"`, a),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ran != 1 {
+		t.Fatalf("ran %d times, want 1", ran)
+	}
+}
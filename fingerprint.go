@@ -0,0 +1,132 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Fingerprint returns a content hash of the files under dir matched by the
+// source globs, along with the given values. Only file names and contents
+// are hashed, not modification times, so the fingerprint is stable across
+// checkouts and machines.
+func Fingerprint(dir string, sources []string, values ...string) (string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	for _, pattern := range sources {
+		list, err := Glob(dir, pattern)
+		if err != nil {
+			return "", err
+		}
+		for _, fn := range list {
+			if seen[fn] {
+				continue
+			}
+			seen[fn] = true
+			files = append(files, fn)
+		}
+	}
+	sort.Strings(files)
+
+	h := sha256.New()
+	for _, fn := range files {
+		writeField(h, fn)
+		f, err := os.Open(filepath.Join(dir, filepath.FromSlash(fn)))
+		if err != nil {
+			return "", err
+		}
+		fh := sha256.New()
+		_, err = io.Copy(fh, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+		h.Write(fh.Sum(nil))
+	}
+	for _, v := range values {
+		writeField(h, v)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeField writes a length prefixed value so adjacent values can't collide.
+func writeField(h hash.Hash, v string) {
+	var n [8]byte
+	binary.LittleEndian.PutUint64(n[:], uint64(len(v)))
+	h.Write(n[:])
+	io.WriteString(h, v)
+}
+
+// FingerprintStore is a file backed store of fingerprints by key.
+// It is safe for concurrent use.
+type FingerprintStore struct {
+	filename string
+
+	mu   sync.Mutex
+	sums map[string]string
+}
+
+// OpenFingerprintStore reads the fingerprints saved in filename.
+// A missing file is treated as empty and will be created on the first Set.
+func OpenFingerprintStore(filename string) (*FingerprintStore, error) {
+	fps := &FingerprintStore{
+		filename: filename,
+		sums:     make(map[string]string),
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fps, nil
+		}
+		return nil, err
+	}
+	err = json.Unmarshal(b, &fps.sums)
+	if err != nil {
+		return nil, err
+	}
+	return fps, nil
+}
+
+// Get the fingerprint for key, or an empty string if none is stored.
+func (fps *FingerprintStore) Get(key string) string {
+	fps.mu.Lock()
+	defer fps.mu.Unlock()
+
+	return fps.sums[key]
+}
+
+// Set the fingerprint for key and save the store.
+func (fps *FingerprintStore) Set(key, sum string) error {
+	fps.mu.Lock()
+	defer fps.mu.Unlock()
+
+	fps.sums[key] = sum
+	b, err := json.MarshalIndent(fps.sums, "", "\t")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(fps.filename), 0700)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so a crash doesn't corrupt the store.
+	tmp := fps.filename + ".tmp"
+	err = os.WriteFile(tmp, b, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, fps.filename)
+}
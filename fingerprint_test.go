@@ -0,0 +1,80 @@
+package task
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFingerprintStore(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		fn := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fn), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fn, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("src/a.go", "package a")
+
+	fps, err := OpenFingerprintStore(filepath.Join(dir, ".task", "fp.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &Registry{Fingerprints: fps}
+	runs := 0
+	bt := r.Register("build", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		runs++
+		write("bin/out", "out")
+		return nil
+	}))
+	bt.Sources = []string{"src/**/*.go"}
+	bt.Outputs = []string{"bin/out"}
+	bt.Fingerprint = []string{"go build ${GOOS}"}
+
+	run := func(goos string) {
+		st := &State{
+			Dir:    dir,
+			Env:    map[string]string{"GOOS": goos},
+			Stdout: &strings.Builder{},
+		}
+		err := Run(context.Background(), st, r.Action("build"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	run("linux")
+	run("linux")
+	if runs != 1 {
+		t.Fatalf("expected one run, got %d", runs)
+	}
+	run("windows")
+	if runs != 2 {
+		t.Fatalf("expected env change to run, got %d", runs)
+	}
+
+	// Touching a file without changing content does not run the task.
+	write("src/a.go", "package a")
+	run("windows")
+	if runs != 2 {
+		t.Fatalf("expected same content to be up to date, got %d", runs)
+	}
+	write("src/a.go", "package b")
+	run("windows")
+	if runs != 3 {
+		t.Fatalf("expected content change to run, got %d", runs)
+	}
+
+	// A new store reads the saved fingerprints.
+	fps2, err := OpenFingerprintStore(filepath.Join(dir, ".task", "fp.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := fps2.Get("build"), fps.Get("build"); g != w || g == "" {
+		t.Fatalf("got stored fingerprint %q, want %q", g, w)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"flag"
+	"fmt"
+)
+
+// FromFlagSet returns a Flag for each flag defined in fset, to use in
+// Command.Flags. When the Command parses a flag, the value is set in fset
+// as well as in the State bucket. The default is the value of the flag
+// when FromFlagSet is called.
+func FromFlagSet(fset *flag.FlagSet) []*Flag {
+	var list []*Flag
+	fset.VisitAll(func(f *flag.Flag) {
+		fl := &Flag{
+			Name:  f.Name,
+			Usage: f.Usage,
+			Value: f.Value,
+			Type:  FlagValue,
+		}
+		if g, ok := f.Value.(flag.Getter); ok {
+			fl.Default = g.Get()
+		} else if len(f.DefValue) > 0 {
+			fl.Default = f.DefValue
+		}
+		list = append(list, fl)
+	})
+	return list
+}
+
+// ToFlagSet defines the flags in fset, so a program parsing its arguments
+// with package flag sets the flag values in st, like Command.Exec does.
+// Defaults and values from the ENV of the flags are set in st when the
+// flags are defined. Required flags are not checked.
+func ToFlagSet(fset *flag.FlagSet, st *State, flags ...*Flag) error {
+	for _, fl := range flags {
+		fs := &flagStatus{flag: fl}
+		if err := fs.init(); err != nil {
+			return err
+		}
+		fs.setDefault(st)
+		if len(fl.ENV) > 0 {
+			if v, ok := st.LookupEnv(fl.ENV); ok && len(v) > 0 {
+				if err := fs.set(st, v, true); err != nil {
+					return err
+				}
+			}
+		}
+		fset.Var(&flagSetValue{fs: fs, st: st}, fl.Name, fl.Usage)
+	}
+	return nil
+}
+
+// flagSetValue is the flag.Value of a Flag defined by ToFlagSet.
+type flagSetValue struct {
+	fs *flagStatus
+	st *State
+}
+
+func (v *flagSetValue) String() string {
+	if v.fs == nil {
+		// The zero value used by package flag to find the default.
+		return ""
+	}
+	if got := v.st.Get(v.fs.flag.Name); got != nil {
+		return fmt.Sprint(got)
+	}
+	return ""
+}
+
+func (v *flagSetValue) Set(s string) error {
+	return v.fs.set(v.st, s, false)
+}
+
+func (v *flagSetValue) Get() any {
+	return v.st.Get(v.fs.flag.Name)
+}
+
+func (v *flagSetValue) IsBoolFlag() bool {
+	return !v.fs.spaceValue()
+}
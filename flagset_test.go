@@ -0,0 +1,78 @@
+package task
+
+import (
+	"context"
+	"flag"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestFromFlagSet(t *testing.T) {
+	fset := flag.NewFlagSet("build", flag.ContinueOnError)
+	n := fset.Int("n", 2, "number of workers")
+	v := fset.Bool("v", false, "verbose")
+	tags := fset.String("tags", "", "build tags")
+
+	var got map[string]any
+	cmd := &Command{
+		Name:  "build",
+		Flags: FromFlagSet(fset),
+		Action: ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			got = st.Values()
+			return nil
+		}),
+	}
+	err := Run(context.Background(), &State{}, cmd.Exec([]string{"-v", "-tags", "netgo"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *n != 2 || !*v || *tags != "netgo" {
+		t.Fatalf("got flag set values %d %t %q", *n, *v, *tags)
+	}
+	if got["n"] != 2 || got["v"] != true || got["tags"] != "netgo" {
+		t.Fatalf("got state values %v", got)
+	}
+
+	err = Run(context.Background(), &State{}, cmd.Exec([]string{"-n", "x"}))
+	if g, w := err.Error(), `invalid value "x" for -n: parse error`; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+}
+
+func TestToFlagSet(t *testing.T) {
+	st := &State{Env: map[string]string{"APP_ADDR": ":9000"}}
+	var timeout time.Duration
+	fset := flag.NewFlagSet("app", flag.ContinueOnError)
+	fset.SetOutput(io.Discard)
+	err := ToFlagSet(fset, st,
+		&Flag{Name: "addr", ENV: "APP_ADDR", Default: ":8080"},
+		&Flag{Name: "timeout", Value: &timeout, Default: time.Second},
+		&Flag{Name: "dry", Type: FlagBool},
+		&Flag{Name: "retries", Default: 3},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fset.Parse([]string{"-dry", "-timeout", "5s", "rest"}); err != nil {
+		t.Fatal(err)
+	}
+	if g := st.Get("addr"); g != ":9000" {
+		t.Fatalf("got addr %v, want the env value", g)
+	}
+	if g := st.Get("timeout"); g != 5*time.Second || timeout != 5*time.Second {
+		t.Fatalf("got timeout %v, %v", g, timeout)
+	}
+	if g := st.Get("dry"); g != true {
+		t.Fatalf("got dry %v", g)
+	}
+	if g := st.Get("retries"); g != int64(3) {
+		t.Fatalf("got retries %#v", g)
+	}
+	if g := fset.Lookup("retries").DefValue; g != "3" {
+		t.Fatalf("got default %q", g)
+	}
+	if err := fset.Parse([]string{"-retries", "x"}); err == nil {
+		t.Fatal("expected parse error")
+	}
+}
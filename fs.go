@@ -0,0 +1,221 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FS is a file system used by the file actions ReadFile, WriteFile,
+// OpenFile, Delete, Move, and Copy. Names are OS paths, as returned by
+// State.Filepath. Set State.FS to use an in-memory file system in tests
+// or SandboxFS to confine the actions to a directory. If State.FS is nil
+// the OS file system is used.
+type FS interface {
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+	Stat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	MkdirAll(name string, perm fs.FileMode) error
+	RemoveAll(name string) error
+	Rename(oldname, newname string) error
+}
+
+// File is an open file of an FS.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Closer
+	Stat() (fs.FileInfo, error)
+}
+
+// OSFS is the FS of the operating system.
+type OSFS struct{}
+
+// OpenFile implements FS.
+func (OSFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+// Stat implements FS.
+func (OSFS) Stat(name string) (fs.FileInfo, error) { return os.Stat(name) }
+
+// ReadDir implements FS.
+func (OSFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+
+// MkdirAll implements FS.
+func (OSFS) MkdirAll(name string, perm fs.FileMode) error { return os.MkdirAll(name, perm) }
+
+// RemoveAll implements FS.
+func (OSFS) RemoveAll(name string) error { return os.RemoveAll(name) }
+
+// Rename implements FS.
+func (OSFS) Rename(oldname, newname string) error { return os.Rename(oldname, newname) }
+
+// ErrSandbox is returned by Exec when State.FS is a SandboxFS, as the
+// command could not be confined.
+var ErrSandbox = errors.New("not allowed in sandbox")
+
+// SandboxFS returns an FS that only allows access to names within the
+// directory root of fsys, returning an fs.ErrPermission error otherwise.
+// Names are compared lexically; symbolic links within root are not
+// resolved. Exec fails with ErrSandbox while State.FS is a SandboxFS.
+func SandboxFS(root string, fsys FS) FS {
+	if fsys == nil {
+		fsys = OSFS{}
+	}
+	return &sandboxFS{root: filepath.Clean(root), fsys: fsys}
+}
+
+type sandboxFS struct {
+	root string
+	fsys FS
+}
+
+func (sb *sandboxFS) check(op, name string) error {
+	rel, err := filepath.Rel(sb.root, filepath.Clean(name))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+	}
+	return nil
+}
+
+func (sb *sandboxFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	if err := sb.check("open", name); err != nil {
+		return nil, err
+	}
+	return sb.fsys.OpenFile(name, flag, perm)
+}
+
+func (sb *sandboxFS) Stat(name string) (fs.FileInfo, error) {
+	if err := sb.check("stat", name); err != nil {
+		return nil, err
+	}
+	return sb.fsys.Stat(name)
+}
+
+func (sb *sandboxFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := sb.check("readdir", name); err != nil {
+		return nil, err
+	}
+	return sb.fsys.ReadDir(name)
+}
+
+func (sb *sandboxFS) MkdirAll(name string, perm fs.FileMode) error {
+	if err := sb.check("mkdir", name); err != nil {
+		return err
+	}
+	return sb.fsys.MkdirAll(name, perm)
+}
+
+func (sb *sandboxFS) RemoveAll(name string) error {
+	if err := sb.check("remove", name); err != nil {
+		return err
+	}
+	return sb.fsys.RemoveAll(name)
+}
+
+func (sb *sandboxFS) Rename(oldname, newname string) error {
+	if err := sb.check("rename", oldname); err != nil {
+		return err
+	}
+	if err := sb.check("rename", newname); err != nil {
+		return err
+	}
+	return sb.fsys.Rename(oldname, newname)
+}
+
+// Sandbox runs the action a with State.FS set to a SandboxFS of State.Dir,
+// so file actions may not change files outside of it and Exec fails.
+func Sandbox(a Action) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		orig := st.FS
+		st.FS = SandboxFS(st.Dir, st.FileSystem())
+		err := sc.RunAction(ctx, st, a)
+		st.FS = orig
+		return err
+	})
+}
+
+// FileSystem returns State.FS, or OSFS if it is nil. Actions of other
+// packages should access files through it.
+func (st *State) FileSystem() FS {
+	if st.FS == nil {
+		return OSFS{}
+	}
+	return st.FS
+}
+
+// ensureDirFS creates the parent directory of fn in fsys.
+func ensureDirFS(fsys FS, fn string) error {
+	return fsys.MkdirAll(filepath.Dir(fn), 0700)
+}
+
+func readFileFS(fsys FS, name string) ([]byte, error) {
+	f, err := fsys.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func writeFileFS(fsys FS, name string, r io.Reader, perm fs.FileMode) error {
+	f, err := fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// copyFS copies the file or directory oldpath to newpath like fsop.Copy,
+// writing the copied file content to progress if not nil.
+func copyFS(fsys FS, oldpath, newpath string, only func(p string) bool, progress io.Writer) error {
+	if only != nil && !only(oldpath) {
+		return nil
+	}
+	fi, err := fsys.Stat(oldpath)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		if err := fsys.MkdirAll(newpath, fi.Mode().Perm()); err != nil {
+			return err
+		}
+		list, err := fsys.ReadDir(oldpath)
+		if err != nil {
+			return err
+		}
+		for _, item := range list {
+			err = copyFS(fsys, filepath.Join(oldpath, item.Name()), filepath.Join(newpath, item.Name()), only, progress)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	old, err := fsys.OpenFile(oldpath, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer old.Close()
+	if err := fsys.MkdirAll(filepath.Dir(newpath), fi.Mode().Perm()|0700); err != nil {
+		return err
+	}
+	var r io.Reader = old
+	if progress != nil {
+		r = io.TeeReader(old, progress)
+	}
+	return writeFileFS(fsys, newpath, r, fi.Mode().Perm())
+}
@@ -0,0 +1,72 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+)
+
+// recordFS records the operations on an OSFS.
+type recordFS struct {
+	OSFS
+	ops []string
+}
+
+func (r *recordFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	r.ops = append(r.ops, "open "+filepath.Base(name))
+	return r.OSFS.OpenFile(name, flag, perm)
+}
+
+func (r *recordFS) Rename(oldname, newname string) error {
+	r.ops = append(r.ops, "rename "+filepath.Base(oldname)+" "+filepath.Base(newname))
+	return r.OSFS.Rename(oldname, newname)
+}
+
+func TestFS(t *testing.T) {
+	fsys := &recordFS{}
+	var got string
+	st := &State{Dir: t.TempDir(), FS: fsys}
+	err := Run(context.Background(), st, NewScript(
+		WriteFile("a.txt", 0600, "hello"),
+		Move("a.txt", "b.txt"),
+		Copy("b.txt", "c.txt", nil),
+		ReadFile("c.txt", &got),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "hello" {
+		t.Fatalf("got %q", got)
+	}
+	want := []string{"open a.txt", "rename a.txt b.txt", "open b.txt", "open c.txt", "open c.txt"}
+	if len(fsys.ops) != len(want) {
+		t.Fatalf("got %q, want %q", fsys.ops, want)
+	}
+	for i := range want {
+		if fsys.ops[i] != want[i] {
+			t.Fatalf("got %q, want %q", fsys.ops, want)
+		}
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	dir := t.TempDir()
+	st := &State{Dir: filepath.Join(dir, "work")}
+	err := Run(context.Background(), st, Sandbox(WriteFile("sub/a.txt", 0600, "ok")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Run(context.Background(), st, Sandbox(WriteFile("../escape.txt", 0600, "no")))
+	if !errors.Is(err, fs.ErrPermission) {
+		t.Fatalf("got %v, want permission error", err)
+	}
+	err = Run(context.Background(), st, Sandbox(Exec("go", "version")))
+	if !errors.Is(err, ErrSandbox) {
+		t.Fatalf("got %v, want ErrSandbox", err)
+	}
+	if st.FS != nil {
+		t.Fatal("FS not restored")
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"fmt"
+)
+
+// FromFunc returns an action that calls f. The context passed to f carries
+// the State, which f may get with FromContext.
+func FromFunc(f func(ctx context.Context) error) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		return f(WithState(ctx, st))
+	})
+}
+
+// ToFunc returns a function that runs a with st, for use where a plain
+// function is expected. The function must not be called concurrently
+// with the same State.
+func ToFunc(a Action, st *State) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return Run(ctx, st, a)
+	}
+}
+
+// Mage returns an action that calls a Mage target. The target must be a
+// function with one of the signatures Mage accepts:
+//
+//	func()
+//	func() error
+//	func(context.Context)
+//	func(context.Context) error
+//
+// Other values return an error when run.
+func Mage(target any) Action {
+	switch f := target.(type) {
+	case func():
+		return FromFunc(func(ctx context.Context) error { f(); return nil })
+	case func() error:
+		return FromFunc(func(ctx context.Context) error { return f() })
+	case func(context.Context):
+		return FromFunc(func(ctx context.Context) error { f(ctx); return nil })
+	case func(context.Context) error:
+		return FromFunc(f)
+	}
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		return fmt.Errorf("mage: unsupported target type %T", target)
+	})
+}
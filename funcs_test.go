@@ -0,0 +1,49 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFuncs(t *testing.T) {
+	st := &State{}
+	err := Run(context.Background(), st, FromFunc(func(ctx context.Context) error {
+		FromContext(ctx).Set("built", true)
+		return nil
+	}))
+	if err != nil || st.Get("built") != true {
+		t.Fatalf("from func: got %v, built %v", err, st.Get("built"))
+	}
+
+	f := ToFunc(ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		st.Set("n", st.Default("n", 0).(int)+1)
+		return nil
+	}), st)
+	for i := 0; i < 2; i++ {
+		if err := f(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if g := st.Get("n"); g != 2 {
+		t.Fatalf("to func: got %v runs, want 2", g)
+	}
+
+	fail := errors.New("fail")
+	calls := 0
+	for _, target := range []any{
+		func() { calls++ },
+		func() error { calls++; return nil },
+		func(context.Context) { calls++ },
+		func(context.Context) error { calls++; return fail },
+	} {
+		err = Run(context.Background(), &State{}, Mage(target))
+	}
+	if calls != 4 || !errors.Is(err, fail) {
+		t.Fatalf("mage: got %d calls, error %v", calls, err)
+	}
+	err = Run(context.Background(), &State{}, Mage(func(string) {}))
+	if g, w := err.Error(), "mage: unsupported target type func(string)"; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+}
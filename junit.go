@@ -0,0 +1,120 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// result of a Named action.
+type result struct {
+	Path     []string // Names of the enclosing Named actions and the action.
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// results of the Named actions of a run, shared by copies of the State.
+type results struct {
+	mu   sync.Mutex
+	list []result
+}
+
+func (rs *results) add(r result) {
+	rs.mu.Lock()
+	rs.list = append(rs.list, r)
+	rs.mu.Unlock()
+}
+
+// junitSuites is the JUnit XML report format.
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Time      float64     `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// JUnitReport runs the action a and writes a JUnit XML report to filename,
+// relative to State.Dir, for CI systems that display test reports. Each
+// Named action run by a, including Registry tasks, is a test case named by
+// the path of its enclosing Named actions, with its duration and error.
+// The report is written even if a fails; the error of a is returned.
+func JUnitReport(filename any, suite string, a Action) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		orig := st.results
+		rs := &results{}
+		st.results = rs
+		start := st.Now()
+		err := sc.RunAction(ctx, st, a)
+		st.results = orig
+
+		fn, xerr := ExpandEnvErr(filename, st)
+		if xerr != nil {
+			return errors.Join(err, xerr)
+		}
+		fn = st.Filepath(fn)
+		if dryRun(st, "junit: %s", fn) {
+			return err
+		}
+		werr := os.WriteFile(fn, junitXML(st, suite, start, st.Since(start), rs), 0600)
+		return errors.Join(err, werr)
+	})
+}
+
+func junitXML(st *State, suite string, start time.Time, d time.Duration, rs *results) []byte {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	s := junitSuite{
+		Name:      suite,
+		Tests:     len(rs.list),
+		Time:      d.Seconds(),
+		Timestamp: start.UTC().Format("2006-01-02T15:04:05"),
+	}
+	for _, r := range rs.list {
+		c := junitCase{
+			Name:      strings.Join(r.Path, "/"),
+			Classname: suite,
+			Time:      r.Duration.Seconds(),
+		}
+		if r.Err != nil {
+			msg := st.redactError(r.Err).Error()
+			c.Failure = &junitFailure{Message: firstLine(msg), Text: msg}
+			s.Failures++
+		}
+		s.Cases = append(s.Cases, c)
+	}
+	b, _ := xml.MarshalIndent(junitSuites{Suites: []junitSuite{s}}, "", "\t")
+	return append([]byte(xml.Header), append(b, '\n')...)
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
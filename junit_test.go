@@ -0,0 +1,66 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestJUnitReport(t *testing.T) {
+	dir := t.TempDir()
+	st := &State{Dir: dir, Policy: PolicyContinue}
+	err := Run(context.Background(), st, JUnitReport("report.xml", "build", NewScript(
+		Named("compile", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			return sc.RunAction(ctx, st, Named("gen", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+				return nil
+			})))
+		})),
+		ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			return nil
+		}),
+		Named("test", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			return errors.New("2 tests failed\ndetails")
+		})),
+	)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "report.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := regexp.MustCompile(`(time|timestamp)="[^"]*"`).ReplaceAllString(string(b), `$1="X"`)
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+	<testsuite name="build" tests="3" failures="1" time="X" timestamp="X">
+		<testcase name="compile/gen" classname="build" time="X"></testcase>
+		<testcase name="compile" classname="build" time="X"></testcase>
+		<testcase name="test" classname="build" time="X">
+			<failure message="2 tests failed">2 tests failed&#xA;details</failure>
+		</testcase>
+	</testsuite>
+</testsuites>
+`
+	if got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestJUnitReportFailure(t *testing.T) {
+	dir := t.TempDir()
+	fail := errors.New("fail")
+	err := Run(context.Background(), &State{Dir: dir}, JUnitReport("report.xml", "build",
+		Named("test", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			return fail
+		})),
+	))
+	if !errors.Is(err, fail) {
+		t.Fatalf("got %v, want %v", err, fail)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "report.xml")); err != nil {
+		t.Fatal("expected report on failure:", err)
+	}
+}
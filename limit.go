@@ -0,0 +1,90 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Keep selects the output kept by LimitOutput.
+type Keep byte
+
+// Output kept when the output is larger than the limit.
+const (
+	KeepHead Keep = iota // Keep the first bytes written.
+	KeepTail             // Keep the last bytes written.
+)
+
+type limitOutput struct {
+	std  any
+	max  int
+	keep Keep
+}
+
+// LimitOutput limits the output stored in std, which may be VAR, *[]byte,
+// or *string, to max bytes, for use with WithStd, WithStdCombined, and
+// WithStdTee. Output beyond the limit is dropped as it is written, so a
+// command may write any amount. If output was dropped, a note with the
+// number of bytes dropped is added where the output was cut, such as
+// "\n[... 2048 bytes truncated]\n".
+func LimitOutput(std any, max int, keep Keep) any {
+	return &limitOutput{std: std, max: max, keep: keep}
+}
+
+// limitBuffer keeps up to max bytes written. The tail is kept in a ring
+// buffer, where pos is the start of the oldest byte once it is full.
+type limitBuffer struct {
+	mu    sync.Mutex
+	max   int
+	keep  Keep
+	buf   []byte
+	pos   int
+	total int64 // Bytes written.
+}
+
+func (lb *limitBuffer) Write(p []byte) (int, error) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.total += int64(len(p))
+	n := len(p)
+	if lb.keep == KeepTail && len(p) > lb.max {
+		p = p[len(p)-max(lb.max, 0):]
+	}
+	fill := min(len(p), max(lb.max-len(lb.buf), 0))
+	lb.buf = append(lb.buf, p[:fill]...)
+	if lb.keep == KeepHead {
+		return n, nil
+	}
+	for p = p[fill:]; len(p) > 0; {
+		c := copy(lb.buf[lb.pos:], p)
+		p = p[c:]
+		lb.pos = (lb.pos + c) % lb.max
+	}
+	return n, nil
+}
+
+// Bytes returns a copy of the kept output, with a note if output was dropped.
+func (lb *limitBuffer) Bytes() []byte {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	b := make([]byte, 0, len(lb.buf))
+	b = append(append(b, lb.buf[lb.pos:]...), lb.buf[:lb.pos]...)
+	dropped := lb.total - int64(len(b))
+	if dropped == 0 {
+		return b
+	}
+	note := fmt.Sprintf("[... %d bytes truncated]", dropped)
+	if lb.keep == KeepTail {
+		return append([]byte(note+"\n"), b...)
+	}
+	return append(b, "\n"+note+"\n"...)
+}
+
+func (lb *limitBuffer) Reset() {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.buf, lb.pos, lb.total = lb.buf[:0], 0, 0
+}
@@ -0,0 +1,50 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+func TestLimitBuffer(t *testing.T) {
+	for _, tc := range []struct {
+		keep   Keep
+		max    int
+		writes []string
+		want   string
+	}{
+		{KeepHead, 5, []string{"abc", "defg", "hi"}, "abcde\n[... 4 bytes truncated]\n"},
+		{KeepHead, 5, []string{"abc", "de"}, "abcde"},
+		{KeepTail, 5, []string{"abc", "defg", "hi"}, "[... 4 bytes truncated]\nefghi"},
+		{KeepTail, 5, []string{"abcdefgh", "ij"}, "[... 5 bytes truncated]\nfghij"},
+		{KeepTail, 5, []string{"ab", "c"}, "abc"},
+		{KeepTail, 0, []string{"ab"}, "[... 2 bytes truncated]\n"},
+	} {
+		lb := &limitBuffer{max: tc.max, keep: tc.keep}
+		for _, w := range tc.writes {
+			lb.Write([]byte(w))
+		}
+		if g := string(lb.Bytes()); g != tc.want {
+			t.Errorf("keep %d max %d %q: got %q, want %q", tc.keep, tc.max, tc.writes, g, tc.want)
+		}
+		lb.Reset()
+		if g := lb.Bytes(); len(g) != 0 {
+			t.Errorf("got %q after reset", g)
+		}
+	}
+}
+
+func TestLimitOutput(t *testing.T) {
+	var out string
+	st := &State{Env: Environ()}
+	err := Run(context.Background(), st, WithStd(LimitOutput(&out, 2, KeepTail), nil, Exec("go", "env", "GOOS")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	goos := runtime.GOOS + "\n"
+	want := fmt.Sprintf("[... %d bytes truncated]\n%s", len(goos)-2, goos[len(goos)-2:])
+	if out != want {
+		t.Fatalf("got %q, want %q", out, want)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import "fmt"
+
+// Level is the severity of a logged message.
+type Level int8
+
+// Log levels, in increasing severity. Log and Logf log at LevelInfo and
+// Error at LevelError.
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int8(l))
+}
+
+// VerboseVar is the State variable that, when set to true, logs messages at
+// LevelDebug regardless of State.Level. Commands from a Registry set it
+// with the "-v" flag; other commands may declare a bool Flag of this name.
+const VerboseVar = "v"
+
+// Enabled reports if messages at level l are logged. Messages below
+// State.Level are not logged, unless l is LevelDebug and VerboseVar is set.
+// Errors are always logged.
+func (st *State) Enabled(l Level) bool {
+	if l >= st.Level || l >= LevelError {
+		return true
+	}
+	v, _ := st.Get(VerboseVar).(bool)
+	return v && l >= LevelDebug
+}
+
+// LogLevel logs the message at level l. Messages below LevelError are sent
+// to the MsgLogger, with warnings prefixed with "warning: ", and errors are
+// sent to the ErrorLogger.
+func (st *State) LogLevel(l Level, msg string) {
+	if l >= LevelWarn && l < LevelError && st.emitting() {
+		st.emit(Event{Type: EventWarn, Detail: msg})
+	}
+	if !st.Enabled(l) {
+		return
+	}
+	if l >= LevelError {
+		st.Error(logError(msg))
+		return
+	}
+	if st.MsgLogger == nil {
+		return
+	}
+	if l >= LevelWarn {
+		msg = "warning: " + msg
+	}
+	st.MsgLogger(st.Redact(msg))
+}
+
+// Debugf logs a formatted message at LevelDebug.
+func (st *State) Debugf(f string, v ...any) {
+	if !st.Enabled(LevelDebug) {
+		return
+	}
+	st.LogLevel(LevelDebug, fmt.Sprintf(f, v...))
+}
+
+// Warnf logs a formatted message at LevelWarn.
+func (st *State) Warnf(f string, v ...any) {
+	if !st.Enabled(LevelWarn) {
+		return
+	}
+	st.LogLevel(LevelWarn, fmt.Sprintf(f, v...))
+}
+
+// logError is a message logged at LevelError.
+type logError string
+
+func (err logError) Error() string { return string(err) }
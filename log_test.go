@@ -0,0 +1,64 @@
+package task
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestLogLevel(t *testing.T) {
+	var msgs, errs []string
+	st := &State{
+		MsgLogger:   func(msg string) { msgs = append(msgs, msg) },
+		ErrorLogger: func(err error) { errs = append(errs, err.Error()) },
+	}
+	logAll := func() {
+		msgs, errs = nil, nil
+		st.Debugf("debug %d", 1)
+		st.Logf("info %d", 2)
+		st.Warnf("warn %d", 3)
+		st.LogLevel(LevelError, "error 4")
+	}
+
+	logAll()
+	if g, w := msgs, []string{"info 2", "warning: warn 3"}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("default got %q, want %q", g, w)
+	}
+	if g, w := errs, []string{"error 4"}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("default errors got %q, want %q", g, w)
+	}
+
+	st.Level = LevelWarn
+	logAll()
+	if g, w := msgs, []string{"warning: warn 3"}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("warn got %q, want %q", g, w)
+	}
+
+	st.Level = LevelError + 1
+	logAll()
+	if len(msgs) != 0 || len(errs) != 1 {
+		t.Fatalf("expected only errors, got %q %q", msgs, errs)
+	}
+}
+
+func TestVerboseFlag(t *testing.T) {
+	r := &Registry{}
+	r.Register("build", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		st.Debugf("detail")
+		return nil
+	}))
+	run := func(args ...string) []string {
+		var msgs []string
+		st := &State{MsgLogger: func(msg string) { msgs = append(msgs, msg) }}
+		if err := Run(context.Background(), st, r.Command("reg", "").Exec(args)); err != nil {
+			t.Fatal(err)
+		}
+		return msgs
+	}
+	if g := run("build"); len(g) != 0 {
+		t.Fatalf("expected debug hidden, got %q", g)
+	}
+	if g, w := run("-v", "build"), []string{"detail"}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+}
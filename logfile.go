@@ -0,0 +1,197 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogFile is a log file that is rotated when it grows past MaxSize or
+// is older than MaxAge, for long-running task daemons. The old file is
+// renamed to Filename with a timestamp suffix, such as
+// "task.log.20180102T150405.000", and optionally compressed.
+// Set the State loggers to Log and LogError to use it.
+type LogFile struct {
+	Filename   string
+	MaxSize    int64         // Rotate when the file is larger than this, if set.
+	MaxAge     time.Duration // Rotate when the file was opened longer ago than this, if set.
+	MaxBackups int           // Remove the oldest rotated files past this count, if set.
+	Compress   bool          // Gzip rotated files.
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+	now    func() time.Time
+}
+
+const logFileTime = "20060102T150405.000"
+
+func (lf *LogFile) time() time.Time {
+	if lf.now != nil {
+		return lf.now()
+	}
+	return time.Now()
+}
+
+func (lf *LogFile) open() error {
+	if err := ensureDir(lf.Filename); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(lf.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	lf.f = f
+	lf.size = fi.Size()
+	lf.opened = lf.time()
+	return nil
+}
+
+// Write p to the log file, rotating it first if needed.
+func (lf *LogFile) Write(p []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.f == nil {
+		if err := lf.open(); err != nil {
+			return 0, err
+		}
+	}
+	full := lf.MaxSize > 0 && lf.size > 0 && lf.size+int64(len(p)) > lf.MaxSize
+	old := lf.MaxAge > 0 && lf.time().Sub(lf.opened) >= lf.MaxAge
+	if full || old {
+		if err := lf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := lf.f.Write(p)
+	lf.size += int64(n)
+	return n, err
+}
+
+// Rotate the log file now.
+func (lf *LogFile) Rotate() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	return lf.rotate()
+}
+
+func (lf *LogFile) rotate() error {
+	if lf.f != nil {
+		err := lf.f.Close()
+		lf.f = nil
+		if err != nil {
+			return err
+		}
+	}
+	backup := lf.Filename + "." + lf.time().UTC().Format(logFileTime)
+	err := os.Rename(lf.Filename, backup)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return err
+	case lf.Compress:
+		if err := gzipFile(backup); err != nil {
+			return err
+		}
+	}
+	if err := lf.prune(); err != nil {
+		return err
+	}
+	return lf.open()
+}
+
+// prune removes the oldest rotated files past MaxBackups.
+func (lf *LogFile) prune() error {
+	if lf.MaxBackups <= 0 {
+		return nil
+	}
+	list, err := filepath.Glob(lf.Filename + ".*")
+	if err != nil {
+		return err
+	}
+	prefix := lf.Filename + "."
+	backups := list[:0]
+	for _, fn := range list {
+		ts := strings.TrimSuffix(strings.TrimPrefix(fn, prefix), ".gz")
+		if _, err := time.Parse(logFileTime, ts); err == nil {
+			backups = append(backups, fn)
+		}
+	}
+	if len(backups) <= lf.MaxBackups {
+		return nil
+	}
+	sort.Strings(backups)
+	var errs []error
+	for _, fn := range backups[:len(backups)-lf.MaxBackups] {
+		errs = append(errs, os.Remove(fn))
+	}
+	return errors.Join(errs...)
+}
+
+// gzipFile compresses fn to fn.gz and removes fn.
+func gzipFile(fn string) error {
+	in, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(fn+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	_, err = io.Copy(gz, in)
+	if cerr := gz.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(fn + ".gz")
+		return err
+	}
+	in.Close()
+	return os.Remove(fn)
+}
+
+// Close the log file. It is reopened on the next write.
+func (lf *LogFile) Close() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.f == nil {
+		return nil
+	}
+	err := lf.f.Close()
+	lf.f = nil
+	return err
+}
+
+// Log writes msg as a timestamped line. It may be used as State.MsgLogger.
+func (lf *LogFile) Log(msg string) {
+	fmt.Fprintf(lf, "%s %s\n", lf.time().Format(time.RFC3339), msg)
+}
+
+// LogError writes err as a timestamped line. It may be used as
+// State.ErrorLogger.
+func (lf *LogFile) LogError(err error) {
+	fmt.Fprintf(lf, "%s error: %v\n", lf.time().Format(time.RFC3339), err)
+}
@@ -0,0 +1,76 @@
+package task
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestLogFile(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2018, 1, 2, 15, 4, 5, 0, time.UTC)
+	lf := &LogFile{
+		Filename:   filepath.Join(dir, "log", "task.log"),
+		MaxSize:    80,
+		MaxAge:     time.Hour,
+		MaxBackups: 2,
+		Compress:   true,
+		now:        func() time.Time { return now },
+	}
+	defer lf.Close()
+	st := &State{MsgLogger: lf.Log, ErrorLogger: lf.LogError}
+
+	st.Log("first message") // 35 bytes.
+	st.Log("second message")
+	now = now.Add(time.Minute)
+	st.Error(errors.New("failed")) // Rotates by size.
+	now = now.Add(time.Minute)
+	st.Log("third message")
+	now = now.Add(2 * time.Hour)
+	st.Log("fourth message") // Rotates by age.
+	now = now.Add(time.Minute)
+	if err := lf.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := filepath.Glob(lf.Filename + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(list)
+	want := []string{
+		lf.Filename + ".20180102T170605.000.gz",
+		lf.Filename + ".20180102T170705.000.gz",
+	}
+	if len(list) != len(want) || list[0] != want[0] || list[1] != want[1] {
+		t.Fatalf("got backups %q, want %q", list, want)
+	}
+	f, err := os.Open(list[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := string(b), "2018-01-02T15:05:05Z error: failed\n2018-01-02T15:06:05Z third message\n"; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+	fi, err := os.Stat(lf.Filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != 0 {
+		t.Fatalf("got size %d after rotate", fi.Size())
+	}
+}
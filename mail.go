@@ -0,0 +1,181 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// MailOptions configures SendMail. Addr, Username, Password, From, and To
+// are expanded with ExpandEnv.
+type MailOptions struct {
+	Addr     string // SMTP server host:port.
+	Username string // If set, authenticate with PLAIN auth.
+	Password string
+	From     string
+	To       []string
+
+	// Subject and Body are text/template templates. They are executed
+	// with a MailData value.
+	Subject string
+	Body    string
+
+	// ImplicitTLS connects with TLS, usually on port 465. Otherwise the
+	// server must support STARTTLS, usually on port 587.
+	ImplicitTLS bool
+
+	// TLS configures the connection. If nil, the default configuration
+	// for the Addr host is used.
+	TLS *tls.Config
+}
+
+// MailData is the template data for the mail subject and body.
+// The State methods, such as Get, may be called from the template.
+type MailData struct {
+	*State
+	Failed bool   // True if the script has failed.
+	Action string // Name of the failed Named action, if any.
+	Err    error  // Error the script failed with.
+}
+
+// SendMail sends a plain text email through an SMTP server over TLS.
+// Used with Defer, the templates may report if the script failed.
+func SendMail(opts MailOptions) Action {
+	subject := template.Must(template.New("subject").Parse(opts.Subject))
+	body := template.Must(template.New("body").Parse(opts.Body))
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		data := MailData{State: st}
+		data.Action, data.Err = st.Failure()
+		data.Failed = data.Err != nil
+
+		var subj, text bytes.Buffer
+		if err := subject.Execute(&subj, data); err != nil {
+			return fmt.Errorf("mail subject: %w", err)
+		}
+		if err := body.Execute(&text, data); err != nil {
+			return fmt.Errorf("mail body: %w", err)
+		}
+		from, err := ExpandEnvErr(opts.From, st)
+		if err != nil {
+			return err
+		}
+		to := make([]string, len(opts.To))
+		for i, t := range opts.To {
+			to[i], err = ExpandEnvErr(t, st)
+			if err != nil {
+				return err
+			}
+		}
+		if dryRun(st, "mail: %s (%s)", strings.Join(to, ", "), subj.String()) {
+			return nil
+		}
+		msg := mailMessage(from, to, subj.String(), text.String())
+		var login [3]string
+		for i, v := range []string{opts.Addr, opts.Username, opts.Password} {
+			login[i], err = ExpandEnvErr(v, st)
+			if err != nil {
+				return err
+			}
+		}
+		err = sendMail(ctx, opts, login[0], login[1], login[2], from, to, msg)
+		if err != nil {
+			return fmt.Errorf("mail: %w", err)
+		}
+		return nil
+	})
+}
+
+func mailMessage(from string, to []string, subject, body string) []byte {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "From: %s\r\n", from)
+	fmt.Fprintf(buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	for _, line := range strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n") {
+		buf.WriteString(line)
+		buf.WriteString("\r\n")
+	}
+	return buf.Bytes()
+}
+
+func sendMail(ctx context.Context, opts MailOptions, addr, username, password, from string, to []string, msg []byte) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	cfg := &tls.Config{}
+	if opts.TLS != nil {
+		cfg = opts.TLS.Clone()
+	}
+	if len(cfg.ServerName) == 0 {
+		cfg.ServerName = host
+	}
+
+	var conn net.Conn
+	if opts.ImplicitTLS {
+		d := &tls.Dialer{Config: cfg}
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	} else {
+		d := &net.Dialer{}
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(dl)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if !opts.ImplicitTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s does not support STARTTLS", addr)
+		}
+		if err := c.StartTLS(cfg); err != nil {
+			return err
+		}
+	}
+	if len(username) > 0 {
+		if err := c.Auth(smtp.PlainAuth("", username, password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, t := range to {
+		if err := c.Rcpt(t); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
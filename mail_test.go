@@ -0,0 +1,181 @@
+package task
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+// fakeSMTP accepts a single STARTTLS session and returns the commands and
+// message data it received.
+func fakeSMTP(t *testing.T, cert tls.Certificate) (addr string, result <-chan []string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	ch := make(chan []string, 1)
+	go func() {
+		var got []string
+		defer func() { ch <- got }()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 fake")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			cmd, _, _ := strings.Cut(line, " ")
+			got = append(got, line)
+			switch strings.ToUpper(cmd) {
+			default:
+				reply("250 ok")
+			case "EHLO":
+				reply("250-fake")
+				if _, ok := conn.(*tls.Conn); !ok {
+					reply("250-STARTTLS")
+				}
+				reply("250 AUTH PLAIN")
+			case "STARTTLS":
+				reply("220 go")
+				tc := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+				conn, r = tc, bufio.NewReader(tc)
+			case "AUTH":
+				reply("235 ok")
+			case "DATA":
+				reply("354 go")
+				var data []string
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					line = strings.TrimRight(line, "\r\n")
+					if line == "." {
+						break
+					}
+					data = append(data, line)
+				}
+				got = append(got, strings.Join(data, "\n"))
+				reply("250 ok")
+			case "QUIT":
+				reply("221 bye")
+				return
+			}
+		}
+	}()
+	return l.Addr().String(), ch
+}
+
+func TestSendMail(t *testing.T) {
+	cert, pool := testCert(t)
+	addr, result := fakeSMTP(t, cert)
+
+	st := &State{
+		Env:         map[string]string{"SMTP": addr, "SMTP_PASS": "secret"},
+		ErrorLogger: func(err error) {},
+	}
+	st.Set("version", "v1.2.0")
+	mail := SendMail(MailOptions{
+		Addr:     "$SMTP",
+		Username: "deploy",
+		Password: "$SMTP_PASS",
+		From:     "deploy@example.com",
+		To:       []string{"ops@example.com"},
+		Subject:  `{{if .Failed}}FAILED{{else}}OK{{end}} deploy {{.Get "version"}}`,
+		Body:     "{{if .Failed}}{{.Action}}: {{.Err}}{{end}}",
+		TLS:      &tls.Config{RootCAs: pool},
+	})
+	fail := ActionFunc(func(ctx context.Context, st *State, sc Script) error { return errors.New("disk full") })
+	err := Run(context.Background(), st, NewScript(Defer(mail), Named("migrate", fail)))
+	if err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("expected script error, got %v", err)
+	}
+
+	got := strings.Join(<-result, "\n")
+	for _, want := range []string{
+		"STARTTLS",
+		"AUTH PLAIN",
+		"MAIL FROM:<deploy@example.com>",
+		"RCPT TO:<ops@example.com>",
+		"Subject: FAILED deploy v1.2.0",
+		"migrate: disk full",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestSendMailRequireTLS(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		conn.Write([]byte("220 fake\r\n"))
+		r.ReadString('\n')
+		conn.Write([]byte("250 fake\r\n"))
+		r.ReadString('\n')
+	}()
+
+	st := &State{ErrorLogger: func(err error) {}}
+	err = Run(context.Background(), st, SendMail(MailOptions{
+		Addr: l.Addr().String(),
+		From: "a@example.com",
+		To:   []string{"b@example.com"},
+	}))
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("expected STARTTLS error, got %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Exit codes used by Main.
+const (
+	ExitOK    = 0
+	ExitError = 1
+	ExitUsage = 2
+)
+
+// MainStopTimeout is how long Main waits for the command to stop after
+// an interrupt.
+var MainStopTimeout = time.Second * 5
+
+// Main runs cmd with the program arguments under Start using the
+// DefaultState, then exits the process. A usage error is printed to stderr
+// and exits with ExitUsage, any other error exits with ExitError. If the
+// command does not stop in time after an interrupt, the goroutine stacks
+// are printed after the error.
+//
+//	func main() {
+//		task.Main(&task.Command{ ... })
+//	}
+func Main(cmd *Command) {
+	st := DefaultState()
+	os.Exit(runMain(context.Background(), st, cmd, os.Args[1:]))
+}
+
+func runMain(ctx context.Context, st *State, cmd *Command, args []string) int {
+	err := Start(ctx, MainStopTimeout, func(ctx context.Context) error {
+		return Run(ctx, st, cmd.Exec(args))
+	})
+	if err == nil {
+		return ExitOK
+	}
+	var usage ErrUsage
+	if errors.As(err, &usage) {
+		fmt.Fprint(st.Stderr, usage.Error())
+		return ExitUsage
+	}
+	fmt.Fprintln(st.Stderr, err)
+	var timeout *ShutdownTimeoutError
+	if errors.As(err, &timeout) {
+		fmt.Fprintf(st.Stderr, "\n%s", timeout.Stack)
+	}
+	return ExitError
+}
@@ -0,0 +1,42 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRunMain(t *testing.T) {
+	cmd := &Command{
+		Name: "m",
+		Commands: []*Command{
+			{Name: "ok", Action: ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+				return nil
+			})},
+			{Name: "fail", Action: ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+				return errors.New("failed")
+			})},
+		},
+	}
+	list := []struct {
+		Args   string
+		Code   int
+		Stderr string
+	}{
+		{Args: "ok", Code: ExitOK},
+		{Args: "fail", Code: ExitError, Stderr: "failed\n"},
+		{Args: "nope", Code: ExitUsage, Stderr: "invalid command \"nope\"\nm\n\n\tok\n\tfail\n"},
+	}
+	for _, item := range list {
+		stderr := &strings.Builder{}
+		st := &State{Stdout: stderr, Stderr: stderr}
+		code := runMain(context.Background(), st, cmd, strings.Fields(item.Args))
+		if code != item.Code {
+			t.Errorf("%s: got code %d, want %d", item.Args, code, item.Code)
+		}
+		if g, w := stderr.String(), item.Stderr; g != w {
+			t.Errorf("%s: got stderr %q, want %q", item.Args, g, w)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MatrixCombinations returns each combination of the matrix values, the
+// cross product of the value lists. The last variable in sorted name order
+// changes fastest. A variable with no values results in no combinations.
+func MatrixCombinations(matrix map[string][]string) []map[string]string {
+	names := make([]string, 0, len(matrix))
+	for name := range matrix {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := []map[string]string{{}}
+	for _, name := range names {
+		var next []map[string]string
+		for _, prev := range list {
+			for _, v := range matrix[name] {
+				c := make(map[string]string, len(prev)+1)
+				for k, pv := range prev {
+					c[k] = pv
+				}
+				c[name] = v
+				next = append(next, c)
+			}
+		}
+		list = next
+	}
+	return list
+}
+
+// matrixName returns a short description of the combination, such as
+// "goarch=amd64 goos=linux".
+func matrixName(c map[string]string) string {
+	names := make([]string, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = name + "=" + c[name]
+	}
+	return strings.Join(names, " ")
+}
+
+// runMatrix runs the task once for each matrix combination. Sequential
+// runs stop at the first error. Parallel runs each use a copy of the state
+// and cancel the other runs on the first error, returning all errors.
+// The output lines of parallel runs are prefixed with the task name and
+// combination.
+func (r *Registry) runMatrix(t *Task) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		combos := MatrixCombinations(t.Matrix)
+		if !t.Parallel {
+			for _, c := range combos {
+				prev := make(map[string]interface{}, len(c))
+				for k, v := range c {
+					prev[k] = st.Get(k)
+					st.Set(k, v)
+				}
+				err := sc.RunAction(ctx, st, runTask(t))
+				for k, v := range prev {
+					if v == nil {
+						st.Delete(k)
+					} else {
+						st.Set(k, v)
+					}
+				}
+				if err != nil {
+					return fmt.Errorf("task %q [%s]: %w", t.Name, matrixName(c), err)
+				}
+			}
+			return nil
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		names := make([]string, len(combos))
+		for i, c := range combos {
+			names[i] = t.Name + " " + matrixName(c)
+		}
+		prefixes := Prefixes(names, r.ColorOutput || st.Color)
+		lock := &sync.Mutex{}
+
+		errs := make([]error, len(combos))
+		wg := &sync.WaitGroup{}
+		for i, c := range combos {
+			cst := st.copy()
+			for k, v := range c {
+				cst.Set(k, v)
+			}
+			wg.Add(1)
+			go func(i int, c map[string]string) {
+				defer wg.Done()
+				err := Run(ctx, cst, WithPrefix(prefixes[i], lock, r.GroupOutput, runTask(t)))
+				if err != nil {
+					errs[i] = fmt.Errorf("task %q [%s]: %w", t.Name, matrixName(c), err)
+					cancel()
+				}
+			}(i, c)
+		}
+		wg.Wait()
+		return errors.Join(errs...)
+	})
+}
@@ -0,0 +1,91 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMatrixCombinations(t *testing.T) {
+	got := MatrixCombinations(map[string][]string{
+		"goos":   {"linux", "windows"},
+		"goarch": {"amd64", "arm64"},
+	})
+	var names []string
+	for _, c := range got {
+		names = append(names, matrixName(c))
+	}
+	want := []string{
+		"goarch=amd64 goos=linux",
+		"goarch=amd64 goos=windows",
+		"goarch=arm64 goos=linux",
+		"goarch=arm64 goos=windows",
+	}
+	if g, w := strings.Join(names, ","), strings.Join(want, ","); g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+	if got := MatrixCombinations(map[string][]string{"a": {"1"}, "b": nil}); len(got) != 0 {
+		t.Fatalf("expected no combinations, got %v", got)
+	}
+}
+
+func TestRegistryMatrix(t *testing.T) {
+	for _, parallel := range []bool{false, true} {
+		r := &Registry{}
+		var mu sync.Mutex
+		var ran []string
+		rt := r.Register("cross", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			mu.Lock()
+			defer mu.Unlock()
+			ran = append(ran, st.Env["TARGET"])
+			if st.Get("goos") == "windows" && st.Get("goarch") == "arm64" {
+				return errors.New("unsupported")
+			}
+			return nil
+		}))
+		rt.Matrix = map[string][]string{
+			"goos":   {"linux", "windows"},
+			"goarch": {"amd64", "arm64"},
+		}
+		rt.Env = map[string]string{"TARGET": "${goos}/${goarch}"}
+		rt.Parallel = parallel
+
+		st := &State{}
+		err := Run(context.Background(), st, r.Action("cross"))
+		if err == nil || !strings.Contains(err.Error(), `task "cross" [goarch=arm64 goos=windows]: unsupported`) {
+			t.Fatalf("parallel=%t: unexpected error %v", parallel, err)
+		}
+		if st.Get("goos") != nil {
+			t.Fatalf("parallel=%t: matrix value leaked into state", parallel)
+		}
+		if parallel {
+			// Other runs may be canceled by the failure.
+			if len(ran) == 0 {
+				t.Fatal("parallel: no runs")
+			}
+			continue
+		}
+		if g, w := strings.Join(ran, ","), "linux/amd64,windows/amd64,linux/arm64,windows/arm64"; g != w {
+			t.Fatalf("got %q, want %q", g, w)
+		}
+	}
+}
+
+func TestRegistryMatrixParallelNamed(t *testing.T) {
+	r := &Registry{}
+	noop := ActionFunc(func(ctx context.Context, st *State, sc Script) error { return nil })
+	rt := r.Register("cross", Named("build", noop))
+	rt.Matrix = map[string][]string{
+		"goos":   {"linux", "windows", "darwin"},
+		"goarch": {"amd64", "arm64"},
+	}
+	rt.Parallel = true
+
+	st := &State{}
+	growNames(t, st)
+	if err := Run(context.Background(), st, Named("all", r.Action("cross"))); err != nil {
+		t.Fatal(err)
+	}
+}
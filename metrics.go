@@ -0,0 +1,154 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMetricBuckets are the duration histogram buckets, in seconds, used
+// when Metrics.Buckets is not set.
+var DefaultMetricBuckets = []float64{.1, .5, 1, 5, 10, 30, 60, 300, 600, 1800, 3600}
+
+// Metrics counts the runs, failures, and durations of Named actions, such
+// as Registry tasks, and serves them in the Prometheus text format, for
+// programs that run tasks on a schedule under Start:
+//
+//	m := &task.Metrics{}
+//	http.Handle("/metrics", m)
+//	err := task.Run(ctx, st, m.Collect(r.Action("sync")))
+//
+// Actions are identified by the path of their enclosing Named actions,
+// joined with "/". The zero value is ready to use.
+type Metrics struct {
+	Buckets []float64 // Upper bounds of the duration histogram in seconds.
+
+	mu      sync.Mutex
+	actions map[string]*actionMetrics
+}
+
+type actionMetrics struct {
+	runs, failures int64
+	buckets        []int64
+	sum            float64
+	lastSuccess    time.Time
+}
+
+// Collect runs the action a, recording each Named action it runs.
+func (m *Metrics) Collect(a Action) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		orig := st.eventFuncs
+		st.eventFuncs = append(orig[:len(orig):len(orig)], func(e Event) {
+			if e.Type == EventFinish {
+				m.Observe(e.Action, e.Duration, len(e.Err) > 0)
+			}
+		})
+		err := sc.RunAction(ctx, st, a)
+		st.eventFuncs = orig
+		return err
+	})
+}
+
+// Observe records a run of the named action.
+func (m *Metrics) Observe(name string, d time.Duration, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.actions == nil {
+		m.actions = make(map[string]*actionMetrics)
+	}
+	bounds := m.bounds()
+	am := m.actions[name]
+	if am == nil {
+		am = &actionMetrics{buckets: make([]int64, len(bounds))}
+		m.actions[name] = am
+	}
+	am.runs++
+	if failed {
+		am.failures++
+	} else {
+		am.lastSuccess = time.Now()
+	}
+	sec := d.Seconds()
+	am.sum += sec
+	for i, b := range bounds {
+		if sec <= b {
+			am.buckets[i]++
+		}
+	}
+}
+
+func (m *Metrics) bounds() []float64 {
+	if len(m.Buckets) > 0 {
+		return m.Buckets
+	}
+	return DefaultMetricBuckets
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics to w in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.actions))
+	for name := range m.actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bounds := m.bounds()
+
+	buf := &strings.Builder{}
+	header := func(name, typ, help string) {
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+	header("task_runs_total", "counter", "Number of runs of the action.")
+	for _, name := range names {
+		fmt.Fprintf(buf, "task_runs_total{action=%s} %d\n", quoteLabel(name), m.actions[name].runs)
+	}
+	header("task_failures_total", "counter", "Number of failed runs of the action.")
+	for _, name := range names {
+		fmt.Fprintf(buf, "task_failures_total{action=%s} %d\n", quoteLabel(name), m.actions[name].failures)
+	}
+	header("task_duration_seconds", "histogram", "Duration of the action runs.")
+	for _, name := range names {
+		am, label := m.actions[name], quoteLabel(name)
+		for i, b := range bounds {
+			fmt.Fprintf(buf, "task_duration_seconds_bucket{action=%s,le=\"%s\"} %d\n", label, formatFloat(b), am.buckets[i])
+		}
+		fmt.Fprintf(buf, "task_duration_seconds_bucket{action=%s,le=\"+Inf\"} %d\n", label, am.runs)
+		fmt.Fprintf(buf, "task_duration_seconds_sum{action=%s} %s\n", label, formatFloat(am.sum))
+		fmt.Fprintf(buf, "task_duration_seconds_count{action=%s} %d\n", label, am.runs)
+	}
+	header("task_last_success_timestamp_seconds", "gauge", "Unix time the action last succeeded.")
+	for _, name := range names {
+		if t := m.actions[name].lastSuccess; !t.IsZero() {
+			fmt.Fprintf(buf, "task_last_success_timestamp_seconds{action=%s} %d\n", quoteLabel(name), t.Unix())
+		}
+	}
+	n, err := io.WriteString(w, buf.String())
+	return int64(n), err
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// quoteLabel returns the quoted Prometheus label value.
+func quoteLabel(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v) + `"`
+}
@@ -0,0 +1,47 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	m := &Metrics{Buckets: []float64{1, 10}}
+	r := &Registry{}
+	fail := false
+	r.Register("sync", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		if fail {
+			return errors.New("sync failed")
+		}
+		return nil
+	}))
+	for _, f := range []bool{false, true, false} {
+		fail = f
+		Run(context.Background(), &State{}, m.Collect(r.Action("sync")))
+	}
+	m.Observe(`a"b`, 5*time.Second, false)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	got := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE task_runs_total counter\n",
+		`task_runs_total{action="sync"} 3` + "\n",
+		`task_failures_total{action="sync"} 1` + "\n",
+		`task_duration_seconds_bucket{action="sync",le="1"} 3` + "\n",
+		`task_duration_seconds_bucket{action="sync",le="+Inf"} 3` + "\n",
+		`task_duration_seconds_count{action="sync"} 3` + "\n",
+		`task_duration_seconds_bucket{action="a\"b",le="1"} 0` + "\n",
+		`task_duration_seconds_bucket{action="a\"b",le="10"} 1` + "\n",
+		`task_duration_seconds_sum{action="a\"b"} 5` + "\n",
+		`task_last_success_timestamp_seconds{action="sync"} `,
+	} {
+		if !strings.Contains(got, line) {
+			t.Errorf("missing %q in:\n%s", line, got)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// NotifyClient is the HTTP client used by Notify.
+var NotifyClient = http.DefaultClient
+
+// Notify posts the payload as JSON to the webhook URL. The webhookURL is
+// expanded with ExpandEnv. A string or []byte payload is sent as is,
+// a func(*State) any is called when the action runs and its result
+// marshaled, and any other value is marshaled to JSON.
+func Notify(webhookURL any, payload any) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		u, err := ExpandEnvErr(webhookURL, st)
+		if err != nil {
+			return err
+		}
+		if dryRun(st, "notify: %s", u) {
+			return nil
+		}
+		if f, ok := payload.(func(st *State) any); ok {
+			return postJSON(ctx, u, f(st))
+		}
+		return postJSON(ctx, u, payload)
+	})
+}
+
+func postJSON(ctx context.Context, u string, payload any) error {
+	var body []byte
+	switch v := payload.(type) {
+	case []byte:
+		body = v
+	case string:
+		body = []byte(v)
+	default:
+		var err error
+		body, err = json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("notify: %w", err)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("notify: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := NotifyClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("notify: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("notify: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// SlackNotify defers a Slack webhook message that reports if the script
+// named name succeeded or failed, how long it ran, and on failure the name
+// of the failing Named action and the error. Add it at the start of the
+// script so the duration covers the whole run. The message is sent after
+// the script finishes even if it fails.
+func SlackNotify(webhookURL any, name string) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		start := time.Now()
+		sc.Defer(Notify(webhookURL, func(st *State) any {
+			return map[string]string{"text": slackText(name, time.Since(start), st)}
+		}))
+		return nil
+	})
+}
+
+func slackText(name string, d time.Duration, st *State) string {
+	d = d.Round(time.Millisecond)
+	action, err := st.Failure()
+	if err == nil {
+		return fmt.Sprintf(":white_check_mark: %s succeeded in %v", name, d)
+	}
+	if len(action) == 0 {
+		return fmt.Sprintf(":x: %s failed in %v: %v", name, d, err)
+	}
+	return fmt.Sprintf(":x: %s failed in %v at %q: %v", name, d, action, err)
+}
@@ -0,0 +1,75 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSlackNotify(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg struct{ Text string }
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Error(err)
+		}
+		got = append(got, msg.Text)
+	}))
+	defer srv.Close()
+
+	ok := ActionFunc(func(ctx context.Context, st *State, sc Script) error { return nil })
+	fail := ActionFunc(func(ctx context.Context, st *State, sc Script) error { return errors.New("boom") })
+
+	st := &State{Env: map[string]string{"HOOK": srv.URL}}
+	err := Run(context.Background(), st, NewScript(SlackNotify("$HOOK", "release"), Named("build", ok)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st = &State{Env: map[string]string{"HOOK": srv.URL}, ErrorLogger: func(err error) {}}
+	err = Run(context.Background(), st, NewScript(SlackNotify("$HOOK", "release"), Named("build", ok), Named("deploy", fail)))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d messages, want 2: %q", len(got), got)
+	}
+	if !strings.HasPrefix(got[0], ":white_check_mark: release succeeded in ") {
+		t.Errorf("success message: %q", got[0])
+	}
+	if !strings.HasPrefix(got[1], ":x: release failed in ") || !strings.HasSuffix(got[1], ` at "deploy": boom`) {
+		t.Errorf("failure message: %q", got[1])
+	}
+}
+
+func TestNotify(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("content type %q", ct)
+		}
+		var v map[string]any
+		json.NewDecoder(r.Body).Decode(&v)
+		got, _ = v["status"].(string)
+		if got == "bad" {
+			http.Error(w, "no", http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	st := &State{}
+	err := Run(context.Background(), st, Notify(srv.URL, map[string]string{"status": "done"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "done" {
+		t.Fatalf("got %q", got)
+	}
+	err = Run(context.Background(), st, Notify(srv.URL, `{"status":"bad"}`))
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Fatalf("expected status error, got %v", err)
+	}
+}
@@ -9,12 +9,12 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
-
-	"github.com/kardianos/task/fsop"
+	"sync"
 )
 
 // Env sets one or more environment variables.
@@ -27,15 +27,19 @@ func Env(env ...string) Action {
 			st.Env = make(map[string]string, len(env))
 		}
 		for i, e := range env {
-			env[i] = ExpandEnv(e, st)
+			s, err := ExpandEnvErr(e, st)
+			if err != nil {
+				return err
+			}
+			env[i] = s
 		}
 		for _, e := range env {
 			k, v, ok := strings.Cut(e, "=")
 			if !ok {
-				delete(st.Env, k)
+				st.Unsetenv(k)
 				continue
 			}
-			st.Env[k] = v
+			st.Setenv(k, v)
 		}
 		return nil
 	})
@@ -45,24 +49,60 @@ func Env(env ...string) Action {
 // Var names may take the form of "text${var}suffix".
 // The source of the value will first look for current state bucket,
 // then in the state Env.
-// The text may be VAR or string.
+// The text may be VAR, string, or Literal, which is not expanded.
+// ExpandEnv panics where ExpandEnvErr returns an error.
 func ExpandEnv(text any, st *State) string {
+	s, err := ExpandEnvErr(text, st)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// StrictVar is the State variable that, when set to true, makes ExpandEnv
+// and ExpandEnvErr fail on a variable that is in neither the State bucket
+// nor the State Env, rather than expanding it to an empty string.
+// In strict mode ExpandEnv panics on such a variable, use ExpandEnvErr or
+// a Literal where a variable may be missing.
+const StrictVar = "strict"
+
+// ExpandEnvErr expands text like ExpandEnv, but returns an error if text
+// is of an unsupported type, or is a VAR that is not set or not text.
+// If StrictVar is set it also returns an error for a missing variable.
+func ExpandEnvErr(text any, st *State) (string, error) {
+	strict, _ := st.Get(StrictVar).(bool)
+	return expandEnv(text, st, strict)
+}
+
+// ExpandEnvStrict expands text like ExpandEnvErr in strict mode, returning
+// an error for a missing variable even if StrictVar is not set.
+func ExpandEnvStrict(text any, st *State) (string, error) {
+	return expandEnv(text, st, true)
+}
+
+func expandEnv(text any, st *State, strict bool) (string, error) {
 	var stringText string
 	switch v := text.(type) {
 	default:
-		panic(fmt.Errorf("knows VAR and string, unsupported type %#v", v))
+		return "", fmt.Errorf("knows VAR and string, unsupported type %#v", v)
+	case Literal:
+		return string(v), nil
 	case VAR:
-		switch v := st.Get(string(v)).(type) {
+		val, err := st.MustGet(string(v))
+		if err != nil {
+			return "", err
+		}
+		switch x := val.(type) {
 		default:
-			panic(fmt.Errorf("knows VAR and string, unsupported type %#v", v))
+			return "", fmt.Errorf("variable %q: knows string and []byte, unsupported type %#v", string(v), x)
 		case string:
-			stringText = v
+			stringText = x
 		case *string:
-			stringText = *v
+			stringText = *x
 		case []byte:
-			stringText = string(v)
+			stringText = string(x)
 		case *[]byte:
-			stringText = string(*v)
+			stringText = string(*x)
 		}
 	case string:
 		stringText = v
@@ -73,7 +113,8 @@ func ExpandEnv(text any, st *State) string {
 	case *[]byte:
 		stringText = string(*v)
 	}
-	return os.Expand(stringText, func(key string) string {
+	var missing []string
+	s := os.Expand(stringText, func(key string) string {
 		if st.bucket != nil {
 			if v, ok := st.bucket[key]; ok {
 				switch x := v.(type) {
@@ -88,15 +129,50 @@ func ExpandEnv(text any, st *State) string {
 				}
 			}
 		}
-		return st.Env[key]
+		v, ok := st.LookupEnv(key)
+		if !ok && strict {
+			missing = append(missing, key)
+		}
+		return v
 	})
+	switch len(missing) {
+	case 0:
+		return s, nil
+	case 1:
+		return "", fmt.Errorf("expand %q: variable %q is not set", stringText, missing[0])
+	}
+	return "", fmt.Errorf("expand %q: variables %q are not set", stringText, missing)
 }
 
 // VAR represents a state variable name.
 // When passed to a function, resolves to the state variable name.
 type VAR string
 
+// Literal is text that is used as is, without expanding variables. It may
+// be passed wherever text is expanded with ExpandEnv, such as arguments
+// containing "$" like awk programs, passwords, or regular expressions.
+//
+//	Exec("awk", Literal("{print $1}"), "${file}")
+type Literal string
+
+// captureBuffer holds output written to a VAR, *[]byte, or *string.
+type captureBuffer interface {
+	io.Writer
+	Bytes() []byte
+	Reset()
+}
+
 func outputSetup(name string, std any) (func(st *State, def io.Writer) io.Writer, postStdWriteFunc) {
+	newBuffer := func() captureBuffer { return &bytes.Buffer{} }
+	if lo, ok := std.(*limitOutput); ok {
+		switch lo.std.(type) {
+		default:
+			panic(fmt.Sprintf("%s limit must be one of: VAR, *[]byte, *string; got %T", name, lo.std))
+		case VAR, *[]byte, *string:
+		}
+		std = lo.std
+		newBuffer = func() captureBuffer { return &limitBuffer{max: lo.max, keep: lo.keep} }
+	}
 	switch s := std.(type) {
 	default:
 		panic(fmt.Sprintf("%s must be one of: nil, VAR, io.Writer, *[]byte, *string; got %T", name, s))
@@ -106,11 +182,12 @@ func outputSetup(name string, std any) (func(st *State, def io.Writer) io.Writer
 			}, func(st *State) {
 			}
 	case VAR:
-		buf := &bytes.Buffer{}
+		buf := newBuffer()
 		return func(st *State, def io.Writer) io.Writer {
 				return buf
 			}, func(st *State) {
-				st.Set(string(s), buf.Bytes())
+				// Copy, as the buffer is reused.
+				st.Set(string(s), bytes.Clone(buf.Bytes()))
 				buf.Reset()
 			}
 	case io.Writer:
@@ -119,19 +196,19 @@ func outputSetup(name string, std any) (func(st *State, def io.Writer) io.Writer
 			}, func(st *State) {
 			}
 	case *[]byte:
-		buf := &bytes.Buffer{}
+		buf := newBuffer()
 		return func(st *State, def io.Writer) io.Writer {
 				return buf
 			}, func(st *State) {
-				*s = buf.Bytes()
+				*s = bytes.Clone(buf.Bytes())
 				buf.Reset()
 			}
 	case *string:
-		buf := &bytes.Buffer{}
+		buf := newBuffer()
 		return func(st *State, def io.Writer) io.Writer {
 				return buf
 			}, func(st *State) {
-				*s = buf.String()
+				*s = string(buf.Bytes())
 				buf.Reset()
 			}
 	}
@@ -143,6 +220,7 @@ type postStdWriteFunc func(st *State)
 
 // WithStd runs the child script using adjusted stdout and stderr outputs.
 // stdout and stderr may be nil, VAR (state name stored as []byte), io.Writer, *string, or *[]byte.
+// The output stored may be limited with LimitOutput.
 func WithStd(stdout, stderr any, a Action) Action {
 	outPre, outPost := outputSetup("stdout", stdout)
 	errPre, errPost := outputSetup("stderr", stderr)
@@ -169,19 +247,84 @@ func WithStd(stdout, stderr any, a Action) Action {
 }
 
 // WithStdCombined runs the child script using adjusted stdout and stderr outputs.
-// std may be nil, string (state name stored as []byte), io.Writer, or *[]byte.
+// std may be nil, VAR (state name stored as []byte), io.Writer, *string, or *[]byte.
+// Writes to stdout and stderr are serialized, as Exec writes them concurrently.
 func WithStdCombined(std any, a Action) Action {
 	outPre, outPost := outputSetup("std", std)
 	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
 		oldStdout, oldStderr := st.Stdout, st.Stderr
 		w := outPre(st, nil)
 		if w != nil {
-			st.Stdout = w
-			st.Stderr = w
+			mu := &sync.Mutex{}
+			st.Stdout = &teeWriter{mu: mu, w: w}
+			st.Stderr = &teeWriter{mu: mu, w: w}
+		}
+		prevPost := st.Get(postStdWriteKey)
+		var f postStdWriteFunc = func(st *State) {
+			outPost(st)
+		}
+		st.Set(postStdWriteKey, f)
+		err := sc.RunAction(ctx, st, a)
+		if prevPost == nil {
+			st.Delete(postStdWriteKey)
+		} else {
+			st.Set(postStdWriteKey, prevPost)
+		}
+		st.Stdout, st.Stderr = oldStdout, oldStderr
+		return err
+	})
+}
+
+// teeWriter writes to w and to the combined writer, serialized by mu, so
+// the combined output is interleaved in the order of the writes.
+type teeWriter struct {
+	mu       *sync.Mutex
+	w        io.Writer
+	combined io.Writer
+}
+
+func (tw *teeWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.w != nil {
+		if _, err := tw.w.Write(p); err != nil {
+			return 0, err
+		}
+	}
+	if tw.combined != nil {
+		if _, err := tw.combined.Write(p); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// WithStdTee runs the child script capturing stdout and stderr separately
+// while also writing both, interleaved in the order written, to combined.
+// Each may be nil, VAR (state name stored as []byte), io.Writer, *string,
+// or *[]byte. If stdout or stderr is nil it is not captured. If combined
+// is nil, output is written to the current State.Stdout and State.Stderr.
+func WithStdTee(stdout, stderr, combined any, a Action) Action {
+	outPre, outPost := outputSetup("stdout", stdout)
+	errPre, errPost := outputSetup("stderr", stderr)
+	comPre, comPost := outputSetup("combined", combined)
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		oldStdout, oldStderr := st.Stdout, st.Stderr
+		mu := &sync.Mutex{}
+		outCombined, errCombined := oldStdout, oldStderr
+		if w := comPre(st, nil); w != nil {
+			outCombined, errCombined = w, w
 		}
+		st.Stdout = &teeWriter{mu: mu, w: outPre(st, nil), combined: outCombined}
+		st.Stderr = &teeWriter{mu: mu, w: errPre(st, nil), combined: errCombined}
+
 		prevPost := st.Get(postStdWriteKey)
 		var f postStdWriteFunc = func(st *State) {
+			mu.Lock()
+			defer mu.Unlock()
 			outPost(st)
+			errPost(st)
+			comPost(st)
 		}
 		st.Set(postStdWriteKey, f)
 		err := sc.RunAction(ctx, st, a)
@@ -201,62 +344,147 @@ func Exec(executable any, args ...any) Action {
 	return ExecStdin(nil, executable, args...)
 }
 
+// StdinFile returns a stdin source for ExecStdin that reads the file,
+// relative to State.Dir. The filename may be VAR or string.
+func StdinFile(filename any) any {
+	return stdinFile{filename: filename}
+}
+
+type stdinFile struct {
+	filename any
+}
+
+// stdinValue returns a reader of the stdin value v of the variable name.
+func stdinValue(name string, v any) (io.Reader, error) {
+	switch x := v.(type) {
+	case []byte:
+		return bytes.NewReader(x), nil
+	case *[]byte:
+		return bytes.NewReader(*x), nil
+	case string:
+		return strings.NewReader(x), nil
+	case *string:
+		return strings.NewReader(*x), nil
+	case io.Reader:
+		return x, nil
+	case io.ReaderAt:
+		return io.NewSectionReader(x, 0, math.MaxInt64), nil
+	}
+	return nil, fmt.Errorf("stdin variable %q: knows []byte, string, and io.Reader, unsupported type %T", name, v)
+}
+
 // ExecStdin runs an executable and streams the output to stderr and stdout.
-// The stdin takes one of: nil, "string (state variable to []byte data), []byte, or io.Reader.
+// The stdin takes one of: nil, VAR (state variable of []byte, string, or
+// io.Reader data), string, []byte, io.Reader, io.ReaderAt, or a file from
+// StdinFile.
 // The executable and args may be of type VAR or string.
+// On Windows the executable is found in the PATH of State.Env, trying the
+// extensions of PATHEXT, and .bat and .cmd scripts are run with cmd.exe
+// with the arguments quoted by QuoteCmd.
 func ExecStdin(stdin any, executable any, args ...any) Action {
-	var stdinReader func(st *State) io.Reader
+	// stdinReader returns the stdin and, if it must be closed, its Closer.
+	var stdinReader func(st *State) (io.Reader, io.Closer, error)
 	switch si := stdin.(type) {
 	default:
-		panic("stdin takes on of: nil, VAR (state variable to []byte), string, []byte, or io.Reader")
+		panic(fmt.Sprintf("stdin takes one of: nil, VAR, string, []byte, io.Reader, io.ReaderAt, or StdinFile; got %T", si))
 	case nil:
-		stdinReader = func(st *State) io.Reader {
-			return nil
+		stdinReader = func(st *State) (io.Reader, io.Closer, error) {
+			return nil, nil, nil
 		}
 	case VAR:
-		stdinReader = func(st *State) io.Reader {
-			stdin, _ := st.Default(string(si), []byte{}).([]byte)
-			if len(stdin) > 0 {
-				return bytes.NewReader(stdin)
+		stdinReader = func(st *State) (io.Reader, io.Closer, error) {
+			v, err := st.MustGet(string(si))
+			if err != nil {
+				return nil, nil, err
 			}
-			return nil
+			r, err := stdinValue(string(si), v)
+			return r, nil, err
+		}
+	case stdinFile:
+		stdinReader = func(st *State) (io.Reader, io.Closer, error) {
+			fn, err := ExpandEnvErr(si.filename, st)
+			if err != nil {
+				return nil, nil, err
+			}
+			f, err := st.FileSystem().OpenFile(st.Filepath(fn), os.O_RDONLY, 0)
+			if err != nil {
+				return nil, nil, err
+			}
+			return f, f, nil
 		}
 	case string:
-		stdinReader = func(st *State) io.Reader {
-			return strings.NewReader(si)
+		stdinReader = func(st *State) (io.Reader, io.Closer, error) {
+			return strings.NewReader(si), nil, nil
 		}
 	case []byte:
-		stdinReader = func(st *State) io.Reader {
-			return bytes.NewReader(si)
+		stdinReader = func(st *State) (io.Reader, io.Closer, error) {
+			return bytes.NewReader(si), nil, nil
 		}
 	case io.Reader:
-		stdinReader = func(_ *State) io.Reader {
-			return si
+		stdinReader = func(_ *State) (io.Reader, io.Closer, error) {
+			return si, nil, nil
+		}
+	case io.ReaderAt:
+		stdinReader = func(_ *State) (io.Reader, io.Closer, error) {
+			return io.NewSectionReader(si, 0, math.MaxInt64), nil, nil
 		}
 	}
 	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
-		sExec := ExpandEnv(executable, st)
+		sExec, err := ExpandEnvErr(executable, st)
+		if err != nil {
+			return err
+		}
 		sArgs := make([]string, len(args))
 		for i, a := range args {
-			sArgs[i] = ExpandEnv(a, st)
+			sArgs[i], err = ExpandEnvErr(a, st)
+			if err != nil {
+				return err
+			}
+		}
+		if dryRun(st, "exec: %s (in %s)", quoteArgs(append([]string{sExec}, sArgs...)), st.Dir) {
+			return nil
 		}
-		cmd := exec.CommandContext(ctx, sExec, sArgs...)
+		if _, ok := st.FS.(*sandboxFS); ok {
+			return fmt.Errorf("exec %s: %w", sExec, ErrSandbox)
+		}
+		path, err := resolveExec(st, sExec)
+		if err != nil {
+			return err
+		}
+		cmd := exec.CommandContext(ctx, path, sArgs...)
 		envList := make([]string, 0, len(st.Env))
 		for key, value := range st.Env {
 			envList = append(envList, key+"="+value)
 		}
 		cmd.Env = envList
 		cmd.Dir = st.Dir
-		cmd.Stdin = stdinReader(st)
-		cmd.Stdout = st.Stdout
-		cmd.Stderr = st.Stderr
-		err := cmd.Run()
+		stdin, closer, err := stdinReader(st)
+		if err != nil {
+			return err
+		}
+		if closer != nil {
+			defer closer.Close()
+		}
+		cmd.Stdin = stdin
+		cmd.Stdout = st.redactWriter(st.Stdout)
+		cmd.Stderr = st.redactWriter(st.Stderr)
+		if err := prepareCmd(st, cmd); err != nil {
+			return err
+		}
+		if st.elevated {
+			if err := elevateCmd(ctx, st, cmd); err != nil {
+				return fmt.Errorf("exec %s: %w", sExec, err)
+			}
+		}
+		start := st.Now()
+		err = cmd.Run()
+		st.AuditCmd(cmd, start, err)
 		if f, ok := st.Get(postStdWriteKey).(postStdWriteFunc); ok {
 			f(st)
 		}
 		if err != nil {
 			if ec, ok := err.(*exec.ExitError); ok {
-				return fmt.Errorf("%s %q failed: %v\n%s", executable, args, err, ec.Stderr)
+				return st.redactError(fmt.Errorf("%s %q failed: %w\n%s", executable, args, err, ec.Stderr))
 			}
 			return err
 		}
@@ -272,76 +500,101 @@ func ensureDir(fn string) error {
 // WriteFile writes the given file from the input.
 // Input may be a VAR, []byte, string, or io.Reader.
 // The filename may be VAR or string.
+// In dry-run mode a unified diff of the change to the file is written,
+// unless the input is an io.Reader.
 func WriteFile(filename any, perm os.FileMode, input any) Action {
 	switch i := input.(type) {
 	default:
 		panic("input must be one of: string ([]byte state variable name), []byte (file data), io.Reader (file data)")
 	case VAR:
 		return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
-			fn := ExpandEnv(filename, st)
+			fn, err := ExpandEnvErr(filename, st)
+			if err != nil {
+				return err
+			}
 			fn = st.Filepath(fn)
-			err := ensureDir(fn)
+			if DryRun(st) {
+				switch v := st.Get(string(i)).(type) {
+				case []byte:
+					dryRunWrite(st, fn, perm, v)
+				case string:
+					dryRunWrite(st, fn, perm, []byte(v))
+				default:
+					dryRun(st, "write: %s (%v)", fn, perm)
+				}
+				return nil
+			}
+			dryRun(st, "write: %s (%v)", fn, perm)
+			fsys := st.FileSystem()
+			err = ensureDirFS(fsys, fn)
+			if err != nil {
+				return err
+			}
+			val, err := st.MustGet(string(i))
 			if err != nil {
 				return err
 			}
-			switch v := st.Get(string(i)).(type) {
+			switch v := val.(type) {
 			default:
-				return fmt.Errorf("uknown type for %q: %#v", i, v)
+				return fmt.Errorf("variable %q: knows string, []byte, and io.Reader, unsupported type %#v", string(i), v)
 			case []byte:
-				return os.WriteFile(fn, v, perm)
+				return writeFileFS(fsys, fn, bytes.NewReader(v), perm)
 			case string:
-				return os.WriteFile(fn, []byte(v), perm)
+				return writeFileFS(fsys, fn, strings.NewReader(v), perm)
 			case io.Reader:
-				f, err := os.OpenFile(fn, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
-				if err != nil {
-					return err
-				}
-				defer f.Close()
-				_, err = io.Copy(f, v)
-				if err != nil {
-					return err
-				}
-				return nil
+				return writeFileFS(fsys, fn, v, perm)
 			}
 		})
 	case string:
 		return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
-			fn := ExpandEnv(filename, st)
+			fn, err := ExpandEnvErr(filename, st)
+			if err != nil {
+				return err
+			}
 			fn = st.Filepath(fn)
-			err := ensureDir(fn)
+			if dryRunWrite(st, fn, perm, []byte(i)) {
+				return nil
+			}
+			fsys := st.FileSystem()
+			err = ensureDirFS(fsys, fn)
 			if err != nil {
 				return err
 			}
-			return os.WriteFile(fn, []byte(i), perm)
+			return writeFileFS(fsys, fn, strings.NewReader(i), perm)
 		})
 	case []byte:
 		return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
-			fn := ExpandEnv(filename, st)
+			fn, err := ExpandEnvErr(filename, st)
+			if err != nil {
+				return err
+			}
 			fn = st.Filepath(fn)
-			err := ensureDir(fn)
+			if dryRunWrite(st, fn, perm, i) {
+				return nil
+			}
+			fsys := st.FileSystem()
+			err = ensureDirFS(fsys, fn)
 			if err != nil {
 				return err
 			}
-			return os.WriteFile(fn, i, perm)
+			return writeFileFS(fsys, fn, bytes.NewReader(i), perm)
 		})
 	case io.Reader:
 		return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
-			fn := ExpandEnv(filename, st)
-			fn = st.Filepath(fn)
-			err := ensureDir(fn)
+			fn, err := ExpandEnvErr(filename, st)
 			if err != nil {
 				return err
 			}
-			f, err := os.OpenFile(fn, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
-			if err != nil {
-				return err
+			fn = st.Filepath(fn)
+			if dryRun(st, "write: %s (%v)", fn, perm) {
+				return nil
 			}
-			defer f.Close()
-			_, err = io.Copy(f, i)
+			fsys := st.FileSystem()
+			err = ensureDirFS(fsys, fn)
 			if err != nil {
 				return err
 			}
-			return nil
+			return writeFileFS(fsys, fn, i, perm)
 		})
 	}
 }
@@ -354,13 +607,20 @@ func OpenFile(filename any, file any) Action {
 		panic("file must be one of: VAR, *io.Closer (file handle)")
 	case VAR:
 		return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
-			fn := ExpandEnv(filename, st)
+			fn, err := ExpandEnvErr(filename, st)
+			if err != nil {
+				return err
+			}
 			fn = st.Filepath(fn)
-			err := ensureDir(fn)
+			if dryRun(st, "open: %s", fn) {
+				return nil
+			}
+			fsys := st.FileSystem()
+			err = ensureDirFS(fsys, fn)
 			if err != nil {
 				return err
 			}
-			fh, err := os.Open(fn)
+			fh, err := fsys.OpenFile(fn, os.O_RDONLY, 0)
 			if err != nil {
 				return err
 			}
@@ -371,13 +631,20 @@ func OpenFile(filename any, file any) Action {
 		})
 	case *io.Closer:
 		return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
-			fn := ExpandEnv(filename, st)
+			fn, err := ExpandEnvErr(filename, st)
+			if err != nil {
+				return err
+			}
 			fn = st.Filepath(fn)
-			err := ensureDir(fn)
+			if dryRun(st, "open: %s", fn) {
+				return nil
+			}
+			fsys := st.FileSystem()
+			err = ensureDirFS(fsys, fn)
 			if err != nil {
 				return err
 			}
-			fh, err := os.Open(fn)
+			fh, err := fsys.OpenFile(fn, os.O_RDONLY, 0)
 			if err != nil {
 				return err
 			}
@@ -396,15 +663,25 @@ func CloseFile(file any) Action {
 		panic("file must be one of: string (state variable name), io.Closer (file handle)")
 	case VAR:
 		return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
-			fh, ok := st.Get(string(f)).(io.Closer)
+			if dryRun(st, "close: %s", f) {
+				return nil
+			}
+			v, err := st.MustGet(string(f))
+			if err != nil {
+				return err
+			}
+			fh, ok := v.(io.Closer)
 			if !ok {
-				return fmt.Errorf("state name %q is not an io.Closer, is %#v", f, fh)
+				return fmt.Errorf("variable %q is not an io.Closer, is %#v", string(f), v)
 			}
 
 			return fh.Close()
 		})
 	case io.Closer:
 		return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			if dryRun(st, "close: %v", f) {
+				return nil
+			}
 			if f == nil {
 				return nil
 			}
@@ -422,8 +699,14 @@ func ReadFile(filename any, output any) Action {
 		panic("output must be one of: VAR, *[]byte (file data), io.Writer (file data)")
 	case VAR:
 		return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
-			fn := ExpandEnv(filename, st)
-			b, err := os.ReadFile(st.Filepath(fn))
+			fn, err := ExpandEnvErr(filename, st)
+			if err != nil {
+				return err
+			}
+			if dryRun(st, "read: %s", st.Filepath(fn)) {
+				return nil
+			}
+			b, err := readFileFS(st.FileSystem(), st.Filepath(fn))
 			if err != nil {
 				return err
 			}
@@ -432,8 +715,14 @@ func ReadFile(filename any, output any) Action {
 		})
 	case *string:
 		return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
-			fn := ExpandEnv(filename, st)
-			b, err := os.ReadFile(st.Filepath(fn))
+			fn, err := ExpandEnvErr(filename, st)
+			if err != nil {
+				return err
+			}
+			if dryRun(st, "read: %s", st.Filepath(fn)) {
+				return nil
+			}
+			b, err := readFileFS(st.FileSystem(), st.Filepath(fn))
 			if err != nil {
 				return err
 			}
@@ -442,8 +731,14 @@ func ReadFile(filename any, output any) Action {
 		})
 	case *[]byte:
 		return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
-			fn := ExpandEnv(filename, st)
-			b, err := os.ReadFile(st.Filepath(fn))
+			fn, err := ExpandEnvErr(filename, st)
+			if err != nil {
+				return err
+			}
+			if dryRun(st, "read: %s", st.Filepath(fn)) {
+				return nil
+			}
+			b, err := readFileFS(st.FileSystem(), st.Filepath(fn))
 			if err != nil {
 				return err
 			}
@@ -452,11 +747,18 @@ func ReadFile(filename any, output any) Action {
 		})
 	case io.Writer:
 		return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
-			fn := ExpandEnv(filename, st)
-			f, err := os.Open(st.Filepath(fn))
+			fn, err := ExpandEnvErr(filename, st)
 			if err != nil {
 				return err
 			}
+			if dryRun(st, "read: %s", st.Filepath(fn)) {
+				return nil
+			}
+			f, err := st.FileSystem().OpenFile(st.Filepath(fn), os.O_RDONLY, 0)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
 			_, err = io.Copy(o, f)
 			if err != nil {
 				return err
@@ -470,8 +772,14 @@ func ReadFile(filename any, output any) Action {
 // The filename may be VAR or string.
 func Delete(filename any) Action {
 	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
-		fn := ExpandEnv(filename, st)
-		return os.RemoveAll(st.Filepath(fn))
+		fn, err := ExpandEnvErr(filename, st)
+		if err != nil {
+			return err
+		}
+		if dryRun(st, "delete: %s", st.Filepath(fn)) {
+			return nil
+		}
+		return st.FileSystem().RemoveAll(st.Filepath(fn))
 	})
 }
 
@@ -479,14 +787,24 @@ func Delete(filename any) Action {
 // The filenames old and new may be VAR or string.
 func Move(old, new any) Action {
 	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
-		fnOld := ExpandEnv(old, st)
-		fnNew := ExpandEnv(new, st)
+		fnOld, err := ExpandEnvErr(old, st)
+		if err != nil {
+			return err
+		}
+		fnNew, err := ExpandEnvErr(new, st)
+		if err != nil {
+			return err
+		}
 		np := st.Filepath(fnNew)
-		err := os.MkdirAll(filepath.Dir(np), 0700)
+		if dryRun(st, "move: %s -> %s", st.Filepath(fnOld), np) {
+			return nil
+		}
+		fsys := st.FileSystem()
+		err = ensureDirFS(fsys, np)
 		if err != nil {
 			return err
 		}
-		return os.Rename(st.Filepath(fnOld), np)
+		return fsys.Rename(st.Filepath(fnOld), np)
 	})
 }
 
@@ -495,13 +813,25 @@ func Move(old, new any) Action {
 // The filenames old and new may be VAR or string.
 func Copy(old, new any, only func(p string, st *State) bool) Action {
 	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
-		fnOld := ExpandEnv(old, st)
-		fnNew := ExpandEnv(new, st)
-		return fsop.Copy(st.Filepath(fnOld), st.Filepath(fnNew), func(p string) bool {
+		fnOld, err := ExpandEnvErr(old, st)
+		if err != nil {
+			return err
+		}
+		fnNew, err := ExpandEnvErr(new, st)
+		if err != nil {
+			return err
+		}
+		if dryRun(st, "copy: %s -> %s", st.Filepath(fnOld), st.Filepath(fnNew)) {
+			return nil
+		}
+		prog := st.StartProgress("copy "+fnOld, 0)
+		err = copyFS(st.FileSystem(), st.Filepath(fnOld), st.Filepath(fnNew), func(p string) bool {
 			if only == nil {
 				return true
 			}
 			return only(p, st)
-		})
+		}, prog)
+		prog.Done(err)
+		return err
 	})
 }
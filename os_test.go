@@ -3,8 +3,13 @@ package task
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 )
@@ -57,6 +62,65 @@ func TestExpandEnv(t *testing.T) {
 	}
 }
 
+func TestExpandEnvStrict(t *testing.T) {
+	st := &State{Env: map[string]string{"empty": ""}}
+	st.Set("dir", "build")
+	if got := ExpandEnv("rm ${root}/${dir}", st); got != "rm /build" {
+		t.Fatalf("got %q", got)
+	}
+	_, err := ExpandEnvStrict("rm ${root}/${dir}${empty}", st)
+	if g, w := fmt.Sprint(err), `expand "rm ${root}/${dir}${empty}": variable "root" is not set`; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+
+	st.Set(StrictVar, true)
+	err = Run(context.Background(), st, Delete("${root}/${other}"))
+	if g, w := fmt.Sprint(err), `expand "${root}/${other}": variables ["root" "other"] are not set`; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+	if got := ExpandEnv(Literal("${root}"), st); got != "${root}" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestLiteral(t *testing.T) {
+	st := &State{Env: map[string]string{"file": "a.txt"}}
+	if got := ExpandEnv(Literal("^a$|${x}"), st); got != "^a$|${x}" {
+		t.Fatalf("got %q", got)
+	}
+	dry := &State{Env: st.Env, Stdout: &strings.Builder{}}
+	dry.Set(DryRunVar, true)
+	Run(context.Background(), dry, Exec("awk", Literal("{print $1}"), "${file}"))
+	if g, w := dry.Stdout.(*strings.Builder).String(), "exec: awk \"{print $1}\" a.txt (in )\n"; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+}
+
+func TestExpandEnvErr(t *testing.T) {
+	st := &State{}
+	st.Set("count", 3)
+	for _, text := range []any{VAR("missing"), VAR("count"), 42} {
+		if _, err := ExpandEnvErr(text, st); err == nil {
+			t.Errorf("%#v: expected error", text)
+		}
+	}
+
+	rolledBack := false
+	err := Run(context.Background(), st, NewScript(
+		AddRollback(ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			rolledBack = true
+			return nil
+		})),
+		WriteFile(VAR("missing"), 0600, "data"),
+	))
+	if g, w := fmt.Sprint(err), `variable "missing" not set; known variables: count`; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+	if !rolledBack {
+		t.Fatal("rollback not run")
+	}
+}
+
 func getString(varName string, value *string) Action {
 	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
 		switch v := st.Get(varName).(type) {
@@ -109,3 +173,69 @@ func TestWriteStd(t *testing.T) {
 		t.Fatal("stderr has data")
 	}
 }
+
+// readerAt only implements io.ReaderAt.
+type readerAt struct {
+	io.ReaderAt
+}
+
+func TestExecStdinTypes(t *testing.T) {
+	dir := t.TempDir()
+	src := "package  a\n"
+	if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	st := &State{Dir: dir, Env: Environ()}
+	st.Set("str", src)
+	st.Set("bytes", []byte(src))
+	st.Set("count", 3)
+	for _, stdin := range []any{VAR("str"), VAR("bytes"), StdinFile("a.go"), strings.NewReader(src), readerAt{strings.NewReader(src)}} {
+		var out string
+		err := Run(context.Background(), st, WithStd(&out, nil, ExecStdin(stdin, "gofmt")))
+		if err != nil {
+			t.Fatalf("%T: %v", stdin, err)
+		}
+		if out != "package a\n" {
+			t.Fatalf("%#v: got %q", stdin, out)
+		}
+	}
+	err := Run(context.Background(), st, ExecStdin(VAR("count"), "gofmt"))
+	if g, w := fmt.Sprint(err), `stdin variable "count": knows []byte, string, and io.Reader, unsupported type int`; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+	err = Run(context.Background(), st, ExecStdin(VAR("missing"), "gofmt"))
+	var verr *VarError
+	if !errors.As(err, &verr) {
+		t.Fatalf("got %v, want *VarError", err)
+	}
+}
+
+func TestWithStdTee(t *testing.T) {
+	var out, errOut string
+	combined := &bytes.Buffer{}
+	st := &State{Env: Environ()}
+	err := Run(context.Background(), st, WithStdTee(&out, &errOut, combined, NewScript(
+		Exec("go", "env", "GOOS"),
+		Exec("go", "bogus-command"),
+	)))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	// Captured output is set after each command.
+	if len(out) != 0 || !strings.Contains(errOut, "bogus-command") {
+		t.Fatalf("got stdout %q, stderr %q", out, errOut)
+	}
+	if g, w := combined.String(), runtime.GOOS+"\n"+errOut; g != w {
+		t.Fatalf("got combined %q, want %q", g, w)
+	}
+
+	stdout := &strings.Builder{}
+	st = &State{Env: Environ(), Stdout: stdout}
+	err = Run(context.Background(), st, WithStdTee(VAR("out"), nil, nil, Exec("go", "env", "GOOS")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := st.Get("out").([]byte); len(v) == 0 || string(v) != stdout.String() {
+		t.Fatalf("got var %q, stdout %q", v, stdout.String())
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ActionInfo describes an action of a Script, as listed by Actions before
+// the script runs. Actions added while the script runs are not known until
+// then.
+type ActionInfo struct {
+	Name   string // Name of a Named action, empty otherwise.
+	Step   int    // Index of the action in its script, as in Error.Step.
+	Depth  int    // Number of scripts the action is nested in.
+	Script bool   // The action is a Script, its actions follow at Depth+1.
+}
+
+// Actions lists the actions of the script in the order they run, each
+// followed by the actions of a nested Script. It returns nil for a Script
+// not created by NewScript.
+func Actions(sc Script) []ActionInfo {
+	s, ok := sc.(*script)
+	if !ok {
+		return nil
+	}
+	var list []ActionInfo
+	s.actions(&list, 0)
+	return list
+}
+
+func (sc *script) actions(list *[]ActionInfo, depth int) {
+	for i, a := range sc.list {
+		info := ActionInfo{Step: i, Depth: depth}
+		if na, ok := a.(*namedAction); ok {
+			info.Name = na.name
+			a = na.a
+		}
+		child, ok := a.(*script)
+		info.Script = ok
+		*list = append(*list, info)
+		if ok {
+			child.actions(list, depth+1)
+		}
+	}
+}
+
+// String lists the actions of the script, one per line, as the step and
+// the name, or "action" if not Named. Actions of a nested Script are
+// indented.
+func (sc *script) String() string {
+	buf := &strings.Builder{}
+	for _, info := range Actions(sc) {
+		name := info.Name
+		if len(name) == 0 {
+			name = "action"
+			if info.Script {
+				name = "script"
+			}
+		}
+		fmt.Fprintf(buf, "%s%d %s\n", strings.Repeat("\t", info.Depth), info.Step, name)
+	}
+	return buf.String()
+}
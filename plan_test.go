@@ -0,0 +1,35 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestScriptActions(t *testing.T) {
+	step := ActionFunc(func(ctx context.Context, st *State, sc Script) error { return nil })
+	sc := NewScript(
+		Named("build", step),
+		Named("deploy", NewScript(
+			Named("push", step),
+			step,
+		)),
+		NewScript(Named("notify", step)),
+	)
+	want := []ActionInfo{
+		{Name: "build", Step: 0},
+		{Name: "deploy", Step: 1, Script: true},
+		{Name: "push", Step: 0, Depth: 1},
+		{Step: 1, Depth: 1},
+		{Step: 2, Script: true},
+		{Name: "notify", Step: 0, Depth: 1},
+	}
+	if g := Actions(sc); !reflect.DeepEqual(g, want) {
+		t.Fatalf("got %+v, want %+v", g, want)
+	}
+	wantText := "0 build\n1 deploy\n\t0 push\n\t1 action\n2 script\n\t0 notify\n"
+	if g := fmt.Sprint(sc); g != wantText {
+		t.Fatalf("got:\n%s\nwant:\n%s", g, wantText)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"unicode/utf8"
+)
+
+// PrefixWriter writes each line to W starting with Prefix. Partial lines
+// are held until the line is complete or Flush is called. If Lock is set
+// it is held while writing to W, so writers sharing a lock and W never
+// interleave within a line. If Buffer is set, all output is held until
+// Flush and written at once.
+type PrefixWriter struct {
+	W      io.Writer
+	Prefix string
+	Lock   sync.Locker
+	Buffer bool
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+// Write p to the writer. Write always reports all of p as written unless
+// W returns an error.
+func (w *PrefixWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	if w.Buffer {
+		return len(p), nil
+	}
+	i := bytes.LastIndexByte(w.buf, '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+	err := w.write(w.buf[:i+1])
+	w.buf = w.buf[:copy(w.buf, w.buf[i+1:])]
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes any held output. A final partial line is ended with a newline.
+func (w *PrefixWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+	if w.buf[len(w.buf)-1] != '\n' {
+		w.buf = append(w.buf, '\n')
+	}
+	err := w.write(w.buf)
+	w.buf = w.buf[:0]
+	return err
+}
+
+// write complete lines in b to W with the prefix.
+func (w *PrefixWriter) write(b []byte) error {
+	out := make([]byte, 0, len(b)+len(w.Prefix)*bytes.Count(b, []byte{'\n'}))
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		out = append(out, w.Prefix...)
+		out = append(out, b[:i+1]...)
+		b = b[i+1:]
+	}
+	if w.Lock != nil {
+		w.Lock.Lock()
+		defer w.Lock.Unlock()
+	}
+	_, err := w.W.Write(out)
+	return err
+}
+
+// prefixColors are the ANSI foreground colors used to tell prefixes apart.
+var prefixColors = []Color{Cyan, Yellow, Green, Magenta, Blue, Red}
+
+// Prefixes returns a line prefix for each name, padded to the same width
+// and ending with " | ". If color is true, each prefix is given an ANSI
+// color in turn.
+func Prefixes(names []string, color bool) []string {
+	width := 0
+	for _, name := range names {
+		if n := utf8.RuneCountInString(name); n > width {
+			width = n
+		}
+	}
+	list := make([]string, len(names))
+	for i, name := range names {
+		p := fmt.Sprintf("%-*s | ", width, name)
+		if color {
+			p = fmt.Sprintf("\x1b[%dm%s\x1b[0m", prefixColors[i%len(prefixColors)], p)
+		}
+		list[i] = p
+	}
+	return list
+}
+
+// WithPrefix runs the action with each line of stdout and stderr starting
+// with prefix. If lock is not nil it is held while writing each line, and
+// should be shared with other actions writing to the same outputs. If buffer
+// is true, the output is held until the action returns.
+func WithPrefix(prefix string, lock sync.Locker, buffer bool, a Action) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		oldStdout, oldStderr := st.Stdout, st.Stderr
+		var flush []*PrefixWriter
+		wrap := func(w io.Writer) io.Writer {
+			if w == nil {
+				return nil
+			}
+			pw := &PrefixWriter{W: w, Prefix: prefix, Lock: lock, Buffer: buffer}
+			flush = append(flush, pw)
+			return pw
+		}
+		st.Stdout = wrap(oldStdout)
+		st.Stderr = wrap(oldStderr)
+		err := sc.RunAction(ctx, st, a)
+		st.Stdout, st.Stderr = oldStdout, oldStderr
+		for _, pw := range flush {
+			if ferr := pw.Flush(); ferr != nil && err == nil {
+				err = ferr
+			}
+		}
+		return err
+	})
+}
+
+// Label runs the action, such as a Script, with its log messages, logged
+// errors, and each line of stdout and stderr starting with "[label] ".
+// Labels of nested actions are combined, such as "[web] [build] ".
+func Label(label string, a Action) Action {
+	prefix := "[" + label + "] "
+	return WithPrefix(prefix, nil, false, ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		oldMsg, oldErr := st.MsgLogger, st.ErrorLogger
+		if oldMsg != nil {
+			st.MsgLogger = func(msg string) {
+				oldMsg(prefix + msg)
+			}
+		}
+		if oldErr != nil {
+			st.ErrorLogger = func(err error) {
+				oldErr(&labelError{prefix: prefix, err: err})
+			}
+		}
+		err := sc.RunAction(ctx, st, a)
+		st.MsgLogger, st.ErrorLogger = oldMsg, oldErr
+		return err
+	}))
+}
+
+// labelError is a logged error with a label prefix.
+type labelError struct {
+	prefix string
+	err    error
+}
+
+func (err *labelError) Error() string { return err.prefix + err.err.Error() }
+func (err *labelError) Unwrap() error { return err.err }
@@ -0,0 +1,115 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	out := &strings.Builder{}
+	w := &PrefixWriter{W: out, Prefix: "a | "}
+	fmt.Fprint(w, "one\ntw")
+	if g, w := out.String(), "a | one\n"; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+	fmt.Fprint(w, "o\nthree")
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if g, w := out.String(), "a | one\na | two\na | three\n"; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+}
+
+func TestPrefixes(t *testing.T) {
+	got := Prefixes([]string{"a", "bcd"}, false)
+	if g, w := strings.Join(got, ","), "a   | ,bcd | "; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+	got = Prefixes([]string{"a"}, true)
+	if g, w := got[0], "\x1b[36ma | \x1b[0m"; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+}
+
+func TestRegistryGroupOutput(t *testing.T) {
+	r := &Registry{GroupOutput: true}
+	rt := r.Register("x", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(st.Stdout, "%v %d\n", st.Get("n"), i)
+		}
+		return nil
+	}))
+	rt.Matrix = map[string][]string{"n": {"1", "2"}}
+	rt.Parallel = true
+
+	out := &lockedBuilder{}
+	err := Run(context.Background(), &State{Stdout: out, Stderr: out}, r.Action("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := func(n string) string {
+		return fmt.Sprintf("x n=%[1]s | %[1]s 0\nx n=%[1]s | %[1]s 1\nx n=%[1]s | %[1]s 2\n", n)
+	}
+	g := out.String()
+	if g != group("1")+group("2") && g != group("2")+group("1") {
+		t.Fatalf("unexpected output %q", g)
+	}
+}
+
+type lockedBuilder struct {
+	mu sync.Mutex
+	sb strings.Builder
+}
+
+func (b *lockedBuilder) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.sb.Write(p)
+}
+
+func (b *lockedBuilder) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.sb.String()
+}
+
+func TestLabel(t *testing.T) {
+	out := &strings.Builder{}
+	var log []string
+	st := &State{
+		Stdout:      out,
+		Stderr:      out,
+		Policy:      PolicyLog | PolicyContinue,
+		MsgLogger:   func(msg string) { log = append(log, msg) },
+		ErrorLogger: func(err error) { log = append(log, "error: "+err.Error()) },
+	}
+	err := Run(context.Background(), st, NewScript(
+		Label("web", NewScript(
+			ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+				st.Log("start")
+				fmt.Fprint(st.Stdout, "out\npartial")
+				return nil
+			}),
+			Label("build", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+				return fmt.Errorf("fail")
+			})),
+		)),
+		ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			st.Log("after")
+			return nil
+		}),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := out.String(), "[web] out\n[web] partial\n"; g != w {
+		t.Fatalf("got output %q, want %q", g, w)
+	}
+	if g, w := strings.Join(log, "\n"), "[web] start\nerror: [web] [build] fail\nafter"; g != w {
+		t.Fatalf("got log %q, want %q", g, w)
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Progress of a long operation, such as a download or copy, started with
+// State.StartProgress. Write may be used to count bytes with io.TeeReader
+// or io.MultiWriter. Methods may be called concurrently.
+type Progress struct {
+	Name  string
+	Total int64 // Total amount, zero if unknown.
+
+	mu      sync.Mutex
+	clock   Clock
+	start   time.Time
+	current int64
+	done    bool
+	err     error
+	r       ProgressRenderer
+}
+
+// ProgressRenderer displays the progress of operations. Render is called
+// when a Progress starts, each time it is updated, and when it is done.
+// Progress is not displayed unless State.ProgressRenderer is set, such as
+// to TerminalProgress(os.Stderr).
+type ProgressRenderer interface {
+	Render(p *Progress)
+}
+
+// StartProgress starts reporting the progress of the named operation to
+// State.ProgressRenderer. The total is zero if unknown. If no renderer is
+// set, the progress is not reported. Done must be called when the operation
+// ends.
+func (st *State) StartProgress(name string, total int64) *Progress {
+	r := st.ProgressRenderer
+	if r == nil {
+		r = nopProgress{}
+	}
+	clock := st.clock()
+	p := &Progress{Name: name, Total: total, clock: clock, start: clock.Now(), r: r}
+	r.Render(p)
+	return p
+}
+
+// Add n to the current amount.
+func (p *Progress) Add(n int64) {
+	p.mu.Lock()
+	p.current += n
+	p.mu.Unlock()
+	p.r.Render(p)
+}
+
+// Write adds the length of b to the current amount.
+func (p *Progress) Write(b []byte) (int, error) {
+	p.Add(int64(len(b)))
+	return len(b), nil
+}
+
+// Done ends the operation with the error, if any.
+func (p *Progress) Done(err error) {
+	p.mu.Lock()
+	if p.done {
+		p.mu.Unlock()
+		return
+	}
+	p.done, p.err = true, err
+	p.mu.Unlock()
+	p.r.Render(p)
+}
+
+// Status returns the current amount, if the operation is done, and the
+// error it ended with.
+func (p *Progress) Status() (current int64, done bool, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.current, p.done, p.err
+}
+
+// Elapsed returns the time since the operation started on the State.Clock.
+func (p *Progress) Elapsed() time.Duration {
+	return p.clock.Now().Sub(p.start)
+}
+
+// summary of the progress, such as "download 45% 1.2 MiB/2.7 MiB".
+func (p *Progress) summary() string {
+	current, done, err := p.Status()
+	switch {
+	case err != nil:
+		return fmt.Sprintf("%s failed after %s: %v", p.Name, formatBytes(current), err)
+	case done:
+		return fmt.Sprintf("%s done, %s in %s", p.Name, formatBytes(current), p.Elapsed().Round(time.Millisecond))
+	case p.Total > 0:
+		return fmt.Sprintf("%s %3d%% %s/%s", p.Name, percent(current, p.Total), formatBytes(current), formatBytes(p.Total))
+	}
+	return fmt.Sprintf("%s %s", p.Name, formatBytes(current))
+}
+
+func percent(current, total int64) int {
+	if current >= total {
+		return 100
+	}
+	return int(current * 100 / total)
+}
+
+// formatBytes formats n with a binary unit, such as "1.2 MiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// nopProgress does not report progress.
+type nopProgress struct{}
+
+func (nopProgress) Render(p *Progress) {}
+
+// TerminalProgress returns a ProgressRenderer that draws progress bars and
+// spinners on f if it is a terminal. Otherwise it writes a line when an
+// operation starts, passes each quarter of its total, and ends.
+func TerminalProgress(f *os.File) ProgressRenderer {
+	if isTerminal(f) {
+		return NewProgressBars(f)
+	}
+	return &progressLines{w: f, last: make(map[*Progress]int)}
+}
+
+// progressLines writes plain progress lines.
+type progressLines struct {
+	mu   sync.Mutex
+	w    io.Writer
+	last map[*Progress]int // Last quarter written.
+}
+
+func (pl *progressLines) Render(p *Progress) {
+	current, done, _ := p.Status()
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	q, started := pl.last[p]
+	switch {
+	case done:
+		delete(pl.last, p)
+	case !started:
+		pl.last[p] = 0
+		if current == 0 {
+			fmt.Fprintf(pl.w, "%s started\n", p.Name)
+			return
+		}
+	case p.Total > 0:
+		nq := percent(current, p.Total) / 25
+		if nq <= q || nq == 4 {
+			return
+		}
+		pl.last[p] = nq
+	default:
+		return
+	}
+	fmt.Fprintln(pl.w, p.summary())
+}
+
+// ProgressBars draws a line of progress bars on a terminal.
+type ProgressBars struct {
+	// Interval is the minimum time between redraws, defaults to 100ms.
+	Interval time.Duration
+
+	mu     sync.Mutex
+	w      io.Writer
+	active []*Progress
+	drawn  time.Time
+	spin   int
+}
+
+// NewProgressBars returns ProgressBars that draw on w, which should be a
+// terminal.
+func NewProgressBars(w io.Writer) *ProgressBars {
+	return &ProgressBars{w: w}
+}
+
+var spinner = []string{"|", "/", "-", "\\"}
+
+const barWidth = 20
+
+// Render implements ProgressRenderer. Finished operations are written on
+// their own line and the active operations are redrawn.
+func (pb *ProgressBars) Render(p *Progress) {
+	_, done, _ := p.Status()
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	i := 0
+	for ; i < len(pb.active) && pb.active[i] != p; i++ {
+	}
+	if done {
+		if i < len(pb.active) {
+			pb.active = append(pb.active[:i], pb.active[i+1:]...)
+		}
+		fmt.Fprintf(pb.w, "\r\x1b[K%s\n", p.summary())
+		pb.draw(p.clock.Now())
+		return
+	}
+	if i == len(pb.active) {
+		pb.active = append(pb.active, p)
+	}
+	interval := pb.Interval
+	if interval == 0 {
+		interval = 100 * time.Millisecond
+	}
+	now := p.clock.Now()
+	if now.Sub(pb.drawn) < interval {
+		return
+	}
+	pb.draw(now)
+}
+
+func (pb *ProgressBars) draw(now time.Time) {
+	pb.drawn = now
+	if len(pb.active) == 0 {
+		return
+	}
+	pb.spin = (pb.spin + 1) % len(spinner)
+	parts := make([]string, len(pb.active))
+	for i, p := range pb.active {
+		current, _, _ := p.Status()
+		if p.Total <= 0 {
+			parts[i] = fmt.Sprintf("%s %s %s", spinner[pb.spin], p.Name, formatBytes(current))
+			continue
+		}
+		fill := percent(current, p.Total) * barWidth / 100
+		bar := strings.Repeat("=", fill) + strings.Repeat(" ", barWidth-fill)
+		parts[i] = fmt.Sprintf("%s [%s] %3d%%", p.Name, bar, percent(current, p.Total))
+	}
+	fmt.Fprintf(pb.w, "\r\x1b[K%s", strings.Join(parts, "  "))
+}
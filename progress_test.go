@@ -0,0 +1,83 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressLines(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	st := &State{ProgressRenderer: TerminalProgress(f), Clock: stoppedClock(time.Unix(0, 0))}
+
+	p := st.StartProgress("download", 4096)
+	for i := 0; i < 8; i++ {
+		p.Write(make([]byte, 512))
+	}
+	p.Done(nil)
+	p.Done(nil)
+	q := st.StartProgress("copy", 0)
+	q.Add(10)
+	q.Done(errors.New("disk full"))
+
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(b)
+	for _, line := range []string{
+		"download started\n",
+		"download  25% 1.0 KiB/4.0 KiB\n",
+		"download  50% 2.0 KiB/4.0 KiB\n",
+		"download  75% 3.0 KiB/4.0 KiB\n",
+		"copy failed after 10 B: disk full\n",
+	} {
+		if !strings.Contains(got, line) {
+			t.Errorf("missing %q in:\n%s", line, got)
+		}
+	}
+	if n := strings.Count(got, "download done, 4.0 KiB in 0s\n"); n != 1 {
+		t.Errorf("expected one done line, got %d in:\n%s", n, got)
+	}
+}
+
+func TestProgressBars(t *testing.T) {
+	buf := &strings.Builder{}
+	pb := NewProgressBars(buf)
+	pb.Interval = -1
+	st := &State{ProgressRenderer: pb}
+
+	p := st.StartProgress("a", 100)
+	p.Add(50)
+	if g, w := buf.String()[strings.LastIndex(buf.String(), "\r"):], "\r\x1b[Ka [==========          ]  50%"; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+	p.Done(nil)
+	if !strings.Contains(buf.String(), "\r\x1b[Ka done, 50 B in ") {
+		t.Fatalf("missing done line in %q", buf.String())
+	}
+}
+
+func TestProgressNone(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var msgs []string
+	st := &State{Dir: dir, MsgLogger: func(msg string) { msgs = append(msgs, msg) }}
+	err := Run(context.Background(), st, Copy("a.txt", "b.txt", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 0 {
+		t.Fatalf("got %q, want no progress without a renderer", msgs)
+	}
+}
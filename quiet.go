@@ -0,0 +1,96 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// QuietVar is the State variable that, when set to true, runs Registry
+// tasks with Quiet and QuietSize. Commands from a Registry set it with the
+// "-quiet" flag.
+const QuietVar = "quiet"
+
+// QuietSize is the default number of output bytes kept by Quiet.
+const QuietSize = 64 << 10
+
+// tailBuffer keeps the last size bytes written.
+type tailBuffer struct {
+	mu   sync.Mutex
+	size int
+	buf  []byte
+	cut  bool // Output before buf was dropped.
+}
+
+func (tb *tailBuffer) Write(p []byte) (int, error) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.buf = append(tb.buf, p...)
+	if over := len(tb.buf) - tb.size; over > 0 {
+		tb.buf = tb.buf[:copy(tb.buf, tb.buf[over:])]
+		tb.cut = true
+	}
+	return len(p), nil
+}
+
+// take returns the held output and resets the buffer.
+func (tb *tailBuffer) take() ([]byte, bool) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	b, cut := tb.buf, tb.cut
+	tb.buf, tb.cut = nil, false
+	return b, cut
+}
+
+// writeKept writes the kept output b, framed with a header describing it.
+func writeKept(w io.Writer, what string, b []byte) {
+	fmt.Fprintf(w, "--- %s ---\n", what)
+	w.Write(b)
+	if b[len(b)-1] != '\n' {
+		io.WriteString(w, "\n")
+	}
+	io.WriteString(w, "---\n")
+}
+
+// Quiet runs the action a without writing its stdout and stderr. The last
+// size bytes of output are kept, and written to stderr if an action fails,
+// so the failure has context. The kept output is dropped each time a Named
+// action succeeds. If size is zero, QuietSize is used.
+func Quiet(size int, a Action) Action {
+	if size <= 0 {
+		size = QuietSize
+	}
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		tb := &tailBuffer{size: size}
+		orig := *st
+		st.Stdout, st.Stderr = tb, tb
+		st.eventFuncs = append(orig.eventFuncs[:len(orig.eventFuncs):len(orig.eventFuncs)], func(e Event) {
+			switch {
+			case e.Type == EventFinish && len(e.Err) == 0:
+				tb.take()
+			case e.Type == EventError:
+				b, cut := tb.take()
+				if len(b) == 0 || orig.Stderr == nil {
+					return
+				}
+				what := "output"
+				if cut {
+					what = fmt.Sprintf("last %d bytes of output", len(b))
+				}
+				if len(e.Action) > 0 {
+					what += " of " + e.Action
+				}
+				writeKept(orig.Stderr, what, b)
+			}
+		})
+		err := sc.RunAction(ctx, st, a)
+		st.Stdout, st.Stderr = orig.Stdout, orig.Stderr
+		st.eventFuncs = orig.eventFuncs
+		return err
+	})
+}
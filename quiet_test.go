@@ -0,0 +1,45 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestQuiet(t *testing.T) {
+	r := &Registry{}
+	r.Register("gen", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		fmt.Fprintln(st.Stdout, "generating")
+		return nil
+	}))
+	r.Register("test", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		fmt.Fprintln(st.Stdout, "running 3 tests")
+		fmt.Fprint(st.Stderr, strings.Repeat("x", 20)+"FAIL: TestB")
+		return errors.New("1 test failed")
+	})).Deps = []string{"gen"}
+
+	out := &strings.Builder{}
+	st := &State{Stdout: out, Stderr: out}
+	err := Run(context.Background(), st, r.Command("r", "").Exec([]string{"-quiet", "test"}))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	want := "--- output of test ---\nrunning 3 tests\n" + strings.Repeat("x", 20) + "FAIL: TestB\n---\n"
+	if g := out.String(); g != want {
+		t.Fatalf("got %q, want %q", g, want)
+	}
+
+	out.Reset()
+	err = Run(context.Background(), st, Quiet(8, ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		fmt.Fprint(st.Stdout, "0123456789abcdef\n")
+		return errors.New("fail")
+	})))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if g, w := out.String(), "--- last 8 bytes of output ---\n9abcdef\n---\n"; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// CommandLine returns args quoted as a command line for the current
+// operating system, with QuoteWindows on Windows and QuotePOSIX otherwise.
+func CommandLine(args ...string) string {
+	if runtime.GOOS == "windows" {
+		return QuoteWindows(args)
+	}
+	return QuotePOSIX(args)
+}
+
+// QuotePOSIX returns args quoted for a POSIX shell. Arguments that are
+// empty or contain characters special to the shell are single quoted.
+func QuotePOSIX(args []string) string {
+	list := make([]string, len(args))
+	for i, a := range args {
+		if len(a) > 0 && strings.IndexFunc(a, func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:,+@%", r))
+		}) < 0 {
+			list[i] = a
+			continue
+		}
+		list[i] = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+	}
+	return strings.Join(list, " ")
+}
+
+// QuoteWindows returns args quoted as a Windows command line, to be split
+// by programs with the rules of CommandLineToArgvW.
+func QuoteWindows(args []string) string {
+	list := make([]string, len(args))
+	for i, a := range args {
+		list[i] = quoteWindowsArg(a)
+	}
+	return strings.Join(list, " ")
+}
+
+func quoteWindowsArg(a string) string {
+	if len(a) > 0 && !strings.ContainsAny(a, " \t\"") {
+		return a
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	slashes := 0
+	for _, r := range a {
+		switch r {
+		case '\\':
+			slashes++
+			continue
+		case '"':
+			// Escape the backslashes and the quote.
+			b.WriteString(strings.Repeat(`\`, 2*slashes+1))
+		default:
+			b.WriteString(strings.Repeat(`\`, slashes))
+		}
+		slashes = 0
+		b.WriteRune(r)
+	}
+	// Backslashes before the closing quote are escaped.
+	b.WriteString(strings.Repeat(`\`, 2*slashes))
+	b.WriteByte('"')
+	return b.String()
+}
+
+// QuoteCmd returns args quoted as a command line for cmd.exe, such as to
+// run a .bat or .cmd script. Arguments with characters special to cmd.exe
+// are double quoted, and "%" is written so it is not expanded. An argument
+// with a line break or NUL can not be passed and returns an error.
+func QuoteCmd(args []string) (string, error) {
+	list := make([]string, len(args))
+	for i, a := range args {
+		if strings.ContainsAny(a, "\r\n\x00") {
+			return "", fmt.Errorf("argument %q can not be passed to cmd.exe", a)
+		}
+		if len(a) > 0 && !strings.ContainsAny(a, " \t\"&|<>^(),;=%!'`") {
+			list[i] = a
+			continue
+		}
+		q := quoteWindowsArg(strings.ReplaceAll(a, `"`, "\x00"))
+		if !strings.HasPrefix(q, `"`) {
+			q = `"` + q + `"`
+		}
+		// Within quotes cmd.exe only treats '"' and '%' specially.
+		q = strings.ReplaceAll(q, "\x00", `""`)
+		q = strings.ReplaceAll(q, "%", "%%cd:~,%")
+		list[i] = q
+	}
+	return strings.Join(list, " "), nil
+}
+
+// defaultPathExt is used when PATHEXT is not set.
+const defaultPathExt = ".com;.exe;.bat;.cmd"
+
+// envValue returns the env value of key, ignoring case if fold is set,
+// as Windows does.
+func envValue(env map[string]string, key string, fold bool) (string, bool) {
+	if v, ok := env[key]; ok || !fold {
+		return v, ok
+	}
+	for k, v := range env {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// lookPath finds the executable name in the PATH of env, or relative to
+// dir if name has a directory. On Windows the extensions of PATHEXT are
+// tried if name does not have one of them. If env does not have a PATH,
+// exec.LookPath is used.
+func lookPath(name, dir string, env map[string]string, windows bool, isFile func(fn string) bool) (string, error) {
+	path, ok := envValue(env, "PATH", windows)
+	if !ok {
+		return exec.LookPath(name)
+	}
+	candidates := func(base string) []string {
+		if !windows {
+			return []string{base}
+		}
+		pathExt, _ := envValue(env, "PATHEXT", true)
+		if len(pathExt) == 0 {
+			pathExt = defaultPathExt
+		}
+		var exts []string
+		for _, e := range strings.Split(strings.ToLower(pathExt), ";") {
+			if len(e) > 0 {
+				exts = append(exts, e)
+			}
+		}
+		ext := strings.ToLower(filepath.Ext(base))
+		for _, e := range exts {
+			if e == ext {
+				return []string{base}
+			}
+		}
+		var list []string
+		if len(ext) > 0 {
+			list = append(list, base)
+		}
+		for _, e := range exts {
+			list = append(list, base+e)
+		}
+		return list
+	}
+	if strings.ContainsAny(name, `/\:`) {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		for _, fn := range candidates(name) {
+			if isFile(fn) {
+				return fn, nil
+			}
+		}
+		return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+	}
+	for _, p := range filepath.SplitList(path) {
+		if len(p) == 0 || !filepath.IsAbs(p) {
+			continue
+		}
+		for _, fn := range candidates(filepath.Join(p, name)) {
+			if isFile(fn) {
+				return fn, nil
+			}
+		}
+	}
+	return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+}
+
+// isRegularFile reports if fn is a regular file.
+func isRegularFile(fn string) bool {
+	fi, err := os.Stat(fn)
+	return err == nil && fi.Mode().IsRegular()
+}
+
+// isCmdScript reports if fn is run by cmd.exe.
+func isCmdScript(fn string) bool {
+	switch strings.ToLower(filepath.Ext(fn)) {
+	case ".bat", ".cmd":
+		return true
+	}
+	return false
+}
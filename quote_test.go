@@ -0,0 +1,73 @@
+package task
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQuote(t *testing.T) {
+	args := []string{"run", "", "a b", `say "hi"`, `C:\dir\`, `C:\a b\`, "it's", "50%"}
+	if g, w := QuotePOSIX(args), `run '' 'a b' 'say "hi"' 'C:\dir\' 'C:\a b\' 'it'\''s' 50%`; g != w {
+		t.Errorf("posix: got %s, want %s", g, w)
+	}
+	if g, w := QuoteWindows(args), `run "" "a b" "say \"hi\"" C:\dir\ "C:\a b\\" it's 50%`; g != w {
+		t.Errorf("windows: got %s, want %s", g, w)
+	}
+	g, err := QuoteCmd(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := `run "" "a b" "say ""hi""" C:\dir\ "C:\a b\\" "it's" "50%%cd:~,%"`; g != w {
+		t.Errorf("cmd: got %s, want %s", g, w)
+	}
+	if _, err := QuoteCmd([]string{"a\nb"}); err == nil {
+		t.Error("expected error for line break")
+	}
+}
+
+func TestLookPath(t *testing.T) {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	for _, fn := range []string{"bin/tool.cmd", "bin/run.exe", "bin/run.bat", "local/build.bat"} {
+		fn = filepath.Join(dir, filepath.FromSlash(fn))
+		if err := os.MkdirAll(filepath.Dir(fn), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fn, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	env := map[string]string{
+		"Path":    strings.Join([]string{"relative", filepath.Join(dir, "missing"), bin}, string(os.PathListSeparator)),
+		"PATHEXT": ".EXE;.BAT;.CMD",
+	}
+	list := []struct {
+		name string
+		want string
+	}{
+		{"tool", filepath.Join(bin, "tool.cmd")},
+		{"run", filepath.Join(bin, "run.exe")},
+		{"run.bat", filepath.Join(bin, "run.bat")},
+		{filepath.Join("local", "build"), filepath.Join(dir, "local", "build.bat")},
+		{"missing", ""},
+	}
+	if !isCmdScript("RUN.BAT") || isCmdScript("run.exe") {
+		t.Error("isCmdScript")
+	}
+	for _, item := range list {
+		got, err := lookPath(item.name, dir, env, true, isRegularFile)
+		if len(item.want) == 0 {
+			if !errors.Is(err, exec.ErrNotFound) {
+				t.Errorf("%s: got %q, %v, want not found", item.name, got, err)
+			}
+			continue
+		}
+		if err != nil || got != item.want {
+			t.Errorf("%s: got %q, %v, want %q", item.name, got, err, item.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"sync"
+)
+
+// SeedVar is the State variable holding the int64 seed of the run's random
+// values. If set before they are first used, RunID and the random helpers
+// return the same values for each run with the seed. Commands from a
+// Registry set it with the "-seed" flag.
+const SeedVar = "seed"
+
+// runRand is the seeded random source of a run, shared by copies of the
+// State.
+type runRand struct {
+	mu   sync.Mutex
+	seed int64
+	rand *rand.Rand
+	id   string
+}
+
+func (st *State) runRand() *runRand {
+	if st.rand != nil {
+		return st.rand
+	}
+	seed, ok := st.Get(SeedVar).(int64)
+	if !ok {
+		var b [8]byte
+		crand.Read(b[:])
+		seed = int64(binary.LittleEndian.Uint64(b[:]) >> 1)
+	}
+	r := rand.New(rand.NewSource(seed))
+	st.rand = &runRand{seed: seed, rand: r, id: fmt.Sprintf("%016x", r.Uint64())}
+	st.Debugf("run %s, seed %d", st.rand.id, seed)
+	return st.rand
+}
+
+// Seed returns the seed of the run's random values, from SeedVar or chosen
+// at random. Pass it as SeedVar to repeat the run's random values.
+func (st *State) Seed() int64 {
+	return st.runRand().seed
+}
+
+// RunID returns the identifier of the run, 16 hex characters derived from
+// the seed.
+func (st *State) RunID() string {
+	return st.runRand().id
+}
+
+// RandInt63n returns a random number in [0, n) from the run's seeded source.
+// It panics if n <= 0.
+func (st *State) RandInt63n(n int64) int64 {
+	r := st.runRand()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rand.Int63n(n)
+}
+
+// RandomName returns prefix followed by 8 random hex characters from the
+// run's seeded source, for temporary names and resource suffixes. It is
+// not suitable for secrets.
+func (st *State) RandomName(prefix string) string {
+	r := st.runRand()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return fmt.Sprintf("%s%08x", prefix, r.rand.Uint32())
+}
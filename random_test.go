@@ -0,0 +1,54 @@
+package task
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRandomSeed(t *testing.T) {
+	values := func(st *State) string {
+		return strings.Join([]string{st.RunID(), st.RandomName("tmp-"), st.RandomName("tmp-")}, " ")
+	}
+	seeded := func() *State {
+		st := &State{}
+		st.Set(SeedVar, int64(42))
+		return st
+	}
+	a, b := values(seeded()), values(seeded())
+	if a != b {
+		t.Fatalf("expected seeded values to repeat, got %q and %q", a, b)
+	}
+	if !strings.HasPrefix(strings.Fields(a)[1], "tmp-") || len(strings.Fields(a)[0]) != 16 {
+		t.Fatalf("bad values %q", a)
+	}
+
+	st := &State{}
+	c := values(st)
+	if c == a {
+		t.Fatal("expected random seed")
+	}
+	again := &State{}
+	again.Set(SeedVar, st.Seed())
+	if g := values(again); g != c {
+		t.Fatalf("expected Seed to repeat run, got %q, want %q", g, c)
+	}
+}
+
+func TestSeedFlag(t *testing.T) {
+	r := &Registry{}
+	var id string
+	r.Register("name", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		id = st.RunID()
+		return nil
+	}))
+	run := func() string {
+		if err := Run(context.Background(), &State{}, r.Command("reg", "").Exec([]string{"-seed", "7", "name"})); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	if a, b := run(), run(); a != b || len(a) == 0 {
+		t.Fatalf("got %q and %q", a, b)
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Streams of recorded output.
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+	StreamLog    = "log"
+	StreamError  = "error"
+)
+
+// RecordEntry is an entry of a run recording: an Event or output written
+// to a stream.
+type RecordEntry struct {
+	Offset time.Duration `json:"offset"`           // Time since the recording started.
+	Event  *Event        `json:"event,omitempty"`  // Set for events.
+	Stream string        `json:"stream,omitempty"` // Set for output.
+	Action string        `json:"action,omitempty"` // Path of the Named actions when output was written.
+	Data   string        `json:"data,omitempty"`
+}
+
+// recorder writes entries to a recording file.
+type recorder struct {
+	mu    sync.Mutex
+	start time.Time
+	enc   *json.Encoder
+}
+
+func (r *recorder) add(e RecordEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e.Offset = time.Since(r.start)
+	r.enc.Encode(e)
+}
+
+// recordWriter records writes to the stream and passes them on to w.
+type recordWriter struct {
+	r      *recorder
+	st     *State
+	stream string
+	w      io.Writer
+}
+
+func (rw *recordWriter) Write(p []byte) (int, error) {
+	rw.r.add(RecordEntry{Stream: rw.stream, Action: strings.Join(rw.st.names, "/"), Data: rw.st.Redact(string(p))})
+	if rw.w == nil {
+		return len(p), nil
+	}
+	return rw.w.Write(p)
+}
+
+// Record runs the action a and records its events, output, logged messages,
+// and timing to filename, relative to State.Dir, as lines of JSON. The
+// recording is written as the run progresses, so it is kept if the process
+// is killed. Use Replay or ReplayCommand to view it.
+func Record(filename any, a Action) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		fn, err := ExpandEnvErr(filename, st)
+		if err != nil {
+			return err
+		}
+		f, err := os.Create(st.Filepath(fn))
+		if err != nil {
+			return err
+		}
+		rec := &recorder{start: time.Now(), enc: json.NewEncoder(f)}
+
+		orig := *st
+		st.eventFuncs = append(orig.eventFuncs[:len(orig.eventFuncs):len(orig.eventFuncs)], func(e Event) {
+			rec.add(RecordEntry{Event: &e})
+		})
+		st.Stdout = &recordWriter{r: rec, st: st, stream: StreamStdout, w: orig.Stdout}
+		st.Stderr = &recordWriter{r: rec, st: st, stream: StreamStderr, w: orig.Stderr}
+		st.MsgLogger = func(msg string) {
+			rec.add(RecordEntry{Stream: StreamLog, Action: strings.Join(st.names, "/"), Data: msg})
+			if orig.MsgLogger != nil {
+				orig.MsgLogger(msg)
+			}
+		}
+		st.ErrorLogger = func(err error) {
+			rec.add(RecordEntry{Stream: StreamError, Action: strings.Join(st.names, "/"), Data: err.Error()})
+			if orig.ErrorLogger != nil {
+				orig.ErrorLogger(err)
+			}
+		}
+		err = sc.RunAction(ctx, st, a)
+		st.eventFuncs = orig.eventFuncs
+		st.Stdout, st.Stderr = orig.Stdout, orig.Stderr
+		st.MsgLogger, st.ErrorLogger = orig.MsgLogger, orig.ErrorLogger
+
+		if err != nil {
+			rec.add(RecordEntry{Stream: StreamError, Data: st.redactError(err).Error()})
+		}
+		return errors.Join(err, f.Close())
+	})
+}
+
+// ReadRecording reads the entries of a recording written by Record.
+func ReadRecording(r io.Reader) ([]RecordEntry, error) {
+	var list []RecordEntry
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 16<<20)
+	for s.Scan() {
+		var e RecordEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return list, fmt.Errorf("recording line %d: %w", len(list)+1, err)
+		}
+		list = append(list, e)
+	}
+	return list, s.Err()
+}
+
+// ReplayOptions configure Replay.
+type ReplayOptions struct {
+	// Failures only shows the entries of failed Named actions, their
+	// enclosing actions, and errors.
+	Failures bool
+
+	// Speed replays with the recorded timing, faster if greater then one.
+	// If zero the entries are written at once.
+	Speed float64
+}
+
+// Replay writes the recording entries to w in a human readable form, with
+// the time offset of each entry.
+func Replay(ctx context.Context, w io.Writer, list []RecordEntry, opts ReplayOptions) error {
+	var failed []string
+	if opts.Failures {
+		for _, e := range list {
+			if e.Event != nil && e.Event.Type == EventFinish && len(e.Event.Err) > 0 {
+				failed = append(failed, e.Event.Action)
+			}
+		}
+	}
+	show := func(action string) bool {
+		for _, f := range failed {
+			if action == f || strings.HasPrefix(f, action+"/") || strings.HasPrefix(action, f+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	var last time.Duration
+	for _, e := range list {
+		action := e.Action
+		if e.Event != nil {
+			action = e.Event.Action
+		}
+		if opts.Failures && e.Stream != StreamError && !show(action) {
+			continue
+		}
+		if opts.Speed > 0 && e.Offset > last {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(float64(e.Offset-last) / opts.Speed)):
+			}
+			last = e.Offset
+		}
+		if _, err := io.WriteString(w, formatEntry(e)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatEntry(e RecordEntry) string {
+	prefix := fmt.Sprintf("[%8.3fs] ", e.Offset.Seconds())
+	if ev := e.Event; ev != nil {
+		line := fmt.Sprintf("%s%s %s", prefix, ev.Type, ev.Action)
+		switch ev.Type {
+		case EventOp:
+			line = fmt.Sprintf("%s%s: %s", prefix, ev.Op, ev.Detail)
+		case EventFinish:
+			line += fmt.Sprintf(" (%s)", ev.Duration.Round(time.Millisecond))
+		}
+		if len(ev.Err) > 0 {
+			line += ": " + ev.Err
+		}
+		return line + "\n"
+	}
+	buf := &strings.Builder{}
+	for _, l := range strings.SplitAfter(strings.TrimSuffix(e.Data, "\n"), "\n") {
+		fmt.Fprintf(buf, "%s%s| %s", prefix, e.Stream, l)
+		if !strings.HasSuffix(l, "\n") {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.String()
+}
+
+// ReplayCommand returns a command that replays the recording file given as
+// its argument to stdout. The "-failures" flag shows only failed actions
+// and the "-speed" flag replays with the recorded timing.
+func ReplayCommand(name string) *Command {
+	return &Command{
+		Name:  name,
+		Usage: "replay a run recording",
+		Flags: []*Flag{
+			{Name: "failures", Usage: "only show failed actions", Type: FlagBool},
+			{Name: "speed", Usage: "replay with recorded timing, at this speed", Type: FlagFloat64},
+		},
+		Action: ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			args, _ := st.Get("args").([]string)
+			if len(args) != 1 {
+				return ErrUsage(name + " - replay a run recording\n\tusage: " + name + " [-failures] [-speed N] <file>\n")
+			}
+			f, err := os.Open(st.Filepath(args[0]))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			list, err := ReadRecording(f)
+			if err != nil {
+				return err
+			}
+			var opts ReplayOptions
+			opts.Failures, _ = st.Get("failures").(bool)
+			opts.Speed, _ = st.Get("speed").(float64)
+			return Replay(ctx, st.Stdout, list, opts)
+		}),
+	}
+}
@@ -0,0 +1,93 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	stdout := &strings.Builder{}
+	st := &State{Dir: dir, Stdout: stdout}
+	err := Run(context.Background(), st, Record("run.jsonl", NewScript(
+		Named("build", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			fmt.Fprintln(st.Stdout, "compiling")
+			return nil
+		})),
+		Named("deploy", NewScript(
+			Named("push", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+				fmt.Fprintln(st.Stdout, "pushing")
+				return errors.New("denied")
+			})),
+		)),
+	)))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if g, w := stdout.String(), "compiling\npushing\n"; g != w {
+		t.Fatalf("got stdout %q, want %q", g, w)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "run.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	list, err := ReadRecording(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay := func(opts ReplayOptions) string {
+		buf := &strings.Builder{}
+		if err := Replay(context.Background(), buf, list, opts); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		for i, l := range lines {
+			// Remove the time offset and durations.
+			l = l[strings.Index(l, "] ")+2:]
+			if i := strings.Index(l, " ("); i > 0 {
+				l = l[:i] + l[strings.Index(l, ")")+1:]
+			}
+			lines[i] = l
+		}
+		return strings.Join(lines, "\n")
+	}
+	all := `start build
+stdout| compiling
+finish build
+start deploy
+start deploy/push
+stdout| pushing
+error deploy/push: denied
+finish deploy/push: denied
+finish deploy: denied
+error| denied`
+	if g := replay(ReplayOptions{}); g != all {
+		t.Fatalf("got:\n%s\nwant:\n%s", g, all)
+	}
+	failures := `start deploy
+start deploy/push
+stdout| pushing
+error deploy/push: denied
+finish deploy/push: denied
+finish deploy: denied
+error| denied`
+	if g := replay(ReplayOptions{Failures: true}); g != failures {
+		t.Fatalf("got:\n%s\nwant:\n%s", g, failures)
+	}
+
+	out := &strings.Builder{}
+	err = Run(context.Background(), &State{Dir: dir, Stdout: out}, ReplayCommand("replay").Exec([]string{"-failures", "run.jsonl"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "stdout| pushing") || strings.Contains(out.String(), "compiling") {
+		t.Fatalf("got replay command output:\n%s", out.String())
+	}
+}
@@ -0,0 +1,458 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Task is a named Action held in a Registry.
+type Task struct {
+	Name   string
+	Usage  string
+	Deps   []string // Names of tasks to run before this task.
+	Flags  []*Flag
+	Action Action
+	Dir    string // Directory to run the task in, relative to State.Dir.
+
+	// Env is set while the task runs, after reading the Dotenv files.
+	// Dotenv files are relative to the task directory, later files
+	// override earlier ones, and missing files are ignored.
+	Env    map[string]string
+	Dotenv []string
+
+	// Matrix lists state variables and the values each may take. If set,
+	// the task is run once for each combination of values, with the
+	// values set in the State bucket. Env values may refer to them, such
+	// as "GOOS": "${goos}". Combinations are run in order of the sorted
+	// variable names unless Parallel is set, then they are run concurrently.
+	Matrix   map[string][]string
+	Parallel bool
+
+	// Sources and Outputs are file globs relative to the task directory.
+	// If Outputs are declared and every output is newer then every source,
+	// the task is up to date and is skipped.
+	Sources []string
+	Outputs []string
+
+	// Fingerprint values, such as command lines, are expanded with ExpandEnv
+	// and included with the content of the Sources when the Registry uses
+	// a FingerprintStore.
+	Fingerprint []string
+
+	// UpToDate optionally reports if the task has nothing to do.
+	// If set, it is used instead of comparing Sources and Outputs.
+	// It is called with State.Dir set to the task directory.
+	UpToDate func(ctx context.Context, st *State) (bool, error)
+}
+
+// State variables used by Registry actions. Commands from a Registry set
+// them with the "-force" and "-watch" flags.
+const (
+	ForceVar = "force" // Run tasks even if they are up to date.
+	WatchVar = "watch" // Re-run tasks when their sources change.
+)
+
+// Registry holds named tasks. Packages may register tasks in an init
+// function and the main package exposes them with Command.
+//
+// If Fingerprints is set, a task with outputs is up to date when its
+// outputs exist and the fingerprint of its sources matches the stored
+// fingerprint, rather then comparing file modification times.
+//
+// Output lines of tasks run in parallel are prefixed with the task name.
+// If GroupOutput is set, the output of each run is held until it ends so
+// the output of runs does not interleave. If ColorOutput or State.Color is
+// set, the prefixes are colored.
+//
+// If Cache is set along with Fingerprints, the outputs of a task are
+// stored in the cache under the fingerprint of its sources after it runs,
+// and restored from the cache rather than running the task again, such as
+// on another machine. Cache errors are logged and do not fail the task.
+type Registry struct {
+	Fingerprints  *FingerprintStore
+	Cache         CacheBackend
+	WatchInterval time.Duration // Poll interval in watch mode, defaults to half a second.
+	GroupOutput   bool
+	ColorOutput   bool
+
+	mu    sync.Mutex
+	tasks map[string]*Task
+}
+
+// DefaultRegistry is the Registry used by Register.
+var DefaultRegistry = &Registry{}
+
+// Register the action under name in the DefaultRegistry.
+func Register(name string, a Action) *Task {
+	return DefaultRegistry.Register(name, a)
+}
+
+// Register the action under name. The returned Task may be used to set
+// the usage and flags. Register panics if name is already registered.
+func (r *Registry) Register(name string, a Action) *Task {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.tasks == nil {
+		r.tasks = make(map[string]*Task)
+	}
+	if _, ok := r.tasks[name]; ok {
+		panic(fmt.Errorf("task %q already registered", name))
+	}
+	t := &Task{
+		Name:   name,
+		Action: a,
+	}
+	r.tasks[name] = t
+	return t
+}
+
+// Include registers each task of other under namespace, named
+// "namespace:name". Dependencies between the included tasks are
+// renamed to match. Tasks added to other after Include are not seen.
+func (r *Registry) Include(namespace string, other *Registry) {
+	for _, t := range other.Tasks() {
+		deps := make([]string, len(t.Deps))
+		for i, dep := range t.Deps {
+			deps[i] = namespace + ":" + dep
+		}
+		nt := r.Register(namespace+":"+t.Name, t.Action)
+		nt.Usage = t.Usage
+		nt.Deps = deps
+		nt.Flags = t.Flags
+		nt.Dir = t.Dir
+		nt.Env = t.Env
+		nt.Dotenv = t.Dotenv
+		nt.Matrix = t.Matrix
+		nt.Parallel = t.Parallel
+		nt.Sources = t.Sources
+		nt.Outputs = t.Outputs
+		nt.Fingerprint = t.Fingerprint
+		nt.UpToDate = t.UpToDate
+	}
+}
+
+// Lookup the task called name.
+func (r *Registry) Lookup(name string) (*Task, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.tasks[name]
+	return t, ok
+}
+
+// Tasks returns all registered tasks sorted by name.
+func (r *Registry) Tasks() []*Task {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := make([]*Task, 0, len(r.tasks))
+	for _, t := range r.tasks {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Action returns an action that runs the named task after its dependencies.
+// Dependencies are run depth first in the order declared and each task is
+// run at most once, even if several tasks depend on it. A dependency
+// cycle returns an error before any task is run.
+func (r *Registry) Action(name string) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		order, err := r.order(name)
+		if err != nil {
+			return err
+		}
+		if watch, _ := st.Get(WatchVar).(bool); watch {
+			return r.watch(ctx, st, order)
+		}
+		run := r.runOrder(order, nil)
+		if quiet, _ := st.Get(QuietVar).(bool); quiet {
+			run = Quiet(QuietSize, run)
+		}
+		if dir, _ := st.Get(ArtifactsVar).(string); len(dir) > 0 {
+			run = ActionOutput(dir, run)
+		}
+		if summary, _ := st.Get(SummaryVar).(bool); summary {
+			run = Summarize(nil, run)
+		}
+		if trace, _ := st.Get(TraceVar).(bool); trace {
+			run = Trace(run)
+		}
+		return sc.RunAction(ctx, st, run)
+	})
+}
+
+// runOrder runs each task in order. Tasks in forced are run even if
+// they are up to date.
+func (r *Registry) runOrder(order []*Task, forced map[string]bool) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		for _, t := range order {
+			if t.Action == nil {
+				continue
+			}
+			err := sc.RunAction(ctx, st, Named(t.Name, r.run(t, forced[t.Name])))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// run the task unless it is up to date.
+func (r *Registry) run(t *Task, force bool) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		if f, _ := st.Get(ForceVar).(bool); f {
+			force = true
+		}
+		ok, sum, err := r.upToDate(ctx, st, t)
+		if err != nil {
+			return fmt.Errorf("task %q: %w", t.Name, err)
+		}
+		if ok && !force {
+			st.emit(Event{Type: EventSkip, Detail: "up to date"})
+			st.LogStatus(StatusSkip, fmt.Sprintf("task %s (up to date)", t.Name))
+			return nil
+		}
+		cache := r.Cache != nil && len(sum) > 0 && !DryRun(st)
+		if cache && !force {
+			ok, err := r.restoreOutputs(ctx, st, t, sum)
+			if err != nil {
+				st.Logf("task %s cache: %v", t.Name, err)
+			}
+			if ok {
+				st.emit(Event{Type: EventSkip, Detail: "restored from cache"})
+				st.Logf("task %s restored from cache", t.Name)
+				return r.Fingerprints.Set(t.Name, sum)
+			}
+		}
+
+		if len(t.Matrix) > 0 {
+			err = sc.RunAction(ctx, st, r.runMatrix(t))
+		} else {
+			err = sc.RunAction(ctx, st, runTask(t))
+		}
+		if err != nil {
+			return err
+		}
+		if len(sum) > 0 && !DryRun(st) {
+			if cache {
+				if err := r.storeOutputs(ctx, st, t, sum); err != nil {
+					st.Logf("task %s cache: %v", t.Name, err)
+				}
+			}
+			return r.Fingerprints.Set(t.Name, sum)
+		}
+		return nil
+	})
+}
+
+// runTask runs the task action once in the task directory with the task env.
+func runTask(t *Task) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		origDir, origEnv := st.Dir, st.Env
+		defer func() {
+			st.Dir, st.Env = origDir, origEnv
+		}()
+		st.Dir = st.Filepath(t.Dir)
+		if len(t.Env) > 0 || len(t.Dotenv) > 0 {
+			env, err := taskEnv(st, t)
+			if err != nil {
+				return fmt.Errorf("task %q: %w", t.Name, err)
+			}
+			st.Env = env
+		}
+		return sc.RunAction(ctx, st, t.Action)
+	})
+}
+
+// upToDate reports if the task is up to date. If a fingerprint is used
+// it is returned to be stored after the task runs.
+func (r *Registry) upToDate(ctx context.Context, st *State, t *Task) (bool, string, error) {
+	origDir := st.Dir
+	st.Dir = st.Filepath(t.Dir)
+	defer func() {
+		st.Dir = origDir
+	}()
+
+	if t.UpToDate != nil {
+		ok, err := t.UpToDate(ctx, st)
+		return ok, "", err
+	}
+	if len(t.Outputs) == 0 {
+		return false, "", nil
+	}
+	if r.Fingerprints == nil {
+		ok, err := SourcesUpToDate(st.Dir, t.Sources, t.Outputs)
+		return ok, "", err
+	}
+	values := make([]string, len(t.Fingerprint))
+	for i, v := range t.Fingerprint {
+		var err error
+		values[i], err = ExpandEnvErr(v, st)
+		if err != nil {
+			return false, "", err
+		}
+	}
+	sum, err := Fingerprint(st.Dir, t.Sources, values...)
+	if err != nil {
+		return false, "", err
+	}
+	for _, pattern := range t.Outputs {
+		list, err := Glob(st.Dir, pattern)
+		if err != nil {
+			return false, "", err
+		}
+		if len(list) == 0 {
+			return false, sum, nil
+		}
+	}
+	return r.Fingerprints.Get(t.Name) == sum, sum, nil
+}
+
+// order returns the named task and its dependencies in the order to run them.
+func (r *Registry) order(name string) ([]*Task, error) {
+	var order []*Task
+	done := make(map[string]bool)
+	visiting := make(map[string]bool)
+	var visit func(name string, chain []string) error
+	visit = func(name string, chain []string) error {
+		if done[name] {
+			return nil
+		}
+		chain = append(chain, name)
+		if visiting[name] {
+			return fmt.Errorf("task dependency cycle: %q", chain)
+		}
+		t, ok := r.Lookup(name)
+		if !ok {
+			if len(chain) > 1 {
+				return fmt.Errorf("task %q depends on unknown task %q", chain[len(chain)-2], name)
+			}
+			return fmt.Errorf("unknown task %q", name)
+		}
+		visiting[name] = true
+		for _, dep := range t.Deps {
+			if err := visit(dep, chain); err != nil {
+				return err
+			}
+		}
+		visiting[name] = false
+		done[name] = true
+		order = append(order, t)
+		return nil
+	}
+	return order, visit(name, nil)
+}
+
+// Command returns a root command with a sub-command for each task and
+// a "list" sub-command that prints the tasks. Running the root command
+// with the "-l" flag also lists the tasks. Running a task first runs
+// its dependencies. Tasks that are up to date are skipped unless the
+// "-force" flag is given. The "-watch" flag keeps running and re-runs
+// tasks when their sources change. The "-dry-run" flag prints the commands
+// and file operations the tasks would run. The "-v" flag logs debug
+// messages and the "-seed" flag sets SeedVar. The "-quiet" flag only
+// shows the output of failed tasks and the "-artifacts" flag writes the
+// output of each task to files. The "-summary" flag logs a Summary at the
+// end and the "-strict" flag sets StrictVar. The "-trace" flag writes each
+// task, command, and file operation to stderr as it runs. Arguments after
+// the task name are passed to the task as "args".
+func (r *Registry) Command(name, usage string) *Command {
+	root := &Command{
+		Name:  name,
+		Usage: usage,
+		Flags: []*Flag{
+			{Name: "l", Usage: "list available tasks", Type: FlagBool},
+			{Name: ForceVar, Usage: "run tasks even if up to date", Type: FlagBool},
+			{Name: WatchVar, Usage: "re-run tasks when sources change", Type: FlagBool},
+			{Name: DryRunVar, Usage: "print commands and file operations without running them", Type: FlagBool},
+			{Name: VerboseVar, Usage: "log debug messages", Type: FlagBool},
+			{Name: SeedVar, Usage: "seed of random values, to repeat a run", Type: FlagInt64},
+			{Name: QuietVar, Usage: "only show output of failed tasks", Type: FlagBool},
+			{Name: ArtifactsVar, Usage: "write the output of each task to files in this directory", Type: FlagString},
+			{Name: SummaryVar, Usage: "log a summary at the end of the run", Type: FlagBool},
+			{Name: StrictVar, Usage: "fail on variables that are not set", Type: FlagBool},
+			{Name: TraceVar, Usage: "print each task, command, and file operation as it runs", Type: FlagBool},
+		},
+	}
+	root.Action = ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		if l, _ := st.Get("l").(bool); l {
+			return sc.RunAction(ctx, st, r.List())
+		}
+		return root.helpError("missing task")
+	})
+	hasList := false
+	for _, t := range r.Tasks() {
+		if t.Name == "list" {
+			hasList = true
+		}
+		root.Commands = append(root.Commands, &Command{
+			Name:   t.Name,
+			Usage:  t.Usage,
+			Flags:  t.Flags,
+			Action: r.Action(t.Name),
+		})
+	}
+	if !hasList {
+		root.Commands = append(root.Commands, &Command{
+			Name:   "list",
+			Usage:  "list available tasks",
+			Action: r.List(),
+		})
+	}
+	return root
+}
+
+// List returns an action that writes each task to stdout with its usage,
+// dependencies, and if it is up to date.
+func (r *Registry) List() Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		buf := &strings.Builder{}
+		w := tabwriter.NewWriter(buf, 0, 4, 2, ' ', 0)
+		for _, t := range r.Tasks() {
+			var notes []string
+			if len(t.Deps) > 0 {
+				notes = append(notes, "deps: "+strings.Join(t.Deps, ", "))
+			}
+			if t.UpToDate != nil || len(t.Outputs) > 0 {
+				ok, _, err := r.upToDate(ctx, st, t)
+				switch {
+				case err != nil:
+					notes = append(notes, "status: "+err.Error())
+				case ok:
+					notes = append(notes, "up to date")
+				}
+			}
+			note := ""
+			if len(notes) > 0 {
+				note = "(" + strings.Join(notes, "; ") + ")"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", t.Name, t.Usage, note)
+		}
+		err := w.Flush()
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.SplitAfter(buf.String(), "\n") {
+			if len(line) == 0 {
+				continue
+			}
+			fmt.Fprintln(st.Stdout, strings.TrimRight(line, " \n"))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,141 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := &Registry{}
+	r.Register("build", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		fmt.Fprintf(st.Stdout, "build %v\n", st.Get("args"))
+		return nil
+	})).Usage = "build the thing"
+	tt := r.Register("test", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		return nil
+	}))
+	tt.Deps = []string{"build"}
+	tt.UpToDate = func(ctx context.Context, st *State) (bool, error) {
+		return true, nil
+	}
+
+	run := func(args ...string) string {
+		stdout := &strings.Builder{}
+		st := &State{
+			Stdout: stdout,
+			Stderr: stdout,
+		}
+		err := Run(context.Background(), st, r.Command("reg", "").Exec(args))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stdout.String()
+	}
+
+	list := "" +
+		"build  build the thing\n" +
+		"test                    (deps: build; up to date)\n"
+	if g, w := run("list"), list; g != w {
+		t.Fatalf("list got %q, want %q", g, w)
+	}
+	if g, w := run("-l"), list; g != w {
+		t.Fatalf("-l got %q, want %q", g, w)
+	}
+	if g, w := run("build", "x", "y"), "build [x y]\n"; g != w {
+		t.Fatalf("build got %q, want %q", g, w)
+	}
+}
+
+func TestRegistryDeps(t *testing.T) {
+	r := &Registry{}
+	var ran []string
+	add := func(name string, deps ...string) {
+		r.Register(name, ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			ran = append(ran, name)
+			return nil
+		})).Deps = deps
+	}
+	add("generate")
+	add("build", "generate")
+	add("test", "generate", "build")
+	add("release", "test", "build")
+
+	err := Run(context.Background(), &State{}, r.Action("release"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := strings.Join(ran, ","), "generate,build,test,release"; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+
+	add("a", "b")
+	add("b", "a")
+	ran = nil
+	err = Run(context.Background(), &State{}, r.Action("a"))
+	if err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("expected cycle error, got %v", err)
+	}
+	if len(ran) != 0 {
+		t.Fatalf("tasks run despite cycle: %q", ran)
+	}
+}
+
+func TestRegistryInclude(t *testing.T) {
+	var ran []string
+	add := func(r *Registry, name string, deps ...string) {
+		r.Register(name, ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			ran = append(ran, name)
+			return nil
+		})).Deps = deps
+	}
+	backend := &Registry{}
+	add(backend, "generate")
+	add(backend, "build", "generate")
+
+	root := &Registry{}
+	root.Include("backend", backend)
+	add(root, "release", "backend:build")
+
+	if _, ok := root.Lookup("backend:generate"); !ok {
+		t.Fatal("missing backend:generate")
+	}
+	err := Run(context.Background(), &State{}, root.Command("root", "").Exec([]string{"release"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := strings.Join(ran, ","), "generate,build,release"; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+}
+
+func TestRegistryEnv(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, ".env"), []byte("# comment\nA=dotenv\nexport B=\"dot env\"\nC='${A}' # raw\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &Registry{}
+	var got string
+	rt := r.Register("env", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		got = strings.Join([]string{st.Env["A"], st.Env["B"], st.Env["C"], st.Env["D"]}, "|")
+		return nil
+	}))
+	rt.Dotenv = []string{".env", "missing.env"}
+	rt.Env = map[string]string{"A": "task", "D": "${B}!"}
+
+	st := &State{Dir: dir, Env: map[string]string{"A": "state"}}
+	err = Run(context.Background(), st, r.Action("env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := "task|dot env|${A}|dot env!"; got != w {
+		t.Fatalf("got %q, want %q", got, w)
+	}
+	if len(st.Env) != 1 || st.Env["A"] != "state" {
+		t.Fatalf("task env leaked into state: %v", st.Env)
+	}
+}
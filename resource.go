@@ -0,0 +1,52 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Track registers a resource to release when the innermost running Script
+// ends, whether it succeeds or fails, after its rollback actions run. The
+// resource may be an io.Closer, a func(), or a func() error. Resources are
+// released in the reverse order they are tracked, and release errors are
+// joined to the error of the script.
+//
+// Use Track in actions that open files, create temporary directories, or
+// take locks, so they are released even if no CloseFile or Defer action
+// is added for them.
+func (st *State) Track(resource any) {
+	var release func() error
+	switch r := resource.(type) {
+	default:
+		panic(fmt.Sprintf("resource must be one of: io.Closer, func(), func() error; got %T", r))
+	case io.Closer:
+		release = r.Close
+	case func():
+		release = func() error { r(); return nil }
+	case func() error:
+		release = r
+	}
+	st.resources = append(st.resources, release)
+}
+
+// release releases the resources tracked after the first n.
+func (st *State) release(n int) error {
+	var errs []error
+	for len(st.resources) > n {
+		last := len(st.resources) - 1
+		r := st.resources[last]
+		st.resources = st.resources[:last]
+		if err := r(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("release: %w", errors.Join(errs...))
+}
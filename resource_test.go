@@ -0,0 +1,66 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type closeFunc func() error
+
+func (f closeFunc) Close() error { return f() }
+
+func TestTrack(t *testing.T) {
+	var log []string
+	logf := func(s string) func() { return func() { log = append(log, s) } }
+	step := func(s string, err error) Action {
+		return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			log = append(log, s)
+			return err
+		})
+	}
+	track := func(r any) Action {
+		return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			st.Track(r)
+			return nil
+		})
+	}
+	fail := errors.New("fail")
+	closeErr := errors.New("close failed")
+
+	err := Run(context.Background(), &State{}, NewScript(
+		track(logf("release outer")),
+		NewScript(
+			Rollback(step("rollback inner", nil)),
+			track(logf("release a")),
+			track(closeFunc(func() error { log = append(log, "release b"); return closeErr })),
+			step("fail", fail),
+		),
+		step("not run", nil),
+	))
+	if !errors.Is(err, fail) || !errors.Is(err, closeErr) {
+		t.Fatalf("got error %v", err)
+	}
+	want := "fail,rollback inner,release b,release a,release outer"
+	if g := strings.Join(log, ","); g != want {
+		t.Fatalf("got %q, want %q", g, want)
+	}
+
+	dir := filepath.Join(t.TempDir(), "work")
+	err = Run(context.Background(), &State{}, ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		if err := os.Mkdir(dir, 0700); err != nil {
+			return err
+		}
+		st.Track(func() error { return os.RemoveAll(dir) })
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("expected %s removed, got %v", dir, err)
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+)
+
+// SecretProvider fetches secrets by name from a secret manager.
+type SecretProvider interface {
+	Secret(ctx context.Context, st *State, name string) (string, error)
+}
+
+// SecretProviderFunc is a function SecretProvider.
+type SecretProviderFunc func(ctx context.Context, st *State, name string) (string, error)
+
+// Secret calls f.
+func (f SecretProviderFunc) Secret(ctx context.Context, st *State, name string) (string, error) {
+	return f(ctx, st, name)
+}
+
+// ErrSecretNotFound is returned by a SecretProvider when the named secret
+// does not exist.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// redacted replaces secret values in output.
+const redacted = "****"
+
+// secrets are the secret provider, fetched secrets, and values to redact
+// of a run. They are shared by copies of the State.
+type secrets struct {
+	mu       sync.Mutex
+	provider SecretProvider
+	cache    map[string]string
+	values   []string
+}
+
+func (st *State) secretState() *secrets {
+	if st.secrets == nil {
+		st.secrets = &secrets{}
+	}
+	return st.secrets
+}
+
+// UseSecrets sets the provider Secret fetches from for the rest of the run.
+func UseSecrets(p SecretProvider) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		s := st.secretState()
+		s.mu.Lock()
+		s.provider = p
+		s.cache = nil
+		s.mu.Unlock()
+		return nil
+	})
+}
+
+// Secret fetches the named secret from the provider set by UseSecrets and
+// stores it in the State variable out. The secret is fetched once per run
+// and its value is redacted from logged messages, errors, and Exec output.
+func Secret(name string, out VAR) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		s := st.secretState()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		v, ok := s.cache[name]
+		if !ok {
+			if s.provider == nil {
+				return fmt.Errorf("secret %q: no secret provider, see UseSecrets", name)
+			}
+			var err error
+			v, err = s.provider.Secret(ctx, st, name)
+			if err != nil {
+				return fmt.Errorf("secret %q: %w", name, err)
+			}
+			if s.cache == nil {
+				s.cache = make(map[string]string)
+			}
+			s.cache[name] = v
+			s.mark(v)
+		}
+		st.Set(string(out), v)
+		return nil
+	})
+}
+
+func (s *secrets) mark(v string) {
+	if len(v) == 0 {
+		return
+	}
+	for _, x := range s.values {
+		if x == v {
+			return
+		}
+	}
+	s.values = append(s.values, v)
+}
+
+// MarkSecret marks the value to be redacted from logged messages, errors,
+// and Exec output for the rest of the run.
+func (st *State) MarkSecret(v string) {
+	s := st.secretState()
+	s.mu.Lock()
+	s.mark(v)
+	s.mu.Unlock()
+}
+
+// Redact returns text with every secret value replaced with "****".
+func (st *State) Redact(text string) string {
+	if st.secrets == nil {
+		return text
+	}
+	s := st.secrets
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range s.values {
+		text = strings.ReplaceAll(text, v, redacted)
+	}
+	return text
+}
+
+func (st *State) hasSecrets() bool {
+	if st.secrets == nil {
+		return false
+	}
+	st.secrets.mu.Lock()
+	defer st.secrets.mu.Unlock()
+	return len(st.secrets.values) > 0
+}
+
+// redactError is an error with secrets removed from its message.
+type redactError struct {
+	msg string
+	err error
+}
+
+func (err *redactError) Error() string { return err.msg }
+func (err *redactError) Unwrap() error { return err.err }
+
+func (st *State) redactError(err error) error {
+	if err == nil || !st.hasSecrets() {
+		return err
+	}
+	msg := err.Error()
+	if r := st.Redact(msg); r != msg {
+		return &redactError{msg: r, err: err}
+	}
+	return err
+}
+
+// redactWriter redacts secrets from each write. A secret split across
+// writes is not redacted.
+type redactWriter struct {
+	st *State
+	w  io.Writer
+}
+
+func (rw redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(rw.w, rw.st.Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// redactWriter returns w wrapped to redact secrets, if any are marked.
+func (st *State) redactWriter(w io.Writer) io.Writer {
+	if w == nil || !st.hasSecrets() {
+		return w
+	}
+	return redactWriter{st: st, w: w}
+}
+
+// DotenvSecrets returns a SecretProvider that reads secrets from a dotenv
+// file, relative to State.Dir, keyed by name. The file is read once.
+func DotenvSecrets(filename string) SecretProvider {
+	var (
+		once sync.Once
+		env  map[string]string
+		err  error
+	)
+	return SecretProviderFunc(func(ctx context.Context, st *State, name string) (string, error) {
+		once.Do(func() {
+			env, err = ReadDotenv(st.Filepath(filename))
+		})
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return "", fmt.Errorf("%w: %v", ErrSecretNotFound, err)
+			}
+			return "", err
+		}
+		v, ok := env[name]
+		if !ok {
+			return "", ErrSecretNotFound
+		}
+		return v, nil
+	})
+}
@@ -0,0 +1,106 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSecret(t *testing.T) {
+	calls := 0
+	p := SecretProviderFunc(func(ctx context.Context, st *State, name string) (string, error) {
+		calls++
+		if name == "db/password" {
+			return "hunter2", nil
+		}
+		return "", ErrSecretNotFound
+	})
+	var logs, errs []string
+	stdout := &strings.Builder{}
+	st := &State{
+		Env:         Environ(),
+		Stdout:      stdout,
+		MsgLogger:   func(msg string) { logs = append(logs, msg) },
+		ErrorLogger: func(err error) { errs = append(errs, err.Error()) },
+	}
+	ctx := context.Background()
+	sc := NewScript(
+		UseSecrets(p),
+		Secret("db/password", VAR("dbpass")),
+		Secret("db/password", VAR("again")),
+		ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			st.Logf("connecting with %s", st.Get("dbpass"))
+			return nil
+		}),
+	)
+	if runtime.GOOS != "windows" {
+		sc.Add(Exec("sh", "-c", "echo password=${dbpass}"))
+	}
+	if err := Run(ctx, st, sc); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Fatalf("got %d provider calls, want 1", calls)
+	}
+	if g := st.Get("again"); g != "hunter2" {
+		t.Fatalf("got %v", g)
+	}
+	if len(logs) != 1 || logs[0] != "connecting with ****" {
+		t.Fatalf("got logs %q", logs)
+	}
+	if runtime.GOOS != "windows" && stdout.String() != "password=****\n" {
+		t.Fatalf("got stdout %q", stdout.String())
+	}
+
+	err := Run(ctx, st, NewScript(
+		Secret("missing", VAR("x")),
+	))
+	if !errors.Is(err, ErrSecretNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	err = Run(ctx, st, ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		return errors.New("login hunter2 rejected")
+	}))
+	if err == nil || err.Error() != "login **** rejected" {
+		t.Fatalf("got error %v", err)
+	}
+	st.Policy = PolicyLog | PolicyContinue
+	err = Run(ctx, st, ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		return errors.New("token hunter2 expired")
+	}))
+	if err != nil || len(errs) != 1 || errs[0] != "token **** expired" {
+		t.Fatalf("got %v, logged %q", err, errs)
+	}
+
+	err = Run(ctx, &State{}, Secret("db/password", VAR("x")))
+	if err == nil || !strings.Contains(err.Error(), "no secret provider") {
+		t.Fatalf("expected missing provider error, got %v", err)
+	}
+}
+
+func TestDotenvSecrets(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "secrets.env"), []byte("API_KEY=abc123\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	st := &State{Dir: dir}
+	ctx := context.Background()
+	err := Run(ctx, st, NewScript(UseSecrets(DotenvSecrets("secrets.env")), Secret("API_KEY", VAR("key"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := st.Get("key"); g != "abc123" {
+		t.Fatalf("got %v", g)
+	}
+	if g := st.Redact("key=abc123"); g != "key=****" {
+		t.Fatalf("got %q", g)
+	}
+	err = Run(ctx, st, Secret("OTHER", VAR("x")))
+	if !errors.Is(err, ErrSecretNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
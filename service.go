@@ -0,0 +1,102 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// WithService runs the start action, such as an Exec of a server, in the
+// background, then the ready action, then the child action, such as
+// integration tests against the server. The service is stopped by
+// canceling the context of start when child returns, or when ready or
+// child fails, and WithService waits for start to return.
+//
+// The ready action should block until the service is ready, and is
+// canceled if the service exits first. The output of the service is
+// written to "NAME.service.log" in the directory set in ArtifactsVar, where
+// NAME is the name of start if it is Named, or "service". If ArtifactsVar
+// is not set, the last QuietSize bytes of output are written to stderr if
+// the service exits before it is ready or the child fails.
+func WithService(start, ready, child Action) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		name := "service"
+		if na, ok := start.(*namedAction); ok {
+			name = na.name
+		}
+		if DryRun(st) {
+			for _, a := range []Action{start, ready, child} {
+				if err := sc.RunAction(ctx, st, a); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		var log io.Writer
+		var kept *tailBuffer
+		if dir, _ := st.Get(ArtifactsVar).(string); len(dir) > 0 {
+			fn := filepath.Join(st.Filepath(dir), artifactName(name)+".service.log")
+			if err := ensureDir(fn); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			log = f
+		} else {
+			kept = &tailBuffer{size: QuietSize}
+			log = kept
+		}
+
+		sst := st.copy()
+		sst.Stdout, sst.Stderr = log, log
+		sctx, stop := context.WithCancel(ctx)
+		exited := make(chan struct{})
+		var serr error
+		go func() {
+			defer close(exited)
+			serr = Run(sctx, sst, start)
+		}()
+		defer func() {
+			stop()
+			<-exited
+		}()
+
+		rctx, cancelReady := context.WithCancel(ctx)
+		go func() {
+			select {
+			case <-exited:
+				cancelReady()
+			case <-rctx.Done():
+			}
+		}()
+		err := sc.RunAction(rctx, st, ready)
+		cancelReady()
+		select {
+		case <-exited:
+			err = fmt.Errorf("%s exited before it was ready", name)
+			if serr != nil {
+				err = fmt.Errorf("%w: %w", err, serr)
+			}
+		default:
+			if err == nil {
+				err = sc.RunAction(ctx, st, child)
+			}
+		}
+		if err != nil && kept != nil && st.Stderr != nil {
+			if b, _ := kept.take(); len(b) > 0 {
+				writeKept(st.Stderr, "output of "+name, b)
+			}
+		}
+		return err
+	})
+}
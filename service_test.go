@@ -0,0 +1,114 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithService(t *testing.T) {
+	dir := t.TempDir()
+	waitFile := ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		for {
+			if _, err := os.Stat(st.Filepath("ready")); err == nil {
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	})
+	var ran bool
+	child := ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		ran = true
+		return nil
+	})
+
+	st := &State{Dir: dir, Env: Environ()}
+	st.Set(ArtifactsVar, "out")
+	start := time.Now()
+	err := Run(context.Background(), st, WithService(
+		Named("api", Exec("sh", "-c", "echo listening; touch ready; exec sleep 30")),
+		waitFile,
+		child,
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ran {
+		t.Fatal("child not run")
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Fatalf("service not stopped, took %v", d)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "out", "api.service.log"))
+	if err != nil || string(b) != "listening\n" {
+		t.Fatalf("got log %q, %v", b, err)
+	}
+
+	ran = false
+	stderr := &strings.Builder{}
+	st = &State{Dir: t.TempDir(), Env: Environ(), Stderr: stderr}
+	err = Run(context.Background(), st, WithService(
+		Exec("sh", "-c", "echo bad config; exit 3"),
+		waitFile,
+		child,
+	))
+	if err == nil || !strings.Contains(err.Error(), "service exited before it was ready") || ran {
+		t.Fatalf("got %v, child ran %t", err, ran)
+	}
+	if g, w := stderr.String(), "--- output of service ---\nbad config\n---\n"; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+
+	fail := errors.New("tests failed")
+	st = &State{Dir: dir, Env: Environ()}
+	err = Run(context.Background(), st, WithService(
+		Exec("sh", "-c", "exec sleep 30"),
+		ActionFunc(func(ctx context.Context, st *State, sc Script) error { return nil }),
+		ActionFunc(func(ctx context.Context, st *State, sc Script) error { return fail }),
+	))
+	if !errors.Is(err, fail) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestWithServiceNamed(t *testing.T) {
+	noop := ActionFunc(func(ctx context.Context, st *State, sc Script) error { return nil })
+	started := make(chan bool)
+	// The service and the child both run Named actions once the service
+	// is ready, each on its own State.
+	service := ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		close(started)
+		for i := 0; i < 1000; i++ {
+			sc.RunAction(ctx, st, Named("tick", noop))
+		}
+		<-ctx.Done()
+		return nil
+	})
+	ready := ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		<-started
+		return nil
+	})
+	st := &State{}
+	growNames(t, st)
+	err := Run(context.Background(), st, Named("all", WithService(
+		Named("api", service),
+		ready,
+		Named("child", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			for i := 0; i < 1000; i++ {
+				sc.RunAction(ctx, st, Named("test", noop))
+			}
+			return nil
+		})),
+	)))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
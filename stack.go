@@ -0,0 +1,70 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StackError is returned by CaptureStacks when the action fails. Stack is
+// a dump of all goroutines taken when the action returned.
+type StackError struct {
+	Err   error
+	Stack []byte
+	File  string // File the stacks were written to, if any.
+}
+
+func (err *StackError) Error() string {
+	if len(err.File) == 0 {
+		return err.Err.Error()
+	}
+	return fmt.Sprintf("%v (goroutine stacks in %s)", err.Err, err.File)
+}
+
+func (err *StackError) Unwrap() error {
+	return err.Err
+}
+
+// CaptureStacks runs the action a and, if it fails, captures the stacks of
+// all goroutines, returning the error as a *StackError. If dir is not
+// empty the stacks are also written to a file in dir, relative to
+// State.Dir, such as an artifacts directory. This shows where other
+// goroutines were blocked, such as when a timeout fails the action.
+func CaptureStacks(dir any, a Action) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		err := sc.RunAction(ctx, st, a)
+		if err == nil {
+			return nil
+		}
+		serr := &StackError{Err: err, Stack: allStacks()}
+		var d string
+		if dir != nil {
+			var xerr error
+			d, xerr = ExpandEnvErr(dir, st)
+			if xerr != nil {
+				return errors.Join(serr, xerr)
+			}
+		}
+		if len(d) == 0 || DryRun(st) {
+			return serr
+		}
+		fn := filepath.Join(st.Filepath(d), "stacks-"+time.Now().UTC().Format("20060102T150405.000")+".txt")
+		werr := ensureDir(fn)
+		if werr == nil {
+			werr = os.WriteFile(fn, serr.Stack, 0600)
+		}
+		if werr != nil {
+			st.Error(fmt.Errorf("write goroutine stacks: %w", werr))
+			return serr
+		}
+		serr.File = fn
+		return serr
+	})
+}
@@ -0,0 +1,47 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCaptureStacks(t *testing.T) {
+	dir := t.TempDir()
+	fail := errors.New("fail")
+	block := make(chan struct{})
+	defer close(block)
+	go func() {
+		<-block
+	}()
+
+	err := Run(context.Background(), &State{Dir: dir}, CaptureStacks("artifacts", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		return fail
+	})))
+	var serr *StackError
+	if !errors.As(err, &serr) || !errors.Is(err, fail) {
+		t.Fatalf("expected *StackError, got %T %v", err, err)
+	}
+	if !strings.Contains(string(serr.Stack), "TestCaptureStacks.func1") {
+		t.Fatalf("missing blocked goroutine in stacks:\n%s", serr.Stack)
+	}
+	b, err := os.ReadFile(serr.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != string(serr.Stack) {
+		t.Fatal("stack file does not match")
+	}
+	if !strings.HasSuffix(serr.Error(), "(goroutine stacks in "+serr.File+")") {
+		t.Fatalf("got %q", serr.Error())
+	}
+
+	err = Run(context.Background(), &State{}, CaptureStacks(nil, ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		return nil
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
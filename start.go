@@ -2,8 +2,12 @@ package task
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"os/signal"
+	"runtime"
+	"runtime/debug"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -13,42 +17,181 @@ import (
 // context to check if it should shutdown.
 type StartFunc func(ctx context.Context) error
 
+// ErrShutdownTimeout is returned from Start when run does not return within
+// stopTimeout after the context is canceled. The returned error will be a
+// *ShutdownTimeoutError that matches ErrShutdownTimeout with errors.Is.
+var ErrShutdownTimeout = errors.New("shutdown timeout")
+
+// ShutdownTimeoutError is returned when run fails to return in time.
+// Stack contains a dump of all goroutines taken when the timeout expired,
+// which will usually show where run is stuck.
+type ShutdownTimeoutError struct {
+	Timeout time.Duration
+	Stack   []byte
+}
+
+func (err *ShutdownTimeoutError) Error() string {
+	return fmt.Sprintf("%v: run did not return within %v", ErrShutdownTimeout, err.Timeout)
+}
+
+// Is reports true for ErrShutdownTimeout.
+func (err *ShutdownTimeoutError) Is(target error) bool {
+	return target == ErrShutdownTimeout
+}
+
+// PanicError is returned from Start when run panics.
+// Stack contains the stack trace of the panicking goroutine.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (err *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n\n%s", err.Value, err.Stack)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (err *PanicError) Unwrap() error {
+	if v, ok := err.Value.(error); ok {
+		return v
+	}
+	return nil
+}
+
 // Start listens for an interrupt signal, and cancels the context if
 // interrupted. It starts run in a new goroutine. If it takes more then
 // stopTimeout before run returns after the ctx is canceled, then
-// it returns regardless.
+// it returns a *ShutdownTimeoutError regardless. A panic in run is
+// recovered and returned as a *PanicError.
 func Start(ctx context.Context, stopTimeout time.Duration, run StartFunc) error {
 	notify := make(chan os.Signal, 3)
 	signal.Notify(notify, os.Interrupt)
 	ctx, cancel := context.WithCancel(ctx)
 	once := &sync.Once{}
 	fin := make(chan bool)
-	unlock := func() {
-		close(fin)
-	}
+	var timeoutErr error
 	unlockOnce := func() {
-		once.Do(unlock)
+		once.Do(func() {
+			close(fin)
+		})
 	}
 	runErr := atomic.Value{}
 	go func() {
+		defer unlockOnce()
+		defer func() {
+			if r := recover(); r != nil {
+				runErr.Store(&PanicError{Value: r, Stack: debug.Stack()})
+			}
+		}()
 		err := run(ctx)
 		if err != nil {
 			runErr.Store(err)
 		}
-		unlockOnce()
 	}()
 	select {
 	case <-notify:
+	case <-ctx.Done():
 	case <-fin:
 	}
 	cancel()
 	go func() {
 		<-time.After(stopTimeout)
-		unlockOnce()
+		once.Do(func() {
+			timeoutErr = &ShutdownTimeoutError{
+				Timeout: stopTimeout,
+				Stack:   allStacks(),
+			}
+			close(fin)
+		})
 	}()
 	<-fin
+	if timeoutErr != nil {
+		return timeoutErr
+	}
 	if err, ok := runErr.Load().(error); ok {
 		return err
 	}
 	return nil
 }
+
+// allStacks returns the stack traces of all goroutines.
+func allStacks() []byte {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, len(buf)*2)
+	}
+}
+
+// Phase is a named step of a phased start-up, such as "init", "migrate",
+// or "serve". If Timeout is greater then zero the phase must complete
+// within that duration or the start-up fails.
+type Phase struct {
+	Name    string
+	Timeout time.Duration
+	Action  Action
+}
+
+// PhaseError is returned from StartPhases when a phase fails.
+type PhaseError struct {
+	Phase string
+	Err   error
+}
+
+func (err *PhaseError) Error() string {
+	return fmt.Sprintf("phase %q: %v", err.Phase, err.Err)
+}
+
+func (err *PhaseError) Unwrap() error {
+	return err.Err
+}
+
+// StartPhases runs each phase in order under Start, using st as the state.
+// The failing phase is reported with a *PhaseError. A phase that does not
+// return within its own Timeout is abandoned and reported as
+// context.DeadlineExceeded, so a hung phase can be told apart from
+// a hung later phase. The abandoned Action may still be running when
+// StartPhases returns, so it must not share unsynchronized data with
+// the caller.
+func StartPhases(ctx context.Context, stopTimeout time.Duration, st *State, phases ...Phase) error {
+	return Start(ctx, stopTimeout, func(ctx context.Context) error {
+		for _, ph := range phases {
+			err := ph.run(ctx, st)
+			if err != nil {
+				return &PhaseError{Phase: ph.Name, Err: err}
+			}
+		}
+		return nil
+	})
+}
+
+func (ph Phase) run(ctx context.Context, st *State) error {
+	if ph.Action == nil {
+		return nil
+	}
+	if ph.Timeout <= 0 {
+		return Run(ctx, st, ph.Action)
+	}
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, ph.Timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, st, ph.Action)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		if err := parent.Err(); err != nil {
+			// The parent context is done, Start handles the stop timeout.
+			<-done
+			return err
+		}
+		return fmt.Errorf("timeout after %v: %w", ph.Timeout, ctx.Err())
+	}
+}
@@ -2,7 +2,11 @@ package task_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"testing"
 	"time"
 
 	"github.com/kardianos/task"
@@ -20,3 +24,101 @@ func ExampleStart() {
 	// Output:
 	// Return errors at top level
 }
+
+func TestStartPhases(t *testing.T) {
+	// The timed out phase is abandoned while running, so guard ran.
+	var mu sync.Mutex
+	var ran []string
+	phase := func(name string, timeout time.Duration, wait time.Duration) task.Phase {
+		return task.Phase{
+			Name:    name,
+			Timeout: timeout,
+			Action: task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+				mu.Lock()
+				ran = append(ran, name)
+				mu.Unlock()
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				return nil
+			}),
+		}
+	}
+	st := &task.State{}
+	err := task.StartPhases(context.Background(), time.Second, st,
+		phase("init", time.Second, 0),
+		phase("migrate", time.Millisecond*10, time.Second*5),
+		phase("serve", 0, 0),
+	)
+	var pe *task.PhaseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected *PhaseError, got %v", err)
+	}
+	if pe.Phase != "migrate" {
+		t.Fatalf("expected migrate phase to fail, got %q", pe.Phase)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if g, w := strings.Join(ran, ","), "init,migrate"; g != w {
+		t.Fatalf("got phases %q, want %q", g, w)
+	}
+}
+
+func TestStartPhasesParentDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	err := task.StartPhases(ctx, time.Second, &task.State{}, task.Phase{
+		Name:    "serve",
+		Timeout: time.Hour,
+		Action: task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if strings.Contains(err.Error(), "timeout after") {
+		t.Fatalf("parent deadline reported as phase timeout: %v", err)
+	}
+}
+
+func TestStartShutdownTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	block := make(chan bool)
+	defer close(block)
+	err := task.Start(ctx, time.Millisecond*10, func(ctx context.Context) error {
+		cancel()
+		<-block
+		return nil
+	})
+	if !errors.Is(err, task.ErrShutdownTimeout) {
+		t.Fatalf("expected shutdown timeout, got %v", err)
+	}
+	var ste *task.ShutdownTimeoutError
+	if !errors.As(err, &ste) || len(ste.Stack) == 0 {
+		t.Fatal("expected goroutine dump")
+	}
+}
+
+func TestStartPanic(t *testing.T) {
+	err := task.Start(context.Background(), time.Second, func(ctx context.Context) error {
+		panic("bad thing")
+	})
+	var pe *task.PanicError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected *PanicError, got %v", err)
+	}
+	if pe.Value != "bad thing" {
+		t.Fatalf("unexpected panic value %v", pe.Value)
+	}
+	if !strings.Contains(string(pe.Stack), "TestStartPanic") {
+		t.Fatalf("stack missing test function:\n%s", pe.Stack)
+	}
+}
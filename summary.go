@@ -0,0 +1,87 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SummaryVar is the State variable that, when set to true, logs a Summary
+// at the end of running Registry tasks. Commands from a Registry set it
+// with the "-summary" flag.
+const SummaryVar = "summary"
+
+// Summary counts what happened in a run.
+type Summary struct {
+	Duration  time.Duration
+	Actions   int // Named actions run, including failed actions and not skipped tasks.
+	Skipped   int // Registry tasks skipped as up to date or restored from cache.
+	Failed    int // Actions that returned an error.
+	Rollbacks int // Times rollback actions were run.
+	Warnings  int // Warnings logged.
+}
+
+func plural(n int, s string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, s)
+	}
+	return fmt.Sprintf("%d %ss", n, s)
+}
+
+// String formats the summary as a single line, such as
+// "4 actions, 1 skipped, 1 failed, 1 rollback, 2 warnings in 1.5s".
+func (s *Summary) String() string {
+	return fmt.Sprintf("%s, %d skipped, %d failed, %s, %s in %v",
+		plural(s.Actions, "action"), s.Skipped, s.Failed,
+		plural(s.Rollbacks, "rollback"), plural(s.Warnings, "warning"),
+		s.Duration.Round(time.Millisecond))
+}
+
+// Summarize runs the action a and logs a Summary of the run when it
+// returns, as the last line of the output. If sum is not nil it is set to
+// the Summary.
+func Summarize(sum *Summary, a Action) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		if sum == nil {
+			sum = &Summary{}
+		}
+		*sum = Summary{}
+		var mu sync.Mutex
+		start := st.Now()
+		orig := st.eventFuncs
+		st.eventFuncs = append(orig[:len(orig):len(orig)], func(e Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			switch e.Type {
+			case EventFinish:
+				sum.Actions++
+			case EventSkip:
+				sum.Skipped++
+				sum.Actions--
+			case EventError:
+				sum.Failed++
+			case EventRollback:
+				sum.Rollbacks++
+			case EventWarn:
+				sum.Warnings++
+			}
+		})
+		err := sc.RunAction(ctx, st, a)
+		st.eventFuncs = orig
+
+		mu.Lock()
+		defer mu.Unlock()
+		sum.Duration = st.Since(start)
+		status := StatusOK
+		if err != nil || sum.Failed > 0 {
+			status = StatusFail
+		}
+		st.LogStatus(status, sum.String())
+		return err
+	})
+}
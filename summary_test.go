@@ -0,0 +1,50 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	r := &Registry{}
+	r.Register("gen", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		st.Warnf("deprecated flag")
+		return nil
+	}))
+	r.Register("build", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		sc.Rollback(ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			return nil
+		}))
+		return sc.RunAction(ctx, st, Named("compile", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			return errors.New("syntax error")
+		})))
+	})).Deps = []string{"gen"}
+
+	var log []string
+	st := &State{MsgLogger: func(msg string) { log = append(log, msg) }}
+	err := Run(context.Background(), st, r.Command("r", "").Exec([]string{"-summary", "build"}))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if len(log) == 0 {
+		t.Fatal("no summary logged")
+	}
+	last := log[len(log)-1]
+	want := "fail 3 actions, 0 skipped, 1 failed, 1 rollback, 1 warning in "
+	if !strings.HasPrefix(last, want) {
+		t.Fatalf("got %q, want prefix %q", last, want)
+	}
+
+	sum := &Summary{}
+	err = Run(context.Background(), &State{}, Summarize(sum, Named("ok", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		return nil
+	}))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Actions != 1 || sum.Failed != 0 || sum.Duration <= 0 {
+		t.Fatalf("got %+v", sum)
+	}
+}
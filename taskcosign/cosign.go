@@ -0,0 +1,142 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package taskcosign has actions that sign and verify container images and
+// blobs with Sigstore cosign.
+//
+// Without a key cosign signs keyless, with a short lived certificate from
+// the OIDC identity of the environment. A key may be a file, a KMS URI,
+// or "env://NAME"; the key password is read by cosign from COSIGN_PASSWORD
+// in the State env. Arguments may be of type task.VAR or string and are
+// expanded with task.ExpandEnv.
+package taskcosign
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"sort"
+
+	"github.com/kardianos/task"
+)
+
+// SignOptions configure SignImage and SignBlob.
+type SignOptions struct {
+	Key string // Private key reference, empty to sign keyless.
+
+	// Annotations are added to image signatures.
+	Annotations map[string]string
+
+	// TlogVar is the State variable to store the transparency log entry
+	// index in. It is not set if no entry was uploaded.
+	TlogVar string
+}
+
+// VerifyOptions configure VerifyImage and VerifyBlob. Set Key to verify
+// against a public key, or the certificate identity and issuer to verify
+// a keyless signature.
+type VerifyOptions struct {
+	Key string // Public key reference.
+
+	CertificateIdentity   string // Such as "release@example.com".
+	CertificateOIDCIssuer string // Such as "https://accounts.google.com".
+}
+
+// args returns the verify arguments. Exec expands them, so they are not
+// expanded here.
+func (opts VerifyOptions) args() []any {
+	if len(opts.Key) > 0 {
+		return []any{"--key", opts.Key}
+	}
+	return []any{
+		"--certificate-identity", opts.CertificateIdentity,
+		"--certificate-oidc-issuer", opts.CertificateOIDCIssuer,
+	}
+}
+
+var tlogRE = regexp.MustCompile(`tlog entry created with index: (\d+)`)
+
+// sign runs cosign and stores the transparency log index, reported on
+// stderr, in opts.TlogVar.
+func sign(ctx context.Context, st *task.State, sc task.Script, opts SignOptions, args []any) error {
+	orig := st.Stderr
+	buf := &bytes.Buffer{}
+	if orig != nil {
+		st.Stderr = io.MultiWriter(orig, buf)
+	} else {
+		st.Stderr = buf
+	}
+	err := sc.RunAction(ctx, st, task.Exec("cosign", args...))
+	st.Stderr = orig
+	if err != nil {
+		return err
+	}
+	if len(opts.TlogVar) == 0 {
+		return nil
+	}
+	if m := tlogRE.FindSubmatch(buf.Bytes()); m != nil {
+		st.Set(opts.TlogVar, string(m[1]))
+	}
+	return nil
+}
+
+func signArgs(opts SignOptions, args ...any) []any {
+	args = append(args, "--yes")
+	if len(opts.Key) > 0 {
+		args = append(args, "--key", opts.Key)
+	}
+	return args
+}
+
+// SignImage signs the image, preferably referenced by digest, and pushes
+// the signature to its registry.
+func SignImage(image any, opts SignOptions) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		args := signArgs(opts, "sign")
+		keys := make([]string, 0, len(opts.Annotations))
+		for k := range opts.Annotations {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			args = append(args, "-a", k+"="+opts.Annotations[k])
+		}
+		return sign(ctx, st, sc, opts, append(args, image))
+	})
+}
+
+// SignBlob signs the file, writing the signature to the file name with
+// ".sig" appended and the Sigstore bundle, which holds the certificate and
+// transparency log entry, with ".bundle" appended.
+func SignBlob(file any, opts SignOptions) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		fn, err := task.ExpandEnvErr(file, st)
+		if err != nil {
+			return err
+		}
+		args := signArgs(opts, "sign-blob", "--output-signature", task.Literal(fn+".sig"), "--bundle", task.Literal(fn+".bundle"))
+		return sign(ctx, st, sc, opts, append(args, task.Literal(fn)))
+	})
+}
+
+// VerifyImage verifies the signatures of the image.
+func VerifyImage(image any, opts VerifyOptions) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		args := append([]any{"verify"}, opts.args()...)
+		return sc.RunAction(ctx, st, task.Exec("cosign", append(args, image)...))
+	})
+}
+
+// VerifyBlob verifies the file against the bundle written by SignBlob.
+func VerifyBlob(file any, opts VerifyOptions) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		fn, err := task.ExpandEnvErr(file, st)
+		if err != nil {
+			return err
+		}
+		args := append([]any{"verify-blob", "--bundle", task.Literal(fn + ".bundle")}, opts.args()...)
+		return sc.RunAction(ctx, st, task.Exec("cosign", append(args, task.Literal(fn))...))
+	})
+}
@@ -0,0 +1,69 @@
+package taskcosign
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kardianos/task"
+	"github.com/kardianos/task/tasktest"
+)
+
+func TestSign(t *testing.T) {
+	fake := tasktest.FakeExec(t, `echo "tlog entry created with index: 4213" >&2`, "cosign")
+	st := &task.State{Env: map[string]string{"COSIGN_PASSWORD": "x"}}
+	st.Set("image", "example.com/app@sha256:abc")
+	err := task.Run(context.Background(), st, task.NewScript(
+		SignImage(task.VAR("image"), SignOptions{
+			Key:         "cosign.key",
+			Annotations: map[string]string{"version": "v1", "commit": "abc"},
+			TlogVar:     "tlog",
+		}),
+		SignBlob("dist/app.tar.gz", SignOptions{TlogVar: "blob_tlog"}),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := fake.Calls()
+	want := []string{
+		"cosign sign --yes --key cosign.key -a commit=abc -a version=v1 example.com/app@sha256:abc",
+		"cosign sign-blob --output-signature dist/app.tar.gz.sig --bundle dist/app.tar.gz.bundle --yes dist/app.tar.gz",
+	}
+	if strings.Join(args, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got args\n%s\nwant\n%s", strings.Join(args, "\n"), strings.Join(want, "\n"))
+	}
+	if g := st.Get("tlog"); g != "4213" {
+		t.Fatalf("got tlog %v", g)
+	}
+	if g := st.Get("blob_tlog"); g != "4213" {
+		t.Fatalf("got blob tlog %v", g)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	fake := tasktest.FakeExec(t, `case "$*" in *bad*) exit 1;; esac`, "cosign")
+	st := &task.State{ErrorLogger: func(err error) {}}
+	ctx := context.Background()
+	err := task.Run(ctx, st, task.NewScript(
+		VerifyImage("example.com/app:v1", VerifyOptions{Key: "cosign.pub"}),
+		VerifyBlob("app.tar.gz", VerifyOptions{
+			CertificateIdentity:   "release@example.com",
+			CertificateOIDCIssuer: "https://accounts.google.com",
+		}),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := fake.Calls()
+	want := []string{
+		"cosign verify --key cosign.pub example.com/app:v1",
+		"cosign verify-blob --bundle app.tar.gz.bundle --certificate-identity release@example.com --certificate-oidc-issuer https://accounts.google.com app.tar.gz",
+	}
+	if strings.Join(args, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got args\n%s\nwant\n%s", strings.Join(args, "\n"), strings.Join(want, "\n"))
+	}
+	err = task.Run(ctx, st, VerifyImage("example.com/bad:v1", VerifyOptions{Key: "cosign.pub"}))
+	if err == nil {
+		t.Fatal("expected verify error")
+	}
+}
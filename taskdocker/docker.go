@@ -0,0 +1,223 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package taskdocker has actions that run docker.
+//
+// Arguments may be of type task.VAR or string and are expanded with
+// task.ExpandEnv.
+package taskdocker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kardianos/task"
+)
+
+// Step is the progress of a single build step.
+type Step struct {
+	ID      int
+	Name    string // Such as "[2/3] RUN go build".
+	Done    bool
+	Cached  bool
+	Error   string
+	Elapsed time.Duration
+}
+
+// BuildOptions configure Build.
+type BuildOptions struct {
+	Dockerfile string   // Dockerfile path, defaults to "Dockerfile" in the context directory.
+	Platforms  []string // Target platforms, such as "linux/amd64".
+	Target     string   // Build stage to target.
+
+	// BuildArgs maps build argument names to values. Values are expanded,
+	// so "${version}" injects the State variable version.
+	BuildArgs map[string]string
+
+	// StateArgs names State variables or env to pass as build arguments
+	// of the same name.
+	StateArgs []string
+
+	// Progress is called as build steps start and end. If nil, the build
+	// output is written to State.Stderr.
+	Progress func(Step)
+
+	IDVar string // State variable to store the image ID in.
+}
+
+// Build runs "docker build" of the context directory, tagging the image.
+func Build(tag, contextDir any, opts BuildOptions) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		// Exec expands the arguments, so they are not expanded here.
+		args := []any{"build", "--progress=plain", "-t", tag}
+		if len(opts.Dockerfile) > 0 {
+			args = append(args, "-f", opts.Dockerfile)
+		}
+		if len(opts.Platforms) > 0 {
+			args = append(args, "--platform", strings.Join(opts.Platforms, ","))
+		}
+		if len(opts.Target) > 0 {
+			args = append(args, "--target", opts.Target)
+		}
+		buildArgs := make(map[string]string, len(opts.BuildArgs)+len(opts.StateArgs))
+		for _, name := range opts.StateArgs {
+			buildArgs[name] = "${" + name + "}"
+		}
+		for k, v := range opts.BuildArgs {
+			buildArgs[k] = v
+		}
+		keys := make([]string, 0, len(buildArgs))
+		for k := range buildArgs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			args = append(args, "--build-arg", k+"="+buildArgs[k])
+		}
+		var idFile string
+		if len(opts.IDVar) > 0 && !task.DryRun(st) {
+			f, err := os.CreateTemp("", "iid")
+			if err != nil {
+				return err
+			}
+			idFile = f.Name()
+			f.Close()
+			defer os.Remove(idFile)
+			args = append(args, "--iidfile", task.Literal(idFile))
+		}
+		args = append(args, contextDir)
+
+		orig := st.Stderr
+		var pw *progressWriter
+		if opts.Progress != nil {
+			pw = &progressWriter{report: opts.Progress, steps: make(map[int]*Step)}
+			st.Stderr = pw
+		}
+		err := sc.RunAction(ctx, st, task.Exec("docker", args...))
+		st.Stderr = orig
+		if pw != nil {
+			pw.Flush()
+		}
+		if err != nil {
+			return err
+		}
+		if len(idFile) > 0 {
+			b, err := os.ReadFile(idFile)
+			if err != nil {
+				return err
+			}
+			st.Set(opts.IDVar, strings.TrimSpace(string(b)))
+		}
+		return nil
+	})
+}
+
+var digestRE = regexp.MustCompile(`digest: (sha256:[0-9a-f]{64})`)
+
+// Push runs "docker push" of the tag. If digestVar is not empty, the pushed
+// image digest is stored in it.
+func Push(tag any, digestVar string) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		orig := st.Stdout
+		buf := &bytes.Buffer{}
+		if orig != nil {
+			st.Stdout = io.MultiWriter(orig, buf)
+		} else {
+			st.Stdout = buf
+		}
+		err := sc.RunAction(ctx, st, task.Exec("docker", "push", tag))
+		st.Stdout = orig
+		if err != nil {
+			return err
+		}
+		if len(digestVar) == 0 || task.DryRun(st) {
+			return nil
+		}
+		m := digestRE.FindSubmatch(buf.Bytes())
+		if m == nil {
+			t, err := task.ExpandEnvErr(tag, st)
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("push %s: digest not found in output", t)
+		}
+		st.Set(digestVar, string(m[1]))
+		return nil
+	})
+}
+
+// progressWriter parses the plain BuildKit progress output:
+//
+//	#5 [2/3] RUN go build
+//	#5 0.512 compiling
+//	#5 DONE 1.2s
+//	#6 CACHED
+//	#7 ERROR: process "go build" did not complete successfully
+type progressWriter struct {
+	report func(Step)
+	steps  map[int]*Step
+	buf    []byte
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	pw.buf = append(pw.buf, p...)
+	for {
+		i := bytes.IndexByte(pw.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		pw.line(string(pw.buf[:i]))
+		pw.buf = pw.buf[i+1:]
+	}
+}
+
+// Flush parses any final partial line.
+func (pw *progressWriter) Flush() {
+	if len(pw.buf) > 0 {
+		pw.line(string(pw.buf))
+		pw.buf = nil
+	}
+}
+
+func (pw *progressWriter) line(line string) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "#") {
+		return
+	}
+	idText, rest, _ := strings.Cut(line[1:], " ")
+	id, err := strconv.Atoi(idText)
+	if err != nil {
+		return
+	}
+	s := pw.steps[id]
+	if s == nil {
+		s = &Step{ID: id}
+		pw.steps[id] = s
+	}
+	switch {
+	case strings.HasPrefix(rest, "DONE"):
+		s.Done = true
+		s.Elapsed, _ = time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(rest, "DONE")))
+	case rest == "CACHED":
+		s.Done = true
+		s.Cached = true
+	case strings.HasPrefix(rest, "ERROR"):
+		s.Done = true
+		s.Error = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(rest, "ERROR"), ":"))
+	case len(s.Name) == 0:
+		s.Name = rest
+	default:
+		// Step output.
+		return
+	}
+	pw.report(*s)
+}
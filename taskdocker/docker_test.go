@@ -0,0 +1,94 @@
+package taskdocker
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kardianos/task"
+	"github.com/kardianos/task/tasktest"
+)
+
+func TestBuild(t *testing.T) {
+	fake := tasktest.FakeExec(t, `
+while [ $# -gt 0 ]; do
+	if [ "$1" = "--iidfile" ]; then echo sha256:abc > "$2"; fi
+	shift
+done
+echo "#1 [internal] load build definition" >&2
+echo "#1 DONE 0.1s" >&2
+echo "#2 [1/2] FROM golang" >&2
+echo "#2 CACHED" >&2
+echo "#3 [2/2] RUN go build" >&2
+echo "#3 0.5 compiling" >&2
+echo "#3 DONE 1.5s" >&2
+`, "docker")
+	st := &task.State{Env: map[string]string{"GOPROXY": "direct"}}
+	st.Set("version", "v1.0.0")
+	var steps []Step
+	err := task.Run(context.Background(), st, Build("app:${version}", ".", BuildOptions{
+		Platforms: []string{"linux/amd64", "linux/arm64"},
+		BuildArgs: map[string]string{"VERSION": "${version}"},
+		StateArgs: []string{"GOPROXY"},
+		Progress: func(s Step) {
+			steps = append(steps, s)
+		},
+		IDVar: "image",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := fake.Calls()[0]
+	want := "docker build --progress=plain -t app:v1.0.0 --platform linux/amd64,linux/arm64 --build-arg GOPROXY=direct --build-arg VERSION=v1.0.0 --iidfile "
+	if !strings.HasPrefix(args, want) || !strings.HasSuffix(args, " .") {
+		t.Fatalf("got args %q", args)
+	}
+	if g := st.Get("image"); g != "sha256:abc" {
+		t.Fatalf("got image %v", g)
+	}
+	if len(steps) != 6 {
+		t.Fatalf("got %d progress reports, want 6: %+v", len(steps), steps)
+	}
+	if last := steps[5]; !last.Done || last.Name != "[2/2] RUN go build" || last.Elapsed.Seconds() != 1.5 {
+		t.Fatalf("unexpected last step %+v", last)
+	}
+	if !steps[3].Cached {
+		t.Fatalf("expected cached step %+v", steps[3])
+	}
+}
+
+func TestPush(t *testing.T) {
+	tasktest.FakeExec(t, `echo "v1: digest: sha256:`+strings.Repeat("ab", 32)+` size: 1234"`, "docker")
+	st := &task.State{Stdout: &strings.Builder{}}
+	err := task.Run(context.Background(), st, Push("app:v1", "digest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := st.Get("digest"), "sha256:"+strings.Repeat("ab", 32); g != w {
+		t.Fatalf("got digest %v, want %s", g, w)
+	}
+}
+
+func TestBuildExpandOnce(t *testing.T) {
+	fake := tasktest.FakeExec(t, "", "docker")
+	st := &task.State{Env: map[string]string{"b": "ZZ", "TOKEN": "t$b"}}
+	st.Set("pw", "a$b")
+	st.Set("tag", "app:$b")
+	err := task.Run(context.Background(), st, task.NewScript(
+		Build("${tag}", "ctx$b", BuildOptions{
+			BuildArgs: map[string]string{"PW": "${pw}"},
+			StateArgs: []string{"TOKEN"},
+		}),
+		Push("${tag}", ""),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"docker build --progress=plain -t app:$b --build-arg PW=a$b --build-arg TOKEN=t$b ctxZZ",
+		"docker push app:$b",
+	}
+	if got := fake.Calls(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package taskdocker
+
+import (
+	"context"
+	"path"
+
+	"github.com/kardianos/task"
+)
+
+// RunOptions configure Run.
+type RunOptions struct {
+	// Workdir is the container directory State.Dir is mounted on and the
+	// command is run in, defaults to "/work".
+	Workdir string
+
+	// Env names State env variables to set in the container. Values are
+	// passed through the docker process env, not the command line.
+	Env []string
+
+	User     string   // User to run as, such as "1000:1000".
+	Mounts   []string // Extra volume mounts, "host:container[:options]".
+	Network  string   // Network mode, such as "none".
+	Platform string   // Image platform, such as "linux/amd64".
+	Args     []string // Extra arguments to "docker run".
+}
+
+// Run executes the command in a new container of image with State.Dir
+// mounted as the working directory. The container is removed afterwards
+// and its output is streamed to the State outputs. Pin the image by digest
+// for a hermetic toolchain, such as "golang@sha256:...".
+func Run(image any, opts RunOptions, executable any, args ...any) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		workdir, err := task.ExpandEnvErr(opts.Workdir, st)
+		if err != nil {
+			return err
+		}
+		if len(workdir) == 0 {
+			workdir = "/work"
+		}
+		workdir = path.Clean(workdir)
+		// Exec expands the arguments, so they are not expanded here.
+		dargs := []any{"run", "--rm", "-v", task.Literal(st.Dir + ":" + workdir), "-w", task.Literal(workdir)}
+		for _, name := range opts.Env {
+			dargs = append(dargs, "-e", name)
+		}
+		if len(opts.User) > 0 {
+			dargs = append(dargs, "--user", opts.User)
+		}
+		for _, m := range opts.Mounts {
+			dargs = append(dargs, "-v", m)
+		}
+		if len(opts.Network) > 0 {
+			dargs = append(dargs, "--network", opts.Network)
+		}
+		if len(opts.Platform) > 0 {
+			dargs = append(dargs, "--platform", opts.Platform)
+		}
+		for _, a := range opts.Args {
+			dargs = append(dargs, a)
+		}
+		dargs = append(dargs, image, executable)
+		dargs = append(dargs, args...)
+
+		// Only pass the named env to docker, keeping PATH to find docker.
+		orig := st.Env
+		env := make(map[string]string, len(opts.Env)+8)
+		for _, name := range dockerEnv {
+			if v, ok := orig[name]; ok {
+				env[name] = v
+			}
+		}
+		for _, name := range opts.Env {
+			env[name] = orig[name]
+		}
+		st.Env = env
+		err = sc.RunAction(ctx, st, task.Exec("docker", dargs...))
+		st.Env = orig
+		return err
+	})
+}
+
+// dockerEnv are the env variables the docker client itself uses.
+var dockerEnv = []string{
+	"PATH", "HOME", "USERPROFILE", "SYSTEMROOT", "TMPDIR",
+	"DOCKER_HOST", "DOCKER_CONFIG", "DOCKER_CONTEXT", "DOCKER_CERT_PATH", "DOCKER_TLS_VERIFY",
+}
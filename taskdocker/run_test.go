@@ -0,0 +1,57 @@
+package taskdocker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kardianos/task"
+	"github.com/kardianos/task/tasktest"
+)
+
+func TestRun(t *testing.T) {
+	fake := tasktest.FakeExec(t, `echo "token=$TOKEN secret=$SECRET"`, "docker")
+	src := t.TempDir()
+	stdout := &strings.Builder{}
+	st := &task.State{
+		Dir:    src,
+		Env:    map[string]string{"TOKEN": "abc", "SECRET": "hidden"},
+		Stdout: stdout,
+	}
+	st.Set("pkg", "./cmd/app")
+	err := task.Run(context.Background(), st, Run("golang:1.21", RunOptions{
+		Env:     []string{"TOKEN"},
+		Network: "none",
+	}, "go", "build", "${pkg}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := fake.Calls()[0], "docker run --rm -v "+src+":/work -w /work -e TOKEN --network none golang:1.21 go build ./cmd/app"; g != w {
+		t.Fatalf("got args %q, want %q", g, w)
+	}
+	if g, w := stdout.String(), "token=abc secret=\n"; g != w {
+		t.Fatalf("got output %q, want %q", g, w)
+	}
+	if len(st.Env) != 2 {
+		t.Fatalf("state env changed: %v", st.Env)
+	}
+}
+
+func TestRunExpandOnce(t *testing.T) {
+	fake := tasktest.FakeExec(t, "", "docker")
+	src := filepath.Join(t.TempDir(), "src$b")
+	if err := os.Mkdir(src, 0700); err != nil {
+		t.Fatal(err)
+	}
+	st := &task.State{Dir: src, Env: map[string]string{"b": "ZZ"}}
+	st.Set("user", "u$b")
+	err := task.Run(context.Background(), st, Run("golang", RunOptions{User: "${user}"}, "go", "build"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := fake.Calls()[0], "docker run --rm -v "+src+":/work -w /work --user u$b golang go build"; g != w {
+		t.Fatalf("got args %q, want %q", g, w)
+	}
+}
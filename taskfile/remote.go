@@ -0,0 +1,203 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package taskfile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// CacheDir is the directory remote task files are cached in. If empty,
+// a "kardianos-task" directory in os.UserCacheDir is used.
+var CacheDir string
+
+// HTTPClient is used to fetch task files included by URL.
+var HTTPClient = http.DefaultClient
+
+// defaultTaskfile is the task file name used in a Git include without
+// a taskfile.
+const defaultTaskfile = "taskfile.yaml"
+
+func cacheDir(sub string) (string, error) {
+	dir := CacheDir
+	if len(dir) == 0 {
+		ucd, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(ucd, "kardianos-task")
+	}
+	return filepath.Join(dir, sub), nil
+}
+
+// hashKey returns a hex sha256 of the values.
+func hashKey(values ...string) string {
+	h := sha256.New()
+	for _, v := range values {
+		io.WriteString(h, v)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// checksum returns the pinned sha256 hex, with any "sha256:" prefix removed.
+func (inc *Include) checksum() string {
+	return strings.ToLower(strings.TrimPrefix(inc.Checksum, "sha256:"))
+}
+
+// verify the content against the pinned checksum, if any.
+func (inc *Include) verify(b []byte) error {
+	want := inc.checksum()
+	if len(want) == 0 {
+		return nil
+	}
+	sum := sha256.Sum256(b)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return fmt.Errorf("checksum mismatch: got sha256:%s, want sha256:%s", got, want)
+	}
+	return nil
+}
+
+// filename returns the local file name of the included task file,
+// fetching and caching remote task files as needed.
+func (inc *Include) filename(dir string) (string, error) {
+	switch {
+	default:
+		return "", errors.New("missing taskfile, url, or git")
+	case len(inc.URL) > 0:
+		return inc.fetchURL()
+	case len(inc.Git) > 0:
+		return inc.fetchGit()
+	case len(inc.Taskfile) > 0:
+		return filepath.Join(dir, inc.Taskfile), nil
+	}
+}
+
+// fetchURL downloads the task file over HTTPS. When a checksum is pinned
+// the file is cached by checksum and only downloaded once, otherwise it is
+// downloaded each time it is loaded.
+func (inc *Include) fetchURL() (string, error) {
+	if !strings.HasPrefix(inc.URL, "https://") {
+		return "", fmt.Errorf("url %q must use https", inc.URL)
+	}
+	key := hashKey(inc.URL)
+	if sum := inc.checksum(); len(sum) > 0 {
+		key = sum
+	}
+	dir, err := cacheDir("url")
+	if err != nil {
+		return "", err
+	}
+	fn := filepath.Join(dir, key+".yaml")
+	if len(inc.checksum()) > 0 {
+		b, err := os.ReadFile(fn)
+		if err == nil && inc.verify(b) == nil {
+			return fn, nil
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+	}
+
+	resp, err := HTTPClient.Get(inc.URL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("get %s: %s", inc.URL, resp.Status)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if err := inc.verify(b); err != nil {
+		return "", fmt.Errorf("%s: %w", inc.URL, err)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	tmp := fn + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return "", err
+	}
+	return fn, os.Rename(tmp, fn)
+}
+
+// fetchGit checks out the Git ref into the cache, once per repository and
+// ref, and returns the task file in it. Pin the ref to a tag or commit to
+// avoid a stale cached branch.
+func (inc *Include) fetchGit() (string, error) {
+	ref := inc.Ref
+	if len(ref) == 0 {
+		ref = "HEAD"
+	}
+	name := inc.Taskfile
+	if len(name) == 0 {
+		name = defaultTaskfile
+	}
+	// Git would parse a leading dash as an option, such as --upload-pack.
+	if strings.HasPrefix(inc.Git, "-") || strings.HasPrefix(ref, "-") {
+		return "", fmt.Errorf("invalid git include %q ref %q: must not start with \"-\"", inc.Git, ref)
+	}
+	dir, err := cacheDir("git")
+	if err != nil {
+		return "", err
+	}
+	repoDir := filepath.Join(dir, hashKey(inc.Git, ref))
+	if _, err := os.Stat(repoDir); errors.Is(err, fs.ErrNotExist) {
+		tmp := repoDir + ".tmp"
+		os.RemoveAll(tmp)
+		err = gitCheckout(tmp, inc.Git, ref)
+		if err != nil {
+			os.RemoveAll(tmp)
+			return "", err
+		}
+		if err := os.Rename(tmp, repoDir); err != nil {
+			return "", err
+		}
+	} else if err != nil {
+		return "", err
+	}
+	fn := filepath.Join(repoDir, filepath.FromSlash(name))
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		return "", err
+	}
+	if err := inc.verify(b); err != nil {
+		return "", fmt.Errorf("%s@%s %s: %w", inc.Git, ref, name, err)
+	}
+	return fn, nil
+}
+
+func gitCheckout(dir, repo, ref string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"fetch", "-q", "--depth", "1", "--", repo, ref},
+		{"checkout", "-q", "FETCH_HEAD"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		stderr := &bytes.Buffer{}
+		cmd.Stderr = stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("git %s: %v\n%s", strings.Join(args, " "), err, stderr.Bytes())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,360 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package taskfile loads task definitions from a YAML file.
+//
+// A task file lists named tasks with the commands to run:
+//
+//	env:
+//	  CGO_ENABLED: "0"
+//	dotenv: [.env]
+//	tasks:
+//	  generate:
+//	    cmds:
+//	      - go generate ./...
+//	  build:
+//	    desc: Build the server.
+//	    deps: [generate]
+//	    env:
+//	      GOOS: linux
+//	    cmds:
+//	      - go build -o bin/server ./cmd/server
+//	    sources: ["**/*.go"]
+//	    outputs: [bin/server]
+//	  notify:
+//	    when: os == "linux" && env.CI == "true"
+//	    cmds:
+//	      - ./notify.sh
+//	  cross:
+//	    matrix:
+//	      goos: [linux, windows]
+//	      goarch: [amd64, arm64]
+//	    env:
+//	      GOOS: ${goos}
+//	      GOARCH: ${goarch}
+//	    cmds:
+//	      - go build -o bin/${goos}_${goarch}/ ./cmd/server
+//
+// Env is set from the dotenv files first, then from the env maps, with task
+// values overriding file values. Dotenv files are relative to the task file
+// and missing files are ignored.
+//
+// Each command is split into arguments like a shell would, but is not run
+// in a shell. Arguments are expanded with task.ExpandEnv.
+package taskfile
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kardianos/task"
+	"gopkg.in/yaml.v3"
+)
+
+// File is a parsed task file.
+type File struct {
+	Env      map[string]string   `yaml:"env"`
+	Dotenv   []string            `yaml:"dotenv"` // Dotenv files read before Env.
+	Includes map[string]*Include `yaml:"includes"`
+	Tasks    map[string]*Task    `yaml:"tasks"`
+
+	dir      string           // Absolute directory of the file if loaded from disk.
+	parent   *File            // Including file.
+	included map[string]*File // Loaded includes by namespace.
+}
+
+// Include is another task file whose tasks are added under a namespace,
+// such that task "build" in the "backend" include is named "backend:build".
+// It may be written as just the task file name.
+//
+// Shared task files may be included from an HTTPS URL or a Git repository.
+// Remote task files are cached in CacheDir and their tasks run in the
+// directory of the including file. If Checksum is set, the content of the
+// task file must match it.
+//
+//	includes:
+//	  backend: backend/taskfile.yaml
+//	  web:
+//	    taskfile: web/taskfile.yaml
+//	    dir: web/src
+//	  std:
+//	    url: https://example.com/tasks/go.yaml
+//	    checksum: sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+//	  release:
+//	    git: https://github.com/example/tasks.git
+//	    ref: v1.2.0
+//	    taskfile: release.yaml
+type Include struct {
+	Taskfile string `yaml:"taskfile"` // Task file name, relative to the including file or Git repository.
+	Dir      string `yaml:"dir"`      // Directory to run tasks in, defaults to the directory of Taskfile.
+	URL      string `yaml:"url"`      // HTTPS URL of the task file.
+	Git      string `yaml:"git"`      // Git repository of the task file.
+	Ref      string `yaml:"ref"`      // Git ref to check out, defaults to HEAD.
+	Checksum string `yaml:"checksum"` // Optional sha256 of the task file, "sha256:" followed by hex.
+}
+
+// UnmarshalYAML allows an include to be a single file name.
+func (inc *Include) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		inc.Taskfile = node.Value
+		return nil
+	}
+	type plain Include
+	return node.Decode((*plain)(inc))
+}
+
+// Task is a single named task in a task file.
+type Task struct {
+	Desc    string            `yaml:"desc"`
+	When    string            `yaml:"when"`    // Condition to run the commands, see task.Expr.
+	Deps    []string          `yaml:"deps"`    // Tasks to run before this task.
+	Env     map[string]string `yaml:"env"`     // Env set while the task runs.
+	Dotenv  []string          `yaml:"dotenv"`  // Dotenv files read before Env.
+	Cmds    []string          `yaml:"cmds"`    // Commands to execute in order.
+	Sources []string          `yaml:"sources"` // Globs of files the task reads.
+	Outputs []string          `yaml:"outputs"` // Files the task produces.
+
+	// Matrix runs the task once for each combination of values, with
+	// each variable available to env and cmds as "${name}".
+	Matrix   map[string][]string `yaml:"matrix"`
+	Parallel bool                `yaml:"parallel"` // Run matrix combinations concurrently.
+}
+
+// Load reads and parses the task file at filename along with any
+// included task files.
+func Load(filename string) (*File, error) {
+	return load(filename, nil, nil)
+}
+
+func load(filename string, parent *File, seen []string) (*File, error) {
+	filename, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range seen {
+		if s == filename {
+			return nil, fmt.Errorf("include cycle: %q", append(seen, filename))
+		}
+	}
+	seen = append(seen, filename)
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	f, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	f.dir = filepath.Dir(filename)
+	f.parent = parent
+	for _, ns := range sortedKeys(f.Includes) {
+		inc := f.Includes[ns]
+		fn, err := inc.filename(f.dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: include %q: %w", filename, ns, err)
+		}
+		sub, err := load(fn, f, seen)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case len(inc.Dir) > 0:
+			sub.dir = filepath.Join(f.dir, inc.Dir)
+		case len(inc.URL) > 0 || len(inc.Git) > 0:
+			sub.dir = f.dir
+		}
+		if f.included == nil {
+			f.included = make(map[string]*File)
+		}
+		f.included[ns] = sub
+	}
+	for _, name := range f.Names() {
+		for _, dep := range f.Tasks[name].Deps {
+			if !f.hasTask(dep) {
+				return nil, fmt.Errorf("%s: task %q depends on unknown task %q", filename, name, dep)
+			}
+		}
+	}
+	return f, nil
+}
+
+// hasTask reports if the task name, which may be in an included
+// namespace such as "backend:build", exists.
+func (f *File) hasTask(name string) bool {
+	if _, ok := f.Tasks[name]; ok {
+		return true
+	}
+	ns, rest, ok := strings.Cut(name, ":")
+	if !ok {
+		return false
+	}
+	sub := f.included[ns]
+	return sub != nil && sub.hasTask(rest)
+}
+
+// Parse the task file content.
+func Parse(b []byte) (*File, error) {
+	f := &File{}
+	err := yaml.Unmarshal(b, f)
+	if err != nil {
+		return nil, err
+	}
+	for name, t := range f.Tasks {
+		if t == nil {
+			return nil, fmt.Errorf("task %q is empty", name)
+		}
+		for _, dep := range t.Deps {
+			if ns, _, ok := strings.Cut(dep, ":"); ok && f.Includes[ns] != nil {
+				// Checked by Load once the included task files are loaded.
+				continue
+			}
+			if _, ok := f.Tasks[dep]; !ok {
+				return nil, fmt.Errorf("task %q depends on unknown task %q", name, dep)
+			}
+		}
+		for _, c := range t.Cmds {
+			if _, err := splitArgs(c); err != nil {
+				return nil, fmt.Errorf("task %q: %w", name, err)
+			}
+		}
+		if len(t.When) > 0 {
+			if _, err := task.ParseExpr(t.When); err != nil {
+				return nil, fmt.Errorf("task %q: %w", name, err)
+			}
+		}
+	}
+	return f, nil
+}
+
+// Names returns the sorted task names.
+func (f *File) Names() []string {
+	names := make([]string, 0, len(f.Tasks))
+	for name := range f.Tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Registry returns a task.Registry containing each task in the file.
+// Task dependencies are run before the task, each at most once.
+// Tasks from included files are added under their namespace and run
+// in the directory of the included file. A task that declares outputs
+// is skipped when its outputs are newer then its sources.
+func (f *File) Registry() *task.Registry {
+	r := &task.Registry{}
+	for _, n := range f.Names() {
+		t := f.Tasks[n]
+		rt := r.Register(n, f.taskAction(n))
+		rt.Usage = t.Desc
+		rt.Deps = t.Deps
+		rt.Sources = t.Sources
+		rt.Outputs = t.Outputs
+		rt.Matrix = t.Matrix
+		rt.Parallel = t.Parallel
+		rt.Env = make(map[string]string)
+		for _, env := range append(f.envChain(), t.Env) {
+			for _, k := range sortedKeys(env) {
+				rt.Env[k] = env[k]
+			}
+		}
+		for _, k := range sortedKeys(rt.Env) {
+			rt.Fingerprint = append(rt.Fingerprint, k+"="+rt.Env[k])
+		}
+		rt.Dotenv = append(f.dotenvChain(), f.path(t.Dotenv)...)
+		rt.Fingerprint = append(rt.Fingerprint, t.Cmds...)
+		if f.parent != nil {
+			rt.Dir = f.dir
+		}
+	}
+	for _, ns := range sortedKeys(f.included) {
+		r.Include(ns, f.included[ns].Registry())
+	}
+	return r
+}
+
+// Command returns a root command with a sub-command for each task.
+func (f *File) Command(name, usage string) *task.Command {
+	return f.Registry().Command(name, usage)
+}
+
+// Action returns an action that runs the named task after its dependencies.
+func (f *File) Action(name string) task.Action {
+	return f.Registry().Action(name)
+}
+
+func (f *File) taskAction(name string) task.Action {
+	t := f.Tasks[name]
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		run := task.NewScript()
+		if len(t.When) > 0 {
+			ok, err := task.MustParseExpr(t.When).Bool(st)
+			if err != nil {
+				return fmt.Errorf("task %q: %w", name, err)
+			}
+			if !ok {
+				return nil
+			}
+		}
+		for _, c := range t.Cmds {
+			args, err := splitArgs(c)
+			if err != nil {
+				return err
+			}
+			if len(args) == 0 {
+				continue
+			}
+			exe := args[0]
+			rest := make([]any, len(args)-1)
+			for i, a := range args[1:] {
+				rest[i] = a
+			}
+			run.Add(task.Exec(exe, rest...))
+		}
+		return sc.RunAction(ctx, st, run)
+	})
+}
+
+// envChain returns the file env of each including file, outermost first.
+func (f *File) envChain() []map[string]string {
+	if f.parent == nil {
+		return []map[string]string{f.Env}
+	}
+	return append(f.parent.envChain(), f.Env)
+}
+
+// dotenvChain returns the file dotenv files of each including file,
+// outermost first.
+func (f *File) dotenvChain() []string {
+	list := f.path(f.Dotenv)
+	if f.parent == nil {
+		return list
+	}
+	return append(f.parent.dotenvChain(), list...)
+}
+
+// path returns the file names relative to the task file directory.
+func (f *File) path(names []string) []string {
+	list := make([]string, len(names))
+	for i, fn := range names {
+		if len(f.dir) > 0 && !filepath.IsAbs(fn) {
+			fn = filepath.Join(f.dir, fn)
+		}
+		list[i] = fn
+	}
+	return list
+}
@@ -0,0 +1,259 @@
+package taskfile
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kardianos/task"
+)
+
+func TestSplitArgs(t *testing.T) {
+	list := []struct {
+		Input string
+		Args  []string
+		Error bool
+	}{
+		{Input: "go build ./...", Args: []string{"go", "build", "./..."}},
+		{Input: `echo "a b" 'c d' e\ f`, Args: []string{"echo", "a b", "c d", "e f"}},
+		{Input: `awk '{print $1}'`, Args: []string{"awk", "{print $1}"}},
+		{Input: `echo ""`, Args: []string{"echo", ""}},
+		{Input: `echo "abc`, Error: true},
+	}
+	for _, item := range list {
+		got, err := splitArgs(item.Input)
+		if item.Error {
+			if err == nil {
+				t.Errorf("%q: expected error", item.Input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", item.Input, err)
+			continue
+		}
+		if g, w := strings.Join(got, "|"), strings.Join(item.Args, "|"); g != w {
+			t.Errorf("%q: got %q, want %q", item.Input, g, w)
+		}
+	}
+}
+
+const testFile = `
+env:
+  GREETING: hello
+tasks:
+  a:
+    cmds:
+      - echo a ${GREETING}
+  b:
+    deps: [a]
+    env:
+      GREETING: hi
+    cmds:
+      - echo b ${GREETING}
+  c:
+    desc: Run everything.
+    deps: [a, b]
+    cmds:
+      - echo c
+`
+
+func TestRun(t *testing.T) {
+	if _, err := exec.LookPath("echo"); err != nil {
+		t.Skip("missing echo")
+	}
+	f, err := Parse([]byte(testFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := &strings.Builder{}
+	st := &task.State{
+		Env:    map[string]string{},
+		Dir:    t.TempDir(),
+		Stdout: stdout,
+		Stderr: stdout,
+	}
+	err = task.Run(context.Background(), st, f.Command("tf", "").Exec([]string{"c"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := stdout.String(), "a hello\nb hi\nc\n"; g != w {
+		t.Fatalf("got %q, want %q", g, w)
+	}
+	if len(st.Env) != 0 {
+		t.Fatalf("task env leaked into state: %v", st.Env)
+	}
+}
+
+func TestCycle(t *testing.T) {
+	f, err := Parse([]byte(`
+tasks:
+  a:
+    deps: [b]
+  b:
+    deps: [a]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = task.Run(context.Background(), &task.State{}, f.Action("a"))
+	if err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("expected cycle error, got %v", err)
+	}
+}
+
+func TestInclude(t *testing.T) {
+	if _, err := exec.LookPath("pwd"); err != nil {
+		t.Skip("missing pwd")
+	}
+	dir := t.TempDir()
+	write := func(name, content string) {
+		fn := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fn), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fn, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("taskfile.yaml", `
+env:
+  A: root
+  B: root
+includes:
+  backend: backend/taskfile.yaml
+tasks:
+  all:
+    deps: [backend:build]
+    cmds:
+      - echo all ${A} ${B}
+`)
+	write("backend/taskfile.yaml", `
+env:
+  B: backend
+tasks:
+  gen:
+    cmds:
+      - pwd
+  build:
+    deps: [gen]
+    cmds:
+      - echo build ${A} ${B}
+`)
+	f, err := Load(filepath.Join(dir, "taskfile.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := &strings.Builder{}
+	st := &task.State{
+		Env:    map[string]string{},
+		Dir:    dir,
+		Stdout: stdout,
+		Stderr: stdout,
+	}
+	err = task.Run(context.Background(), st, f.Action("all"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backendDir, _ := filepath.EvalSymlinks(filepath.Join(dir, "backend"))
+	want := backendDir + "\nbuild root backend\nall root root\n"
+	if g := stdout.String(); g != want {
+		t.Fatalf("got %q, want %q", g, want)
+	}
+	if st.Dir != dir {
+		t.Fatalf("state dir changed to %q", st.Dir)
+	}
+
+	write("taskfile.yaml", `
+includes:
+  backend: backend/taskfile.yaml
+tasks:
+  all:
+    deps: [backend:x]
+`)
+	_, err = Load(filepath.Join(dir, "taskfile.yaml"))
+	if err == nil || !strings.Contains(err.Error(), `task "all" depends on unknown task "backend:x"`) {
+		t.Fatalf("expected unknown task error, got %v", err)
+	}
+}
+
+func TestIncludeURL(t *testing.T) {
+	shared := []byte(`
+tasks:
+  hello:
+    cmds:
+      - echo shared hello
+`)
+	sum := sha256.Sum256(shared)
+	fetched := 0
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched++
+		w.Write(shared)
+	}))
+	defer srv.Close()
+
+	oldCache, oldClient := CacheDir, HTTPClient
+	CacheDir, HTTPClient = t.TempDir(), srv.Client()
+	defer func() {
+		CacheDir, HTTPClient = oldCache, oldClient
+	}()
+
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "taskfile.yaml")
+	write := func(checksum string) {
+		content := "includes:\n  std:\n    url: " + srv.URL + "/go.yaml\n    checksum: sha256:" + checksum + "\n"
+		if err := os.WriteFile(fn, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(hex.EncodeToString(sum[:]))
+	for i := 0; i < 2; i++ {
+		f, err := Load(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := f.Registry().Lookup("std:hello"); !ok {
+			t.Fatal("missing std:hello")
+		}
+	}
+	if fetched != 1 {
+		t.Fatalf("fetched %d times, want once", fetched)
+	}
+
+	write(strings.Repeat("0", 64))
+	_, err := Load(fn)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+}
+
+func TestIncludeGitOption(t *testing.T) {
+	oldCache := CacheDir
+	CacheDir = t.TempDir()
+	defer func() {
+		CacheDir = oldCache
+	}()
+
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "taskfile.yaml")
+	for _, inc := range []string{
+		"git: --upload-pack=touch /tmp/pwned",
+		"git: https://example.com/repo.git\n    ref: --upload-pack=touch /tmp/pwned",
+	} {
+		content := "includes:\n  std:\n    " + inc + "\n"
+		if err := os.WriteFile(fn, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := Load(fn)
+		if err == nil || !strings.Contains(err.Error(), `must not start with "-"`) {
+			t.Fatalf("%s: expected invalid git include, got %v", inc, err)
+		}
+	}
+}
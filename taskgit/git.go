@@ -0,0 +1,229 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package taskgit has actions that run git.
+//
+// Arguments may be of type task.VAR or string and are expanded with
+// task.ExpandEnv. An argument that expands empty is an error, unless
+// documented as optional. Git is run in State.Dir with State.Env.
+package taskgit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/kardianos/task"
+)
+
+// SHAVar is the State variable set to the commit hash of HEAD after
+// Clone, Checkout, and Fetch.
+const SHAVar = "git_sha"
+
+// Error is returned when git fails.
+type Error struct {
+	Args     []string
+	ExitCode int
+	Stderr   string
+	Err      error
+}
+
+func (err *Error) Error() string {
+	msg := fmt.Sprintf("git %s: %v", strings.Join(err.Args, " "), err.Err)
+	if s := strings.TrimSpace(err.Stderr); len(s) > 0 {
+		msg += ": " + s
+	}
+	return msg
+}
+
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+// optional is an argument of git that is left out if it expands empty.
+type optional struct {
+	v any
+}
+
+// expand the args. An empty argument is an error unless it is optional.
+func expand(st *task.State, args []any) ([]string, error) {
+	list := make([]string, 0, len(args))
+	for i, a := range args {
+		opt, isOptional := a.(optional)
+		if isOptional {
+			a = opt.v
+		}
+		s, err := task.ExpandEnvErr(a, st)
+		if err != nil {
+			return nil, err
+		}
+		if len(s) > 0 {
+			list = append(list, s)
+			continue
+		}
+		if isOptional {
+			continue
+		}
+		if name, ok := a.(task.VAR); ok {
+			return nil, fmt.Errorf("git %s: variable %s is empty", strings.Join(list, " "), name)
+		}
+		return nil, fmt.Errorf("git %s: argument %d is empty", strings.Join(list, " "), i)
+	}
+	return list, nil
+}
+
+// Output runs git with args in dir and returns the trimmed stdout.
+// It is run even in dry-run mode, so it should not change the repository.
+func Output(ctx context.Context, st *task.State, dir string, args ...string) (string, error) {
+	stdout := &bytes.Buffer{}
+	err := run(ctx, st, dir, stdout, io.Discard, args)
+	return strings.TrimSpace(stdout.String()), err
+}
+
+// run git with args in dir. Stderr is captured into the returned *Error.
+func run(ctx context.Context, st *task.State, dir string, stdout, stderr io.Writer, args []string) error {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	for k, v := range st.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	errBuf := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = io.MultiWriter(errBuf, stderr)
+	start := st.Now()
+	err := cmd.Run()
+	st.AuditCmd(cmd, start, err)
+	if err == nil {
+		return nil
+	}
+	gerr := &Error{Args: args, ExitCode: -1, Stderr: errBuf.String(), Err: err}
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		gerr.ExitCode = ee.ExitCode()
+	}
+	return gerr
+}
+
+// git returns an action that runs git with the expanded args with
+// task.Exec, so in dry-run mode the command is printed. If setSHA is true,
+// SHAVar is set to HEAD in the directory returned by dir.
+func git(dir func(st *task.State) (string, error), setSHA bool, args ...any) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		sArgs, err := expand(st, args)
+		if err != nil {
+			return err
+		}
+		d := st.Dir
+		if dir != nil {
+			d, err = dir(st)
+			if err != nil {
+				return err
+			}
+		}
+		// The arguments are expanded, so Exec must not expand them again.
+		execArgs := make([]any, len(sArgs))
+		for i, a := range sArgs {
+			execArgs[i] = task.Literal(a)
+		}
+		orig := st.Stderr
+		errBuf := &bytes.Buffer{}
+		if orig != nil {
+			st.Stderr = io.MultiWriter(orig, errBuf)
+		} else {
+			st.Stderr = errBuf
+		}
+		err = sc.RunAction(ctx, st, task.Exec("git", execArgs...))
+		st.Stderr = orig
+		if err != nil {
+			var ee *exec.ExitError
+			if errors.As(err, &ee) {
+				return &Error{Args: sArgs, ExitCode: ee.ExitCode(), Stderr: errBuf.String(), Err: ee}
+			}
+			return err
+		}
+		if !setSHA || task.DryRun(st) {
+			return nil
+		}
+		sha, err := Output(ctx, st, d, "rev-parse", "HEAD")
+		if err != nil {
+			return err
+		}
+		st.Set(SHAVar, sha)
+		return nil
+	})
+}
+
+// Clone the repository into dir, relative to State.Dir.
+func Clone(repo, dir any, args ...any) task.Action {
+	return git(func(st *task.State) (string, error) {
+		d, err := task.ExpandEnvErr(dir, st)
+		return st.Filepath(d), err
+	}, true, append(append([]any{"clone"}, args...), repo, dir)...)
+}
+
+// Checkout the ref.
+func Checkout(ref any) task.Action {
+	return git(nil, true, "checkout", ref)
+}
+
+// Fetch refs from the remote. An empty remote fetches the default remote.
+func Fetch(remote any, refs ...any) task.Action {
+	return git(nil, true, append([]any{"fetch", optional{remote}}, refs...)...)
+}
+
+// Tag HEAD with name. If message is not empty an annotated tag is created.
+func Tag(name, message any) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		msg, err := task.ExpandEnvErr(message, st)
+		if err != nil {
+			return err
+		}
+		if len(msg) == 0 {
+			return sc.RunAction(ctx, st, git(nil, false, "tag", name))
+		}
+		return sc.RunAction(ctx, st, git(nil, false, "tag", "-a", "-m", msg, name))
+	})
+}
+
+// Push refs to the remote.
+func Push(remote any, refs ...any) task.Action {
+	return git(nil, false, append([]any{"push", remote}, refs...)...)
+}
+
+// Describe stores the output of "git describe --tags --always" with any
+// extra args in the State variable out.
+func Describe(out string, args ...any) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		sArgs, err := expand(st, args)
+		if err != nil {
+			return err
+		}
+		s, err := Output(ctx, st, st.Dir, append([]string{"describe", "--tags", "--always"}, sArgs...)...)
+		if err != nil {
+			return err
+		}
+		st.Set(out, s)
+		return nil
+	})
+}
+
+// RevParse stores the commit hash of rev in the State variable out.
+func RevParse(rev any, out string) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		r, err := task.ExpandEnvErr(rev, st)
+		if err != nil {
+			return err
+		}
+		s, err := Output(ctx, st, st.Dir, "rev-parse", r)
+		if err != nil {
+			return err
+		}
+		st.Set(out, s)
+		return nil
+	})
+}
@@ -0,0 +1,123 @@
+package taskgit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kardianos/task"
+)
+
+func gitState(t *testing.T, dir string) *task.State {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("missing git")
+	}
+	env := task.Environ()
+	for k, v := range map[string]string{
+		"GIT_AUTHOR_NAME":     "a",
+		"GIT_AUTHOR_EMAIL":    "a@example.com",
+		"GIT_COMMITTER_NAME":  "a",
+		"GIT_COMMITTER_EMAIL": "a@example.com",
+		"GIT_CONFIG_GLOBAL":   os.DevNull,
+	} {
+		env[k] = v
+	}
+	return &task.State{
+		Env:    env,
+		Dir:    dir,
+		Stdout: &strings.Builder{},
+		Stderr: &strings.Builder{},
+	}
+}
+
+// commit writes the file and commits it.
+func commit(name, content string) task.Action {
+	return task.NewScript(
+		task.WriteFile(name, 0600, content),
+		task.Exec("git", "add", name),
+		task.Exec("git", "commit", "-q", "-m", "add "+name),
+	)
+}
+
+func TestGit(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := os.Mkdir(src, 0700); err != nil {
+		t.Fatal(err)
+	}
+	st := gitState(t, src)
+	ctx := context.Background()
+
+	err := task.Run(ctx, st, task.NewScript(
+		task.Exec("git", "init", "-q", "-b", "main"),
+		commit("a.txt", "a"),
+		Tag("v1.0.0", "release"),
+		commit("b.txt", "b"),
+		Describe("version"),
+		RevParse("HEAD", "head"),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, _ := st.Get("version").(string)
+	if !strings.HasPrefix(version, "v1.0.0-1-g") {
+		t.Fatalf("unexpected version %q", version)
+	}
+	head, _ := st.Get("head").(string)
+
+	st.Dir = dir
+	err = task.Run(ctx, st, task.NewScript(
+		Clone(src, "dst"),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := st.Get(SHAVar); g != head {
+		t.Fatalf("got sha %v, want %s", g, head)
+	}
+
+	st.Dir = filepath.Join(dir, "dst")
+	err = task.Run(ctx, st, Checkout("v1.0.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := st.Get(SHAVar); g == head {
+		t.Fatal("sha not updated by checkout")
+	}
+
+	err = task.Run(ctx, st, Checkout("nope"))
+	var gerr *Error
+	if !errors.As(err, &gerr) {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+	if gerr.ExitCode == 0 || !strings.Contains(gerr.Stderr, "nope") {
+		t.Fatalf("unexpected error %#v", gerr)
+	}
+
+	// An empty remote is optional for Fetch but not for Push.
+	st.Set("remote", "")
+	err = task.Run(ctx, st, Fetch(task.VAR("remote")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = task.Run(ctx, st, Push(task.VAR("remote"), "main"))
+	if g, w := fmt.Sprint(err), "git push: variable remote is empty"; !strings.Contains(g, w) {
+		t.Fatalf("got error %q, want %q", g, w)
+	}
+
+	out := &strings.Builder{}
+	st.Stdout = out
+	st.Set(task.DryRunVar, true)
+	err = task.Run(ctx, st, Checkout("main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := out.String(), "exec: git checkout main"; !strings.HasPrefix(g, w) {
+		t.Fatalf("got dry-run %q, want %q", g, w)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package taskgit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kardianos/task"
+	"github.com/kardianos/task/tasksemver"
+)
+
+// ErrDirty is returned by RequireClean when the working tree has changes.
+// The returned error is a *DirtyError that matches ErrDirty with errors.Is.
+var ErrDirty = errors.New("git working tree is dirty")
+
+// DirtyError lists the changed files, as reported by "git status --porcelain".
+type DirtyError struct {
+	Files []string
+}
+
+func (err *DirtyError) Error() string {
+	return fmt.Sprintf("%v:\n\t%s", ErrDirty, strings.Join(err.Files, "\n\t"))
+}
+
+// Is reports true for ErrDirty.
+func (err *DirtyError) Is(target error) bool {
+	return target == ErrDirty
+}
+
+// Status returns the changed and untracked files in the working tree of dir.
+func Status(ctx context.Context, st *task.State, dir string) ([]string, error) {
+	out, err := Output(ctx, st, dir, "status", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+// RequireClean returns a *DirtyError if the working tree has changes.
+func RequireClean() task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		files, err := Status(ctx, st, st.Dir)
+		if err != nil {
+			return err
+		}
+		if len(files) > 0 {
+			return &DirtyError{Files: files}
+		}
+		return nil
+	})
+}
+
+// BranchClean sets State.Branch to task.BranchTrue if the working tree is
+// clean and task.BranchFalse if it has changes, for use with task.Switch.
+func BranchClean() task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		files, err := Status(ctx, st, st.Dir)
+		if err != nil {
+			return err
+		}
+		if len(files) > 0 {
+			st.Branch = task.BranchFalse
+		} else {
+			st.Branch = task.BranchTrue
+		}
+		return nil
+	})
+}
+
+// VersionString derives a version from the nearest tag of HEAD in dir:
+//
+//	v1.2.3                  HEAD is tagged v1.2.3
+//	v1.2.3-4-gabcdef0       4 commits after v1.2.3
+//	v0.0.0-12-gabcdef0      no tags, 12 commits in total
+//	v1.2.3-dirty            any of the above with a dirty working tree
+func VersionString(ctx context.Context, st *task.State, dir string) (string, error) {
+	desc, err := Output(ctx, st, dir, "describe", "--tags", "--long", "--dirty", "--always", "--abbrev=7")
+	if err != nil {
+		return "", err
+	}
+	desc, dirty := strings.CutSuffix(desc, "-dirty")
+
+	var v string
+	// A long description is "tag-distance-gsha", but the tag may contain dashes.
+	parts := strings.Split(desc, "-")
+	if n := len(parts); n >= 3 && strings.HasPrefix(parts[n-1], "g") {
+		tag := strings.Join(parts[:n-2], "-")
+		if parts[n-2] == "0" {
+			v = tag
+		} else {
+			v = tag + "-" + parts[n-2] + "-" + parts[n-1]
+		}
+	} else {
+		// No tags, desc is the abbreviated hash.
+		count, err := Output(ctx, st, dir, "rev-list", "--count", "HEAD")
+		if err != nil {
+			return "", err
+		}
+		v = "v0.0.0-" + count + "-g" + desc
+	}
+	if dirty {
+		v += "-dirty"
+	}
+	return v, nil
+}
+
+// Version stores the VersionString of State.Dir in the State variable out,
+// such as for use in linker flags.
+func Version(out string) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		v, err := VersionString(ctx, st, st.Dir)
+		if err != nil {
+			return err
+		}
+		st.Set(out, v)
+		return nil
+	})
+}
+
+// NextVersion stores the next release version in the State variable out,
+// bumping the part of the greatest semver release tag in State.Dir.
+// Pre-release tags are ignored. Without a release tag the part is bumped
+// from v0.0.0.
+func NextVersion(part tasksemver.Part, out string) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		tags, err := Output(ctx, st, st.Dir, "tag", "--list")
+		if err != nil {
+			return err
+		}
+		latest, ok := tasksemver.Latest(strings.Fields(tags), false)
+		if !ok {
+			latest = tasksemver.Version{Prefix: "v"}
+		}
+		st.Set(out, latest.Bump(part).String())
+		return nil
+	})
+}
@@ -0,0 +1,93 @@
+package taskgit
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/kardianos/task"
+	"github.com/kardianos/task/tasksemver"
+)
+
+func TestVersion(t *testing.T) {
+	dir := t.TempDir()
+	st := gitState(t, dir)
+	ctx := context.Background()
+
+	version := func(want string) {
+		t.Helper()
+		err := task.Run(ctx, st, Version("version"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := st.Get("version").(string)
+		if !regexp.MustCompile("^" + want + "$").MatchString(got) {
+			t.Fatalf("got version %q, want %q", got, want)
+		}
+	}
+	run := func(a ...task.Action) {
+		t.Helper()
+		if err := task.Run(ctx, st, task.NewScript(a...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run(task.Exec("git", "init", "-q"), commit("a.txt", "a"))
+	version(`v0\.0\.0-1-g[0-9a-f]{7}`)
+	run(Tag("v1.2.3-rc-1", ""))
+	version(`v1\.2\.3-rc-1`)
+	run(commit("b.txt", "b"))
+	version(`v1\.2\.3-rc-1-1-g[0-9a-f]{7}`)
+
+	run(RequireClean())
+	run(task.WriteFile("b.txt", 0600, "changed"))
+	version(`v1\.2\.3-rc-1-1-g[0-9a-f]{7}-dirty`)
+
+	err := task.Run(ctx, st, RequireClean())
+	if !errors.Is(err, ErrDirty) {
+		t.Fatalf("expected ErrDirty, got %v", err)
+	}
+	var branch task.Branch
+	run(task.Switch(BranchClean(), map[task.Branch]task.Action{
+		task.BranchFalse: task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+			branch = task.BranchFalse
+			return nil
+		}),
+	}))
+	if branch != task.BranchFalse {
+		t.Fatal("expected dirty branch")
+	}
+}
+
+func TestNextVersion(t *testing.T) {
+	dir := t.TempDir()
+	st := gitState(t, dir)
+	ctx := context.Background()
+	next := func(part tasksemver.Part, want string) {
+		t.Helper()
+		if err := task.Run(ctx, st, NextVersion(part, "next")); err != nil {
+			t.Fatal(err)
+		}
+		if g := st.Get("next"); g != want {
+			t.Fatalf("got %v, want %s", g, want)
+		}
+	}
+	err := task.Run(ctx, st, task.NewScript(task.Exec("git", "init", "-q"), commit("a.txt", "a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	next(tasksemver.Minor, "v0.1.0")
+	err = task.Run(ctx, st, task.NewScript(
+		Tag("v1.2.0", ""),
+		Tag("v1.9.3", ""),
+		Tag("v1.10.0-rc.1", ""),
+		Tag("nightly", ""),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	next(tasksemver.Patch, "v1.9.4")
+	next(tasksemver.Minor, "v1.10.0")
+	next(tasksemver.Major, "v2.0.0")
+}
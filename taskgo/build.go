@@ -0,0 +1,159 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package taskgo has actions that run the go tool.
+package taskgo
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/kardianos/task"
+)
+
+// BuildOptions configure GoBuild. String values may refer to State
+// variables and env with "${name}".
+type BuildOptions struct {
+	Package  string   // Package to build, defaults to ".".
+	Output   string   // Output file or directory, passed as -o if set.
+	Tags     []string // Build tags.
+	TrimPath bool     // Remove file system paths from the binary.
+	LDFlags  []string // Extra linker flags.
+
+	// X sets string variables in the binary with the linker -X flag,
+	// mapping "importpath.name" to the value, such as
+	// "main.version": "${version}".
+	X map[string]string
+
+	GOOS   string // Target operating system, defaults to the env GOOS.
+	GOARCH string // Target architecture, defaults to the env GOARCH.
+
+	// If Cache is set, the build is skipped when Output exists and the
+	// go files, go.mod, go.sum, and command line are unchanged since the
+	// last build. The Go build cache is always used.
+	Cache *task.FingerprintStore
+}
+
+// buildSources are the files fingerprinted when BuildOptions.Cache is set.
+var buildSources = []string{"**/*.go", "go.mod", "go.sum"}
+
+// args returns the expanded go command arguments.
+func (opts BuildOptions) args(st *task.State) ([]string, error) {
+	var err error
+	expand := func(v string) string {
+		if err != nil {
+			return ""
+		}
+		var s string
+		s, err = task.ExpandEnvErr(v, st)
+		return s
+	}
+	args := []string{"build"}
+	if len(opts.Output) > 0 {
+		args = append(args, "-o", expand(opts.Output))
+	}
+	if len(opts.Tags) > 0 {
+		tags := make([]string, len(opts.Tags))
+		for i, t := range opts.Tags {
+			tags[i] = expand(t)
+		}
+		args = append(args, "-tags", strings.Join(tags, ","))
+	}
+	if opts.TrimPath {
+		args = append(args, "-trimpath")
+	}
+	var ldflags []string
+	for _, f := range opts.LDFlags {
+		ldflags = append(ldflags, expand(f))
+	}
+	keys := make([]string, 0, len(opts.X))
+	for k := range opts.X {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		ldflags = append(ldflags, "-X", quoteFlag(k+"="+expand(opts.X[k])))
+	}
+	if len(ldflags) > 0 {
+		args = append(args, "-ldflags", strings.Join(ldflags, " "))
+	}
+	pkg := opts.Package
+	if len(pkg) == 0 {
+		pkg = "."
+	}
+	args = append(args, expand(pkg))
+	if err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// quoteFlag quotes v for the go tool flag parser if it contains spaces.
+func quoteFlag(v string) string {
+	if !strings.ContainsAny(v, " \t'\"") {
+		return v
+	}
+	return "'" + strings.ReplaceAll(v, "'", `'\''`) + "'"
+}
+
+// GoBuild runs "go build" with the options in State.Dir.
+func GoBuild(opts BuildOptions) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		args, err := opts.args(st)
+		if err != nil {
+			return err
+		}
+
+		env := make(map[string]string, len(st.Env)+2)
+		for k, v := range st.Env {
+			env[k] = v
+		}
+		if len(opts.GOOS) > 0 {
+			env["GOOS"], err = task.ExpandEnvErr(opts.GOOS, st)
+			if err != nil {
+				return err
+			}
+		}
+		if len(opts.GOARCH) > 0 {
+			env["GOARCH"], err = task.ExpandEnvErr(opts.GOARCH, st)
+			if err != nil {
+				return err
+			}
+		}
+
+		var key, sum string
+		if opts.Cache != nil && len(opts.Output) > 0 && !task.DryRun(st) {
+			key = "go " + strings.Join(args, " ")
+			sum, err = task.Fingerprint(st.Dir, buildSources, env["GOOS"], env["GOARCH"], env["CGO_ENABLED"], key)
+			if err != nil {
+				return err
+			}
+			// The output is the argument after "-o".
+			_, err = os.Stat(st.Filepath(args[2]))
+			if err == nil && opts.Cache.Get(key) == sum {
+				st.Logf("%s is up to date", key)
+				return nil
+			}
+		}
+
+		// The arguments are expanded, so Exec must not expand them again.
+		goArgs := make([]any, len(args))
+		for i, a := range args {
+			goArgs[i] = task.Literal(a)
+		}
+		orig := st.Env
+		st.Env = env
+		err = sc.RunAction(ctx, st, task.Exec("go", goArgs...))
+		st.Env = orig
+		if err != nil {
+			return err
+		}
+		if len(sum) > 0 {
+			return opts.Cache.Set(key, sum)
+		}
+		return nil
+	})
+}
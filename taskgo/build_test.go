@@ -0,0 +1,97 @@
+package taskgo
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kardianos/task"
+)
+
+func TestBuildArgs(t *testing.T) {
+	st := &task.State{}
+	st.Set("version", "v1.2.3")
+	opts := BuildOptions{
+		Package:  "./cmd/app",
+		Output:   "bin/app",
+		Tags:     []string{"netgo", "prod"},
+		TrimPath: true,
+		LDFlags:  []string{"-s", "-w"},
+		X: map[string]string{
+			"main.version": "${version}",
+			"main.note":    "a b",
+		},
+	}
+	args, err := opts.args(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(args, "|")
+	want := "build|-o|bin/app|-tags|netgo,prod|-trimpath|-ldflags|-s -w -X 'main.note=a b' -X main.version=v1.2.3|./cmd/app"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	st.Set(task.StrictVar, true)
+	opts.X["main.commit"] = "${commit}"
+	if _, err := opts.args(st); err == nil {
+		t.Fatal("expected error for missing variable")
+	}
+}
+
+func TestGoBuild(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("missing go")
+	}
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("go.mod", "module example.com/app\n\ngo 1.21\n")
+	write("main.go", "package main\n\nvar version = \"dev\"\n\nfunc main() { println(version) }\n")
+
+	cache, err := task.OpenFingerprintStore(filepath.Join(dir, "fp.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := &bytes.Buffer{}
+	st := &task.State{
+		Env:    task.Environ(),
+		Dir:    dir,
+		Stdout: stdout,
+		Stderr: stdout,
+	}
+	var logs []string
+	st.MsgLogger = func(msg string) {
+		logs = append(logs, msg)
+	}
+	// The version is expanded once, so "$b" is kept.
+	st.Env["b"] = "ZZ"
+	st.Set("version", "v1.0.0-$b")
+	build := GoBuild(BuildOptions{
+		Output: "bin/app",
+		X:      map[string]string{"main.version": "${version}"},
+		Cache:  cache,
+	})
+	for i := 0; i < 2; i++ {
+		if err := task.Run(context.Background(), st, build); err != nil {
+			t.Fatalf("%v\n%s", err, stdout.Bytes())
+		}
+	}
+	if len(logs) != 1 || !strings.Contains(logs[0], "up to date") {
+		t.Fatalf("expected second build to be skipped, got logs %q", logs)
+	}
+	out, err := exec.Command(filepath.Join(dir, "bin", "app")).CombinedOutput()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := strings.TrimSpace(string(out)), "v1.0.0-$b"; g != w {
+		t.Fatalf("got version %q, want %q", g, w)
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package taskgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kardianos/task"
+)
+
+// TestOptions configure Test. String values may refer to State variables
+// and env with "${name}".
+type TestOptions struct {
+	Packages     []string      // Packages to test, defaults to "./...".
+	Run          string        // Only run tests matching the regular expression.
+	Tags         []string      // Build tags.
+	Race         bool          // Enable the race detector.
+	Timeout      time.Duration // Test binary timeout, the go default if zero.
+	CoverProfile string        // Write a coverage profile to the file.
+	Args         []string      // Extra arguments to go test.
+	Verbose      bool          // Print passing tests, not only failures and package results.
+
+	// Result is the State variable the *TestResult is stored in.
+	// If empty the result is not stored.
+	Result string
+}
+
+// TestCase is the result of a single test.
+type TestCase struct {
+	Package string
+	Name    string
+	Action  string // One of "pass", "fail", or "skip".
+	Elapsed time.Duration
+	Output  string // Test output, only kept for failed tests.
+}
+
+// TestResult summarizes a go test run.
+type TestResult struct {
+	Passed  int
+	Failed  int
+	Skipped int
+	Elapsed time.Duration
+	Tests   []TestCase
+
+	// FailedPackages lists packages that failed without a failing test,
+	// such as from a build error.
+	FailedPackages []string
+}
+
+// Slowest returns the n slowest tests, slowest first.
+func (r *TestResult) Slowest(n int) []TestCase {
+	list := make([]TestCase, len(r.Tests))
+	copy(list, r.Tests)
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Elapsed > list[j].Elapsed
+	})
+	if n < len(list) {
+		list = list[:n]
+	}
+	return list
+}
+
+// testEvent is a line of "go test -json" output, see "go doc test2json".
+type testEvent struct {
+	Action     string
+	Package    string
+	ImportPath string // Set for "build-output" and "build-fail".
+	Test       string
+	Elapsed    float64
+	Output     string
+}
+
+// testWriter parses the go test JSON stream and writes progress to w.
+type testWriter struct {
+	w       io.Writer
+	verbose bool
+	result  *TestResult
+	buf     []byte
+	output  map[string]*strings.Builder
+	pkgFail map[string]bool
+}
+
+func (tw *testWriter) Write(p []byte) (int, error) {
+	tw.buf = append(tw.buf, p...)
+	for {
+		i := bytes.IndexByte(tw.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := tw.buf[:i]
+		tw.buf = tw.buf[i+1:]
+		tw.event(line)
+	}
+}
+
+func (tw *testWriter) event(line []byte) {
+	var ev testEvent
+	if err := json.Unmarshal(line, &ev); err != nil {
+		// Not an event, such as a build error.
+		fmt.Fprintf(tw.w, "%s\n", line)
+		return
+	}
+	key := ev.Package + " " + ev.Test
+	elapsed := time.Duration(ev.Elapsed * float64(time.Second))
+	switch ev.Action {
+	case "build-output", "build-fail":
+		// Since Go 1.24 build errors are reported under the ImportPath,
+		// which may name a test variant of the package. The package
+		// result follows.
+		key = "build " + ev.ImportPath
+		if ev.Action == "build-output" {
+			if tw.output[key] == nil {
+				tw.output[key] = &strings.Builder{}
+			}
+			tw.output[key].WriteString(ev.Output)
+			return
+		}
+		if out := tw.output[key]; out != nil {
+			delete(tw.output, key)
+			io.WriteString(tw.w, out.String())
+		}
+	case "output":
+		if tw.output[key] == nil {
+			tw.output[key] = &strings.Builder{}
+		}
+		tw.output[key].WriteString(ev.Output)
+	case "pass", "fail", "skip":
+		out := tw.output[key]
+		delete(tw.output, key)
+		if len(ev.Test) == 0 {
+			tw.packageDone(ev, elapsed, out)
+			return
+		}
+		tc := TestCase{
+			Package: ev.Package,
+			Name:    ev.Test,
+			Action:  ev.Action,
+			Elapsed: elapsed,
+		}
+		switch ev.Action {
+		case "pass":
+			tw.result.Passed++
+			if tw.verbose {
+				fmt.Fprintf(tw.w, "--- PASS: %s %s (%v)\n", ev.Package, ev.Test, elapsed)
+			}
+		case "skip":
+			tw.result.Skipped++
+			if tw.verbose {
+				fmt.Fprintf(tw.w, "--- SKIP: %s %s\n", ev.Package, ev.Test)
+			}
+		case "fail":
+			tw.result.Failed++
+			tw.pkgFail[ev.Package] = true
+			if out != nil {
+				tc.Output = out.String()
+			}
+			fmt.Fprintf(tw.w, "--- FAIL: %s %s (%v)\n%s", ev.Package, ev.Test, elapsed, tc.Output)
+		}
+		tw.result.Tests = append(tw.result.Tests, tc)
+	}
+}
+
+func (tw *testWriter) packageDone(ev testEvent, elapsed time.Duration, out *strings.Builder) {
+	switch ev.Action {
+	case "pass":
+		fmt.Fprintf(tw.w, "ok   %s %v\n", ev.Package, elapsed)
+	case "skip":
+		fmt.Fprintf(tw.w, "?    %s [no test files]\n", ev.Package)
+	case "fail":
+		if !tw.pkgFail[ev.Package] {
+			tw.result.FailedPackages = append(tw.result.FailedPackages, ev.Package)
+			if out != nil {
+				io.WriteString(tw.w, out.String())
+			}
+		}
+		fmt.Fprintf(tw.w, "FAIL %s %v\n", ev.Package, elapsed)
+	}
+}
+
+// args returns the expanded go command arguments.
+func (opts TestOptions) args(st *task.State) ([]string, error) {
+	var err error
+	expand := func(v string) string {
+		if err != nil {
+			return ""
+		}
+		var s string
+		s, err = task.ExpandEnvErr(v, st)
+		return s
+	}
+	args := []string{"test", "-json"}
+	if len(opts.Run) > 0 {
+		args = append(args, "-run", expand(opts.Run))
+	}
+	if len(opts.Tags) > 0 {
+		tags := make([]string, len(opts.Tags))
+		for i, t := range opts.Tags {
+			tags[i] = expand(t)
+		}
+		args = append(args, "-tags", strings.Join(tags, ","))
+	}
+	if opts.Race {
+		args = append(args, "-race")
+	}
+	if opts.Timeout > 0 {
+		args = append(args, "-timeout", opts.Timeout.String())
+	}
+	if len(opts.CoverProfile) > 0 {
+		args = append(args, "-coverprofile", expand(opts.CoverProfile))
+	}
+	for _, a := range opts.Args {
+		args = append(args, expand(a))
+	}
+	pkgs := opts.Packages
+	if len(pkgs) == 0 {
+		pkgs = []string{"./..."}
+	}
+	for _, p := range pkgs {
+		args = append(args, expand(p))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// Test runs "go test -json" in State.Dir. Failed tests and package results
+// are written to stdout as they finish. The *TestResult is stored in the
+// Result State variable, even if tests fail. Test returns an error if any
+// test or package fails.
+func Test(opts TestOptions) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		args, err := opts.args(st)
+		if err != nil {
+			return err
+		}
+		// The arguments are expanded, so Exec must not expand them again.
+		goArgs := make([]any, len(args))
+		for i, a := range args {
+			goArgs[i] = task.Literal(a)
+		}
+		start := time.Now()
+		tw := &testWriter{
+			w:       st.Stdout,
+			verbose: opts.Verbose,
+			result:  &TestResult{},
+			output:  make(map[string]*strings.Builder),
+			pkgFail: make(map[string]bool),
+		}
+		if tw.w == nil {
+			tw.w = io.Discard
+		}
+		orig := st.Stdout
+		st.Stdout = tw
+		err = sc.RunAction(ctx, st, task.Exec("go", goArgs...))
+		st.Stdout = orig
+		if len(tw.buf) > 0 {
+			tw.event(tw.buf)
+		}
+		res := tw.result
+		res.Elapsed = time.Since(start)
+		if len(opts.Result) > 0 && !task.DryRun(st) {
+			st.Set(opts.Result, res)
+		}
+		switch {
+		case res.Failed > 0:
+			return fmt.Errorf("%d of %d tests failed", res.Failed, len(res.Tests))
+		case len(res.FailedPackages) > 0:
+			return fmt.Errorf("packages failed: %s", strings.Join(res.FailedPackages, ", "))
+		}
+		return err
+	})
+}
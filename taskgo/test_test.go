@@ -0,0 +1,105 @@
+package taskgo
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kardianos/task"
+)
+
+func TestTest(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("missing go")
+	}
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("go.mod", "module example.com/app\n\ngo 1.21\n")
+	write("app.go", "package app\n\nfunc Add(a, b int) int { return a + b }\n")
+	write("app_test.go", `package app
+
+import "testing"
+
+func TestPass(t *testing.T) {
+	if Add(1, 2) != 3 {
+		t.Fatal("bad add")
+	}
+}
+
+func TestFail(t *testing.T) {
+	t.Fatal("always fails")
+}
+
+func TestSkip(t *testing.T) {
+	t.Skip("not today")
+}
+`)
+	stdout := &bytes.Buffer{}
+	st := &task.State{
+		Env:    task.Environ(),
+		Dir:    dir,
+		Stdout: stdout,
+		Stderr: &bytes.Buffer{},
+	}
+	st.Env["b"] = "ZZ"
+	st.Set("cover", "cover$b.out")
+	err := task.Run(context.Background(), st, Test(TestOptions{
+		CoverProfile: "${cover}",
+		Result:       "result",
+	}))
+	if err == nil || err.Error() != "1 of 3 tests failed" {
+		t.Fatalf("unexpected error %v\n%s", err, stdout.Bytes())
+	}
+	res, ok := st.Get("result").(*TestResult)
+	if !ok {
+		t.Fatal("missing result")
+	}
+	if res.Passed != 1 || res.Failed != 1 || res.Skipped != 1 {
+		t.Fatalf("got %d passed, %d failed, %d skipped", res.Passed, res.Failed, res.Skipped)
+	}
+	if len(res.Slowest(2)) != 2 {
+		t.Fatalf("expected two slowest tests")
+	}
+	out := stdout.String()
+	if !strings.Contains(out, "--- FAIL: example.com/app TestFail") || !strings.Contains(out, "always fails") {
+		t.Fatalf("missing failure in output:\n%s", out)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cover$b.out")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTestWriterBuildFail(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tw := &testWriter{
+		w:       buf,
+		result:  &TestResult{},
+		output:  make(map[string]*strings.Builder),
+		pkgFail: make(map[string]bool),
+	}
+	events := `{"ImportPath":"example.com/app [example.com/app.test]","Action":"build-output","Output":"# example.com/app\n"}
+{"ImportPath":"example.com/app [example.com/app.test]","Action":"build-output","Output":"./app.go:3:1: syntax error\n"}
+{"ImportPath":"example.com/app [example.com/app.test]","Action":"build-fail"}
+{"Action":"start","Package":"example.com/app"}
+{"Action":"output","Package":"example.com/app","Output":"FAIL\texample.com/app [build failed]\n"}
+{"Action":"fail","Package":"example.com/app","Elapsed":0,"FailedBuild":"example.com/app [example.com/app.test]"}
+`
+	if _, err := tw.Write([]byte(events)); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "./app.go:3:1: syntax error") {
+		t.Fatalf("missing build output:\n%s", out)
+	}
+	if got := tw.result.FailedPackages; len(got) != 1 || got[0] != "example.com/app" {
+		t.Fatalf("got failed packages %q", got)
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package taskgpg has actions that sign and verify files with gpg.
+//
+// The key is imported into a temporary gpg home directory for each action,
+// so the user keyring is neither used nor changed. File arguments may be
+// of type task.VAR or string and are expanded with task.ExpandEnv.
+package taskgpg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/kardianos/task"
+)
+
+// Key is an armored or binary OpenPGP key read from a file or from a
+// State env variable. File, Env, and Passphrase are expanded with
+// task.ExpandEnv.
+type Key struct {
+	File       string // Key file, relative to State.Dir.
+	Env        string // Name of the State env variable with the key, used if File is empty.
+	Passphrase string // Passphrase of the secret key, if any.
+}
+
+func (k Key) read(st *task.State) ([]byte, error) {
+	fn, err := task.ExpandEnvErr(k.File, st)
+	if err != nil {
+		return nil, err
+	}
+	if len(fn) > 0 {
+		return os.ReadFile(st.Filepath(fn))
+	}
+	name, err := task.ExpandEnvErr(k.Env, st)
+	if err != nil {
+		return nil, err
+	}
+	if len(name) == 0 {
+		return nil, errors.New("key has no File or Env")
+	}
+	v := st.Getenv(name)
+	if len(v) == 0 {
+		return nil, fmt.Errorf("key env %s is empty", name)
+	}
+	return []byte(v), nil
+}
+
+// Error is returned when gpg fails.
+type Error struct {
+	Args   []string
+	Stderr string
+	Err    error
+}
+
+func (err *Error) Error() string {
+	msg := fmt.Sprintf("gpg %s: %v", strings.Join(err.Args, " "), err.Err)
+	if s := strings.TrimSpace(err.Stderr); len(s) > 0 {
+		msg += ": " + s
+	}
+	return msg
+}
+
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+// home is a temporary gpg home directory with the key imported.
+type home struct {
+	dir        string
+	passphrase string // Passphrase file name.
+}
+
+func newHome(ctx context.Context, st *task.State, key Key) (*home, error) {
+	b, err := key.read(st)
+	if err != nil {
+		return nil, err
+	}
+	pass, err := task.ExpandEnvErr(key.Passphrase, st)
+	if err != nil {
+		return nil, err
+	}
+	// Keep the path short, the agent socket is placed in it.
+	dir, err := os.MkdirTemp("", "taskgpg")
+	if err != nil {
+		return nil, err
+	}
+	h := &home{dir: dir, passphrase: filepath.Join(dir, "passphrase")}
+	err = os.WriteFile(h.passphrase, []byte(pass), 0600)
+	if err == nil {
+		err = h.run(ctx, b, "--import")
+	}
+	if err != nil {
+		h.close()
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *home) run(ctx context.Context, stdin []byte, args ...string) error {
+	opts := []string{"--batch", "--yes", "--no-tty", "--homedir", h.dir, "--pinentry-mode", "loopback", "--passphrase-file", h.passphrase}
+	cmd := exec.CommandContext(ctx, "gpg", append(opts, args...)...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	errBuf := &bytes.Buffer{}
+	cmd.Stderr = errBuf
+	if err := cmd.Run(); err != nil {
+		return &Error{Args: args, Stderr: errBuf.String(), Err: err}
+	}
+	return nil
+}
+
+func (h *home) close() {
+	exec.Command("gpgconf", "--homedir", h.dir, "--kill", "gpg-agent").Run()
+	os.RemoveAll(h.dir)
+}
+
+func expandFiles(st *task.State, files []any) ([]string, error) {
+	list := make([]string, len(files))
+	for i, f := range files {
+		fn, err := task.ExpandEnvErr(f, st)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = st.Filepath(fn)
+	}
+	return list, nil
+}
+
+// Sign writes an armored detached signature of each file to the file
+// name with ".asc" appended, using the secret key.
+func Sign(key Key, files ...any) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		list, err := expandFiles(st, files)
+		if err != nil {
+			return err
+		}
+		if task.DryRun(st) {
+			if st.Stdout != nil {
+				for _, fn := range list {
+					fmt.Fprintf(st.Stdout, "sign: %s -> %s.asc\n", fn, fn)
+				}
+			}
+			return nil
+		}
+		h, err := newHome(ctx, st, key)
+		if err != nil {
+			return fmt.Errorf("sign: %w", err)
+		}
+		defer h.close()
+		for _, fn := range list {
+			err = h.run(ctx, nil, "--armor", "--detach-sign", "--output", fn+".asc", fn)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Verify checks the detached signature, the file name with ".asc" appended,
+// of each file against the public key.
+func Verify(key Key, files ...any) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		list, err := expandFiles(st, files)
+		if err != nil {
+			return err
+		}
+		h, err := newHome(ctx, st, key)
+		if err != nil {
+			return fmt.Errorf("verify: %w", err)
+		}
+		defer h.close()
+		for _, fn := range list {
+			if err := h.run(ctx, nil, "--verify", fn+".asc", fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
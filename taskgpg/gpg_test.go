@@ -0,0 +1,82 @@
+package taskgpg
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/kardianos/task"
+)
+
+// genKey generates a signing key and returns the armored secret and
+// public keys.
+func genKey(t *testing.T, passphrase string) (secret, public []byte) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("missing gpg")
+	}
+	dir, err := os.MkdirTemp("", "gpgtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &home{dir: dir, passphrase: filepath.Join(dir, "passphrase")}
+	t.Cleanup(h.close)
+	if err := os.WriteFile(h.passphrase, []byte(passphrase), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := h.run(ctx, nil, "--quick-gen-key", "test@example.com", "ed25519", "sign", "never"); err != nil {
+		t.Skip(err)
+	}
+	gpg := func(args ...string) []byte {
+		b, err := exec.Command("gpg", append([]string{"--batch", "--homedir", dir, "--pinentry-mode", "loopback", "--passphrase-file", h.passphrase, "--armor"}, args...)...).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	return gpg("--export-secret-keys", "test@example.com"), gpg("--export", "test@example.com")
+}
+
+func TestSignVerify(t *testing.T) {
+	secret, public := genKey(t, "pass")
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "key.asc"), secret, 0600); err != nil {
+		t.Fatal(err)
+	}
+	st := &task.State{
+		Dir: dir,
+		Env: map[string]string{"GPG_PUBLIC": string(public), "GPG_PASS": "pass"},
+	}
+	st.Set("out", "app.tar.gz")
+	ctx := context.Background()
+	err := task.Run(ctx, st, task.NewScript(
+		task.WriteFile("app.tar.gz", 0600, "app"),
+		task.WriteFile("app.sha256", 0600, "sum"),
+		Sign(Key{File: "key.asc", Passphrase: "$GPG_PASS"}, task.VAR("out"), "app.sha256"),
+		Verify(Key{Env: "GPG_PUBLIC"}, "app.tar.gz", "app.sha256"),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "app.tar.gz.asc")); err != nil {
+		t.Fatal(err)
+	}
+
+	st.ErrorLogger = func(err error) {}
+	err = task.Run(ctx, st, task.NewScript(
+		task.WriteFile("app.tar.gz", 0600, "changed"),
+		Verify(Key{Env: "GPG_PUBLIC"}, "app.tar.gz"),
+	))
+	var gerr *Error
+	if !errors.As(err, &gerr) {
+		t.Fatalf("expected verify error, got %v", err)
+	}
+
+	err = task.Run(ctx, st, Sign(Key{File: "key.asc", Passphrase: "wrong"}, "app.sha256"))
+	if err == nil {
+		t.Fatal("expected error with wrong passphrase")
+	}
+}
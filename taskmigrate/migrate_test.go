@@ -0,0 +1,238 @@
+package taskmigrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kardianos/task"
+)
+
+// fakeDB is an in-memory database that records executed statements and
+// understands the schema table statements.
+type fakeDB struct {
+	mu      sync.Mutex
+	applied map[int64]string
+	log     []string
+}
+
+var (
+	fakeMu  sync.Mutex
+	fakeDBs = map[string]*fakeDB{}
+)
+
+func init() {
+	sql.Register("fakesql", fakeDriver{})
+	RegisterDriver("fake", Driver{
+		Name:        "fakesql",
+		Placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+	})
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeMu.Lock()
+	defer fakeMu.Unlock()
+	db := fakeDBs[name]
+	if db == nil {
+		db = &fakeDB{applied: map[int64]string{}}
+		fakeDBs[name] = db
+	}
+	return &fakeConn{db: db}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepare not supported")
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *fakeConn) Commit() error             { return nil }
+func (c *fakeConn) Rollback() error           { return nil }
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	db := c.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	switch {
+	case strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS schema_migrations"):
+	case strings.HasPrefix(query, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)"):
+		db.applied[args[0].Value.(int64)] = args[1].Value.(string)
+	case strings.HasPrefix(query, "DELETE FROM schema_migrations WHERE version = $1"):
+		delete(db.applied, args[0].Value.(int64))
+	case strings.Contains(query, "FAIL"):
+		return nil, errors.New("syntax error")
+	default:
+		db.log = append(db.log, strings.TrimSpace(query))
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if query != "SELECT version FROM schema_migrations" {
+		return nil, errors.New("unexpected query " + query)
+	}
+	db := c.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	rows := &fakeRows{}
+	for v := range db.applied {
+		rows.versions = append(rows.versions, v)
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	versions []int64
+}
+
+func (r *fakeRows) Columns() []string { return []string{"version"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.versions) == 0 {
+		return io.EOF
+	}
+	dest[0] = r.versions[0]
+	r.versions = r.versions[1:]
+	return nil
+}
+
+func (db *fakeDB) state() (applied []int64, log []string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for v := range db.applied {
+		applied = append(applied, v)
+	}
+	sort.Slice(applied, func(i, j int) bool { return applied[i] < applied[j] })
+	log, db.log = db.log, nil
+	return applied, log
+}
+
+func writeMigrations(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	dir := t.TempDir()
+	writeMigrations(t, dir, map[string]string{
+		"0001_users.up.sql":   "create users",
+		"0001_users.down.sql": "drop users",
+		"0002_posts.up.sql":   "create posts",
+		"0002_posts.down.sql": "drop posts",
+		"README.md":           "not a migration",
+	})
+	stdout := &strings.Builder{}
+	st := &task.State{
+		Dir:         dir,
+		Env:         map[string]string{"DB": "fake://migrate"},
+		Stdout:      stdout,
+		ErrorLogger: func(err error) {},
+	}
+	db, _ := fakeDriver{}.Open("fake://migrate")
+	fdb := db.(*fakeConn).db
+	ctx := context.Background()
+	check := func(wantApplied string, wantLog ...string) {
+		t.Helper()
+		applied, log := fdb.state()
+		if g := fmtInts(applied); g != wantApplied {
+			t.Fatalf("got applied %q, want %q", g, wantApplied)
+		}
+		if strings.Join(log, ",") != strings.Join(wantLog, ",") {
+			t.Fatalf("got log %q, want %q", log, wantLog)
+		}
+	}
+
+	if err := task.Run(ctx, st, Up("$DB", ".", Options{})); err != nil {
+		t.Fatal(err)
+	}
+	check("1 2", "create users", "create posts")
+
+	writeMigrations(t, dir, map[string]string{
+		"0003_tags.up.sql":   "create tags",
+		"0003_tags.down.sql": "drop tags",
+	})
+	st.Set(task.DryRunVar, true)
+	if err := task.Run(ctx, st, Up("$DB", ".", Options{})); err != nil {
+		t.Fatal(err)
+	}
+	st.Delete(task.DryRunVar)
+	if g := stdout.String(); g != "migrate: up 0003_tags.up.sql\n" {
+		t.Fatalf("got dry run %q", g)
+	}
+	check("1 2")
+
+	if err := task.Run(ctx, st, Down("$DB", ".", Options{Target: 1})); err != nil {
+		t.Fatal(err)
+	}
+	check("1", "drop posts")
+
+	// A later failure rolls back the migrations applied by the script.
+	fail := task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		return errors.New("deploy failed")
+	})
+	err := task.Run(ctx, st, task.NewScript(Up("$DB", ".", Options{Rollback: true}), fail))
+	if err == nil || !strings.Contains(err.Error(), "deploy failed") {
+		t.Fatalf("expected deploy error, got %v", err)
+	}
+	check("1", "create posts", "create tags", "drop tags", "drop posts")
+
+	// A failing migration is not recorded.
+	writeMigrations(t, dir, map[string]string{"0004_bad.up.sql": "FAIL"})
+	err = task.Run(ctx, st, Up("$DB", ".", Options{Target: 4}))
+	if err == nil || !strings.Contains(err.Error(), "0004_bad.up.sql") {
+		t.Fatalf("expected migration error, got %v", err)
+	}
+	check("1 2 3", "create posts", "create tags")
+}
+
+func fmtInts(list []int64) string {
+	s := make([]string, len(list))
+	for i, v := range list {
+		s[i] = strconv.FormatInt(v, 10)
+	}
+	return strings.Join(s, " ")
+}
+
+func mustURL(t *testing.T, s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestRead(t *testing.T) {
+	dir := t.TempDir()
+	writeMigrations(t, dir, map[string]string{"0001_a.down.sql": "x"})
+	if _, err := Read(dir); err == nil {
+		t.Fatal("expected error for missing up file")
+	}
+	writeMigrations(t, dir, map[string]string{"0001_b.up.sql": "x"})
+	if _, err := Read(dir); err == nil {
+		t.Fatal("expected error for mismatched names")
+	}
+	if g := sqliteDSN(mustURL(t, "sqlite:///var/db/app.db?_fk=1")); g != "/var/db/app.db?_fk=1" {
+		t.Fatalf("got sqlite DSN %q", g)
+	}
+	if g := mysqlDSN(mustURL(t, "mysql://u:p@db:3306/app?parseTime=true")); g != "u:p@tcp(db:3306)/app?parseTime=true" {
+		t.Fatalf("got mysql DSN %q", g)
+	}
+}
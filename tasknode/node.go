@@ -0,0 +1,188 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package tasknode has actions that install and run Node packages with
+// npm, yarn, or pnpm, detected from the lockfile in State.Dir.
+package tasknode
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kardianos/task"
+)
+
+// Package manager names returned by Detect, which are also the names of
+// their executables.
+const (
+	NPM  = "npm"
+	YARN = "yarn"
+	PNPM = "pnpm"
+)
+
+// lockfiles in detection order.
+var lockfiles = []struct {
+	name, manager string
+}{
+	{"pnpm-lock.yaml", PNPM},
+	{"yarn.lock", YARN},
+	{"package-lock.json", NPM},
+	{"npm-shrinkwrap.json", NPM},
+}
+
+// Detect returns the package manager of the package in dir and its
+// lockfile name. Without a lockfile it returns NPM and an empty lockfile.
+func Detect(dir string) (manager, lockfile string) {
+	for _, lf := range lockfiles {
+		if _, err := os.Stat(filepath.Join(dir, lf.name)); err == nil {
+			return lf.manager, lf.name
+		}
+	}
+	return NPM, ""
+}
+
+// markerFile in node_modules holds the key of the installed lockfile.
+const markerFile = ".task-install"
+
+// InstallOptions configure NpmInstall.
+type InstallOptions struct {
+	Production bool // Do not install dev dependencies.
+
+	// CacheDir, if set, keeps an archive of node_modules for each
+	// lockfile, which is restored rather than running the install.
+	CacheDir string
+}
+
+// installArgs returns the lockfile aware install arguments.
+func installArgs(manager, lockfile string, production bool) []any {
+	var args []any
+	switch {
+	case manager == NPM && len(lockfile) > 0:
+		args = []any{"ci"}
+	case manager == NPM:
+		args = []any{"install"}
+	default:
+		args = []any{"install", "--frozen-lockfile"}
+	}
+	if production {
+		switch manager {
+		case NPM:
+			args = append(args, "--omit=dev")
+		case YARN:
+			args = append(args, "--production")
+		case PNPM:
+			args = append(args, "--prod")
+		}
+	}
+	return args
+}
+
+// NpmInstall installs the dependencies of the package in State.Dir with the
+// detected package manager, failing if the lockfile is out of date.
+// The install is skipped if node_modules was installed from the same
+// lockfile. Without a lockfile "npm install" is always run.
+func NpmInstall(opts InstallOptions) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		manager, lockfile := Detect(st.Dir)
+		args := installArgs(manager, lockfile, opts.Production)
+		install := task.Exec(manager, args...)
+		if len(lockfile) == 0 || task.DryRun(st) {
+			return sc.RunAction(ctx, st, install)
+		}
+		key, err := lockKey(st.Filepath(lockfile), manager, opts.Production)
+		if err != nil {
+			return err
+		}
+		modules := st.Filepath("node_modules")
+		marker := filepath.Join(modules, markerFile)
+		if b, err := os.ReadFile(marker); err == nil && string(b) == key {
+			st.Logf("node_modules is up to date with %s", lockfile)
+			return nil
+		}
+		var archive string
+		if len(opts.CacheDir) > 0 {
+			dir, err := task.ExpandEnvErr(opts.CacheDir, st)
+			if err != nil {
+				return err
+			}
+			archive = filepath.Join(st.Filepath(dir), "node_modules-"+key+".tar.gz")
+			if _, err := os.Stat(archive); err == nil {
+				if err := os.RemoveAll(modules); err != nil {
+					return err
+				}
+				if err := extract(archive, st.Dir); err != nil {
+					return err
+				}
+				st.Logf("node_modules restored from %s", archive)
+				return nil
+			}
+		}
+		if err := sc.RunAction(ctx, st, install); err != nil {
+			return err
+		}
+		if err := os.WriteFile(marker, []byte(key), 0600); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				// Nothing was installed.
+				return nil
+			}
+			return err
+		}
+		if len(archive) > 0 {
+			return save(archive, st.Dir, "node_modules")
+		}
+		return nil
+	})
+}
+
+// lockKey returns the hex sha256 of the lockfile and install settings.
+func lockKey(lockfile, manager string, production bool) (string, error) {
+	f, err := os.Open(lockfile)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	io.WriteString(h, manager)
+	if production {
+		io.WriteString(h, " production")
+	}
+	h.Write([]byte{0})
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// NpmRun runs the package.json script with the detected package manager.
+func NpmRun(script string, args ...any) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		manager, _ := Detect(st.Dir)
+		runArgs := []any{"run", script}
+		if manager == NPM && len(args) > 0 {
+			// npm needs "--" to pass arguments to the script.
+			runArgs = append(runArgs, "--")
+		}
+		runArgs = append(runArgs, args...)
+		return sc.RunAction(ctx, st, task.Exec(manager, runArgs...))
+	})
+}
+
+// relSlash returns the path of p relative to dir, with forward slashes.
+func relSlash(dir, p string) (string, error) {
+	rel, err := filepath.Rel(dir, p)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(rel, "..") {
+		return "", errors.New("path outside of directory: " + p)
+	}
+	return filepath.ToSlash(rel), nil
+}
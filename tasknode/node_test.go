@@ -0,0 +1,121 @@
+package tasknode
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kardianos/task"
+	"github.com/kardianos/task/tasktest"
+)
+
+// fakeManagers installs fake package managers that create node_modules
+// on install.
+func fakeManagers(t *testing.T) *tasktest.Fake {
+	return tasktest.FakeExec(t, `
+if [ "$1" = "install" ] || [ "$1" = "ci" ]; then
+	mkdir -p node_modules/pkg node_modules/.bin
+	echo "module.exports = 1" > node_modules/pkg/index.js
+	ln -sf ../pkg/index.js node_modules/.bin/pkg
+fi
+`, NPM, YARN, PNPM)
+}
+
+func TestDetect(t *testing.T) {
+	dir := t.TempDir()
+	if m, lf := Detect(dir); m != NPM || lf != "" {
+		t.Fatalf("got %s %s", m, lf)
+	}
+	for _, tc := range []struct{ file, manager string }{
+		{"package-lock.json", NPM},
+		{"yarn.lock", YARN},
+		{"pnpm-lock.yaml", PNPM},
+	} {
+		if err := os.WriteFile(filepath.Join(dir, tc.file), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if m, lf := Detect(dir); m != tc.manager || lf != tc.file {
+			t.Fatalf("got %s %s, want %s %s", m, lf, tc.manager, tc.file)
+		}
+	}
+}
+
+func TestNpmInstall(t *testing.T) {
+	fake := fakeManagers(t)
+	dir := t.TempDir()
+	cache := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("package.json", "{}")
+	write("pnpm-lock.yaml", "lock: 1")
+	st := &task.State{Dir: dir, Env: task.Environ()}
+	ctx := context.Background()
+	install := NpmInstall(InstallOptions{CacheDir: cache, Production: true})
+
+	for i := 0; i < 2; i++ {
+		if err := task.Run(ctx, st, install); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := fake.Calls(); len(got) != 1 || !strings.HasSuffix(got[0], "pnpm install --frozen-lockfile --prod") {
+		t.Fatalf("got runs %q", got)
+	}
+
+	// Removed node_modules is restored from the cache.
+	if err := os.RemoveAll(filepath.Join(dir, "node_modules")); err != nil {
+		t.Fatal(err)
+	}
+	if err := task.Run(ctx, st, install); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.Calls(); len(got) != 1 {
+		t.Fatalf("got runs %q", got)
+	}
+	link, err := os.Readlink(filepath.Join(dir, "node_modules", ".bin", "pkg"))
+	if err != nil || link != "../pkg/index.js" {
+		t.Fatalf("got link %q, %v", link, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "node_modules", "pkg", "index.js")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A lockfile change installs again.
+	write("pnpm-lock.yaml", "lock: 2")
+	if err := task.Run(ctx, st, install); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.Calls(); len(got) != 2 {
+		t.Fatalf("got runs %q", got)
+	}
+}
+
+func TestNpmRun(t *testing.T) {
+	fake := fakeManagers(t)
+	dir := t.TempDir()
+	st := &task.State{Dir: dir, Env: task.Environ()}
+	ctx := context.Background()
+	if err := task.Run(ctx, st, NpmRun("build", "--watch")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "yarn.lock"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := task.Run(ctx, st, task.NewScript(NpmInstall(InstallOptions{}), NpmRun("build", "--watch"))); err != nil {
+		t.Fatal(err)
+	}
+	got := fake.Calls()
+	want := []string{"npm run build -- --watch", "yarn install --frozen-lockfile", "yarn run build --watch"}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if !strings.HasSuffix(got[i], want[i]) {
+			t.Fatalf("got %q, want %q", got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package taskobj
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/kardianos/task"
+)
+
+// Cache returns a task.CacheBackend that stores artifacts in the bucket
+// under the key prefix, such as for task.Registry.Cache.
+func Cache(b Bucket, prefix string) task.CacheBackend {
+	return bucketCache{b: b, prefix: prefix}
+}
+
+type bucketCache struct {
+	b      Bucket
+	prefix string
+}
+
+func (c bucketCache) Get(ctx context.Context, key string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := c.b.Get(ctx, c.prefix+key, buf)
+	var oerr *Error
+	if errors.As(err, &oerr) && oerr.StatusCode == http.StatusNotFound {
+		return nil, task.ErrCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c bucketCache) Put(ctx context.Context, key string, data []byte) error {
+	return c.b.Put(ctx, c.prefix+key, bytes.NewReader(data), int64(len(data)))
+}
@@ -0,0 +1,142 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package taskobj has actions to upload, download, and list objects in
+// S3 compatible and GCS buckets.
+//
+// File names and keys may be of type task.VAR or string and are expanded
+// with task.ExpandEnv.
+package taskobj
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kardianos/task"
+)
+
+// Object describes a stored object.
+type Object struct {
+	Key      string
+	Size     int64
+	ETag     string
+	Modified time.Time
+	URL      string
+}
+
+// Bucket is an object store bucket.
+type Bucket interface {
+	Put(ctx context.Context, key string, r io.ReaderAt, size int64) error
+	Get(ctx context.Context, key string, w io.Writer) error
+	List(ctx context.Context, prefix string) ([]Object, error)
+	URL(key string) string
+}
+
+// expand returns the file name, relative to State.Dir, and the key.
+func expand(st *task.State, filename, key any) (string, string, error) {
+	fn, err := task.ExpandEnvErr(filename, st)
+	if err != nil {
+		return "", "", err
+	}
+	k, err := task.ExpandEnvErr(key, st)
+	if err != nil {
+		return "", "", err
+	}
+	return st.Filepath(fn), k, nil
+}
+
+// Upload the file to the bucket as key. If urlVar is not empty, the object
+// URL is stored in it.
+func Upload(b Bucket, filename, key any, urlVar string) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		fn, k, err := expand(st, filename, key)
+		if err != nil {
+			return err
+		}
+		if task.DryRunf(st, "upload: %s -> %s", fn, b.URL(k)) {
+			return nil
+		}
+		f, err := st.FileSystem().OpenFile(fn, os.O_RDONLY, 0)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		// Files of an FS other than the OS may not support ReadAt.
+		r, ok := f.(io.ReaderAt)
+		if !ok {
+			body, err := io.ReadAll(f)
+			if err != nil {
+				return err
+			}
+			r = bytes.NewReader(body)
+		}
+		err = b.Put(ctx, k, r, fi.Size())
+		if err != nil {
+			return err
+		}
+		if len(urlVar) > 0 {
+			st.Set(urlVar, b.URL(k))
+		}
+		return nil
+	})
+}
+
+// Download the object key from the bucket to the file. A download that
+// fails validation removes the file.
+func Download(b Bucket, key, filename any) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		fn, k, err := expand(st, filename, key)
+		if err != nil {
+			return err
+		}
+		if task.DryRunf(st, "download: %s -> %s", b.URL(k), fn) {
+			return nil
+		}
+		fsys := st.FileSystem()
+		err = fsys.MkdirAll(filepath.Dir(fn), 0700)
+		if err != nil {
+			return err
+		}
+		f, err := fsys.OpenFile(fn, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+		if err != nil {
+			return err
+		}
+		p := st.StartProgress("download "+k, 0)
+		err = b.Get(ctx, k, io.MultiWriter(f, p))
+		p.Done(err)
+		cerr := f.Close()
+		if err == nil {
+			err = cerr
+		}
+		if err != nil {
+			fsys.RemoveAll(fn)
+			return err
+		}
+		return nil
+	})
+}
+
+// List stores the []Object with the key prefix in the State variable out.
+func List(b Bucket, prefix any, out string) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		p, err := task.ExpandEnvErr(prefix, st)
+		if err != nil {
+			return err
+		}
+		list, err := b.List(ctx, p)
+		if err != nil {
+			return err
+		}
+		st.Set(out, list)
+		return nil
+	})
+}
@@ -0,0 +1,373 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package taskobj
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TokenProvider returns an OAuth2 access token, used for GCS.
+type TokenProvider interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// TokenFunc is a function TokenProvider.
+type TokenFunc func(ctx context.Context) (string, error)
+
+// Token calls f.
+func (f TokenFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// S3 is a bucket of an S3 compatible object store. Objects are addressed
+// with path style URLs, "endpoint/bucket/key".
+type S3 struct {
+	Endpoint string // Such as "https://s3.us-east-1.amazonaws.com".
+	Region   string // Signing region, defaults to "us-east-1".
+	Bucket   string
+
+	// Requests are signed with Credentials, or if Token is set, sent with
+	// the token as a bearer token.
+	Credentials CredentialsProvider
+	Token       TokenProvider
+
+	// Files larger then PartSize are uploaded in parts of PartSize,
+	// defaults to 16 MiB. Parts are held in memory while uploading.
+	PartSize int64
+
+	Client *http.Client // Defaults to http.DefaultClient.
+}
+
+// GCS returns a Google Cloud Storage bucket that uses the interoperable
+// XML API. Use either token for OAuth2 access, or HMAC keys as credentials.
+func GCS(bucket string, token TokenProvider, credentials CredentialsProvider) *S3 {
+	return &S3{
+		Endpoint:    "https://storage.googleapis.com",
+		Region:      "auto",
+		Bucket:      bucket,
+		Token:       token,
+		Credentials: credentials,
+	}
+}
+
+// Error is an error response from the object store.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (err *Error) Error() string {
+	if len(err.Code) == 0 {
+		return fmt.Sprintf("object store: %s", http.StatusText(err.StatusCode))
+	}
+	return fmt.Sprintf("object store: %d %s: %s", err.StatusCode, err.Code, err.Message)
+}
+
+// sha256Meta is the metadata header holding the hex sha256 of the object
+// content, used to validate downloads of multipart objects.
+const sha256Meta = "X-Amz-Meta-Sha256"
+
+const defaultPartSize = 16 << 20
+
+// URL of the object.
+func (b *S3) URL(key string) string {
+	return strings.TrimSuffix(b.Endpoint, "/") + "/" + uriEncode(b.Bucket, false) + "/" + uriEncode(key, false)
+}
+
+func (b *S3) do(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := b.URL(key)
+	if len(key) == 0 {
+		u = strings.TrimSuffix(b.Endpoint, "/") + "/" + uriEncode(b.Bucket, false)
+	}
+	if len(query) > 0 {
+		u += "?" + canonicalQuery(query)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	switch {
+	case b.Token != nil:
+		tok, err := b.Token.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+tok)
+	case b.Credentials != nil:
+		c, err := b.Credentials.Credentials(ctx)
+		if err != nil {
+			return nil, err
+		}
+		region := b.Region
+		if len(region) == 0 {
+			region = "us-east-1"
+		}
+		sum := sha256.Sum256(body)
+		signV4(req, c, region, "s3", hex.EncodeToString(sum[:]), time.Now())
+	}
+	client := b.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	serr := &Error{StatusCode: resp.StatusCode}
+	rb, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	xml.Unmarshal(rb, serr)
+	return nil, serr
+}
+
+// UnmarshalXML reads an S3 error document.
+func (err *Error) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var doc struct {
+		Code    string
+		Message string
+	}
+	if derr := d.DecodeElement(&doc, &start); derr != nil {
+		return derr
+	}
+	err.Code, err.Message = doc.Code, doc.Message
+	return nil
+}
+
+func md5Header(b []byte) (string, string) {
+	sum := md5.Sum(b)
+	return base64.StdEncoding.EncodeToString(sum[:]), hex.EncodeToString(sum[:])
+}
+
+// etagMD5 returns the ETag of the response header and if it is the hex MD5
+// of the content. It is only for objects that are unencrypted or encrypted
+// with SSE-S3 and were uploaded in one part; the ETag of SSE-KMS and SSE-C
+// objects is not their MD5.
+func etagMD5(h http.Header) (string, bool) {
+	switch h.Get("X-Amz-Server-Side-Encryption") {
+	default:
+		return "", false
+	case "", "AES256":
+	}
+	if len(h.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm")) > 0 {
+		return "", false
+	}
+	etag := strings.Trim(h.Get("Etag"), `"`)
+	return etag, len(etag) == 32
+}
+
+// Put uploads size bytes from r as the object key. Each request carries
+// the content MD5 which the store validates. The returned ETag is also
+// compared to it when it is the MD5 of the content.
+func (b *S3) Put(ctx context.Context, key string, r io.ReaderAt, size int64) error {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(r, 0, size)); err != nil {
+		return err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	partSize := b.PartSize
+	if partSize <= 0 {
+		partSize = defaultPartSize
+	}
+	if size <= partSize {
+		body := make([]byte, size)
+		if _, err := r.ReadAt(body, 0); err != nil && err != io.EOF {
+			return err
+		}
+		md5b64, md5hex := md5Header(body)
+		header := http.Header{}
+		header.Set("Content-Md5", md5b64)
+		header.Set(sha256Meta, sum)
+		resp, err := b.do(ctx, http.MethodPut, key, nil, header, body)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if etag, ok := etagMD5(resp.Header); ok && etag != md5hex {
+			return fmt.Errorf("put %s: checksum mismatch: etag %s, want %s", key, etag, md5hex)
+		}
+		return nil
+	}
+	return b.putMultipart(ctx, key, r, size, partSize, sum)
+}
+
+func (b *S3) putMultipart(ctx context.Context, key string, r io.ReaderAt, size, partSize int64, sum string) error {
+	header := http.Header{}
+	header.Set(sha256Meta, sum)
+	resp, err := b.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, header, nil)
+	if err != nil {
+		return err
+	}
+	var initResult struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&initResult)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("put %s: %w", key, err)
+	}
+	uploadID := initResult.UploadID
+
+	type part struct {
+		PartNumber int
+		ETag       string
+	}
+	var complete struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []part   `xml:"Part"`
+	}
+	err = func() error {
+		buf := make([]byte, partSize)
+		for off, n := int64(0), 1; off < size; off, n = off+partSize, n+1 {
+			body := buf[:min(partSize, size-off)]
+			if _, err := r.ReadAt(body, off); err != nil && err != io.EOF {
+				return err
+			}
+			md5b64, md5hex := md5Header(body)
+			header := http.Header{}
+			header.Set("Content-Md5", md5b64)
+			q := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {uploadID}}
+			resp, err := b.do(ctx, http.MethodPut, key, q, header, body)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			if got, ok := etagMD5(resp.Header); ok && got != md5hex {
+				return fmt.Errorf("put %s part %d: checksum mismatch: etag %s, want %s", key, n, got, md5hex)
+			}
+			complete.Parts = append(complete.Parts, part{PartNumber: n, ETag: resp.Header.Get("Etag")})
+		}
+		body, err := xml.Marshal(complete)
+		if err != nil {
+			return err
+		}
+		resp, err := b.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, nil, body)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		// Complete may fail after a 200 status, reported in the body.
+		rb, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(rb, []byte("<Error>")) {
+			serr := &Error{StatusCode: resp.StatusCode}
+			xml.Unmarshal(rb, serr)
+			return serr
+		}
+		return nil
+	}()
+	if err != nil {
+		if resp, aerr := b.do(context.Background(), http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil); aerr == nil {
+			resp.Body.Close()
+		}
+		return fmt.Errorf("put %s: %w", key, err)
+	}
+	return nil
+}
+
+// Get downloads the object key into w. The content is validated against
+// the stored sha256 metadata, or the ETag if it is the MD5 of the content.
+// The content is fully written to w before it is validated.
+func (b *S3) Get(ctx context.Context, key string, w io.Writer) error {
+	resp, err := b.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var h hash.Hash
+	var want string
+	etag, etagOK := etagMD5(resp.Header)
+	switch {
+	case len(resp.Header.Get(sha256Meta)) > 0:
+		h, want = sha256.New(), resp.Header.Get(sha256Meta)
+	case etagOK:
+		h, want = md5.New(), etag
+	}
+	if h != nil {
+		w = io.MultiWriter(w, h)
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return err
+	}
+	if h == nil {
+		return nil
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != strings.ToLower(want) {
+		return fmt.Errorf("get %s: checksum mismatch: got %s, want %s", key, got, want)
+	}
+	return nil
+}
+
+// List the objects with the key prefix.
+func (b *S3) List(ctx context.Context, prefix string) ([]Object, error) {
+	var list []Object
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if len(token) > 0 {
+			q.Set("continuation-token", token)
+		}
+		resp, err := b.do(ctx, http.MethodGet, "", q, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Contents []struct {
+				Key          string
+				Size         int64
+				ETag         string
+				LastModified time.Time
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range result.Contents {
+			list = append(list, Object{
+				Key:      c.Key,
+				Size:     c.Size,
+				ETag:     strings.Trim(c.ETag, `"`),
+				Modified: c.LastModified,
+				URL:      b.URL(c.Key),
+			})
+		}
+		if !result.IsTruncated {
+			return list, nil
+		}
+		if len(result.NextContinuationToken) == 0 {
+			return nil, errors.New("list: truncated result without continuation token")
+		}
+		token = result.NextContinuationToken
+	}
+}
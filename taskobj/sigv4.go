@@ -0,0 +1,169 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package taskobj
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Credentials are S3 access keys.
+type Credentials struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string // Optional temporary session token.
+}
+
+// CredentialsProvider returns the credentials to sign a request with.
+// It is called for each request, so it may refresh expiring credentials.
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// CredentialsFunc is a function CredentialsProvider.
+type CredentialsFunc func(ctx context.Context) (Credentials, error)
+
+// Credentials calls f.
+func (f CredentialsFunc) Credentials(ctx context.Context) (Credentials, error) {
+	return f(ctx)
+}
+
+// StaticCredentials always returns the same credentials.
+func StaticCredentials(accessKey, secretKey, sessionToken string) CredentialsProvider {
+	return CredentialsFunc(func(ctx context.Context) (Credentials, error) {
+		return Credentials{AccessKey: accessKey, SecretKey: secretKey, SessionToken: sessionToken}, nil
+	})
+}
+
+// EnvCredentials reads AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and
+// AWS_SESSION_TOKEN from env, such as State.Env.
+func EnvCredentials(env map[string]string) CredentialsProvider {
+	return CredentialsFunc(func(ctx context.Context) (Credentials, error) {
+		c := Credentials{
+			AccessKey:    env["AWS_ACCESS_KEY_ID"],
+			SecretKey:    env["AWS_SECRET_ACCESS_KEY"],
+			SessionToken: env["AWS_SESSION_TOKEN"],
+		}
+		if len(c.AccessKey) == 0 || len(c.SecretKey) == 0 {
+			return c, errors.New("missing AWS_ACCESS_KEY_ID or AWS_SECRET_ACCESS_KEY")
+		}
+		return c, nil
+	})
+}
+
+// emptyHash is the hex sha256 of no content.
+const emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// SignV4 signs the request for the AWS service, such as "s3" or
+// "secretsmanager", with AWS Signature Version 4. The body is the request
+// payload. The host, range, content-md5, content-type and x-amz-* headers
+// are signed, so they must be set before.
+func SignV4(req *http.Request, c Credentials, region, service string, body []byte) {
+	sum := sha256.Sum256(body)
+	signV4(req, c, region, service, hex.EncodeToString(sum[:]), time.Now())
+}
+
+// signV4 signs the request with AWS Signature Version 4.
+func signV4(req *http.Request, c Credentials, region, service, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if len(c.SessionToken) > 0 {
+		req.Header.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		switch {
+		case strings.HasPrefix(lk, "x-amz-"), lk == "range", lk == "content-md5", lk == "content-type":
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	canonHeaders := &strings.Builder{}
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canon := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		canonHeaders.String(),
+		signed,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	canonSum := sha256.Sum256([]byte(canon))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonSum[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.SecretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+c.AccessKey+"/"+scope+", SignedHeaders="+signed+", Signature="+sig)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var list []string
+	for _, k := range keys {
+		values := q[k]
+		sort.Strings(values)
+		for _, v := range values {
+			list = append(list, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(list, "&")
+}
+
+// uriEncode percent encodes s except for unreserved characters, and
+// slashes if encodeSlash is false.
+func uriEncode(s string, encodeSlash bool) string {
+	const hexChars = "0123456789ABCDEF"
+	b := &strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexChars[c>>4])
+			b.WriteByte(hexChars[c&15])
+		}
+	}
+	return b.String()
+}
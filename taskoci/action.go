@@ -0,0 +1,165 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package taskoci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kardianos/task"
+)
+
+// PushOptions configure Push.
+type PushOptions struct {
+	ArtifactType string            // Artifact type of the manifest, such as "application/vnd.example.plugin".
+	MediaType    string            // Media type of each file, defaults to MediaTypeFile.
+	Annotations  map[string]string // Manifest annotations, values are expanded.
+	DigestVar    string            // State variable to store the manifest digest in.
+}
+
+// Push the files as an artifact to ref, such as "org/plugin:v1.0.0".
+// Each file is a layer annotated with its base name.
+func Push(r *Remote, ref any, files []any, opts PushOptions) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		sref, err := task.ExpandEnvErr(ref, st)
+		if err != nil {
+			return err
+		}
+		name, tag, err := parseRef(sref)
+		if err != nil {
+			return err
+		}
+		fns := make([]string, len(files))
+		for i, f := range files {
+			fn, err := task.ExpandEnvErr(f, st)
+			if err != nil {
+				return err
+			}
+			fns[i] = st.Filepath(fn)
+		}
+		if task.DryRun(st) {
+			if st.Stdout != nil {
+				fmt.Fprintf(st.Stdout, "push: %s -> %s/%s\n", strings.Join(fns, " "), r.Host, sref)
+			}
+			return nil
+		}
+		mediaType := opts.MediaType
+		if len(mediaType) == 0 {
+			mediaType = MediaTypeFile
+		}
+		m := Manifest{
+			SchemaVersion: 2,
+			MediaType:     MediaTypeManifest,
+			ArtifactType:  opts.ArtifactType,
+		}
+		empty := []byte("{}")
+		dig, err := r.pushBlob(ctx, name, empty)
+		if err != nil {
+			return err
+		}
+		m.Config = Descriptor{MediaType: MediaTypeEmpty, Digest: dig, Size: int64(len(empty))}
+		for _, fn := range fns {
+			b, err := os.ReadFile(fn)
+			if err != nil {
+				return err
+			}
+			dig, err := r.pushBlob(ctx, name, b)
+			if err != nil {
+				return fmt.Errorf("push %s: %w", fn, err)
+			}
+			m.Layers = append(m.Layers, Descriptor{
+				MediaType:   mediaType,
+				Digest:      dig,
+				Size:        int64(len(b)),
+				Annotations: map[string]string{AnnotationTitle: filepath.Base(fn)},
+			})
+		}
+		if len(opts.Annotations) > 0 {
+			m.Annotations = make(map[string]string, len(opts.Annotations))
+			for k, v := range opts.Annotations {
+				m.Annotations[k], err = task.ExpandEnvErr(v, st)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		mb, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		header := http.Header{"Content-Type": {MediaTypeManifest}}
+		resp, err := r.do(ctx, name, http.MethodPut, r.url(name, "/manifests/"+tag), header, mb)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if len(opts.DigestVar) > 0 {
+			st.Set(opts.DigestVar, digestOf(mb))
+		}
+		return nil
+	})
+}
+
+// Pull the artifact ref into dir, writing each layer with a title
+// annotation to a file of that name. Layer digests are verified.
+func Pull(r *Remote, ref, dir any) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		sref, err := task.ExpandEnvErr(ref, st)
+		if err != nil {
+			return err
+		}
+		name, tag, err := parseRef(sref)
+		if err != nil {
+			return err
+		}
+		out, err := task.ExpandEnvErr(dir, st)
+		if err != nil {
+			return err
+		}
+		out = st.Filepath(out)
+		if task.DryRun(st) {
+			if st.Stdout != nil {
+				fmt.Fprintf(st.Stdout, "pull: %s/%s -> %s\n", r.Host, sref, out)
+			}
+			return nil
+		}
+		header := http.Header{"Accept": {MediaTypeManifest}}
+		resp, err := r.do(ctx, name, http.MethodGet, r.url(name, "/manifests/"+tag), header, nil)
+		if err != nil {
+			return err
+		}
+		var m Manifest
+		err = json.NewDecoder(resp.Body).Decode(&m)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(out, 0700); err != nil {
+			return err
+		}
+		for _, l := range m.Layers {
+			title := l.Annotations[AnnotationTitle]
+			if len(title) == 0 {
+				continue
+			}
+			if title != filepath.Base(title) || title == ".." {
+				return fmt.Errorf("pull %s: invalid file name %q", sref, title)
+			}
+			b, err := r.pullBlob(ctx, name, l.Digest)
+			if err != nil {
+				return fmt.Errorf("pull %s: %w", title, err)
+			}
+			if err := os.WriteFile(filepath.Join(out, title), b, 0600); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,271 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package taskoci has actions to push and pull files as OCI artifacts
+// to and from a container registry.
+//
+// Files are stored as layers annotated with their file name, compatible
+// with ORAS. References and file names may be of type task.VAR or string
+// and are expanded with task.ExpandEnv.
+package taskoci
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Media types used for artifacts.
+const (
+	MediaTypeManifest = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeEmpty    = "application/vnd.oci.empty.v1+json"
+	MediaTypeFile     = "application/octet-stream"
+)
+
+// AnnotationTitle holds the file name of a layer.
+const AnnotationTitle = "org.opencontainers.image.title"
+
+// Descriptor describes content in the registry.
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Manifest is an OCI image manifest.
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// Remote is a container registry.
+type Remote struct {
+	Host      string // Registry host, such as "ghcr.io".
+	Username  string
+	Password  string
+	PlainHTTP bool         // Use http rather then https, for local registries.
+	Client    *http.Client // Defaults to http.DefaultClient.
+
+	mu     sync.Mutex
+	tokens map[string]string // Bearer tokens by scope.
+}
+
+// Error is an error response from the registry.
+type Error struct {
+	StatusCode int
+	Errors     []struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func (err *Error) Error() string {
+	if len(err.Errors) == 0 {
+		return fmt.Sprintf("registry: %s", http.StatusText(err.StatusCode))
+	}
+	var list []string
+	for _, e := range err.Errors {
+		list = append(list, e.Code+": "+e.Message)
+	}
+	return fmt.Sprintf("registry: %d %s", err.StatusCode, strings.Join(list, "; "))
+}
+
+// parseRef splits "name:tag" or "name@digest" into the repository name
+// and reference. The tag defaults to "latest".
+func parseRef(ref string) (string, string, error) {
+	if name, dig, ok := strings.Cut(ref, "@"); ok {
+		return name, dig, nil
+	}
+	name, tag := ref, "latest"
+	if i := strings.LastIndexByte(ref, ':'); i > strings.LastIndexByte(ref, '/') {
+		name, tag = ref[:i], ref[i+1:]
+	}
+	if len(name) == 0 || len(tag) == 0 {
+		return "", "", fmt.Errorf("invalid reference %q", ref)
+	}
+	return name, tag, nil
+}
+
+func digestOf(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func (r *Remote) url(name, p string) string {
+	scheme := "https"
+	if r.PlainHTTP {
+		scheme = "http"
+	}
+	return scheme + "://" + r.Host + "/v2/" + name + p
+}
+
+// do sends the request, answering a token or basic auth challenge once.
+func (r *Remote) do(ctx context.Context, name, method, u string, header http.Header, body []byte) (*http.Response, error) {
+	scope := "repository:" + name + ":pull"
+	if method != http.MethodGet && method != http.MethodHead {
+		scope += ",push"
+	}
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	send := func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		r.mu.Lock()
+		tok := r.tokens[scope]
+		r.mu.Unlock()
+		switch {
+		case len(tok) > 0:
+			req.Header.Set("Authorization", "Bearer "+tok)
+		case len(r.Username) > 0:
+			req.SetBasicAuth(r.Username, r.Password)
+		}
+		return client.Do(req)
+	}
+	resp, err := send()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("Www-Authenticate")
+		resp.Body.Close()
+		if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+			return nil, &Error{StatusCode: http.StatusUnauthorized}
+		}
+		if err := r.fetchToken(ctx, challenge, scope); err != nil {
+			return nil, err
+		}
+		resp, err = send()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	rerr := &Error{StatusCode: resp.StatusCode}
+	json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(rerr)
+	return nil, rerr
+}
+
+// fetchToken gets a bearer token for scope from the challenge realm.
+func (r *Remote) fetchToken(ctx context.Context, challenge, scope string) error {
+	params := make(map[string]string)
+	for _, p := range strings.Split(challenge[len("bearer "):], ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+		params[strings.ToLower(k)] = strings.Trim(v, `"`)
+	}
+	realm := params["realm"]
+	if len(realm) == 0 {
+		return errors.New("registry: auth challenge missing realm")
+	}
+	q := url.Values{"scope": {scope}}
+	if s := params["service"]; len(s) > 0 {
+		q.Set("service", s)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm+"?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if len(r.Username) > 0 {
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(r.Username+":"+r.Password)))
+	}
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry: token request: %s", resp.Status)
+	}
+	var tr struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return err
+	}
+	tok := tr.Token
+	if len(tok) == 0 {
+		tok = tr.AccessToken
+	}
+	r.mu.Lock()
+	if r.tokens == nil {
+		r.tokens = make(map[string]string)
+	}
+	r.tokens[scope] = tok
+	r.mu.Unlock()
+	return nil
+}
+
+// pushBlob uploads the blob unless the registry already has it.
+func (r *Remote) pushBlob(ctx context.Context, name string, b []byte) (string, error) {
+	dig := digestOf(b)
+	if resp, err := r.do(ctx, name, http.MethodHead, r.url(name, "/blobs/"+dig), nil, nil); err == nil {
+		resp.Body.Close()
+		return dig, nil
+	}
+	resp, err := r.do(ctx, name, http.MethodPost, r.url(name, "/blobs/uploads/"), nil, nil)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	loc, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return "", err
+	}
+	q := loc.Query()
+	q.Set("digest", dig)
+	loc.RawQuery = q.Encode()
+	header := http.Header{"Content-Type": {"application/octet-stream"}}
+	resp, err = r.do(ctx, name, http.MethodPut, loc.String(), header, b)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return dig, nil
+}
+
+// pullBlob downloads the blob and verifies its digest.
+func (r *Remote) pullBlob(ctx context.Context, name, dig string) ([]byte, error) {
+	resp, err := r.do(ctx, name, http.MethodGet, r.url(name, "/blobs/"+dig), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if got := digestOf(b); got != dig {
+		return nil, fmt.Errorf("blob digest mismatch: got %s, want %s", got, dig)
+	}
+	return b, nil
+}
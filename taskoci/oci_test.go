@@ -0,0 +1,145 @@
+package taskoci
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kardianos/task"
+)
+
+func TestParseRef(t *testing.T) {
+	list := []struct {
+		Ref, Name, Tag string
+	}{
+		{"org/plugin:v1", "org/plugin", "v1"},
+		{"org/plugin", "org/plugin", "latest"},
+		{"org/plugin@sha256:abc", "org/plugin", "sha256:abc"},
+	}
+	for _, item := range list {
+		name, tag, err := parseRef(item.Ref)
+		if err != nil || name != item.Name || tag != item.Tag {
+			t.Errorf("%s: got %q %q %v", item.Ref, name, tag, err)
+		}
+	}
+}
+
+// fakeRegistry is an in-memory registry that requires a bearer token.
+type fakeRegistry struct {
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	realm     string
+}
+
+func (reg *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if r.URL.Path == "/token" {
+		if u, p, _ := r.BasicAuth(); u != "user" || p != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"token": "tok-" + r.URL.Query().Get("scope")})
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer tok-") {
+		w.Header().Set("Www-Authenticate", `Bearer realm="`+reg.realm+`",service="test"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	p := strings.TrimPrefix(r.URL.Path, "/v2/")
+	body, _ := io.ReadAll(r.Body)
+	switch {
+	case strings.Contains(p, "/blobs/uploads/") && r.Method == "POST":
+		w.Header().Set("Location", "/v2/upload/1")
+		w.WriteHeader(http.StatusAccepted)
+	case strings.HasPrefix(p, "upload/") && r.Method == "PUT":
+		reg.blobs[r.URL.Query().Get("digest")] = body
+		w.WriteHeader(http.StatusCreated)
+	case strings.Contains(p, "/blobs/"):
+		_, dig, _ := strings.Cut(p, "/blobs/")
+		b, ok := reg.blobs[dig]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(b)
+	case strings.Contains(p, "/manifests/") && r.Method == "PUT":
+		reg.manifests[p] = body
+		w.WriteHeader(http.StatusCreated)
+	case strings.Contains(p, "/manifests/"):
+		b, ok := reg.manifests[p]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]any{"errors": []map[string]string{{"code": "MANIFEST_UNKNOWN", "message": "not found"}}})
+			return
+		}
+		w.Write(b)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestPushPull(t *testing.T) {
+	reg := &fakeRegistry{
+		blobs:     make(map[string][]byte),
+		manifests: make(map[string][]byte),
+	}
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+	reg.realm = srv.URL + "/token"
+
+	r := &Remote{
+		Host:      strings.TrimPrefix(srv.URL, "http://"),
+		Username:  "user",
+		Password:  "pass",
+		PlainHTTP: true,
+	}
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "plugin"), []byte("binary"), 0600)
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("readme"), 0600)
+
+	st := &task.State{Dir: dir}
+	st.Set("version", "v1.0.0")
+	err := task.Run(context.Background(), st, task.NewScript(
+		Push(r, "org/plugin:${version}", []any{"plugin", "README.md"}, PushOptions{
+			ArtifactType: "application/vnd.example.plugin",
+			Annotations:  map[string]string{"org.opencontainers.image.version": "${version}"},
+			DigestVar:    "digest",
+		}),
+		Pull(r, "org/plugin:v1.0.0", "out"),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(reg.manifests["org/plugin/manifests/v1.0.0"], &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.ArtifactType != "application/vnd.example.plugin" || m.Annotations["org.opencontainers.image.version"] != "v1.0.0" || len(m.Layers) != 2 {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+	if dig, _ := st.Get("digest").(string); !strings.HasPrefix(dig, "sha256:") {
+		t.Fatalf("missing digest, got %q", dig)
+	}
+	for name, want := range map[string]string{"plugin": "binary", "README.md": "readme"} {
+		b, err := os.ReadFile(filepath.Join(dir, "out", name))
+		if err != nil || string(b) != want {
+			t.Fatalf("%s: got %q, %v", name, b, err)
+		}
+	}
+
+	err = task.Run(context.Background(), st, Pull(r, "org/plugin:nope", "out"))
+	if err == nil || !strings.Contains(err.Error(), "MANIFEST_UNKNOWN") {
+		t.Fatalf("expected unknown manifest error, got %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package taskproto
+
+import (
+	"context"
+	"strings"
+
+	"github.com/kardianos/task"
+)
+
+// GenerateOptions configure Generate. Paths and globs are relative to
+// State.Dir, and string values are expanded with task.ExpandEnv.
+type GenerateOptions struct {
+	Protoc  *Tool   // Defaults to protoc from PATH.
+	Plugins []*Tool // Plugins, named "protoc-gen-NAME".
+
+	Includes []string // Import paths, passed as -I.
+	Sources  []string // Globs of the .proto files to generate.
+	Args     []string // Generator flags, such as "--go_out=gen".
+
+	// Outputs are globs of the generated files. If Cache is nil, the
+	// generation is skipped when every output is newer than the sources.
+	Outputs []string
+
+	// If Cache is set, the generation is skipped when the outputs exist
+	// and the sources, tool versions, and arguments are unchanged.
+	Cache *task.FingerprintStore
+}
+
+// Generate runs protoc on the source files.
+func Generate(opts GenerateOptions) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		var err error
+		expand := func(list []string) []string {
+			out := make([]string, len(list))
+			for i, s := range list {
+				if err != nil {
+					return nil
+				}
+				out[i], err = task.ExpandEnvErr(s, st)
+			}
+			return out
+		}
+		sources, outputs := expand(opts.Sources), expand(opts.Outputs)
+		includes, extra := expand(opts.Includes), expand(opts.Args)
+		if err != nil {
+			return err
+		}
+
+		var files []string
+		for _, pattern := range sources {
+			list, err := task.Glob(st.Dir, pattern)
+			if err != nil {
+				return err
+			}
+			files = append(files, list...)
+		}
+		args := []string{}
+		for _, inc := range includes {
+			args = append(args, "-I", inc)
+		}
+		args = append(args, extra...)
+
+		protoc := opts.Protoc
+		if protoc == nil {
+			protoc = &Tool{Name: "protoc"}
+		}
+		tools := append([]*Tool{protoc}, opts.Plugins...)
+
+		var key, sum string
+		switch {
+		case task.DryRun(st):
+		case opts.Cache != nil:
+			values := append([]string{}, args...)
+			for _, t := range tools {
+				values = append(values, t.Name, t.Version)
+			}
+			key = "protoc " + strings.Join(sources, " ")
+			sum, err = task.Fingerprint(st.Dir, sources, values...)
+			if err != nil {
+				return err
+			}
+			if ok, _ := outputsExist(st, outputs); ok && opts.Cache.Get(key) == sum {
+				st.Logf("%s is up to date", key)
+				return nil
+			}
+		case len(outputs) > 0:
+			ok, err := task.SourcesUpToDate(st.Dir, sources, outputs)
+			if err != nil {
+				return err
+			}
+			if ok {
+				st.Logf("protoc %s is up to date", strings.Join(sources, " "))
+				return nil
+			}
+		}
+
+		var protocPath string
+		if task.DryRun(st) {
+			protocPath = protoc.Name
+		} else {
+			for i, t := range tools {
+				p, err := t.Locate(ctx, st)
+				if err != nil {
+					return err
+				}
+				if i == 0 {
+					protocPath = p
+					continue
+				}
+				args = append(args, "--plugin="+t.Name+"="+p)
+			}
+		}
+		// The arguments are expanded, so Exec must not expand them again.
+		execArgs := make([]any, 0, len(args)+len(files))
+		for _, a := range args {
+			execArgs = append(execArgs, task.Literal(a))
+		}
+		for _, f := range files {
+			execArgs = append(execArgs, task.Literal(f))
+		}
+		if err := sc.RunAction(ctx, st, task.Exec(protocPath, execArgs...)); err != nil {
+			return err
+		}
+		if len(sum) > 0 {
+			return opts.Cache.Set(key, sum)
+		}
+		return nil
+	})
+}
+
+// outputsExist reports if every output glob matches a file.
+func outputsExist(st *task.State, outputs []string) (bool, error) {
+	for _, pattern := range outputs {
+		list, err := task.Glob(st.Dir, pattern)
+		if err != nil || len(list) == 0 {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,117 @@
+package taskproto
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kardianos/task"
+)
+
+// fakeProtoc logs its arguments to $LOG and writes NAME.pb.go to the
+// --go_out directory for each NAME.proto argument.
+const fakeProtoc = `#!/bin/sh
+echo "$@" >> "$LOG"
+out=.
+for a in "$@"; do
+	case "$a" in
+	--go_out=*) out="${a#--go_out=}";;
+	*.proto) n=$(basename "$a" .proto); echo gen > "$out/$n.pb.go";;
+	esac
+done
+`
+
+func TestGenerate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	srv, _ := toolServer(t, map[string][]byte{
+		"/protoc.zip":    zipFile(t, "bin/protoc", []byte(fakeProtoc)),
+		"/protoc-gen-go": []byte("#!/bin/sh\n"),
+	})
+	dir := t.TempDir()
+	for _, d := range []string{"proto", "gen"} {
+		if err := os.Mkdir(filepath.Join(dir, d), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"a.proto", "b.proto"} {
+		if err := os.WriteFile(filepath.Join(dir, "proto", name), []byte("syntax = \"proto3\";"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	logFile := filepath.Join(t.TempDir(), "log")
+	env := task.Environ()
+	env["LOG"] = logFile
+	st := &task.State{Dir: dir, Env: env}
+	cache, err := task.OpenFingerprintStore(filepath.Join(t.TempDir(), "fp.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := func(cache *task.FingerprintStore) task.Action {
+		return Generate(GenerateOptions{
+			Protoc:   &Tool{Name: "protoc", Version: "25.1", URL: srv.URL + "/protoc.zip", Path: "bin/protoc"},
+			Plugins:  []*Tool{{Name: "protoc-gen-go", Version: "1.31", URL: srv.URL + "/protoc-gen-go"}},
+			Includes: []string{"proto"},
+			Sources:  []string{"proto/*.proto"},
+			Args:     []string{"--go_out=gen"},
+			Outputs:  []string{"gen/*.pb.go"},
+			Cache:    cache,
+		})
+	}
+	calls := func() []string {
+		b, _ := os.ReadFile(logFile)
+		return strings.Split(strings.TrimSpace(string(b)), "\n")
+	}
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := task.Run(ctx, st, gen(cache)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := calls()
+	if len(got) != 1 {
+		t.Fatalf("got %d protoc runs, want 1: %q", len(got), got)
+	}
+	if !strings.HasPrefix(got[0], "-I proto --go_out=gen --plugin=protoc-gen-go=") || !strings.HasSuffix(got[0], " proto/a.proto proto/b.proto") {
+		t.Fatalf("got args %q", got[0])
+	}
+	for _, name := range []string{"a.pb.go", "b.pb.go"} {
+		if _, err := os.Stat(filepath.Join(dir, "gen", name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Without a cache the file times are compared.
+	if err := task.Run(ctx, st, gen(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(calls()); n != 1 {
+		t.Fatalf("got %d protoc runs, want 1", n)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "proto", "a.proto"), future, future); err != nil {
+		t.Fatal(err)
+	}
+	if err := task.Run(ctx, st, gen(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(calls()); n != 2 {
+		t.Fatalf("got %d protoc runs, want 2", n)
+	}
+
+	// A source change runs protoc again with the cache.
+	if err := os.WriteFile(filepath.Join(dir, "proto", "a.proto"), []byte("syntax = \"proto2\";"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := task.Run(ctx, st, gen(cache)); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(calls()); n != 3 {
+		t.Fatalf("got %d protoc runs, want 3", n)
+	}
+}
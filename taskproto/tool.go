@@ -0,0 +1,248 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package taskproto runs protoc code generation with pinned versions of
+// protoc and its plugins, skipping generation when the inputs are unchanged.
+package taskproto
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/kardianos/task"
+)
+
+// CacheDir is the directory tools are downloaded to. If empty, a
+// "kardianos-task/tools" directory in os.UserCacheDir is used.
+var CacheDir string
+
+// HTTPClient is used to download tools.
+var HTTPClient = http.DefaultClient
+
+// Tool is a pinned executable. It is found in the cache, then downloaded
+// from URL or installed with GoInstall. If neither is set, it is looked up
+// in PATH.
+type Tool struct {
+	Name    string // Executable name, such as "protoc-gen-go".
+	Version string
+
+	// URL to download the tool from. "${version}", "${os}", and "${arch}"
+	// are replaced with the Version, GOOS, and GOARCH. A ".zip", ".tar.gz",
+	// or ".tgz" URL is extracted, otherwise the download is the executable.
+	URL string
+
+	// Path of the executable in the archive, defaults to Name.
+	Path string
+
+	// Checksums maps "GOOS/GOARCH" to the sha256 hex of the download.
+	// If not nil, a platform without a checksum can not be downloaded.
+	Checksums map[string]string
+
+	// GoInstall is a Go package to install with "go install
+	// GoInstall@Version", such as "google.golang.org/protobuf/cmd/protoc-gen-go".
+	GoInstall string
+}
+
+// Protoc returns the protoc Tool for the version, such as "25.1", downloaded
+// from the protobuf GitHub releases.
+func Protoc(version string, checksums map[string]string) *Tool {
+	platform := map[string]string{
+		"linux/amd64":   "linux-x86_64",
+		"linux/arm64":   "linux-aarch_64",
+		"darwin/amd64":  "osx-x86_64",
+		"darwin/arm64":  "osx-aarch_64",
+		"windows/amd64": "win64",
+		"windows/386":   "win32",
+	}[runtime.GOOS+"/"+runtime.GOARCH]
+	t := &Tool{
+		Name:      "protoc",
+		Version:   version,
+		Path:      "bin/protoc" + exeSuffix(),
+		Checksums: checksums,
+	}
+	if len(platform) > 0 {
+		t.URL = "https://github.com/protocolbuffers/protobuf/releases/download/v${version}/protoc-${version}-" + platform + ".zip"
+	}
+	return t
+}
+
+func exeSuffix() string {
+	if runtime.GOOS == "windows" {
+		return ".exe"
+	}
+	return ""
+}
+
+func toolDir() (string, error) {
+	dir := CacheDir
+	if len(dir) == 0 {
+		ucd, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(ucd, "kardianos-task", "tools")
+	}
+	return dir, nil
+}
+
+// Locate returns the path of the tool executable, downloading or
+// installing it into the cache if needed.
+func (t *Tool) Locate(ctx context.Context, st *task.State) (string, error) {
+	if len(t.URL) == 0 && len(t.GoInstall) == 0 {
+		p, err := exec.LookPath(t.Name)
+		if err != nil {
+			return "", fmt.Errorf("tool %s: %w", t.Name, err)
+		}
+		return p, nil
+	}
+	root, err := toolDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(root, fmt.Sprintf("%s-%s-%s-%s", t.Name, t.Version, runtime.GOOS, runtime.GOARCH))
+	exe := filepath.Join(dir, t.Name+exeSuffix())
+	if _, err := os.Stat(exe); err == nil {
+		return exe, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	if len(t.URL) > 0 {
+		err = t.download(ctx, st, exe)
+	} else {
+		err = t.goInstall(ctx, st, dir)
+	}
+	if err != nil {
+		return "", fmt.Errorf("tool %s %s: %w", t.Name, t.Version, err)
+	}
+	return exe, nil
+}
+
+func (t *Tool) url() string {
+	return strings.NewReplacer("${version}", t.Version, "${os}", runtime.GOOS, "${arch}", runtime.GOARCH).Replace(t.URL)
+}
+
+func (t *Tool) download(ctx context.Context, st *task.State, exe string) error {
+	u := t.url()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("get %s: %s", u, resp.Status)
+	}
+	p := st.StartProgress("download "+t.Name+" "+t.Version, max(resp.ContentLength, 0))
+	b, err := io.ReadAll(io.TeeReader(resp.Body, p))
+	p.Done(err)
+	if err != nil {
+		return err
+	}
+	if t.Checksums != nil {
+		platform := runtime.GOOS + "/" + runtime.GOARCH
+		want := strings.ToLower(strings.TrimPrefix(t.Checksums[platform], "sha256:"))
+		if len(want) == 0 {
+			return fmt.Errorf("no checksum for %s", platform)
+		}
+		sum := sha256.Sum256(b)
+		if got := hex.EncodeToString(sum[:]); got != want {
+			return fmt.Errorf("checksum mismatch: got sha256:%s, want sha256:%s", got, want)
+		}
+	}
+	name := t.Path
+	if len(name) == 0 {
+		name = t.Name + exeSuffix()
+	}
+	switch {
+	default:
+	case strings.HasSuffix(u, ".zip"):
+		b, err = extractZip(b, name)
+	case strings.HasSuffix(u, ".tar.gz"), strings.HasSuffix(u, ".tgz"):
+		b, err = extractTar(b, name)
+	}
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so a partial write is never used.
+	tmp := exe + ".tmp"
+	if err := os.WriteFile(tmp, b, 0700); err != nil {
+		return err
+	}
+	return os.Rename(tmp, exe)
+}
+
+func extractZip(b []byte, name string) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range zr.File {
+		if path.Clean(f.Name) != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	return nil, fmt.Errorf("%s not found in archive", name)
+}
+
+func extractTar(b []byte, name string) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in archive", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if path.Clean(h.Name) == name {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+func (t *Tool) goInstall(ctx context.Context, st *task.State, dir string) error {
+	cmd := exec.CommandContext(ctx, "go", "install", t.GoInstall+"@"+t.Version)
+	cmd.Dir = st.Dir
+	for k, v := range st.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Env = append(cmd.Env, "GOBIN="+dir)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("go install: %w: %s", err, bytes.TrimSpace(out))
+	}
+	exe := filepath.Join(dir, t.Name+exeSuffix())
+	if _, err := os.Stat(exe); err != nil {
+		return fmt.Errorf("go install did not produce %s", filepath.Base(exe))
+	}
+	return nil
+}
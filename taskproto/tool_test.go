@@ -0,0 +1,117 @@
+package taskproto
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/kardianos/task"
+)
+
+func zipFile(t *testing.T, name string, content []byte) []byte {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	w, err := zw.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(content)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarFile(t *testing.T, name string, content []byte) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "./" + name, Mode: 0755, Size: int64(len(content))})
+	tw.Write(content)
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func sha(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// toolServer serves the files by path and counts the requests.
+func toolServer(t *testing.T, files map[string][]byte) (*httptest.Server, *int) {
+	n := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		n++
+		w.Write(b)
+	}))
+	t.Cleanup(srv.Close)
+	old := CacheDir
+	CacheDir = t.TempDir()
+	t.Cleanup(func() {
+		CacheDir = old
+	})
+	return srv, &n
+}
+
+func TestLocate(t *testing.T) {
+	exe := []byte("#!/bin/sh\necho tool\n")
+	zipped := zipFile(t, "bin/tool", exe)
+	tarred := tarFile(t, "tool", exe)
+	srv, n := toolServer(t, map[string][]byte{
+		"/1.0/tool.zip":    zipped,
+		"/2.0/tool.tar.gz": tarred,
+		"/raw/tool":        exe,
+	})
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+	st := &task.State{}
+	ctx := context.Background()
+	for _, tool := range []*Tool{
+		{Name: "tool", Version: "1.0", URL: srv.URL + "/${version}/tool.zip", Path: "bin/tool", Checksums: map[string]string{platform: "sha256:" + sha(zipped)}},
+		{Name: "tool", Version: "2.0", URL: srv.URL + "/${version}/tool.tar.gz"},
+		{Name: "tool", Version: "raw", URL: srv.URL + "/raw/tool"},
+	} {
+		p, err := tool.Locate(ctx, st)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, exe) {
+			t.Fatalf("%s: got %q", tool.Version, b)
+		}
+		// The second call uses the cache.
+		if _, err := tool.Locate(ctx, st); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if *n != 3 {
+		t.Fatalf("got %d downloads, want 3", *n)
+	}
+
+	bad := &Tool{Name: "bad", Version: "1.0", URL: srv.URL + "/1.0/tool.zip", Path: "bin/tool", Checksums: map[string]string{platform: sha(exe)}}
+	if _, err := bad.Locate(ctx, st); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum error, got %v", err)
+	}
+	missing := &Tool{Name: "bad", Version: "2.0", URL: srv.URL + "/1.0/tool.zip", Checksums: map[string]string{}}
+	if _, err := missing.Locate(ctx, st); err == nil || !strings.Contains(err.Error(), "no checksum") {
+		t.Fatalf("expected missing checksum error, got %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tasksecret
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/kardianos/task"
+	"github.com/kardianos/task/taskobj"
+)
+
+// AWSSecretsManager reads secrets from AWS Secrets Manager. A secret name
+// is the secret ID, optionally followed by "#" and a key to read from a
+// JSON secret, such as "prod/db#password".
+type AWSSecretsManager struct {
+	Region string // Defaults to AWS_REGION or AWS_DEFAULT_REGION of the State env.
+
+	// Endpoint defaults to "https://secretsmanager.REGION.amazonaws.com".
+	Endpoint string
+
+	// Credentials default to taskobj.EnvCredentials of the State env.
+	Credentials taskobj.CredentialsProvider
+
+	Client *http.Client
+}
+
+// Secret implements task.SecretProvider.
+func (sm *AWSSecretsManager) Secret(ctx context.Context, st *task.State, name string) (string, error) {
+	region, err := or(sm.Region, "AWS_REGION", st)
+	if err != nil {
+		return "", fmt.Errorf("secrets manager: %w", err)
+	}
+	if len(region) == 0 {
+		region = st.Getenv("AWS_DEFAULT_REGION")
+	}
+	if len(region) == 0 {
+		return "", fmt.Errorf("secrets manager: missing region")
+	}
+	endpoint := sm.Endpoint
+	if len(endpoint) == 0 {
+		endpoint = "https://secretsmanager." + region + ".amazonaws.com"
+	}
+	cp := sm.Credentials
+	if cp == nil {
+		cp = taskobj.EnvCredentials(st.Env)
+	}
+	creds, err := cp.Credentials(ctx)
+	if err != nil {
+		return "", fmt.Errorf("secrets manager: %w", err)
+	}
+
+	id, key, hasKey := strings.Cut(name, "#")
+	body, err := json.Marshal(map[string]string{"SecretId": id})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	taskobj.SignV4(req, creds, region, "secretsmanager", body)
+	client := sm.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("secrets manager: %w", err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("secrets manager: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(b, &e)
+		if strings.HasSuffix(e.Type, "ResourceNotFoundException") {
+			return "", task.ErrSecretNotFound
+		}
+		return "", fmt.Errorf("secrets manager: %s: %s %s", resp.Status, e.Type, e.Message)
+	}
+	var out struct {
+		SecretString string
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return "", fmt.Errorf("secrets manager: %w", err)
+	}
+	if !hasKey {
+		return out.SecretString, nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(out.SecretString), &fields); err != nil {
+		return "", fmt.Errorf("secrets manager: secret %s is not a JSON object: %w", id, err)
+	}
+	v, ok := fields[key]
+	if !ok {
+		return "", task.ErrSecretNotFound
+	}
+	return stringValue(v)
+}
@@ -0,0 +1,101 @@
+package tasksecret
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kardianos/task"
+	"github.com/kardianos/task/taskobj"
+)
+
+func TestVault(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "tok" || r.Header.Get("X-Vault-Namespace") != "team" {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/kv/data/app/db" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"password":"hunter2","port":5432},"metadata":{"version":3}}}`))
+	}))
+	defer srv.Close()
+
+	st := &task.State{Env: map[string]string{"VAULT_ADDR": srv.URL, "VAULT_TOKEN": "tok", "VAULT_NAMESPACE": "team"}}
+	v := &Vault{Mount: "kv"}
+	ctx := context.Background()
+	err := task.Run(ctx, st, task.NewScript(
+		task.UseSecrets(v),
+		task.Secret("app/db/password", task.VAR("pass")),
+		task.Secret("app/db/port", task.VAR("port")),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Get("pass") != "hunter2" || st.Get("port") != "5432" {
+		t.Fatalf("got %v %v", st.Get("pass"), st.Get("port"))
+	}
+	for _, name := range []string{"app/db/user", "app/other/password"} {
+		if _, err := v.Secret(ctx, st, name); !errors.Is(err, task.ErrSecretNotFound) {
+			t.Fatalf("%s: expected not found, got %v", name, err)
+		}
+	}
+	st.Env["VAULT_TOKEN"] = "bad"
+	if _, err := v.Secret(ctx, st, "app/db/password"); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Fatalf("expected permission error, got %v", err)
+	}
+}
+
+func TestAWSSecretsManager(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.Contains(auth, "Credential=AKID/") || !strings.Contains(auth, "/us-west-2/secretsmanager/aws4_request") {
+			http.Error(w, `{"__type":"UnrecognizedClientException"}`, http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" {
+			http.Error(w, `{"__type":"UnknownOperationException"}`, http.StatusBadRequest)
+			return
+		}
+		var in struct{ SecretId string }
+		json.NewDecoder(r.Body).Decode(&in)
+		switch in.SecretId {
+		case "prod/db":
+			json.NewEncoder(w).Encode(map[string]string{"SecretString": `{"username":"app","password":"hunter2"}`})
+		case "prod/token":
+			json.NewEncoder(w).Encode(map[string]string{"SecretString": "tok"})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"com.amazonaws#ResourceNotFoundException","message":"not found"}`))
+		}
+	}))
+	defer srv.Close()
+
+	sm := &AWSSecretsManager{
+		Region:      "us-west-2",
+		Endpoint:    srv.URL,
+		Credentials: taskobj.StaticCredentials("AKID", "SECRET", ""),
+	}
+	st := &task.State{}
+	ctx := context.Background()
+	for name, want := range map[string]string{"prod/db#password": "hunter2", "prod/token": "tok"} {
+		got, err := sm.Secret(ctx, st, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("%s: got %q, want %q", name, got, want)
+		}
+	}
+	for _, name := range []string{"prod/missing", "prod/db#other"} {
+		if _, err := sm.Secret(ctx, st, name); !errors.Is(err, task.ErrSecretNotFound) {
+			t.Fatalf("%s: expected not found, got %v", name, err)
+		}
+	}
+}
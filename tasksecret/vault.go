@@ -0,0 +1,114 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package tasksecret has task.SecretProvider implementations for HashiCorp
+// Vault and AWS Secrets Manager.
+package tasksecret
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/kardianos/task"
+)
+
+// Vault reads secrets from a Vault KV version 2 secrets engine. A secret
+// name is the secret path followed by the key, so "db/password" is the
+// "password" key of the "db" secret.
+type Vault struct {
+	Addr      string // Server address, defaults to VAULT_ADDR of the State env.
+	Token     string // Defaults to VAULT_TOKEN of the State env.
+	Namespace string // Defaults to VAULT_NAMESPACE of the State env.
+	Mount     string // KV mount path, defaults to "secret".
+	Client    *http.Client
+}
+
+func or(v, env string, st *task.State) (string, error) {
+	if len(v) > 0 {
+		return task.ExpandEnvErr(v, st)
+	}
+	return st.Getenv(env), nil
+}
+
+// Secret implements task.SecretProvider.
+func (v *Vault) Secret(ctx context.Context, st *task.State, name string) (string, error) {
+	addr, err := or(v.Addr, "VAULT_ADDR", st)
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	token, err := or(v.Token, "VAULT_TOKEN", st)
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	ns, err := or(v.Namespace, "VAULT_NAMESPACE", st)
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	addr = strings.TrimSuffix(addr, "/")
+	if len(addr) == 0 {
+		return "", fmt.Errorf("vault: missing address")
+	}
+	i := strings.LastIndexByte(name, '/')
+	if i <= 0 {
+		return "", fmt.Errorf("vault: secret name %q must be path/key", name)
+	}
+	path, key := name[:i], name[i+1:]
+	mount := v.Mount
+	if len(mount) == 0 {
+		mount = "secret"
+	}
+	u := addr + "/v1/" + strings.Trim(mount, "/") + "/data/" + (&url.URL{Path: path}).EscapedPath()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if len(ns) > 0 {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", task.ErrSecretNotFound
+	default:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("vault: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var body struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	value, ok := body.Data.Data[key]
+	if !ok {
+		return "", task.ErrSecretNotFound
+	}
+	return stringValue(value)
+}
+
+// stringValue returns a string value as is and other values as JSON.
+func stringValue(v any) (string, error) {
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
@@ -0,0 +1,306 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package tasksemver parses, compares, and bumps semantic versions,
+// with actions that operate on versions stored in State variables.
+package tasksemver
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kardianos/task"
+)
+
+// Version is a semantic version, such as "v1.2.3-rc.1+build.5".
+type Version struct {
+	Prefix string // "v" or empty, kept when formatting.
+	Major  int
+	Minor  int
+	Patch  int
+	Pre    string // Pre-release identifiers, without the "-".
+	Build  string // Build metadata, without the "+".
+}
+
+// Parse a version with an optional "v" prefix. The minor and patch
+// numbers are required.
+func Parse(s string) (Version, error) {
+	var v Version
+	rest := s
+	if strings.HasPrefix(rest, "v") {
+		v.Prefix, rest = "v", rest[1:]
+	}
+	var hasPre, hasBuild bool
+	rest, v.Build, hasBuild = strings.Cut(rest, "+")
+	rest, v.Pre, hasPre = strings.Cut(rest, "-")
+	parts := strings.Split(rest, ".")
+	if len(parts) != 3 {
+		return Version{}, fmt.Errorf("invalid version %q: want MAJOR.MINOR.PATCH", s)
+	}
+	for i, p := range parts {
+		n, err := parseNumber(p)
+		if err != nil {
+			return Version{}, fmt.Errorf("invalid version %q: %w", s, err)
+		}
+		switch i {
+		case 0:
+			v.Major = n
+		case 1:
+			v.Minor = n
+		case 2:
+			v.Patch = n
+		}
+	}
+	if hasPre && len(v.Pre) == 0 {
+		return Version{}, fmt.Errorf("invalid version %q: empty pre-release", s)
+	}
+	if err := checkIdents(v.Pre, true); err != nil {
+		return Version{}, fmt.Errorf("invalid version %q: pre-release %w", s, err)
+	}
+	if hasBuild && len(v.Build) == 0 {
+		return Version{}, fmt.Errorf("invalid version %q: empty build", s)
+	}
+	if err := checkIdents(v.Build, false); err != nil {
+		return Version{}, fmt.Errorf("invalid version %q: build %w", s, err)
+	}
+	return v, nil
+}
+
+// MustParse is like Parse but panics if the version is invalid.
+func MustParse(s string) Version {
+	v, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func parseNumber(s string) (int, error) {
+	if len(s) == 0 {
+		return 0, fmt.Errorf("empty number")
+	}
+	if len(s) > 1 && s[0] == '0' {
+		return 0, fmt.Errorf("leading zero in %q", s)
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("invalid number %q", s)
+		}
+	}
+	return strconv.Atoi(s)
+}
+
+func checkIdents(s string, numeric bool) error {
+	if len(s) == 0 {
+		return nil
+	}
+	for _, id := range strings.Split(s, ".") {
+		if len(id) == 0 {
+			return fmt.Errorf("has an empty identifier")
+		}
+		allDigits := true
+		for _, c := range id {
+			switch {
+			case c >= '0' && c <= '9':
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '-':
+				allDigits = false
+			default:
+				return fmt.Errorf("identifier %q has invalid character %q", id, c)
+			}
+		}
+		if numeric && allDigits && len(id) > 1 && id[0] == '0' {
+			return fmt.Errorf("identifier %q has a leading zero", id)
+		}
+	}
+	return nil
+}
+
+// String formats the version.
+func (v Version) String() string {
+	s := fmt.Sprintf("%s%d.%d.%d", v.Prefix, v.Major, v.Minor, v.Patch)
+	if len(v.Pre) > 0 {
+		s += "-" + v.Pre
+	}
+	if len(v.Build) > 0 {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Compare returns -1, 0, or 1 if a is less than, equal to, or greater than b
+// in semver precedence. The prefix and build metadata are ignored.
+func Compare(a, b Version) int {
+	if c := cmpInt(a.Major, b.Major); c != 0 {
+		return c
+	}
+	if c := cmpInt(a.Minor, b.Minor); c != 0 {
+		return c
+	}
+	if c := cmpInt(a.Patch, b.Patch); c != 0 {
+		return c
+	}
+	switch {
+	case a.Pre == b.Pre:
+		return 0
+	case len(a.Pre) == 0:
+		return 1
+	case len(b.Pre) == 0:
+		return -1
+	}
+	ap, bp := strings.Split(a.Pre, "."), strings.Split(b.Pre, ".")
+	for i := 0; i < len(ap) && i < len(bp); i++ {
+		an, aNum := number(ap[i])
+		bn, bNum := number(bp[i])
+		var c int
+		switch {
+		case aNum && bNum:
+			c = cmpInt(an, bn)
+		case aNum:
+			c = -1 // Numeric identifiers sort first.
+		case bNum:
+			c = 1
+		default:
+			c = strings.Compare(ap[i], bp[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return cmpInt(len(ap), len(bp))
+}
+
+// number parses a numeric identifier.
+func number(id string) (int, bool) {
+	for _, c := range id {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.Atoi(id)
+	return n, err == nil
+}
+
+func cmpInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Part of a version to bump.
+type Part int
+
+const (
+	Patch Part = iota
+	Minor
+	Major
+)
+
+// Bump returns the next release version for the part. The build metadata
+// is dropped. A pre-release bumps to its own release if that is already a
+// release of the part, so v1.3.0-rc.1 bumps to v1.3.0 for a Patch or
+// Minor bump and to v2.0.0 for a Major bump.
+func (v Version) Bump(p Part) Version {
+	n := Version{Prefix: v.Prefix, Major: v.Major, Minor: v.Minor, Patch: v.Patch}
+	pre := len(v.Pre) > 0
+	switch p {
+	case Patch:
+		if !pre {
+			n.Patch++
+		}
+	case Minor:
+		if !pre || v.Patch != 0 {
+			n.Minor++
+		}
+		n.Patch = 0
+	case Major:
+		if !pre || v.Minor != 0 || v.Patch != 0 {
+			n.Major++
+		}
+		n.Minor, n.Patch = 0, 0
+	}
+	return n
+}
+
+func get(st *task.State, name string) (Version, error) {
+	if _, err := st.MustGet(name); err != nil {
+		return Version{}, fmt.Errorf("version %w", err)
+	}
+	v, err := task.ExpandEnvErr(task.VAR(name), st)
+	if err != nil {
+		return Version{}, err
+	}
+	return Parse(v)
+}
+
+// Bump parses the version in the State variable inVar, bumps the part, and
+// stores the new version in outVar.
+func Bump(p Part, inVar, outVar string) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		v, err := get(st, inVar)
+		if err != nil {
+			return err
+		}
+		st.Set(outVar, v.Bump(p).String())
+		return nil
+	})
+}
+
+// BumpPatch bumps the patch version of inVar into outVar.
+func BumpPatch(inVar, outVar string) task.Action {
+	return Bump(Patch, inVar, outVar)
+}
+
+// BumpMinor bumps the minor version of inVar into outVar.
+func BumpMinor(inVar, outVar string) task.Action {
+	return Bump(Minor, inVar, outVar)
+}
+
+// BumpMajor bumps the major version of inVar into outVar.
+func BumpMajor(inVar, outVar string) task.Action {
+	return Bump(Major, inVar, outVar)
+}
+
+// CompareVars compares the versions in the State variables a and b and
+// stores the result, -1, 0, or 1, in outVar. It may be tested with
+// task.When, such as "cmp < 0".
+func CompareVars(a, b, outVar string) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		av, err := get(st, a)
+		if err != nil {
+			return err
+		}
+		bv, err := get(st, b)
+		if err != nil {
+			return err
+		}
+		st.Set(outVar, Compare(av, bv))
+		return nil
+	})
+}
+
+// Latest returns the greatest valid version in the list, ignoring invalid
+// versions. If includePre is false pre-releases are also ignored.
+func Latest(list []string, includePre bool) (Version, bool) {
+	var latest Version
+	found := false
+	for _, s := range list {
+		v, err := Parse(s)
+		if err != nil {
+			continue
+		}
+		if len(v.Pre) > 0 && !includePre {
+			continue
+		}
+		if !found || Compare(v, latest) > 0 {
+			latest, found = v, true
+		}
+	}
+	return latest, found
+}
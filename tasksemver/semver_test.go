@@ -0,0 +1,105 @@
+package tasksemver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kardianos/task"
+)
+
+func TestParse(t *testing.T) {
+	for _, s := range []string{"1.2.3", "v0.0.0", "v1.2.3-rc.1", "1.0.0-alpha-1+build.5", "v10.20.30+meta"} {
+		v, err := Parse(s)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		if g := v.String(); g != s {
+			t.Errorf("got %q, want %q", g, s)
+		}
+	}
+	for _, s := range []string{"", "1.2", "1.2.3.4", "01.2.3", "v1.2.3-", "1.2.3-rc..1", "1.2.3-01", "1.2.3+", "1.x.3", "1.2.3-r_c"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	// In increasing order, from the semver specification.
+	list := []string{
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta",
+		"1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "v1.0.1", "1.1.0", "2.0.0",
+	}
+	for i := range list {
+		for j := range list {
+			want := cmpInt(i, j)
+			if g := Compare(MustParse(list[i]), MustParse(list[j])); g != want {
+				t.Errorf("Compare(%s, %s) = %d, want %d", list[i], list[j], g, want)
+			}
+		}
+	}
+	if g := Compare(MustParse("v1.0.0+a"), MustParse("1.0.0+b")); g != 0 {
+		t.Errorf("build metadata compared: %d", g)
+	}
+}
+
+func TestBump(t *testing.T) {
+	for _, tc := range []struct {
+		v                   string
+		patch, minor, major string
+	}{
+		{"v1.2.3", "v1.2.4", "v1.3.0", "v2.0.0"},
+		{"1.2.3+build", "1.2.4", "1.3.0", "2.0.0"},
+		{"v1.3.0-rc.1", "v1.3.0", "v1.3.0", "v2.0.0"},
+		{"v1.3.1-rc.1", "v1.3.1", "v1.4.0", "v2.0.0"},
+		{"v2.0.0-rc.1", "v2.0.0", "v2.0.0", "v2.0.0"},
+	} {
+		v := MustParse(tc.v)
+		for p, want := range map[Part]string{Patch: tc.patch, Minor: tc.minor, Major: tc.major} {
+			if g := v.Bump(p).String(); g != want {
+				t.Errorf("%s bump %d: got %s, want %s", tc.v, p, g, want)
+			}
+		}
+	}
+}
+
+func TestActions(t *testing.T) {
+	st := &task.State{ErrorLogger: func(err error) {}}
+	st.Set("version", "v1.2.3")
+	st.Set("deployed", "v1.10.0")
+	err := task.Run(context.Background(), st, task.NewScript(
+		BumpPatch("version", "patch"),
+		BumpMinor("version", "minor"),
+		BumpMajor("version", "major"),
+		CompareVars("version", "deployed", "cmp"),
+		task.When("cmp < 0", task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+			st.Set("older", true)
+			return nil
+		})),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]any{"patch": "v1.2.4", "minor": "v1.3.0", "major": "v2.0.0", "cmp": -1, "older": true} {
+		if g := st.Get(name); g != want {
+			t.Errorf("%s: got %v, want %v", name, g, want)
+		}
+	}
+	if err := task.Run(context.Background(), st, BumpPatch("missing", "out")); err == nil {
+		t.Fatal("expected error for missing variable")
+	}
+}
+
+func TestLatest(t *testing.T) {
+	list := []string{"v1.2.0", "v1.10.0-rc.1", "release-5", "v1.9.0", "v0.1.0"}
+	if v, _ := Latest(list, false); v.String() != "v1.9.0" {
+		t.Fatalf("got %s", v)
+	}
+	if v, _ := Latest(list, true); v.String() != "v1.10.0-rc.1" {
+		t.Fatalf("got %s", v)
+	}
+	if _, ok := Latest([]string{"x"}, true); ok {
+		t.Fatal("expected no version")
+	}
+}
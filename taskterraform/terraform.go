@@ -0,0 +1,217 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package taskterraform has actions that run terraform init, plan, and
+// apply non-interactively.
+//
+// Plan sets State.Branch from whether the plan has changes, so an approval
+// step may be gated with task.Switch:
+//
+//	task.Switch(taskterraform.Plan("tf.plan", opts), map[task.Branch]task.Action{
+//		task.BranchTrue: task.NewScript(approve, taskterraform.Apply("tf.plan", opts)),
+//	})
+//
+// String values may refer to State variables and env with "${name}".
+package taskterraform
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/kardianos/task"
+)
+
+// Options configure the terraform actions.
+type Options struct {
+	Dir string // Configuration directory, relative to State.Dir, passed as -chdir.
+
+	// Vars maps variable names to values, passed as -var to plan.
+	Vars map[string]string
+
+	// StateVars names State variables or env to pass as terraform
+	// variables of the same name to plan.
+	StateVars []string
+
+	VarFiles []string // Variable files, passed as -var-file to plan.
+
+	// BackendConfig maps backend settings to values, passed as
+	// -backend-config to init.
+	BackendConfig map[string]string
+}
+
+// Error is returned when terraform fails.
+type Error struct {
+	Args     []string
+	ExitCode int
+	Err      error
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("terraform %s: %v", strings.Join(err.Args, " "), err.Err)
+}
+
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+// expander expands values, keeping the first error.
+type expander struct {
+	st  *task.State
+	err error
+}
+
+func (e *expander) expand(v any) string {
+	if e.err != nil {
+		return ""
+	}
+	var s string
+	s, e.err = task.ExpandEnvErr(v, e.st)
+	return s
+}
+
+func (e *expander) sortedPairs(m map[string]string, flag string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var args []string
+	for _, k := range keys {
+		args = append(args, flag, k+"="+e.expand(m[k]))
+	}
+	return args
+}
+
+// run terraform with the args, streaming the output to stdout and the
+// State stderr. It returns the exit code, or an *Error for exit codes not
+// in ok.
+func run(ctx context.Context, st *task.State, opts Options, stdout io.Writer, args []string, ok ...int) (int, error) {
+	if len(opts.Dir) > 0 {
+		dir, err := task.ExpandEnvErr(opts.Dir, st)
+		if err != nil {
+			return -1, err
+		}
+		args = append([]string{"-chdir=" + dir}, args...)
+	}
+	if task.DryRun(st) {
+		if st.Stdout != nil {
+			fmt.Fprintf(st.Stdout, "exec: terraform %s (in %s)\n", strings.Join(args, " "), st.Dir)
+		}
+		return 0, nil
+	}
+	cmd := exec.CommandContext(ctx, "terraform", args...)
+	cmd.Dir = st.Dir
+	for k, v := range st.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Env = append(cmd.Env, "TF_IN_AUTOMATION=1")
+	cmd.Stdout = stdout
+	cmd.Stderr = st.Stderr
+	start := st.Now()
+	err := cmd.Run()
+	st.AuditCmd(cmd, start, err)
+	if err == nil {
+		return 0, nil
+	}
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		code := ee.ExitCode()
+		for _, c := range ok {
+			if c == code {
+				return code, nil
+			}
+		}
+		return code, &Error{Args: args, ExitCode: code, Err: err}
+	}
+	return -1, &Error{Args: args, ExitCode: -1, Err: err}
+}
+
+// Init runs "terraform init".
+func Init(opts Options) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		e := &expander{st: st}
+		args := append([]string{"init", "-input=false"}, e.sortedPairs(opts.BackendConfig, "-backend-config")...)
+		if e.err != nil {
+			return e.err
+		}
+		_, err := run(ctx, st, opts, st.Stdout, args)
+		return err
+	})
+}
+
+// Plan runs "terraform plan", writing the plan to planFile, relative to the
+// configuration directory. State.Branch is set to task.BranchTrue if the
+// plan has changes and task.BranchFalse if not. In dry-run mode the
+// Branch is left unset.
+func Plan(planFile any, opts Options) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		e := &expander{st: st}
+		args := []string{"plan", "-input=false", "-detailed-exitcode", "-out=" + e.expand(planFile)}
+		vars := make(map[string]string, len(opts.Vars)+len(opts.StateVars))
+		for _, name := range opts.StateVars {
+			vars[name] = "${" + name + "}"
+		}
+		for k, v := range opts.Vars {
+			vars[k] = v
+		}
+		args = append(args, e.sortedPairs(vars, "-var")...)
+		for _, fn := range opts.VarFiles {
+			args = append(args, "-var-file="+e.expand(fn))
+		}
+		if e.err != nil {
+			return e.err
+		}
+		// Exit code 2 is a successful plan with changes.
+		code, err := run(ctx, st, opts, st.Stdout, args, 2)
+		if err != nil {
+			return err
+		}
+		switch {
+		case task.DryRun(st):
+		case code == 2:
+			st.Branch = task.BranchTrue
+		default:
+			st.Branch = task.BranchFalse
+		}
+		return nil
+	})
+}
+
+// ShowJSON writes the JSON form of the plan file, from "terraform show
+// -json", to the file out, relative to State.Dir, for review or policy
+// checks.
+func ShowJSON(planFile, out any, opts Options) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		e := &expander{st: st}
+		plan, fn := e.expand(planFile), e.expand(out)
+		if e.err != nil {
+			return e.err
+		}
+		buf := &bytes.Buffer{}
+		_, err := run(ctx, st, opts, buf, []string{"show", "-json", plan})
+		if err != nil || task.DryRun(st) {
+			return err
+		}
+		return os.WriteFile(st.Filepath(fn), buf.Bytes(), 0600)
+	})
+}
+
+// Apply runs "terraform apply" of the plan file written by Plan.
+func Apply(planFile any, opts Options) task.Action {
+	return task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		plan, err := task.ExpandEnvErr(planFile, st)
+		if err != nil {
+			return err
+		}
+		_, err = run(ctx, st, opts, st.Stdout, []string{"apply", "-input=false", "-auto-approve", plan})
+		return err
+	})
+}
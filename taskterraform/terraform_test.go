@@ -0,0 +1,90 @@
+package taskterraform
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kardianos/task"
+	"github.com/kardianos/task/tasktest"
+)
+
+func TestPlanApply(t *testing.T) {
+	fake := tasktest.FakeExec(t, `
+[ "$TF_IN_AUTOMATION" = "1" ] || exit 9
+case "$2" in
+plan) case "$*" in *region=none*) exit 0;; esac; exit 2;;
+show) echo '{"format_version":"1.2"}';;
+esac
+`, "terraform")
+	dir := t.TempDir()
+	st := &task.State{Dir: dir, Env: map[string]string{"REGION": "us-east-1"}}
+	st.Set("version", "v1.2.0")
+	opts := Options{
+		Dir:           "infra",
+		Vars:          map[string]string{"region": "${REGION}"},
+		StateVars:     []string{"version"},
+		VarFiles:      []string{"prod.tfvars"},
+		BackendConfig: map[string]string{"key": "prod/${version}"},
+	}
+	applied := false
+	ctx := context.Background()
+	err := task.Run(ctx, st, task.NewScript(
+		Init(opts),
+		ShowJSON("tf.plan", "plan.json", opts),
+		task.Switch(Plan("tf.plan", opts), map[task.Branch]task.Action{
+			task.BranchTrue: task.NewScript(
+				task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+					applied = true
+					return nil
+				}),
+				Apply("tf.plan", opts),
+			),
+		}),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !applied {
+		t.Fatal("expected changes branch")
+	}
+	got := fake.Calls()
+	want := []string{
+		"terraform -chdir=infra init -input=false -backend-config key=prod/v1.2.0",
+		"terraform -chdir=infra show -json tf.plan",
+		"terraform -chdir=infra plan -input=false -detailed-exitcode -out=tf.plan -var region=us-east-1 -var version=v1.2.0 -var-file=prod.tfvars",
+		"terraform -chdir=infra apply -input=false -auto-approve tf.plan",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "plan.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !json.Valid(b) {
+		t.Fatalf("invalid plan json %q", b)
+	}
+
+	st.Env["REGION"] = "none"
+	if err := task.Run(ctx, st, Plan("tf.plan", opts)); err != nil {
+		t.Fatal(err)
+	}
+	if st.Branch != task.BranchFalse {
+		t.Fatalf("got branch %v, want no changes", st.Branch)
+	}
+}
+
+func TestPlanError(t *testing.T) {
+	tasktest.FakeExec(t, "exit 1", "terraform")
+	st := &task.State{ErrorLogger: func(err error) {}}
+	err := task.Run(context.Background(), st, Plan("tf.plan", Options{}))
+	var terr *Error
+	if !errors.As(err, &terr) || terr.ExitCode != 1 {
+		t.Fatalf("expected exit code 1 error, got %v", err)
+	}
+}
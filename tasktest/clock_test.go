@@ -0,0 +1,40 @@
+package tasktest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kardianos/task"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Date(2018, 1, 2, 15, 4, 5, 0, time.UTC)
+	c := NewClock(start)
+	ts := State(t, WithClock(c))
+	done := make(chan error, 1)
+	go func() {
+		done <- ts.Run(task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+			if err := st.Sleep(ctx, time.Hour); err != nil {
+				return err
+			}
+			st.Logf("woke at %s", st.Now().Format(time.Kitchen))
+			return nil
+		}))
+	}()
+	c.BlockUntil(1)
+	c.Advance(30 * time.Minute)
+	select {
+	case <-done:
+		t.Fatal("woke early")
+	default:
+	}
+	c.Advance(30 * time.Minute)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	ts.Log.Equal("woke at 4:04PM\n")
+	if c.Waiters() != 0 {
+		t.Fatalf("got %d waiters", c.Waiters())
+	}
+}
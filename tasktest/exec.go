@@ -0,0 +1,61 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tasktest
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Fake is a set of fake executables installed by FakeExec.
+type Fake struct {
+	t   testing.TB
+	Dir string // Directory of the executables, first in PATH.
+	log string
+}
+
+// FakeExec installs a shell script for each name in a new directory put
+// first in PATH for the rest of the test, so actions that run one of the
+// names run the script instead. Each run appends a line to the log read
+// by Calls before the script runs. The test is skipped on Windows, which
+// can't run the scripts, and must not be run in parallel as PATH is
+// changed.
+func FakeExec(t testing.TB, script string, names ...string) *Fake {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake executables require sh")
+	}
+	f := &Fake{t: t, Dir: t.TempDir()}
+	f.log = filepath.Join(f.Dir, "calls.log")
+	for _, name := range names {
+		sh := "#!/bin/sh\nline='" + name + "'\n" +
+			"[ $# -gt 0 ] && line=\"$line $*\"\n" +
+			"printf '%s\\n' \"$line\" >> '" + f.log + "'\n" + script
+		if err := os.WriteFile(filepath.Join(f.Dir, name), []byte(sh), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", f.Dir+string(filepath.ListSeparator)+os.Getenv("PATH"))
+	return f
+}
+
+// Calls returns a line for each run of the fake executables, in order,
+// with the name and the arguments joined by spaces.
+func (f *Fake) Calls() []string {
+	f.t.Helper()
+	b, err := os.ReadFile(f.log)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		f.t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
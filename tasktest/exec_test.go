@@ -0,0 +1,28 @@
+package tasktest
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kardianos/task"
+)
+
+func TestFakeExec(t *testing.T) {
+	f := FakeExec(t, `[ "$1" = "fail" ] && exit 3; echo "ran $0"`, "tool", "other")
+	if got := f.Calls(); got != nil {
+		t.Fatalf("got calls %q before any run", got)
+	}
+	ts := State(t)
+	ts.MustRun(task.NewScript(
+		task.Exec("tool", "build", task.Literal("a$b")),
+		task.Exec("other"),
+	))
+	if err := ts.Run(task.Exec("tool", "fail")); err == nil {
+		t.Fatal("expected error")
+	}
+	want := []string{"tool build a$b", "other", "tool fail"}
+	if got := f.Calls(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got calls %q, want %q", got, want)
+	}
+	ts.Stdout.Contains("ran " + f.Dir)
+}
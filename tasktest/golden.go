@@ -0,0 +1,197 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package tasktest has helpers to test task actions.
+//
+// RunGolden runs an action in a temporary directory and compares the
+// resulting files to a golden directory. RunGoldenMem does the same in a
+// MemFS, which does not use the disk:
+//
+//	func TestPackage(t *testing.T) {
+//		tasktest.RunGolden(t, "testdata/package", packageAction)
+//	}
+//
+// Run "go test -update" to replace the golden directory with the result.
+package tasktest
+
+import (
+	"flag"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/kardianos/task"
+)
+
+var update = flag.Bool("update", false, "update golden directories")
+
+// Run runs the action a with a State from State and returns State.Dir.
+// The test fails if the action returns an error.
+func Run(t testing.TB, a task.Action) string {
+	t.Helper()
+	ts := State(t)
+	ts.MustRun(a)
+	return ts.State.Dir
+}
+
+// RunMem runs the action a like Run, but with State.FS set to a new MemFS,
+// and returns the MemFS and the State.Dir within it.
+func RunMem(t testing.TB, a task.Action) (*MemFS, string) {
+	t.Helper()
+	ts := State(t, WithMemFS())
+	ts.MustRun(a)
+	return ts.State.FS.(*MemFS), ts.State.Dir
+}
+
+// RunGolden runs the action a with Run and compares the directory to the
+// golden directory with Golden.
+func RunGolden(t testing.TB, golden string, a task.Action) {
+	t.Helper()
+	Golden(t, Run(t, a), golden)
+}
+
+// RunGoldenMem runs the action a with RunMem and compares the directory
+// to the golden directory with GoldenFS.
+func RunGoldenMem(t testing.TB, golden string, a task.Action) {
+	t.Helper()
+	fsys, dir := RunMem(t, a)
+	GoldenFS(t, fsys, dir, golden)
+}
+
+// Golden compares the files in dir to the files in the golden directory.
+// Each file must have the same content and, except on Windows, the same
+// executable bit, which is the mode that version control keeps. With the
+// "-update" flag the golden directory is replaced with the files in dir.
+func Golden(t testing.TB, dir, golden string) {
+	t.Helper()
+	GoldenFS(t, task.OSFS{}, dir, golden)
+}
+
+// GoldenFS compares the files in dir of fsys to the files in the golden
+// directory of the OS like Golden.
+func GoldenFS(t testing.TB, fsys task.FS, dir, golden string) {
+	t.Helper()
+	got, err := readTree(fsys, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *update {
+		if err := writeTree(golden, got); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := readTree(task.OSFS{}, golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := false
+	for _, name := range sortedNames(got, want) {
+		g, inGot := got[name]
+		w, inWant := want[name]
+		switch {
+		case !inWant:
+			t.Errorf("%s: unexpected file", name)
+		case !inGot:
+			t.Errorf("%s: missing file", name)
+		case string(g.data) != string(w.data):
+			t.Errorf("%s: content differs\n%s", name, task.UnifiedDiff("golden/"+name, "got/"+name, w.data, g.data))
+		case runtime.GOOS != "windows" && g.mode&0111 != w.mode&0111:
+			t.Errorf("%s: got mode %v, want %v", name, g.mode, w.mode)
+		default:
+			continue
+		}
+		failed = true
+	}
+	if failed {
+		t.Logf("run with -update to update %s", golden)
+	}
+}
+
+type file struct {
+	mode fs.FileMode
+	data []byte
+}
+
+// readTree reads the regular files in dir by slash separated name.
+func readTree(fsys task.FS, dir string) (map[string]file, error) {
+	tree := make(map[string]file)
+	return tree, readDir(fsys, dir, "", tree)
+}
+
+func readDir(fsys task.FS, dir, prefix string, tree map[string]file) error {
+	list, err := fsys.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, d := range list {
+		fn := filepath.Join(dir, d.Name())
+		switch {
+		case d.IsDir():
+			if err := readDir(fsys, fn, prefix+d.Name()+"/", tree); err != nil {
+				return err
+			}
+			continue
+		case !d.Type().IsRegular():
+			continue
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		f, err := fsys.OpenFile(fn, os.O_RDONLY, 0)
+		if err != nil {
+			return err
+		}
+		b, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		tree[prefix+d.Name()] = file{mode: fi.Mode().Perm(), data: b}
+	}
+	return nil
+}
+
+// writeTree replaces dir with the files of tree.
+func writeTree(dir string, tree map[string]file) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for name, f := range tree {
+		fn := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(fn, f.data, f.mode); err != nil {
+			return err
+		}
+		if err := os.Chmod(fn, f.mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedNames(trees ...map[string]file) []string {
+	var list []string
+	seen := make(map[string]bool)
+	for _, tree := range trees {
+		for name := range tree {
+			if !seen[name] {
+				seen[name] = true
+				list = append(list, name)
+			}
+		}
+	}
+	sort.Strings(list)
+	return list
+}
@@ -0,0 +1,61 @@
+package tasktest
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kardianos/task"
+)
+
+func packageAction() task.Action {
+	return task.NewScript(
+		task.WriteFile("pkg/bin/run.sh", 0755, "#!/bin/sh\necho ok\n"),
+		task.WriteFile("pkg/README", 0644, "hello\n"),
+	)
+}
+
+func TestRunGolden(t *testing.T) {
+	dir := Run(t, packageAction())
+	Golden(t, filepath.Join(dir, "pkg"), "testdata/package")
+}
+
+// recordTB records errors rather than failing the test.
+type recordTB struct {
+	testing.TB
+	errs []string
+}
+
+func (r *recordTB) Errorf(f string, v ...any) {
+	r.errs = append(r.errs, fmt.Sprintf(f, v...))
+}
+
+func (r *recordTB) Logf(f string, v ...any) {}
+
+func TestGoldenDiff(t *testing.T) {
+	dir := Run(t, task.NewScript(
+		task.WriteFile("bin/run.sh", 0644, "#!/bin/sh\necho ok\n"),
+		task.WriteFile("README", 0644, "hello, world\n"),
+		task.WriteFile("extra", 0644, ""),
+	))
+	r := &recordTB{TB: t}
+	Golden(r, dir, "testdata/package")
+	want := []string{
+		"README: content differs\n--- golden/README\n+++ got/README\n@@ -1 +1 @@\n-hello\n+hello, world\n",
+		"bin/run.sh: got mode -rw-r--r--, want -rwxr-xr-x",
+		"extra: unexpected file",
+	}
+	if g := strings.Join(r.errs, "|"); g != strings.Join(want, "|") {
+		t.Fatalf("got %q, want %q", r.errs, want)
+	}
+}
+
+func TestGoldenUpdate(t *testing.T) {
+	golden := filepath.Join(t.TempDir(), "golden")
+	*update = true
+	defer func() { *update = false }()
+	RunGolden(t, golden, packageAction())
+	*update = false
+	Golden(t, Run(t, packageAction()), golden)
+}
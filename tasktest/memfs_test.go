@@ -0,0 +1,138 @@
+package tasktest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kardianos/task"
+)
+
+func TestRunGoldenMem(t *testing.T) {
+	RunGoldenMem(t, "testdata/package", task.NewScript(
+		task.WriteFile("stage/bin/run.sh", 0755, "#!/bin/sh\necho ok\n"),
+		task.WriteFile("stage/README", 0644, "hello\n"),
+		task.Copy("stage/bin", "bin", nil),
+		task.Move("stage/README", "README"),
+		task.Delete("stage"),
+	))
+}
+
+func TestMemFSActions(t *testing.T) {
+	var got string
+	var closer io.Closer
+	fsys, dir := RunMem(t, task.NewScript(
+		task.WriteFile("a.txt", 0600, []byte("hello")),
+		task.ReadFile("a.txt", &got),
+		task.OpenFile("a.txt", &closer),
+	))
+	if got != "hello" {
+		t.Fatalf("got %q", got)
+	}
+	b, err := io.ReadAll(closer.(io.Reader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello" {
+		t.Fatalf("got %q", b)
+	}
+	if err := closer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat(filepath.Join(dir, "missing")); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got %v, want not exist", err)
+	}
+}
+
+func TestMemFS(t *testing.T) {
+	fsys := NewMemFS()
+	root := filepath.Join(string(filepath.Separator), "r")
+	fn := filepath.Join(root, "f")
+	if _, err := fsys.OpenFile(fn, os.O_CREATE|os.O_WRONLY, 0644); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got %v, want not exist without parent", err)
+	}
+	if err := fsys.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fsys.OpenFile(fn, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(f, "abc")
+	if _, err := f.Read(make([]byte, 1)); !errors.Is(err, fs.ErrPermission) {
+		t.Fatalf("got %v, want permission error reading write only file", err)
+	}
+	f.Close()
+	f, err = fsys.OpenFile(fn, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(f, "def")
+	f.Close()
+	if _, err := fsys.OpenFile(fn, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("got %v, want exist", err)
+	}
+	fi, err := fsys.Stat(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != 6 || fi.Mode() != 0644 || fi.Name() != "f" {
+		t.Fatalf("got size %d mode %v name %q", fi.Size(), fi.Mode(), fi.Name())
+	}
+	list, err := fsys.ReadDir(string(filepath.Separator))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Name() != "r" || !list[0].IsDir() {
+		t.Fatalf("got %v", list)
+	}
+	if err := fsys.Rename(root, filepath.Join(root, "sub")); !errors.Is(err, fs.ErrInvalid) {
+		t.Fatalf("got %v, want invalid rename into itself", err)
+	}
+}
+
+func TestResumeScriptMemFS(t *testing.T) {
+	var log []string
+	fail := true
+	deploy := task.ResumeScript(".task/deploy.json",
+		task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+			log = append(log, "build")
+			st.Set("version", "v1.2.0")
+			return nil
+		}),
+		task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+			log = append(log, "push "+task.ExpandEnv("${version}", st))
+			if fail {
+				return errors.New("network down")
+			}
+			return nil
+		}),
+	)
+	ts := State(t, WithMemFS())
+	fn := filepath.Join(ts.State.Dir, ".task", "deploy.json")
+	if err := ts.Run(deploy); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := ts.State.FS.Stat(fn); err != nil {
+		t.Fatalf("checkpoint not saved to the State FS: %v", err)
+	}
+	if _, err := ts.State.FS.Stat(fn + ".tmp"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got %v, want temporary file renamed", err)
+	}
+
+	fail = false
+	ts2 := State(t)
+	ts2.State.Dir, ts2.State.FS = ts.State.Dir, ts.State.FS
+	ts2.MustRun(deploy)
+	if g, w := fmt.Sprint(log), "[build push v1.2.0 push v1.2.0]"; g != w {
+		t.Fatalf("got %s, want %s", g, w)
+	}
+	if _, err := ts.State.FS.Stat(fn); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got %v, want checkpoint removed", err)
+	}
+}
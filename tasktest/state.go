@@ -0,0 +1,212 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tasktest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kardianos/task"
+)
+
+// Buffer is captured output that is safe for concurrent writes. Its
+// assertion methods report failures to the test.
+type Buffer struct {
+	t  testing.TB
+	mu sync.Mutex
+	sb strings.Builder
+}
+
+// Write implements io.Writer.
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.sb.Write(p)
+}
+
+// String returns the captured output.
+func (b *Buffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.sb.String()
+}
+
+// Reset discards the captured output.
+func (b *Buffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sb.Reset()
+}
+
+// Equal reports if the output is want, failing the test if not.
+func (b *Buffer) Equal(want string) bool {
+	b.t.Helper()
+	if got := b.String(); got != want {
+		b.t.Errorf("got output %q, want %q", got, want)
+		return false
+	}
+	return true
+}
+
+// Contains reports if the output contains each sub string, failing the
+// test if not.
+func (b *Buffer) Contains(sub ...string) bool {
+	b.t.Helper()
+	got := b.String()
+	ok := true
+	for _, s := range sub {
+		if !strings.Contains(got, s) {
+			b.t.Errorf("output %q does not contain %q", got, s)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// Empty reports if there is no output, failing the test if not.
+func (b *Buffer) Empty() bool {
+	b.t.Helper()
+	return b.Equal("")
+}
+
+// Harness is a State for a test with its output captured.
+type Harness struct {
+	State  *task.State
+	Stdout *Buffer
+	Stderr *Buffer
+	Log    *Buffer // Lines logged to the MsgLogger and ErrorLogger.
+
+	t testing.TB
+}
+
+// Option configures a Harness.
+type Option func(ts *Harness)
+
+// WithEnv sets environment variables as "KEY=value" pairs.
+func WithEnv(env ...string) Option {
+	return func(ts *Harness) {
+		for _, e := range env {
+			k, v, _ := strings.Cut(e, "=")
+			ts.State.Env[k] = v
+		}
+	}
+}
+
+// WithVar sets the State variable name to v.
+func WithVar(name string, v any) Option {
+	return func(ts *Harness) {
+		ts.State.Set(name, v)
+	}
+}
+
+// WithDryRun sets the State in dry-run mode.
+func WithDryRun() Option {
+	return WithVar(task.DryRunVar, true)
+}
+
+// WithMemFS sets State.FS to a new MemFS, with State.Dir created in it.
+func WithMemFS() Option {
+	return func(ts *Harness) {
+		fsys := NewMemFS()
+		ts.State.Dir = filepath.Join(string(filepath.Separator), "work")
+		if err := fsys.MkdirAll(ts.State.Dir, 0700); err != nil {
+			ts.t.Fatal(err)
+		}
+		ts.State.FS = fsys
+	}
+}
+
+// WithClock sets State.Clock to c.
+func WithClock(c *Clock) Option {
+	return func(ts *Harness) {
+		ts.State.Clock = c
+	}
+}
+
+// hostEnv are the environment variables copied from the OS, so
+// executables may be found and run.
+var hostEnv = []string{"PATH", "PATHEXT", "SYSTEMROOT"}
+
+// State returns a State for the test. State.Dir is a new temporary
+// directory, output is captured, and the environment is deterministic:
+// only PATH and the variables Windows needs to run executables are kept
+// from the OS, HOME and TMPDIR are new temporary directories, and LANG and
+// TZ are fixed. The captured output is logged
+// if the test fails.
+func State(t testing.TB, opts ...Option) *Harness {
+	t.Helper()
+	home := t.TempDir()
+	tmp := filepath.Join(home, "tmp")
+	if err := os.Mkdir(tmp, 0700); err != nil {
+		t.Fatal(err)
+	}
+	ts := &Harness{
+		Stdout: &Buffer{t: t},
+		Stderr: &Buffer{t: t},
+		Log:    &Buffer{t: t},
+		t:      t,
+	}
+	env := map[string]string{
+		"HOME":   home,
+		"TMPDIR": tmp,
+		"LANG":   "C",
+		"TZ":     "UTC",
+	}
+	for _, k := range hostEnv {
+		if v, ok := os.LookupEnv(k); ok {
+			env[k] = v
+		}
+	}
+	ts.State = &task.State{
+		Env:    env,
+		Dir:    t.TempDir(),
+		Stdout: ts.Stdout,
+		Stderr: ts.Stderr,
+		MsgLogger: func(msg string) {
+			fmt.Fprintln(ts.Log, msg)
+		},
+		ErrorLogger: func(err error) {
+			fmt.Fprintln(ts.Log, err)
+		},
+	}
+	for _, o := range opts {
+		o(ts)
+	}
+	t.Cleanup(func() {
+		if !t.Failed() {
+			return
+		}
+		for _, b := range []struct {
+			name string
+			buf  *Buffer
+		}{{"stdout", ts.Stdout}, {"stderr", ts.Stderr}, {"log", ts.Log}} {
+			if s := b.buf.String(); len(s) > 0 {
+				t.Logf("%s:\n%s", b.name, s)
+			}
+		}
+	})
+	return ts
+}
+
+// Run the action a with the State. The context is canceled when the test
+// ends.
+func (ts *Harness) Run(a task.Action) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	ts.t.Cleanup(cancel)
+	return task.Run(ctx, ts.State, a)
+}
+
+// MustRun runs the action a like Run, failing the test on error.
+func (ts *Harness) MustRun(a task.Action) {
+	ts.t.Helper()
+	if err := ts.Run(a); err != nil {
+		ts.t.Fatal(err)
+	}
+}
@@ -0,0 +1,56 @@
+package tasktest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/kardianos/task"
+)
+
+func TestState(t *testing.T) {
+	ts := State(t, WithEnv("NAME=world"), WithVar("count", 2))
+	err := ts.Run(task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+		fmt.Fprintf(st.Stdout, "hello %s %v\n", st.Env["NAME"], st.Get("count"))
+		fmt.Fprint(st.Stderr, "warn")
+		st.Log("logged")
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Stdout.Equal("hello world 2\n")
+	ts.Stderr.Contains("warn")
+	ts.Log.Equal("logged\n")
+	for _, k := range []string{"HOME", "TMPDIR", "PATH"} {
+		if len(ts.State.Env[k]) == 0 {
+			t.Errorf("%s not set", k)
+		}
+	}
+	if ts.State.Env["TZ"] != "UTC" {
+		t.Errorf("got TZ %q", ts.State.Env["TZ"])
+	}
+
+	ts.Stdout.Reset()
+	ts = State(t, WithDryRun(), WithMemFS())
+	ts.MustRun(task.WriteFile("a.txt", 0644, "data"))
+	ts.Stdout.Contains("write: ", "a.txt", "+data")
+	ts.Stderr.Empty()
+}
+
+func TestBufferFailures(t *testing.T) {
+	r := &recordTB{TB: t}
+	b := &Buffer{t: r}
+	b.Write([]byte("abc"))
+	if b.Equal("abd") || b.Contains("b", "x") || b.Empty() {
+		t.Fatal("expected assertions to fail")
+	}
+	want := []string{
+		`got output "abc", want "abd"`,
+		`output "abc" does not contain "x"`,
+		`got output "abc", want ""`,
+	}
+	if fmt.Sprint(r.errs) != fmt.Sprint(want) {
+		t.Fatalf("got %q, want %q", r.errs, want)
+	}
+}
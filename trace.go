@@ -0,0 +1,64 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// TraceVar is the State variable that, when set to true, runs Registry
+// tasks with Trace. Commands from a Registry set it with the "-trace" flag.
+const TraceVar = "trace"
+
+// Trace runs the action a and writes a line to stderr as each Named action
+// starts and finishes, with its duration, and for each exec and file
+// operation, with the expanded command line, like "set -x" in a shell.
+// Lines start with "+ " and the path of the running action. The lines are
+// written to the stderr of the State when Trace starts, so they are not
+// captured by WithStd.
+func Trace(a Action) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		w := st.Stderr
+		if w == nil {
+			return sc.RunAction(ctx, st, a)
+		}
+		var mu sync.Mutex
+		orig := st.eventFuncs
+		st.eventFuncs = append(orig[:len(orig):len(orig)], func(e Event) {
+			var line string
+			switch e.Type {
+			default:
+				return
+			case EventStart:
+				line = "start"
+			case EventFinish:
+				line = fmt.Sprintf("done in %v", e.Duration)
+				if len(e.Err) > 0 {
+					line = fmt.Sprintf("failed in %v: %s", e.Duration, e.Err)
+				}
+			case EventOp:
+				line = e.Op + ": " + e.Detail
+			case EventSkip:
+				line = "skip: " + e.Detail
+			case EventRollback:
+				line = "rollback"
+				if len(e.Err) > 0 {
+					line += " failed: " + e.Err
+				}
+			}
+			if len(e.Action) > 0 {
+				line = e.Action + ": " + line
+			}
+			mu.Lock()
+			fmt.Fprintf(w, "+ %s\n", line)
+			mu.Unlock()
+		})
+		err := sc.RunAction(ctx, st, a)
+		st.eventFuncs = orig
+		return err
+	})
+}
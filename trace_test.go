@@ -0,0 +1,44 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrace(t *testing.T) {
+	dir := t.TempDir()
+	r := &Registry{}
+	r.Register("gen", WriteFile("${out}", 0600, []byte("x")))
+	r.Register("build", NewScript(
+		Exec("go", "env", "GOOS"),
+		Named("check", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			return errors.New("vet failed")
+		})),
+	)).Deps = []string{"gen"}
+
+	stderr := &strings.Builder{}
+	st := &State{Dir: dir, Env: Environ(), Stderr: stderr, Clock: stoppedClock(time.Time{})}
+	st.Set("out", "gen.txt")
+	err := Run(context.Background(), st, WithStd(nil, nil, r.Command("r", "").Exec([]string{"-trace", "build"})))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	want := strings.Join([]string{
+		"+ gen: start",
+		"+ gen: write: " + filepath.Join(dir, "gen.txt") + " (-rw-------)",
+		"+ gen: done in 0s",
+		"+ build: start",
+		"+ build: exec: go env GOOS (in " + dir + ")",
+		"+ build/check: start",
+		"+ build/check: failed in 0s: vet failed",
+		"+ build: failed in 0s: vet failed",
+		"",
+	}, "\n")
+	if g := stderr.String(); g != want {
+		t.Fatalf("got\n%s\nwant\n%s", g, want)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SourcesUpToDate reports true if every output glob matches at least one
+// file and the oldest output is newer then the newest source. Globs
+// are relative to dir, use forward slashes, and may use "**" to match
+// any number of directories.
+func SourcesUpToDate(dir string, sources, outputs []string) (bool, error) {
+	var oldestOutput time.Time
+	for _, pattern := range outputs {
+		list, err := Glob(dir, pattern)
+		if err != nil {
+			return false, err
+		}
+		if len(list) == 0 {
+			return false, nil
+		}
+		for _, fn := range list {
+			fi, err := os.Stat(filepath.Join(dir, fn))
+			if err != nil {
+				return false, err
+			}
+			if oldestOutput.IsZero() || fi.ModTime().Before(oldestOutput) {
+				oldestOutput = fi.ModTime()
+			}
+		}
+	}
+	for _, pattern := range sources {
+		list, err := Glob(dir, pattern)
+		if err != nil {
+			return false, err
+		}
+		for _, fn := range list {
+			fi, err := os.Stat(filepath.Join(dir, fn))
+			if err != nil {
+				return false, err
+			}
+			if fi.ModTime().After(oldestOutput) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// Glob returns the files under dir that match pattern, relative to dir
+// and using forward slashes. In addition to the path.Match syntax,
+// a "**" path element matches zero or more directories.
+func Glob(dir, pattern string) ([]string, error) {
+	pattern = path.Clean(filepath.ToSlash(pattern))
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	root := globRoot(pattern)
+	rootPath := filepath.Join(dir, filepath.FromSlash(root))
+	if _, err := os.Stat(rootPath); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var list []string
+	err := filepath.WalkDir(rootPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if MatchGlob(pattern, rel) {
+			list = append(list, rel)
+		}
+		return nil
+	})
+	return list, err
+}
+
+// globRoot returns the leading directories of pattern without any meta
+// characters, to avoid walking more of the tree then needed.
+func globRoot(pattern string) string {
+	parts := strings.Split(pattern, "/")
+	var root []string
+	for _, p := range parts[:len(parts)-1] {
+		if strings.ContainsAny(p, `*?[\`) {
+			break
+		}
+		root = append(root, p)
+	}
+	if len(root) == 0 {
+		return "."
+	}
+	return strings.Join(root, "/")
+}
+
+// MatchGlob reports whether name matches the pattern. Both use forward
+// slashes. A "**" path element in pattern matches zero or more path
+// elements, otherwise elements are matched with path.Match.
+func MatchGlob(pattern, name string) bool {
+	return matchParts(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchParts(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		p := pattern[0]
+		if p == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchParts(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		ok, _ := path.Match(p, name[0])
+		if !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,83 @@
+package task
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchGlob(t *testing.T) {
+	list := []struct {
+		Pattern string
+		Name    string
+		Match   bool
+	}{
+		{"*.go", "a.go", true},
+		{"*.go", "x/a.go", false},
+		{"**/*.go", "a.go", true},
+		{"**/*.go", "x/y/a.go", true},
+		{"x/**", "x/y/a.go", true},
+		{"x/**/a.go", "x/a.go", true},
+		{"x/**/a.go", "z/a.go", false},
+		{"bin/server", "bin/server", true},
+	}
+	for _, item := range list {
+		if g := MatchGlob(item.Pattern, item.Name); g != item.Match {
+			t.Errorf("MatchGlob(%q, %q) = %t, want %t", item.Pattern, item.Name, g, item.Match)
+		}
+	}
+}
+
+func TestTaskUpToDate(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, mod time.Time) {
+		fn := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fn), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fn, []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(fn, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	write("src/a.go", now.Add(-time.Hour))
+	write("src/b/b.go", now.Add(-time.Hour))
+
+	r := &Registry{}
+	runs := 0
+	bt := r.Register("build", ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		runs++
+		write("bin/out", now.Add(-time.Minute))
+		return nil
+	}))
+	bt.Sources = []string{"src/**/*.go"}
+	bt.Outputs = []string{"bin/out"}
+
+	run := func(args ...string) {
+		st := &State{Dir: dir, Stdout: &strings.Builder{}}
+		err := Run(context.Background(), st, r.Command("r", "").Exec(args))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	run("build")
+	run("build")
+	if runs != 1 {
+		t.Fatalf("expected build to run once, ran %d times", runs)
+	}
+	run("-force", "build")
+	if runs != 2 {
+		t.Fatalf("expected forced build to run, ran %d times", runs)
+	}
+	write("src/b/b.go", now)
+	run("build")
+	if runs != 3 {
+		t.Fatalf("expected build to run after source change, ran %d times", runs)
+	}
+}
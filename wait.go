@@ -0,0 +1,99 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// WaitFor runs check every interval on the State.Clock until it succeeds.
+// A failed check does not run rollback actions. If check has not succeeded
+// within timeout, the last check error is returned. In dry-run mode the
+// check is not run.
+func WaitFor(check Action, interval, timeout time.Duration) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		if dryRun(st, "wait: every %v for up to %v", interval, timeout) {
+			return nil
+		}
+		start := st.Now()
+		for {
+			err := try(ctx, st, sc, check)
+			if err == nil {
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if st.Since(start)+interval > timeout {
+				return fmt.Errorf("wait: timed out after %v: %w", timeout, err)
+			}
+			if err := st.Sleep(ctx, interval); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// FileExists is a check for WaitFor that succeeds if the file exists,
+// relative to State.Dir. The filename may be VAR or string.
+func FileExists(filename any) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		fn, err := ExpandEnvErr(filename, st)
+		if err != nil {
+			return err
+		}
+		_, err = st.FileSystem().Stat(st.Filepath(fn))
+		return err
+	})
+}
+
+// TCPOpen is a check for WaitFor that succeeds if a TCP connection to the
+// address, such as "localhost:5432", can be opened. The address may be
+// VAR or string.
+func TCPOpen(address any) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		addr, err := ExpandEnvErr(address, st)
+		if err != nil {
+			return err
+		}
+		d := &net.Dialer{}
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+}
+
+// HTTPCheckClient is the client used by HTTPOK.
+var HTTPCheckClient = http.DefaultClient
+
+// HTTPOK is a check for WaitFor that succeeds if a GET request of the url
+// returns status 200 OK. The url may be VAR or string.
+func HTTPOK(url any) Action {
+	return ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		u, err := ExpandEnvErr(url, st)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := HTTPCheckClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("GET %s: %s", u, resp.Status)
+		}
+		return nil
+	})
+}
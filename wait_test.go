@@ -0,0 +1,99 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stepClock is a Clock where time passes only while waiting.
+type stepClock struct {
+	now time.Time
+}
+
+func (c *stepClock) Now() time.Time { return c.now }
+
+func (c *stepClock) After(d time.Duration) <-chan time.Time {
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func TestWaitFor(t *testing.T) {
+	dir := t.TempDir()
+	checks := 0
+	check := ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		checks++
+		if checks == 3 {
+			os.WriteFile(filepath.Join(dir, "ready"), nil, 0600)
+		}
+		return FileExists("ready").Run(ctx, st, sc)
+	})
+	st := &State{Dir: dir, Clock: &stepClock{}}
+	if err := Run(context.Background(), st, WaitFor(check, time.Second, time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if checks != 3 {
+		t.Fatalf("got %d checks, want 3", checks)
+	}
+	if _, err := st.Failure(); err != nil {
+		t.Fatalf("failed checks set failure %v", err)
+	}
+
+	checks = 0
+	os.Remove(filepath.Join(dir, "ready"))
+	check = ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+		checks++
+		return FileExists("ready").Run(ctx, st, sc)
+	})
+	err := Run(context.Background(), st, WaitFor(check, time.Second, 5*time.Second))
+	if !errors.Is(err, fs.ErrNotExist) || !strings.HasPrefix(err.Error(), "wait: timed out after 5s: ") {
+		t.Fatalf("got %v", err)
+	}
+	if checks != 6 {
+		t.Fatalf("got %d checks, want 6", checks)
+	}
+}
+
+func TestWaitChecks(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	st := &State{}
+	if err := Run(context.Background(), st, TCPOpen(addr)); err != nil {
+		t.Fatal(err)
+	}
+	ln.Close()
+	if err := Run(context.Background(), st, TCPOpen(addr)); err == nil {
+		t.Fatal("expected error for closed port")
+	}
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	st = &State{Clock: &stepClock{}}
+	st.Set("url", srv.URL+"/health")
+	err = Run(context.Background(), st, HTTPOK(VAR("url")))
+	if err == nil || err.Error() != "GET "+srv.URL+"/health: 503 Service Unavailable" {
+		t.Fatalf("got %v", err)
+	}
+	if err := Run(context.Background(), st, WaitFor(HTTPOK(VAR("url")), time.Second, time.Minute)); err != nil || requests != 3 {
+		t.Fatalf("got %v after %d requests", err, requests)
+	}
+}
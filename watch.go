@@ -0,0 +1,153 @@
+// Copyright 2018 Daniel Theophanes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type fileStamp struct {
+	mod  time.Time
+	size int64
+}
+
+// sourceSnapshot maps task names to the stamps of their source files.
+type sourceSnapshot map[string]map[string]fileStamp
+
+func snapshotSources(dir string, order []*Task) sourceSnapshot {
+	snap := make(sourceSnapshot, len(order))
+	for _, t := range order {
+		taskDir := dir
+		if len(t.Dir) > 0 {
+			if filepath.IsAbs(t.Dir) {
+				taskDir = t.Dir
+			} else {
+				taskDir = filepath.Join(dir, t.Dir)
+			}
+		}
+		files := make(map[string]fileStamp)
+		for _, pattern := range t.Sources {
+			// Errors are ignored, files may be mid-write.
+			list, _ := Glob(taskDir, pattern)
+			for _, fn := range list {
+				fi, err := os.Stat(filepath.Join(taskDir, fn))
+				if err != nil {
+					continue
+				}
+				files[fn] = fileStamp{mod: fi.ModTime(), size: fi.Size()}
+			}
+		}
+		snap[t.Name] = files
+	}
+	return snap
+}
+
+// changed returns the names of the tasks with different source files.
+func (snap sourceSnapshot) changed(next sourceSnapshot) map[string]bool {
+	changed := make(map[string]bool)
+	for name, files := range next {
+		prev := snap[name]
+		if len(prev) != len(files) {
+			changed[name] = true
+			continue
+		}
+		for fn, stamp := range files {
+			if p, ok := prev[fn]; !ok || p != stamp {
+				changed[name] = true
+				break
+			}
+		}
+	}
+	return changed
+}
+
+// watch runs the tasks in order, then polls their sources. When sources
+// change, any in-flight run is canceled, and once the sources stop changing
+// the changed tasks and the tasks that depend on them are run again.
+// Watch returns when ctx is canceled.
+func (r *Registry) watch(ctx context.Context, st *State, order []*Task) error {
+	interval := r.WatchInterval
+	if interval <= 0 {
+		interval = time.Second / 2
+	}
+	// Task runs change st.Dir, use a copy to resolve source paths.
+	dir := st.Dir
+	snap := snapshotSources(dir, order)
+	clock := st.clock()
+
+	var forced map[string]bool
+	for {
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func(forced map[string]bool) {
+			done <- Run(runCtx, st, r.runOrder(order, forced))
+		}(forced)
+		running := true
+
+		stop := func() {
+			cancel()
+			if running {
+				<-done
+				running = false
+			}
+		}
+		var changed map[string]bool
+		for len(changed) == 0 {
+			select {
+			case <-ctx.Done():
+				stop()
+				return nil
+			case err := <-done:
+				running = false
+				if err != nil {
+					st.Error(err)
+				}
+				st.Log("watching for changes")
+			case <-clock.After(interval):
+				next := snapshotSources(dir, order)
+				changed = snap.changed(next)
+				snap = next
+			}
+		}
+		stop()
+
+		// Wait for the sources to settle before running again.
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-clock.After(interval):
+			}
+			next := snapshotSources(dir, order)
+			more := snap.changed(next)
+			snap = next
+			if len(more) == 0 {
+				break
+			}
+			for name := range more {
+				changed[name] = true
+			}
+		}
+
+		// Dependents of changed tasks run again too. Order lists
+		// dependencies before the tasks that depend on them.
+		forced = make(map[string]bool)
+		for _, t := range order {
+			if changed[t.Name] {
+				forced[t.Name] = true
+				continue
+			}
+			for _, dep := range t.Deps {
+				if forced[dep] {
+					forced[t.Name] = true
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package task
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		fn := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fn), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fn, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("gen/a.in", "a")
+	write("src/main.go", "package main")
+
+	var mu sync.Mutex
+	var ran []string
+	r := &Registry{WatchInterval: time.Millisecond * 20}
+	add := func(name string, sources []string, output string, deps ...string) {
+		t := r.Register(name, ActionFunc(func(ctx context.Context, st *State, sc Script) error {
+			mu.Lock()
+			ran = append(ran, name)
+			mu.Unlock()
+			if len(output) > 0 {
+				write(output, name)
+			}
+			return nil
+		}))
+		t.Sources = sources
+		if len(output) > 0 {
+			t.Outputs = []string{output}
+		}
+		t.Deps = deps
+	}
+	add("gen", []string{"gen/*.in"}, "gen/out.txt")
+	add("build", []string{"src/**/*.go"}, "bin/out", "gen")
+	add("other", []string{"src/**/*.go"}, "")
+	add("dev", nil, "", "build")
+
+	get := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return strings.Join(ran, ",")
+	}
+	waitFor := func(want string) {
+		deadline := time.Now().Add(time.Second * 5)
+		for time.Now().Before(deadline) {
+			if get() == want {
+				return
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+		t.Fatalf("got runs %q, want %q", get(), want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		st := &State{Dir: dir, Stdout: &strings.Builder{}}
+		done <- Run(ctx, st, r.Command("r", "").Exec([]string{"-watch", "dev"}))
+	}()
+	waitFor("gen,build,dev")
+
+	// Changing a build source runs build and the dev task depending on it.
+	// The gen task is still up to date.
+	mu.Lock()
+	ran = nil
+	mu.Unlock()
+	write("src/main.go", "package main // changed")
+	waitFor("build,dev")
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}